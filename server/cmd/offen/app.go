@@ -4,12 +4,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -34,7 +37,9 @@ func newApp(populateMissing, quiet bool, envFileOverride string) *app {
 		}
 	}
 
+	config.EventRetention = cfg.App.Retention.Duration()
 	logger.SetLevel(cfg.App.LogLevel.LogLevel())
+	logger.SetFormatter(cfg.App.LogFormat.Formatter())
 	if !quiet && !cfg.SMTPConfigured() {
 		logger.Warn("SMTP for transactional email is not configured right now, mail delivery will be unreliable")
 		logger.Warn("Refer to the documentation to find out how to configure SMTP")
@@ -49,6 +54,17 @@ func newLogger() *logrus.Logger {
 	return logrus.New()
 }
 
+// newAccessLogger returns a logger for writing access logs to stdout
+// using the configured log format. Its level is fixed, as access logging is
+// turned on or off using the AccessLog setting only.
+func (a *app) newAccessLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(os.Stdout)
+	l.SetLevel(logrus.InfoLevel)
+	l.SetFormatter(a.config.App.LogFormat.Formatter())
+	return l
+}
+
 func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
 	var d gorm.Dialector
 	switch c.Database.Dialect.String() {
@@ -95,3 +111,25 @@ func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
 	}
 	return gormDB, nil
 }
+
+// Names of the locks that make sure jobs are run by a single instance only
+// when running multiple instances against the same database.
+const (
+	lockMigrate = "migrate"
+	lockExpire  = "expire"
+)
+
+// applyMigrations waits until no other instance is applying migrations and
+// applies all pending migrations afterwards.
+func applyMigrations(ctx context.Context, db persistence.Service) (err error) {
+	unlock, err := db.Lock(ctx, lockMigrate)
+	if err != nil {
+		return fmt.Errorf("error acquiring migration lock: %w", err)
+	}
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("error releasing migration lock: %w", unlockErr)
+		}
+	}()
+	return db.Migrate(ctx)
+}
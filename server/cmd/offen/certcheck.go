@@ -0,0 +1,75 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/router"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certificateReadinessCheck reports on whether valid certificates for all
+// of the given hosts have been obtained using AutoTLS. As certificates are
+// only requested on the first TLS handshake for a host, it is optional
+// so that a missing certificate does not prevent traffic from being routed
+// to the instance. It is internal as it reads from the certificate cache on
+// each request.
+func certificateReadinessCheck(cache autocert.Cache, hosts []string) router.ReadinessCheck {
+	return router.ReadinessCheck{
+		Name:     "certificates",
+		Optional: true,
+		Internal: true,
+		Check: func(ctx context.Context) error {
+			for _, host := range hosts {
+				if err := checkCachedCertificate(ctx, cache, host); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func checkCachedCertificate(ctx context.Context, cache autocert.Cache, host string) error {
+	var data []byte
+	// autocert stores RSA certificates using a suffixed key
+	for _, key := range []string{host, host + "+rsa"} {
+		var err error
+		data, err = cache.Get(ctx, key)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, autocert.ErrCacheMiss) {
+			return fmt.Errorf("certcheck: error reading certificate for %s from cache: %w", host, err)
+		}
+	}
+	if data == nil {
+		return fmt.Errorf("certcheck: no certificate for %s has been obtained yet", host)
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return fmt.Errorf("certcheck: no certificate for %s found in cached data", host)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("certcheck: error parsing certificate for %s: %w", host, err)
+		}
+		if now := time.Now(); now.After(leaf.NotAfter) || now.Before(leaf.NotBefore) {
+			return fmt.Errorf("certcheck: certificate for %s is only valid between %s and %s", host, leaf.NotBefore, leaf.NotAfter)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func mustCertificate(t *testing.T, host string, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	// autocert stores the private key in front of the certificate chain
+	return append(
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...,
+	)
+}
+
+func TestCertificateReadinessCheck(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		cached      map[string][]byte
+		expectError bool
+	}{
+		{
+			"no certificates",
+			map[string][]byte{},
+			true,
+		},
+		{
+			"valid certificates",
+			map[string][]byte{
+				"offen.example.com":     mustCertificate(t, "offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+				"www.offen.example.com": mustCertificate(t, "www.offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+			},
+			false,
+		},
+		{
+			"rsa certificates",
+			map[string][]byte{
+				"offen.example.com+rsa":     mustCertificate(t, "offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+				"www.offen.example.com+rsa": mustCertificate(t, "www.offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+			},
+			false,
+		},
+		{
+			"missing host",
+			map[string][]byte{
+				"offen.example.com": mustCertificate(t, "offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+			},
+			true,
+		},
+		{
+			"expired certificate",
+			map[string][]byte{
+				"offen.example.com":     mustCertificate(t, "offen.example.com", now.Add(-time.Hour*2), now.Add(-time.Hour)),
+				"www.offen.example.com": mustCertificate(t, "www.offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+			},
+			true,
+		},
+		{
+			"not yet valid",
+			map[string][]byte{
+				"offen.example.com":     mustCertificate(t, "offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+				"www.offen.example.com": mustCertificate(t, "www.offen.example.com", now.Add(time.Hour), now.Add(time.Hour*2)),
+			},
+			true,
+		},
+		{
+			"bad data",
+			map[string][]byte{
+				"offen.example.com":     mustCertificate(t, "offen.example.com", now.Add(-time.Hour), now.Add(time.Hour)),
+				"www.offen.example.com": []byte("not a certificate"),
+			},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := autocert.DirCache(t.TempDir())
+			for key, data := range test.cached {
+				if err := cache.Put(context.Background(), key, data); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+			}
+			check := certificateReadinessCheck(cache, []string{"offen.example.com", "www.offen.example.com"})
+			if !check.Optional || !check.Internal {
+				t.Errorf("Expected check to be optional and internal, got %v", check)
+			}
+			if err := check.Check(context.Background()); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
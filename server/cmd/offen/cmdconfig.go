@@ -0,0 +1,366 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/locales"
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/persistence/relational"
+)
+
+var configUsage = `
+"config" can be used to validate the runtime configuration. The following
+subcommands are available:
+
+- "check" validates the configuration and checks whether all configured
+  services can be reached. It exits with a nonzero status in case any of the
+  checks fails. Note that checking whether ports can be bound fails when
+  the checked instance is already running.
+
+Usage of "config check":
+`
+
+const (
+	checkStatusOK      = "ok"
+	checkStatusWarning = "warning"
+	checkStatusError   = "error"
+	checkStatusSkipped = "skipped"
+)
+
+// certificateExpiryWarning is the remaining validity of a TLS certificate
+// below which a warning is issued.
+const certificateExpiryWarning = time.Hour * 24 * 14
+
+type checkResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type checkReport struct {
+	OK     bool                   `json:"ok"`
+	Checks []checkResult          `json:"checks"`
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+func (r *checkReport) add(name, status, message string, args ...interface{}) {
+	r.Checks = append(r.Checks, checkResult{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(message, args...),
+	})
+	if status == checkStatusError {
+		r.OK = false
+	}
+}
+
+func (r *checkReport) write(w io.Writer, format string) error {
+	if format == "json" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+	for _, check := range r.Checks {
+		if _, err := fmt.Fprintf(w, "%-8s %-12s %s\n", check.Status, check.Name, check.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdConfig(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), configUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file or YAML config file to use")
+		format  = cmd.String("format", "json", "the output format to use (json or text)")
+		timeout = cmd.Duration("timeout", time.Second*15, "the timeout used for checking connectivity")
+	)
+	if len(flags) == 0 || flags[0] != "check" {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	cmd.Parse(flags[1:])
+	if *format != "json" && *format != "text" {
+		fmt.Fprintf(flag.CommandLine.Output(), "Error: unknown format %s\n", *format)
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	report := runChecks(ctx, *envFile)
+	cancel()
+
+	if err := report.write(os.Stdout, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
+
+func runChecks(ctx context.Context, envFile string) *checkReport {
+	report := &checkReport{OK: true}
+
+	cfg, err := config.New(false, envFile)
+	if err != nil {
+		report.add("config", checkStatusError, "%v", err)
+		return report
+	}
+	report.add("config", checkStatusOK, "configuration is valid")
+	report.Config = redactedConfig(cfg)
+
+	if cfg.Sources()["OFFEN_SECRET"] == config.SourceDefault {
+		report.add("secret", checkStatusWarning, "no secret is configured, a random value will be used and sessions will not persist across restarts")
+	} else {
+		report.add("secret", checkStatusOK, "secret is configured")
+	}
+
+	checkDatabase(ctx, cfg, report)
+	checkMailer(ctx, cfg, report)
+	checkTLS(cfg, report)
+	checkPorts(cfg, report)
+	checkLocale(cfg, report)
+	return report
+}
+
+// redactedConfig returns the configuration with all secret values removed
+// so it can safely be included in reports.
+func redactedConfig(cfg *config.Config) map[string]interface{} {
+	result, err := cfg.Redacted()
+	if err != nil {
+		return nil
+	}
+	// the connection string of a SQLite database is a file path that is
+	// useful when checking the configuration
+	if db, ok := result["Database"].(map[string]interface{}); ok && cfg.Database.Dialect.String() == "sqlite3" {
+		db["ConnectionString"] = cfg.Database.ConnectionString.String()
+	}
+	return result
+}
+
+func checkDatabase(ctx context.Context, cfg *config.Config, report *checkReport) {
+	dsn := cfg.Database.ConnectionString.String()
+	switch cfg.Database.Dialect.String() {
+	case "sqlite3":
+		if _, err := os.Stat(dsn); errors.Is(err, os.ErrNotExist) {
+			// opening the database would create the file, which is not
+			// expected to happen when checking the configuration
+			if _, err := os.Stat(filepath.Dir(dsn)); err != nil {
+				report.add("database", checkStatusError, "directory for database file %s does not exist", dsn)
+				return
+			}
+			report.add("database", checkStatusWarning, "database file %s does not exist yet and will be created on startup", dsn)
+			return
+		}
+	case "postgres":
+		if _, err := pgconn.ParseConfig(dsn); err != nil {
+			report.add("database", checkStatusError, "error parsing connection string: %v", err)
+			return
+		}
+	case "mysql":
+		if _, err := mysqldriver.ParseDSN(dsn); err != nil {
+			report.add("database", checkStatusError, "error parsing connection string: %v", err)
+			return
+		}
+	}
+
+	dbConfig := *cfg
+	dbConfig.Database.ConnectionRetries = 0
+	gormDB, err := newDB(&dbConfig, nil)
+	if err != nil {
+		report.add("database", checkStatusError, "%v", err)
+		return
+	}
+	if sqlDB, err := gormDB.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	dal := relational.NewRelationalDAL(gormDB)
+	if err := dal.Ping(ctx); err != nil {
+		report.add("database", checkStatusError, "error connecting to database: %v", err)
+		return
+	}
+	report.add("database", checkStatusOK, "connected to %s database", cfg.Database.Dialect.String())
+
+	pending, err := dal.PendingMigrations(ctx)
+	switch {
+	case err != nil:
+		report.add("migrations", checkStatusError, "error looking up migration status: %v", err)
+	case len(pending) == 0:
+		report.add("migrations", checkStatusOK, "all migrations are applied")
+	default:
+		// "offen serve" applies pending migrations on startup, using a lock
+		// so only one of multiple instances applies them
+		report.add("migrations", checkStatusWarning, "%d pending migrations will be applied on startup: %s", len(pending), strings.Join(pending, ", "))
+	}
+}
+
+func checkMailer(ctx context.Context, cfg *config.Config, report *checkReport) {
+	switch {
+	case cfg.App.Development:
+		report.add("smtp", checkStatusSkipped, "mail is not delivered in development")
+		return
+	case !cfg.SMTPConfigured():
+		report.add("smtp", checkStatusWarning, "SMTP is not configured, falling back to sendmail")
+		return
+	}
+
+	m, err := cfg.NewMailer()
+	if err != nil {
+		report.add("smtp", checkStatusError, "error creating mailer: %v", err)
+		return
+	}
+	if closer, ok := m.(io.Closer); ok {
+		defer closer.Close()
+	}
+	pinger, ok := m.(mailer.Pinger)
+	if !ok {
+		report.add("smtp", checkStatusSkipped, "mailer does not support checking connectivity")
+		return
+	}
+	if err := pinger.Ping(ctx); err != nil {
+		report.add("smtp", checkStatusError, "%v", err)
+		return
+	}
+	report.add("smtp", checkStatusOK, "connected to %s:%d", cfg.SMTP.Host, cfg.SMTP.Port)
+}
+
+func checkTLS(cfg *config.Config, report *checkReport) {
+	cert, key := cfg.Server.SSLCertificate.String(), cfg.Server.SSLKey.String()
+	switch {
+	case cert != "" && key != "":
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			report.add("tls", checkStatusError, "error loading certificate and key: %v", err)
+			return
+		}
+		leaf, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			report.add("tls", checkStatusError, "error parsing certificate: %v", err)
+			return
+		}
+		switch remaining := time.Until(leaf.NotAfter); {
+		case remaining <= 0:
+			report.add("tls", checkStatusError, "certificate has expired on %s", leaf.NotAfter.Format(time.RFC3339))
+		case remaining < certificateExpiryWarning:
+			report.add("tls", checkStatusWarning, "certificate expires on %s", leaf.NotAfter.Format(time.RFC3339))
+		default:
+			report.add("tls", checkStatusOK, "certificate and key match, certificate is valid until %s", leaf.NotAfter.Format(time.RFC3339))
+		}
+	case cert != "" || key != "":
+		report.add("tls", checkStatusError, "both a certificate and a key need to be configured")
+	}
+
+	if ca := cfg.Server.SSLClientCA.String(); ca != "" {
+		if _, err := loadClientCAs(ca); err != nil {
+			report.add("tls", checkStatusError, "%v", err)
+		} else {
+			report.add("tls", checkStatusOK, "client certificate authorities in %s are valid", ca)
+		}
+	}
+
+	if len(cfg.Server.AutoTLS) != 0 {
+		dir := cfg.Server.CertificateCache.String()
+		// the cache directory is created on startup in case it does not exist,
+		// which requires its closest existing parent to be writable
+		existing := dir
+		for {
+			if _, err := os.Stat(existing); err == nil || filepath.Dir(existing) == existing {
+				break
+			}
+			existing = filepath.Dir(existing)
+		}
+		f, err := os.CreateTemp(existing, ".offen-check-")
+		if err != nil {
+			report.add("autotls", checkStatusError, "certificate cache %s is not writable: %v", dir, err)
+			return
+		}
+		f.Close()
+		os.Remove(f.Name())
+		report.add("autotls", checkStatusOK, "certificate cache %s is writable", dir)
+	}
+}
+
+func checkPorts(cfg *config.Config, report *checkReport) {
+	addrs := append(config.ListenAddresses{}, cfg.ListenAddresses()...)
+	if redirect := cfg.RedirectAddress(); !redirect.IsZero() {
+		addrs = append(addrs, redirect)
+	}
+	if !cfg.Server.InternalListen.IsZero() {
+		addrs = append(addrs, cfg.Server.InternalListen)
+	} else if cfg.Server.Metrics && cfg.Server.MetricsPort != 0 {
+		addrs = append(addrs, config.ListenAddress{Network: "tcp", Address: fmt.Sprintf("0.0.0.0:%d", cfg.Server.MetricsPort)})
+	}
+	for _, addr := range addrs {
+		ln, err := net.Listen(addr.Network, addr.Address)
+		if err != nil {
+			report.add("listen", checkStatusError, "unable to bind %s: %v", addr, err)
+			continue
+		}
+		ln.Close()
+		report.add("listen", checkStatusOK, "%s can be bound", addr)
+	}
+}
+
+// retentionRanges lists the ranges the Auditorium offers for each of the
+// retention presets.
+var retentionRanges = map[string][]string{
+	"6months": {"7 days", "30 days", "6 weeks", "12 weeks", "6 months"},
+	"12weeks": {"7 days", "30 days", "6 weeks", "12 weeks"},
+	"6weeks":  {"7 days", "30 days", "6 weeks"},
+	"30days":  {"7 days", "30 days"},
+	"7days":   {"7 days"},
+}
+
+func checkLocale(cfg *config.Config, report *checkReport) {
+	locale, retention, preset := cfg.App.Locale.String(), cfg.App.Retention.String(), cfg.App.Retention.Preset()
+	gettext, err := locales.GettextFor(locale)
+	if err != nil {
+		report.add("locale", checkStatusError, "%v", err)
+		return
+	}
+	ranges := retentionRanges[preset]
+	if locale != "en" {
+		var missing []string
+		for _, r := range ranges {
+			if string(gettext(r)) == r {
+				missing = append(missing, r)
+			}
+		}
+		if len(missing) != 0 {
+			report.add("locale", checkStatusWarning, "locale %s is missing translations for ranges offered for a retention period of %s: %s", locale, retention, strings.Join(missing, ", "))
+			return
+		}
+	}
+	if retention != preset {
+		report.add("locale", checkStatusWarning, "the Auditorium does not offer a range matching a retention period of %s, the longest range offered will be %s", retention, ranges[len(ranges)-1])
+		return
+	}
+	report.add("locale", checkStatusOK, "locale %s supports a retention period of %s", locale, retention)
+}
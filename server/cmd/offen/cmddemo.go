@@ -27,6 +27,7 @@ import (
 	"github.com/offen/offen/server/persistence/relational"
 	"github.com/offen/offen/server/public"
 	"github.com/offen/offen/server/router"
+	"github.com/offen/offen/server/stream"
 	"github.com/phayes/freeport"
 	"github.com/schollz/progressbar/v3"
 )
@@ -87,17 +88,19 @@ func cmdDemo(subcommand string, flags []string) {
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to establish database connection")
 	}
+	broadcaster := stream.NewBroadcaster(0)
 	db, err := persistence.New(
 		relational.NewRelationalDAL(gormDB),
+		persistence.WithPublisher(broadcaster),
 	)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to create persistence layer")
 	}
 
-	if err := db.Migrate(); err != nil {
+	if err := db.Migrate(context.Background()); err != nil {
 		a.logger.WithError(err).Fatal("Error applying initial database migrations")
 	}
-	if err := db.Bootstrap(persistence.BootstrapConfig{
+	if err := db.Bootstrap(context.Background(), persistence.BootstrapConfig{
 		Accounts: []persistence.BootstrapAccount{
 			{AccountID: accountID.String(), Name: "Demo Account"},
 		},
@@ -116,7 +119,7 @@ func cmdDemo(subcommand string, flags []string) {
 
 	a.logger.Info("Offen is generating some random usage data for your demo, this might take a little while.")
 	rand.Seed(time.Now().UnixNano())
-	account, _ := db.GetAccount(accountID.String(), false, false, "")
+	account, _ := db.GetAccount(context.Background(), accountID.String(), false, false, "")
 
 	users := *numUsers
 	if users == -1 {
@@ -142,7 +145,7 @@ func cmdDemo(subcommand string, flags []string) {
 				done <- err
 				return
 			}
-			if err := db.AssociateUserSecret(
+			if err := db.AssociateUserSecret(context.Background(),
 				accountID.String(), userID, encryptedSecret.Marshal(),
 			); err != nil {
 				done <- err
@@ -163,7 +166,7 @@ func cmdDemo(subcommand string, flags []string) {
 						done <- err
 					}
 					eventID, _ := persistence.EventIDAt(evt.Timestamp)
-					if err := db.Insert(
+					if err := db.Insert(context.Background(),
 						userID,
 						accountID.String(),
 						event.Marshal(),
@@ -214,13 +217,16 @@ func cmdDemo(subcommand string, flags []string) {
 		Handler: router.New(
 			router.WithDatabase(db),
 			router.WithLogger(a.logger),
+			router.WithAccessLogger(a.newAccessLogger()),
 			router.WithTemplate(tpl),
 			router.WithEmails(emails),
 			router.WithConfig(a.config),
 			router.WithFS(fs),
 			router.WithMailer(mailer),
+			router.WithBroadcaster(broadcaster),
 		),
 	}
+	srv.RegisterOnShutdown(broadcaster.Close)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			a.logger.WithError(err).Fatal("Error binding server to network")
@@ -233,7 +239,7 @@ func cmdDemo(subcommand string, flags []string) {
 	a.logger.Infof("in your browser. Please make sure to use the `localhost`")
 	a.logger.Infof("hostname so a secure context is available.")
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
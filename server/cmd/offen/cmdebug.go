@@ -11,7 +11,7 @@ import (
 
 var debugUsage = `
 "debug" prints the runtime configuration resolved from the current working
-directory.
+directory and where each of the values has been sourced from.
 
 Usage of "debug":
 `
@@ -23,7 +23,7 @@ func cmdDebug(subcommand string, flags []string) {
 		cmd.PrintDefaults()
 	}
 	var (
-		envFile = cmd.String("envfile", "", "the env file to use")
+		envFile = cmd.String("envfile", "", "the env file or YAML config file to use")
 	)
 	cmd.Parse(flags)
 	a := newApp(false, true, *envFile)
@@ -33,4 +33,11 @@ func cmdDebug(subcommand string, flags []string) {
 	}
 	a.logger.Info("Current configuration values")
 	fmt.Fprintln(a.logger.Out, string(pretty))
+
+	sources, err := json.MarshalIndent(a.config.Sources(), "", "  ")
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error pretty printing config sources")
+	}
+	a.logger.Info("Sources of configuration values")
+	fmt.Fprintln(a.logger.Out, string(sources))
 }
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 
@@ -14,8 +15,9 @@ import (
 
 var expireUsage = `
 "expire" prunes all events older than 6 months (4464 hours) from the connected
-database. Only run this command when you run Offen as a horizontally scaling
-service as the default installation will handle this routine by itself.
+database. Running this command is not required as "serve" prunes expired
+events periodically. In case another instance is currently pruning events, the
+command waits for it to finish.
 
 Usage of "expire":
 `
@@ -27,7 +29,7 @@ func cmdExpire(subcommand string, flags []string) {
 		cmd.PrintDefaults()
 	}
 	var (
-		envFile = cmd.String("envfile", "", "the env file to use")
+		envFile = cmd.String("envfile", "", "the env file or YAML config file to use")
 	)
 	cmd.Parse(flags)
 	a := newApp(false, true, *envFile)
@@ -44,7 +46,14 @@ func cmdExpire(subcommand string, flags []string) {
 		a.logger.WithError(err).Fatalf("Error setting up database")
 	}
 
-	affected, err := db.Expire(config.EventRetention)
+	unlock, err := db.Lock(context.Background(), lockExpire)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error acquiring expiry lock")
+	}
+	affected, err := db.Expire(context.Background(), config.EventRetention)
+	if unlockErr := unlock(); unlockErr != nil {
+		a.logger.WithError(unlockErr).Error("Error releasing expiry lock")
+	}
 	if err != nil {
 		a.logger.WithError(err).Fatalf("Error pruning expired events")
 	}
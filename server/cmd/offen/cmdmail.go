@@ -0,0 +1,78 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/offen/offen/server/mailer"
+)
+
+var mailUsage = `
+"mail" can be used to check the configuration used for sending transactional
+email. The following subcommands are available:
+
+- "test" sends a probe message to the address given to -to and reports the
+  parameters that have been negotiated with the SMTP server
+
+Usage of "mail test":
+`
+
+func cmdMail(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), mailUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file or YAML config file to use")
+		to      = cmd.String("to", "", "the address to send the probe message to")
+	)
+	if len(flags) == 0 || flags[0] != "test" {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	cmd.Parse(flags[1:])
+	if *to == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), "Error: -to is required")
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	a := newApp(false, true, *envFile)
+	m, err := a.config.NewMailer()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Failed to initialize mailer")
+	}
+	if closer, ok := m.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	subject := "Offen Fair Web Analytics test message"
+	body := "This message has been sent using the \"offen mail test\" command. If you can read this, your email configuration is working."
+
+	prober, ok := m.(mailer.Prober)
+	if !ok {
+		if err := m.Send(a.config.SMTP.Sender, *to, subject, body); err != nil {
+			a.logger.WithError(err).Fatal("Error sending test message")
+		}
+		a.logger.Info("Successfully handed test message to mailer, no details about the delivery are available as SMTP is not configured")
+		return
+	}
+
+	result, err := prober.Probe(a.config.SMTP.Sender, *to, subject, body)
+	pretty, prettyErr := json.MarshalIndent(result, "", "  ")
+	if prettyErr != nil {
+		a.logger.WithError(prettyErr).Fatal("Error pretty printing probe result")
+	}
+	fmt.Fprintln(a.logger.Out, string(pretty))
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error sending test message")
+	}
+	a.logger.WithField("to", *to).Info("Successfully sent test message")
+}
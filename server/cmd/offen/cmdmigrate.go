@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 
@@ -13,8 +14,9 @@ import (
 
 var migrateUsage = `
 "migrate" applies all pending database migrations to the connected database.
-Only run this command when you run Offen as a horizontally scaling service as
-the default installation will handle this routine by itself.
+Running this command is not required as "serve" applies pending migrations on
+startup. In case another instance is currently applying migrations, the command
+waits for it to finish.
 
 Usage of "migrate":
 `
@@ -27,7 +29,7 @@ func cmdMigrate(subcommand string, flags []string) {
 		cmd.PrintDefaults()
 	}
 	var (
-		envFile = cmd.String("envfile", "", "the env file to use")
+		envFile = cmd.String("envfile", "", "the env file or YAML config file to use")
 	)
 	cmd.Parse(flags)
 	a := newApp(false, true, *envFile)
@@ -44,7 +46,7 @@ func cmdMigrate(subcommand string, flags []string) {
 		a.logger.WithError(err).Fatal("Error creating persistence layer")
 	}
 
-	if err := db.Migrate(); err != nil {
+	if err := applyMigrations(context.Background(), db); err != nil {
 		a.logger.WithError(err).Fatal("Error applying database migrations")
 	}
 	a.logger.Info("Successfully ran database migrations")
@@ -5,8 +5,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,10 +17,15 @@ import (
 
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/locales"
+	"github.com/offen/offen/server/metrics"
 	"github.com/offen/offen/server/persistence"
 	"github.com/offen/offen/server/persistence/relational"
 	"github.com/offen/offen/server/public"
+	"github.com/offen/offen/server/ratelimiter"
 	"github.com/offen/offen/server/router"
+	"github.com/offen/offen/server/scheduler"
+	"github.com/offen/offen/server/stream"
+	"github.com/offen/offen/server/tracing"
 	"golang.org/x/crypto/acme/autocert"
 )
 
@@ -50,29 +57,45 @@ func cmdServe(subcommand string, flags []string) {
 		cmd.PrintDefaults()
 	}
 	var (
-		envFile = cmd.String("envfile", "", "the env file to use")
+		envFile = cmd.String("envfile", "", "the env file or YAML config file to use")
 	)
 	cmd.Parse(flags)
 	a := newApp(false, false, *envFile)
 
+	shutdownTracing := func(context.Context) error { return nil }
+	if exporter := a.config.Tracing.Exporter.String(); exporter != "" {
+		shutdown, err := tracing.Setup(exporter, a.config.Tracing.SampleRatio, config.Revision)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to set up tracing")
+		}
+		shutdownTracing = shutdown
+		a.logger.Infof("Exporting traces using %s", exporter)
+	}
+
 	gormDB, err := newDB(a.config, a.logger)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to establish database connection")
 	}
 
-	db, err := persistence.New(
-		relational.NewRelationalDAL(gormDB),
-	)
+	dal := relational.NewRelationalDAL(gormDB)
+	broadcaster := stream.NewBroadcaster(0)
+	var persistenceConfigs []persistence.Config
+	if a.config.App.SingleNode {
+		// changes can only be made by this instance, so they are published
+		// directly instead of querying the database for changes
+		persistenceConfigs = append(persistenceConfigs, persistence.WithPublisher(broadcaster))
+	}
+	db, err := persistence.New(dal, persistenceConfigs...)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to create persistence layer")
 	}
 
-	if a.config.App.SingleNode {
-		if err := db.Migrate(); err != nil {
-			a.logger.WithError(err).Fatal("Error applying database migrations")
-		} else {
-			a.logger.Info("Successfully applied database migrations")
-		}
+	// when running multiple instances, the first one to acquire the lock
+	// applies migrations while all others wait for it to finish
+	if err := applyMigrations(context.Background(), db); err != nil {
+		a.logger.WithError(err).Fatal("Error applying database migrations")
+	} else {
+		a.logger.Info("Successfully applied database migrations")
 	}
 
 	fs := public.NewLocalizedFS(a.config.App.Locale.String())
@@ -94,76 +117,233 @@ func cmdServe(subcommand string, flags []string) {
 		a.logger.WithError(err).Fatal("Failed to initialize mailer")
 	}
 
-	srv := &http.Server{
-		Addr: fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
-		Handler: router.New(
-			router.WithDatabase(db),
-			router.WithLogger(a.logger),
-			router.WithTemplate(tpl),
-			router.WithEmails(emails),
-			router.WithConfig(a.config),
-			router.WithFS(fs),
-			router.WithMailer(mailer),
-		),
+	var m *metrics.Metrics
+	if a.config.Server.Metrics {
+		m = metrics.New()
+		sqlDB, err := gormDB.DB()
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to access underlying database connection")
+		}
+		if err := m.RegisterDB(sqlDB); err != nil {
+			a.logger.WithError(err).Fatal("Unable to collect database metrics")
+		}
 	}
-	go func() {
-		if a.config.Server.SSLCertificate != "" && a.config.Server.SSLKey != "" {
-			err := srv.ListenAndServeTLS(a.config.Server.SSLCertificate.String(), a.config.Server.SSLKey.String())
-			if err != nil && err != http.ErrServerClosed {
-				a.logger.WithError(err).Fatal("Error binding server to network")
-			}
-		} else if len(a.config.Server.AutoTLS) != 0 {
-			m := autocert.Manager{
-				Prompt:     autocert.AcceptTOS,
-				HostPolicy: autocert.HostWhitelist(a.config.Server.AutoTLS...),
-				Cache:      autocert.DirCache(a.config.Server.CertificateCache),
-				Email:      a.config.Server.LetsEncryptEmail,
-			}
-			go http.ListenAndServe(":http", m.HTTPHandler(nil))
-			if err := http.Serve(m.Listener(), srv.Handler); err != nil && err != http.ErrServerClosed {
-				a.logger.WithError(err).Fatal("Error binding server to network")
-			}
-		} else {
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				a.logger.WithError(err).Fatal("Error binding server to network")
-			}
+
+	var rateLimitStore ratelimiter.Store
+	if a.config.Server.RateLimitStore.Shared() {
+		rateLimitStore = persistence.NewRateLimitStore(dal)
+		a.logger.Info("Storing rate limits in the database")
+	}
+
+	var certificates *certificateLoader
+	if a.config.Server.SSLCertificate != "" && a.config.Server.SSLKey != "" {
+		certificates, err = newCertificateLoader(a.config.Server.SSLCertificate.String(), a.config.Server.SSLKey.String())
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to load TLS certificate")
 		}
-	}()
+	}
+
+	reload := newReloader(a, *envFile, mailer, certificates)
+
+	var readinessChecks []router.ReadinessCheck
+	certificateCache := autocert.DirCache(a.config.Server.CertificateCache)
 	if len(a.config.Server.AutoTLS) != 0 {
-		a.logger.Info("Server now listening on port 80 and 443 using AutoTLS")
-	} else {
-		a.logger.Infof("Server now listening on port %d", a.config.Server.Port)
+		readinessChecks = append(
+			readinessChecks,
+			certificateReadinessCheck(certificateCache, a.config.Server.AutoTLS),
+		)
 	}
 
-	if a.config.App.SingleNode {
-		hourlyJob := time.Tick(time.Hour)
-		runOnInit := make(chan bool)
-		go func() {
-			for {
-				select {
-				case <-hourlyJob:
-				case <-runOnInit:
-				}
-				affected, err := db.Expire(config.EventRetention)
-				if err != nil {
-					a.logger.WithError(err).Errorf("Error pruning expired events")
-					return
-				}
-				a.logger.WithField("removed", affected).Info("Cron successfully pruned expired events")
+	routerConfigs := []router.Config{
+		router.WithDatabase(db),
+		router.WithLogger(a.logger),
+		router.WithAccessLogger(a.newAccessLogger()),
+		router.WithTemplate(tpl),
+		router.WithEmails(emails),
+		router.WithConfig(a.config),
+		router.WithFS(fs),
+		router.WithMailer(mailer),
+		router.WithMetrics(m),
+		router.WithReadinessChecks(readinessChecks...),
+		router.WithRateLimitStore(rateLimitStore),
+		router.WithBroadcaster(broadcaster),
+		router.WithReloader(reload.router),
+	}
+	srv := &http.Server{
+		Handler: router.New(routerConfigs...),
+	}
+	// live updates are long running requests that would otherwise block
+	// shutting down the server
+	srv.RegisterOnShutdown(broadcaster.Close)
+
+	var manager *autocert.Manager
+	if certificates != nil {
+		// certificates are passed using GetCertificate so they can be
+		// replaced when reloading the configuration
+		srv.TLSConfig = &tls.Config{GetCertificate: certificates.GetCertificate}
+	} else if len(a.config.Server.AutoTLS) != 0 {
+		manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(a.config.Server.AutoTLS...),
+			Cache:      certificateCache,
+			Email:      a.config.Server.LetsEncryptEmail,
+		}
+		srv.TLSConfig = manager.TLSConfig()
+	}
+	if srv.TLSConfig != nil && a.config.Server.SSLClientCA != "" {
+		clientCAs, err := loadClientCAs(a.config.Server.SSLClientCA.String())
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to load client certificate authorities")
+		}
+		// all clients are asked for a certificate, but it is only required
+		// for the routes used by operators
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		srv.TLSConfig.ClientCAs = clientCAs
+	}
+
+	var listeners []net.Listener
+	var httpsPort string
+	for _, addr := range a.config.ListenAddresses() {
+		ln, err := a.listen(addr)
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error binding server to %s", addr)
+		}
+		listeners = append(listeners, ln)
+		if httpsPort == "" {
+			httpsPort = addr.Port()
+		}
+	}
+	a.serve(srv, srv.TLSConfig != nil, listeners...)
+	a.logger.WithField("tls", srv.TLSConfig != nil).Infof("Server now listening on %s", a.config.ListenAddresses())
+
+	// servers that are shut down in addition to the main server
+	var auxiliary []*http.Server
+	if addr := a.config.RedirectAddress(); !addr.IsZero() {
+		handler := router.NewRedirect(httpsPort)
+		if manager != nil {
+			// challenges are answered on the HTTP port, so only other
+			// requests are redirected
+			handler = manager.HTTPHandler(handler)
+		}
+		redirectSrv := &http.Server{Handler: handler}
+		ln, err := a.listen(addr)
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error binding redirect server to %s", addr)
+		}
+		a.serve(redirectSrv, false, ln)
+		auxiliary = append(auxiliary, redirectSrv)
+		a.logger.Infof("Redirecting requests on %s to HTTPS", addr)
+	}
+
+	if addr := a.config.Server.InternalListen; !addr.IsZero() {
+		internalSrv := &http.Server{Handler: router.NewInternal(routerConfigs...)}
+		ln, err := listenAddress(addr)
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error binding internal server to %s", addr)
+		}
+		a.serve(internalSrv, false, ln)
+		auxiliary = append(auxiliary, internalSrv)
+		a.logger.Infof("Serving health checks and metrics on %s", addr)
+	} else if a.config.Server.Metrics && a.config.Server.MetricsPort != 0 {
+		metricsSrv := &http.Server{Handler: m.Handler()}
+		ln, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", a.config.Server.MetricsPort))
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error binding metrics server to network")
+		}
+		a.serve(metricsSrv, false, ln)
+		auxiliary = append(auxiliary, metricsSrv)
+		a.logger.Infof("Serving metrics on port %d", a.config.Server.MetricsPort)
+	}
+
+	pollCtx, cancelPoll := context.WithCancel(context.Background())
+	defer cancelPoll()
+	if !a.config.App.SingleNode {
+		poller := stream.NewPoller(db, broadcaster, a.config.App.StreamPollInterval)
+		go poller.Run(pollCtx, func(err error) {
+			a.logger.WithError(err).Error("Error polling for live updates")
+		})
+	}
+
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	if certificates != nil && a.config.Server.SSLReloadInterval > 0 {
+		// certificates that are rotated in place are picked up without
+		// having to reload the configuration
+		go certificates.watch(jobCtx, a.config.Server.SSLReloadInterval, func(err error) {
+			if err != nil {
+				a.logger.WithError(err).Error("Error reloading rotated TLS certificate, keeping current certificate")
+				return
 			}
-		}()
-		runOnInit <- true
+			a.logger.Info("Reloaded rotated TLS certificate")
+		})
 	}
 
-	quit := make(chan os.Signal)
+	// each instance schedules expiry, but only the instance holding the lock
+	// runs it, so events are expired once per interval
+	expiry := scheduler.New(a.config.App.ExpireInterval, a.config.App.ExpireJitter)
+	go expiry.Run(jobCtx, scheduler.Leader(schedulerLocker{db}, lockExpire, func(ctx context.Context) error {
+		start := time.Now()
+		affected, err := db.Expire(ctx, reload.retentionPeriod())
+		m.ObserveExpire(affected, time.Since(start), err)
+		if err != nil {
+			return err
+		}
+		a.logger.
+			WithField("removed", affected).
+			WithField("duration", time.Since(start).Round(time.Millisecond)).
+			Info("Cron successfully pruned expired events")
+		return nil
+	}), func(err error, retry time.Duration) {
+		a.logger.
+			WithError(err).
+			WithField("retry", retry.Round(time.Second)).
+			Error("Error pruning expired events, scheduling retry")
+	})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			a.logger.Info("Received SIGHUP, reloading configuration")
+			if err := reload.reload(); err != nil {
+				a.logger.WithError(err).Error("Error reloading configuration, keeping current configuration")
+			}
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	signal.Stop(hup)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		a.logger.WithError(err).Fatal("Error shutting down server")
 	}
+	for _, aux := range auxiliary {
+		if err := aux.Shutdown(ctx); err != nil {
+			a.logger.WithError(err).Error("Error shutting down server")
+		}
+	}
+
+	if err := reload.close(); err != nil {
+		a.logger.WithError(err).Error("Error closing mailer")
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		a.logger.WithError(err).Error("Error flushing pending traces")
+	}
 
 	a.logger.Info("Gracefully shut down server")
 }
+
+// schedulerLocker adapts the locks of the persistence layer for use in
+// package scheduler.
+type schedulerLocker struct {
+	db persistence.Service
+}
+
+func (s schedulerLocker) TryLock(ctx context.Context, name string) (scheduler.Lock, bool, error) {
+	return s.db.TryLock(ctx, name)
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"html"
@@ -48,7 +49,7 @@ func cmdSetup(subcommand string, flags []string) {
 		accountName     = cmd.String("name", "", "the account name")
 		email           = cmd.String("email", "", "the email address used for login")
 		password        = cmd.String("password", "", "the password used for login (must be at least 8 characters long)")
-		envFile         = cmd.String("envfile", "", "the env file to use")
+		envFile         = cmd.String("envfile", "", "the env file or YAML config file to use")
 		populateMissing = cmd.Bool("populate", false, "in case required secrets are missing from the configuration, create and persist them in the target env file")
 		force           = cmd.Bool("force", false, "allow setup to delete existing data")
 		source          = cmd.String("source", "", "a configuration file (this is an experimental feature - do not use it if you are not sure)")
@@ -144,11 +145,11 @@ func cmdSetup(subcommand string, flags []string) {
 		a.logger.WithError(dbErr).Fatal("Error creating persistence layer")
 	}
 
-	if err := db.Migrate(); err != nil {
+	if err := db.Migrate(context.Background()); err != nil {
 		a.logger.WithError(err).Fatal("Error applying database migrations")
 	}
 
-	if err := db.Bootstrap(conf); err != nil {
+	if err := db.Bootstrap(context.Background(), conf); err != nil {
 		a.logger.WithError(err).Fatal("Error bootstrapping database")
 	}
 	if *source == "" {
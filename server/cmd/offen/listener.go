@@ -0,0 +1,115 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/offen/offen/server/config"
+	"github.com/pires/go-proxyproto"
+)
+
+// listen announces on the given public address. In case the PROXY protocol is
+// enabled, client addresses are read from the PROXY header sent by trusted
+// proxies, while connections from other sources that send such a header
+// are rejected.
+func (a *app) listen(addr config.ListenAddress) (net.Listener, error) {
+	ln, err := listenAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !a.config.Server.ProxyProtocol {
+		return ln, nil
+	}
+	return &proxyproto.Listener{
+		Listener: ln,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if a.config.Server.TrustedProxies.Contains(upstream.String()) {
+				return proxyproto.USE, nil
+			}
+			return proxyproto.REJECT, nil
+		},
+	}, nil
+}
+
+// listenAddress announces on the given TCP address or UNIX domain socket.
+// Connections accepted on a socket report the loopback address as their
+// remote address, so local proxies are treated the same way no matter how
+// they connect.
+func listenAddress(addr config.ListenAddress) (net.Listener, error) {
+	if addr.Network != "unix" {
+		return net.Listen("tcp", addr.Address)
+	}
+	if err := removeStaleSocket(addr.Address); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", addr.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &localListener{ln}, nil
+}
+
+// removeStaleSocket removes a socket file that is left over from a previous
+// run. Sockets that are still in use are kept, so that binding fails.
+func removeStaleSocket(location string) error {
+	info, err := os.Stat(location)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", location)
+	}
+	if conn, err := net.Dial("unix", location); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use", location)
+	}
+	return os.Remove(location)
+}
+
+type localListener struct {
+	net.Listener
+}
+
+func (l *localListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &localConn{conn}, nil
+}
+
+type localConn struct {
+	net.Conn
+}
+
+func (c *localConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+// serve accepts connections on the given listeners in the background. The
+// application exits in case any of them fails.
+func (a *app) serve(srv *http.Server, useTLS bool, listeners ...net.Listener) {
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			var err error
+			if useTLS {
+				// certificates are passed using srv.TLSConfig
+				err = srv.ServeTLS(ln, "", "")
+			} else {
+				err = srv.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				a.logger.WithError(err).Fatalf("Error serving requests on %s", ln.Addr())
+			}
+		}(ln)
+	}
+}
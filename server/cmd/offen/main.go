@@ -19,6 +19,8 @@ var mainUsage = `
 - "expire" prunes expired events from the database
 - "migrate" applies pending database migrations
 - "debug" prints the currently applied configuration values
+- "config" validates the configuration and connectivity to configured services
+- "mail" sends a test message using the configured mailer
 
 Refer to the -help content of each subcommand for information about how to use
 them. Further documentation is available at
@@ -54,6 +56,10 @@ func main() {
 		cmdExpire("expire", flags)
 	case "debug":
 		cmdDebug("debug", flags)
+	case "config":
+		cmdConfig("config", flags)
+	case "mail":
+		cmdMail("mail", flags)
 	case "secret":
 		cmdSecret("secret", flags)
 	case "version":
@@ -0,0 +1,279 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/router"
+	"github.com/sirupsen/logrus"
+)
+
+// certificateLoader serves a TLS certificate that can be replaced while the
+// server is running.
+type certificateLoader struct {
+	certificate atomic.Pointer[tls.Certificate]
+	mu          sync.Mutex
+	certFile    string
+	keyFile     string
+	stamp       string
+}
+
+func newCertificateLoader(certFile, keyFile string) (*certificateLoader, error) {
+	l := &certificateLoader{}
+	if err := l.load(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load reads the given certificate and key and uses them for all subsequent
+// TLS handshakes.
+func (l *certificateLoader) load(certFile, keyFile string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.loadLocked(certFile, keyFile)
+}
+
+func (l *certificateLoader) loadLocked(certFile, keyFile string) error {
+	// the files are inspected before reading them so that changes made
+	// while reading are picked up on the next refresh
+	stamp, err := certificateStamp(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("error inspecting certificate and key: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate and key: %w", err)
+	}
+	l.certificate.Store(&cert)
+	l.certFile, l.keyFile, l.stamp = certFile, keyFile, stamp
+	return nil
+}
+
+// refresh loads the certificate and key again in case any of the files
+// has changed since they have been loaded. In case the files cannot be
+// loaded, e.g. because only one of them has been replaced yet, the current
+// certificate is kept.
+func (l *certificateLoader) refresh() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stamp, err := certificateStamp(l.certFile, l.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("error inspecting certificate and key: %w", err)
+	}
+	if stamp == l.stamp {
+		return false, nil
+	}
+	if err := l.loadLocked(l.certFile, l.keyFile); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// watch checks the certificate and key for changes using the given interval
+// until the context is cancelled. onRefresh is called each time the files
+// have changed, passing any error that occurred loading them.
+func (l *certificateLoader) watch(ctx context.Context, interval time.Duration, onRefresh func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshed, err := l.refresh()
+			if refreshed || err != nil {
+				onRefresh(err)
+			}
+		}
+	}
+}
+
+// certificateStamp describes the current state of the given files, so that
+// changes can be detected without reading their contents. Files are
+// followed when they are symlinks, which is how mounted secrets are commonly
+// rotated.
+func certificateStamp(files ...string) (string, error) {
+	var stamps []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		stamps = append(stamps, fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()))
+	}
+	return strings.Join(stamps, ","), nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (l *certificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return l.certificate.Load(), nil
+}
+
+// loadClientCAs reads the PEM encoded certificate authorities used for
+// verifying client certificates from the given file.
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(pem); !ok {
+		return nil, fmt.Errorf("no valid certificates found in client CA file %s", file)
+	}
+	return pool, nil
+}
+
+// reloader applies changes in the runtime configuration to a running server.
+// Settings that cannot be changed at runtime are logged and ignored.
+type reloader struct {
+	mu           sync.Mutex
+	envFile      string
+	initial      *config.Config
+	current      *config.Config
+	logger       *logrus.Logger
+	router       *router.Reloader
+	certificates *certificateLoader
+	mailer       mailer.Mailer
+	retention    atomic.Int64
+}
+
+func newReloader(a *app, envFile string, m mailer.Mailer, certificates *certificateLoader) *reloader {
+	r := &reloader{
+		envFile:      envFile,
+		initial:      a.config,
+		current:      a.config,
+		logger:       a.logger,
+		router:       &router.Reloader{},
+		certificates: certificates,
+		mailer:       m,
+	}
+	r.retention.Store(int64(a.config.App.Retention.Duration()))
+	return r
+}
+
+// retentionPeriod returns the currently configured retention period.
+func (r *reloader) retentionPeriod() time.Duration {
+	return time.Duration(r.retention.Load())
+}
+
+// reloadable checks whether a change to the value of the given key can be
+// applied at runtime.
+func (r *reloader) reloadable(key string) bool {
+	switch key {
+	case "OFFEN_APP_LOGLEVEL":
+		return true
+	case "OFFEN_SERVER_SSLCERTIFICATE", "OFFEN_SERVER_SSLKEY":
+		// certificates can only be replaced in case the server has been
+		// started using TLS
+		return r.certificates != nil
+	}
+	return router.ReloadableSettings[key]
+}
+
+// reload sources the configuration again and applies all values that can be
+// changed at runtime. In case the new configuration is invalid, nothing is
+// applied.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := config.New(false, r.envFile)
+	if err != nil {
+		return fmt.Errorf("error sourcing runtime configuration: %w", err)
+	}
+	// applying the new configuration partially would leave the server
+	// in an inconsistent state, so everything that can fail is done first
+	if r.certificates != nil {
+		if next.Server.SSLCertificate == "" || next.Server.SSLKey == "" {
+			return fmt.Errorf("TLS cannot be disabled without a restart")
+		}
+	}
+
+	// settings that cannot be changed at runtime are compared against the
+	// values the server has been started with, so they are reported on each
+	// reload until the change is reverted
+	var applied, ignored []string
+	for _, key := range r.current.Changes(next) {
+		if r.reloadable(key) {
+			applied = append(applied, key)
+		}
+	}
+	for _, key := range r.initial.Changes(next) {
+		if !r.reloadable(key) {
+			ignored = append(ignored, key)
+		}
+	}
+
+	nextMailer := r.mailer
+	for _, key := range applied {
+		if strings.HasPrefix(key, "OFFEN_SMTP_") {
+			m, err := next.NewMailer()
+			if err != nil {
+				return fmt.Errorf("error creating mailer: %w", err)
+			}
+			nextMailer = m
+			break
+		}
+	}
+	if r.certificates != nil {
+		// certificates are always read again as the files might have been
+		// replaced without changing their location
+		if err := r.certificates.load(next.Server.SSLCertificate.String(), next.Server.SSLKey.String()); err != nil {
+			if nextMailer != r.mailer {
+				closeMailer(nextMailer)
+			}
+			return err
+		}
+	}
+
+	for _, key := range ignored {
+		r.logger.WithField("setting", key).Warn("Changing this setting requires a restart, the change has been ignored")
+	}
+
+	r.logger.SetLevel(next.App.LogLevel.LogLevel())
+	r.retention.Store(int64(next.App.Retention.Duration()))
+	config.EventRetention = next.App.Retention.Duration()
+	// Reload waits for messages that are currently being sent using the
+	// previous mailer, so it can be closed right away
+	r.router.Reload(next, nextMailer)
+	if nextMailer != r.mailer {
+		closeMailer(r.mailer)
+		r.mailer = nextMailer
+	}
+
+	r.current = next
+	if len(applied) != 0 {
+		r.logger.WithField("settings", strings.Join(applied, ", ")).Info("Applied changes in configuration")
+	}
+	return nil
+}
+
+// close releases the resources held by the current mailer.
+func (r *reloader) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if closer, ok := r.mailer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func closeMailer(m mailer.Mailer) {
+	if closer, ok := m.(io.Closer); ok {
+		closer.Close()
+	}
+}
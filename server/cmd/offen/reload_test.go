@@ -0,0 +1,288 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReloader_reload(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "offen.env")
+	write := func(content string) {
+		if err := os.WriteFile(envFile, []byte(content), 0600); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	write("OFFEN_SECRET=YWJjZGVm\nOFFEN_SERVER_PORT=4000\nOFFEN_APP_LOGLEVEL=info\nOFFEN_SERVER_CONTENTSECURITYPOLICY=default-src 'self'\n")
+
+	cfg, err := config.New(false, envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	r := newReloader(&app{config: cfg, logger: logger}, envFile, nil, nil)
+
+	t.Run("changes", func(t *testing.T) {
+		write("OFFEN_SECRET=YWJjZGVm\nOFFEN_SERVER_PORT=5000\nOFFEN_APP_LOGLEVEL=debug\nOFFEN_SERVER_CONTENTSECURITYPOLICY=default-src 'none'\nOFFEN_APP_RETENTION=30days\n")
+		if err := r.reload(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if logger.GetLevel() != logrus.DebugLevel {
+			t.Errorf("Expected log level to be applied, got %v", logger.GetLevel())
+		}
+		if csp := r.current.Server.ContentSecurityPolicy; csp != "default-src 'none'" {
+			t.Errorf("Expected content security policy to be applied, got %s", csp)
+		}
+		if retention := r.retentionPeriod(); retention != config.MinRetention*30 {
+			t.Errorf("Expected retention to be applied, got %v", retention)
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		write("OFFEN_SECRET=YWJjZGVm\nOFFEN_APP_LOGLEVEL=warn\nOFFEN_SMTP_PASSWORD_FILE=/does/not/exist\n")
+		if err := r.reload(); err == nil {
+			t.Error("Expected error for invalid configuration")
+		}
+		if logger.GetLevel() != logrus.DebugLevel {
+			t.Errorf("Expected current configuration to be kept, got log level %v", logger.GetLevel())
+		}
+	})
+}
+
+// writeKeyPair creates a self-signed certificate using the given common name
+// and writes it to the given files. The modification time is set explicitly
+// so changes are detected regardless of the file system's granularity.
+func writeKeyPair(t *testing.T, commonName, certFile, keyFile string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if file == "" {
+			continue
+		}
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+}
+
+func servedCommonName(t *testing.T, l *certificateLoader) string {
+	t.Helper()
+	cert, err := l.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertificateLoader_refresh(t *testing.T) {
+	type step struct {
+		rotate          func(t *testing.T, dir string, modTime time.Time)
+		expectRefreshed bool
+		expectError     bool
+		expectName      string
+	}
+	writeDirect := func(commonName string, cert, key bool) func(*testing.T, string, time.Time) {
+		return func(t *testing.T, dir string, modTime time.Time) {
+			certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			if !cert {
+				certFile = ""
+			}
+			if !key {
+				keyFile = ""
+			}
+			writeKeyPair(t, commonName, certFile, keyFile, modTime)
+		}
+	}
+	// linkVersion writes a key pair into its own directory and points the
+	// symlinks at it, which is how mounted secrets are usually rotated
+	linkVersion := func(commonName string) func(*testing.T, string, time.Time) {
+		return func(t *testing.T, dir string, modTime time.Time) {
+			version := filepath.Join(dir, commonName)
+			if err := os.Mkdir(version, 0700); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			writeKeyPair(t, commonName, filepath.Join(version, "cert.pem"), filepath.Join(version, "key.pem"), modTime)
+			next := filepath.Join(dir, "next")
+			if err := os.Symlink(commonName, next); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if err := os.Rename(next, filepath.Join(dir, "current")); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+	}
+	linkFiles := func(t *testing.T, dir string) (string, string) {
+		for _, name := range []string{"cert.pem", "key.pem"} {
+			if err := os.Symlink(filepath.Join("current", name), filepath.Join(dir, name)); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+		return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	}
+	directFiles := func(t *testing.T, dir string) (string, string) {
+		return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	}
+
+	tests := []struct {
+		name    string
+		initial func(*testing.T, string, time.Time)
+		files   func(*testing.T, string) (string, string)
+		steps   []step
+	}{
+		{
+			"unchanged",
+			writeDirect("initial", true, true),
+			directFiles,
+			[]step{
+				{nil, false, false, "initial"},
+			},
+		},
+		{
+			"rotated",
+			writeDirect("initial", true, true),
+			directFiles,
+			[]step{
+				{writeDirect("rotated", true, true), true, false, "rotated"},
+				{nil, false, false, "rotated"},
+			},
+		},
+		{
+			"half written pair",
+			writeDirect("initial", true, true),
+			directFiles,
+			[]step{
+				{writeDirect("rotated", true, false), false, true, "initial"},
+				{nil, false, true, "initial"},
+				{writeDirect("rotated", false, true), false, true, "initial"},
+				{writeDirect("rotated", true, true), true, false, "rotated"},
+			},
+		},
+		{
+			"symlinks",
+			linkVersion("initial"),
+			linkFiles,
+			[]step{
+				{linkVersion("rotated"), true, false, "rotated"},
+				{nil, false, false, "rotated"},
+			},
+		},
+		{
+			"symlink to missing files",
+			linkVersion("initial"),
+			linkFiles,
+			[]step{
+				{func(t *testing.T, dir string, _ time.Time) {
+					if err := os.RemoveAll(filepath.Join(dir, "initial")); err != nil {
+						t.Fatalf("Unexpected error %v", err)
+					}
+				}, false, true, "initial"},
+				{linkVersion("rotated"), true, false, "rotated"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			modTime := time.Now().Add(-time.Hour)
+			test.initial(t, dir, modTime)
+			certFile, keyFile := test.files(t, dir)
+			l, err := newCertificateLoader(certFile, keyFile)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if name := servedCommonName(t, l); name != "initial" {
+				t.Fatalf("Unexpected initial certificate %s", name)
+			}
+			for i, step := range test.steps {
+				if step.rotate != nil {
+					modTime = modTime.Add(time.Minute)
+					step.rotate(t, dir, modTime)
+				}
+				refreshed, err := l.refresh()
+				if refreshed != step.expectRefreshed {
+					t.Errorf("Step %d: expected refreshed to be %v", i, step.expectRefreshed)
+				}
+				if (err != nil) != step.expectError {
+					t.Errorf("Step %d: unexpected error value %v", i, err)
+				}
+				if name := servedCommonName(t, l); name != step.expectName {
+					t.Errorf("Step %d: expected certificate %s, got %s", i, step.expectName, name)
+				}
+			}
+		})
+	}
+}
+
+func TestCertificateLoader_watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeKeyPair(t, "initial", certFile, keyFile, time.Now().Add(-time.Hour))
+	l, err := newCertificateLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	refreshes := make(chan error)
+	go l.watch(ctx, time.Millisecond*10, func(err error) {
+		refreshes <- err
+	})
+
+	writeKeyPair(t, "rotated", certFile, keyFile, time.Now())
+	select {
+	case err := <-refreshes:
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for the certificate to be refreshed")
+	}
+	if name := servedCommonName(t, l); name != "rotated" {
+		t.Errorf("Expected rotated certificate, got %s", name)
+	}
+}
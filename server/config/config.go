@@ -15,6 +15,7 @@ import (
 	"github.com/offen/envconfig"
 	"github.com/offen/offen/server/keys"
 	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/mailer/filemailer"
 	"github.com/offen/offen/server/mailer/localmailer"
 	"github.com/offen/offen/server/mailer/sendmailmailer"
 	"github.com/offen/offen/server/mailer/smtpmailer"
@@ -35,65 +36,55 @@ var ErrPopulatedMissing = errors.New("populated missing secrets")
 // Revision will be set by ldflags on build time
 var Revision string
 
-func init() {
-	envconfig.Lookup = func(key string) (string, bool) {
-		value, okValue := os.LookupEnv(key)
-		location, okFile := os.LookupEnv(key + "_FILE")
-
-		switch {
-		case okValue && !okFile: // only value
-			return value, true
-		case !okValue && okFile: // only file
-			contents, err := os.ReadFile(location)
-			if err != nil {
-				panic(fmt.Errorf("failed to read %s: %s", location, err))
-			}
-			return string(contents), true
-		case okValue && okFile: // both
-			panic(fmt.Errorf("both %s and %s are set!", key, key+"_FILE"))
-		default: // neither, ignore
-			return "", false
-		}
-	}
-}
-
 // SMTPConfigured returns true if a SMTP Host is configured
 func (c *Config) SMTPConfigured() bool {
 	return c.SMTP.Host != ""
 }
 
 // NewMailer returns a new mailer that is suitable for the given config.
-// In development, mail content will be printed to stdout. In production,
-// SMTP is preferred and falls back to sendmail if no SMTP credentials are given.
+// In development, mail content will be printed to stdout or stored in the
+// configured mailbox directory. In production, SMTP is preferred and falls back
+// to sendmail if no SMTP credentials are given.
 func (c *Config) NewMailer() (mailer.Mailer, error) {
 	if c.App.Development {
+		if c.App.Mailbox != "" {
+			return filemailer.New(c.App.Mailbox.String())
+		}
 		return localmailer.New()
 	}
 	if c.SMTPConfigured() {
-		return smtpmailer.New(c.SMTP.Host, c.SMTP.User, c.SMTP.Password, c.SMTP.Authtype, c.SMTP.Port)
+		return smtpmailer.New(
+			c.SMTP.Host, c.SMTP.User, c.SMTP.Password, c.SMTP.Authtype, c.SMTP.Port,
+			smtpmailer.WithImplicitTLS(c.SMTP.ImplicitTLS),
+			smtpmailer.WithStartTLSPolicy(c.SMTP.StartTLS.String()),
+			smtpmailer.WithRootCA(c.SMTP.RootCA.String()),
+			smtpmailer.WithTimeout(c.SMTP.Timeout),
+			smtpmailer.WithPoolSize(c.SMTP.PoolSize),
+			smtpmailer.WithIdleTimeout(c.SMTP.IdleTimeout),
+		)
 	}
 	return sendmailmailer.New()
 }
 
-func walkConfigurationCascade() (string, error) {
+func walkConfigurationCascade(fileName string) (string, error) {
 	wd, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("config: error looking up current working directory: %w", err)
 	}
-	// in case there is an offen.env file next to the binary, it will be loaded
-	// as the env file with the highest precedence
+	// in case there is a file next to the binary, it will be loaded
+	// as the file with the highest precedence
 	var cascade []string
 	switch runtime.GOOS {
 	case "windows":
 		cascade = []string{
-			path.Join(wd, envFileName),
+			path.Join(wd, fileName),
 		}
 	case "darwin", "linux":
 		cascade = []string{
-			path.Join(wd, envFileName),
-			path.Join(ExpandString("$HOME/.config"), envFileName),
-			path.Join(ExpandString("$XDG_CONFIG_HOME"), envFileName),
-			path.Join("/etc/offen", envFileName),
+			path.Join(wd, fileName),
+			path.Join(ExpandString("$HOME/.config"), fileName),
+			path.Join(ExpandString("$XDG_CONFIG_HOME"), fileName),
+			path.Join("/etc/offen", fileName),
 		}
 	}
 	for _, file := range cascade {
@@ -133,10 +124,12 @@ type autopopulatedValue struct {
 	isEmpty func() bool
 }
 
-// New returns a new runtime configuration
+// New returns a new runtime configuration. Values are sourced from the
+// environment, an env file and a YAML config file, in this order of
+// precedence. override can point to either an env file or a config file.
 func New(populateMissing bool, override string) (*Config, error) {
 	var c Config
-	var envFile string
+	var envFile, configFile string
 	// Depending on the system, a certain cascade of configuration options will
 	// be sourced. In case a variable is already set in the environment, it will
 	// not be overridden by any file content.
@@ -144,27 +137,63 @@ func New(populateMissing bool, override string) (*Config, error) {
 		if _, err := os.Stat(override); err != nil {
 			return nil, fmt.Errorf("config: error looking up config file override: %w", err)
 		}
-		envFile = override
-	} else {
-		match, err := walkConfigurationCascade()
+		if isConfigFile(override) {
+			configFile = override
+		} else {
+			envFile = override
+		}
+	}
+	if envFile == "" {
+		match, err := walkConfigurationCascade(envFileName)
 		if err != nil {
 			return nil, fmt.Errorf("config: error checking if config file exists: %w", err)
 		}
 		// there might not exist a config file at all in which case all values
 		// are sourced from environment variables
-		if match != "" {
-			envFile = match
+		envFile = match
+	}
+	if configFile == "" {
+		match, err := walkConfigurationCascade(configFileName)
+		if err != nil {
+			return nil, fmt.Errorf("config: error checking if config file exists: %w", err)
 		}
+		configFile = match
+	}
+
+	r := &resolver{
+		envFile:       envFile,
+		envFileValues: map[string]string{},
+		configFile:    configFile,
+		fileValues:    map[string]string{},
+		sources:       map[string]string{},
 	}
 
 	if envFile != "" {
-		godotenv.Load(envFile)
+		values, err := godotenv.Read(envFile)
+		if err != nil {
+			return nil, fmt.Errorf("config: error reading env file %s: %w", envFile, err)
+		}
+		r.envFileValues = values
 	}
 
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		r.fileValues = values
+	}
+
+	envconfig.Lookup = r.lookup
 	err := envconfig.Process("offen", &c)
+	c.sources = r.sources
+	if err == nil {
+		err = r.err
+	}
 	if err != nil {
 		return &c, fmt.Errorf("config: error processing configuration: %w", err)
 	}
+	r.expand(&c)
 
 	if populateMissing {
 		if envFile == "" {
@@ -196,6 +225,37 @@ func New(populateMissing bool, override string) (*Config, error) {
 		return result, err
 	}
 
+	if c.Server.ProxyProtocol && len(c.Server.TrustedProxies) == 0 {
+		return &c, errors.New("config: using the PROXY protocol requires trusted proxies to be configured")
+	}
+
+	if !c.Server.InternalListen.IsZero() && c.Server.MetricsPort != 0 {
+		return &c, errors.New("config: metrics cannot be served on a dedicated port when using an internal listener")
+	}
+	if c.Server.Metrics && c.Server.InternalListen.IsZero() && c.Server.MetricsPort == 0 && c.Server.MetricsToken == "" {
+		return &c, errors.New("config: serving metrics publicly requires a metrics token, alternatively use a metrics port or an internal listener")
+	}
+	if !c.Server.RedirectListen.IsZero() && !c.TLS() {
+		return &c, errors.New("config: redirecting to HTTPS requires TLS to be configured")
+	}
+	if c.Server.SSLClientCA != "" && !c.TLS() {
+		return &c, errors.New("config: verifying client certificates requires TLS to be configured")
+	}
+	if c.Server.SSLReloadInterval < 0 {
+		return &c, errors.New("config: the certificate reload interval cannot be negative")
+	}
+
+	if c.App.IngestionTokenTTL < 0 || (c.App.IngestionTokenTTL > 0 && c.App.IngestionTokenTTL < time.Second) {
+		return &c, errors.New("config: the ingestion token TTL is required to be at least one second if set")
+	}
+
+	if c.App.ExpireInterval <= 0 {
+		return &c, errors.New("config: the expiry interval is required to be a positive duration")
+	}
+	if c.App.ExpireJitter < 0 || c.App.ExpireJitter >= c.App.ExpireInterval {
+		return &c, errors.New("config: the expiry jitter is required to be shorter than the expiry interval")
+	}
+
 	if c.Secret.IsZero() {
 		cookieSecret, cookieSecretErr := keys.GenerateRandomBytes(keys.DefaultSecretLength)
 		if cookieSecretErr != nil {
@@ -204,8 +264,6 @@ func New(populateMissing bool, override string) (*Config, error) {
 		c.Secret = Bytes(cookieSecret)
 	}
 
-	EventRetention = c.App.Retention.retention
-
 	// some deploy targets have custom overrides for creating the
 	// runtime configuration
 	switch c.App.DeployTarget {
@@ -6,41 +6,80 @@
 
 package config
 
+import "time"
+
 // Config contains all runtime configuration needed for running offen as
 // and also defines the desired defaults. Package envconfig is used to
-// source values from the application environment at runtime.
+// source values from the application environment at runtime. Fields tagged
+// with `secret:"true"` contain credentials and are redacted in reports.
 type Config struct {
 	Server struct {
-		Port             int  `default:"3000"`
-		ReverseProxy     bool `default:"false"`
-		SSLCertificate   EnvString
-		SSLKey           EnvString
-		AutoTLS          []string
-		LetsEncryptEmail string
-		CertificateCache EnvString `default:"%AppData%\offen\.cache"`
+		Port                    int `default:"3000"`
+		Listen                  ListenAddresses
+		InternalListen          ListenAddress
+		RedirectListen          ListenAddress
+		ReverseProxy            bool `default:"false"`
+		TrustedProxies          TrustedProxies
+		ProxyProtocol           bool `default:"false"`
+		SSLCertificate          EnvString
+		SSLKey                  EnvString
+		SSLReloadInterval       time.Duration `default:"1m"`
+		SSLClientCA             EnvString
+		AutoTLS                 []string
+		LetsEncryptEmail        string
+		CertificateCache        EnvString `default:"%AppData%\offen\.cache"`
+		AccessLog               bool      `default:"true"`
+		Metrics                 bool      `default:"false"`
+		MetricsPort             int
+		MetricsToken            string         `secret:"true"`
+		RateLimitStore          RateLimitStore `default:"memory"`
+		RateLimitMode           RateLimitMode  `default:"delay"`
+		RateLimitBurst          int            `default:"10"`
+		RateLimits              RateLimits
+		ContentSecurityPolicy   string
+		StrictTransportSecurity string
+		PermissionsPolicy       string
 	}
 	Database struct {
 		Dialect           Dialect   `default:"sqlite3"`
-		ConnectionString  EnvString `default:"%Temp%\offen.db"`
+		ConnectionString  EnvString `secret:"true" default:"%Temp%\offen.db"`
 		ConnectionRetries int       `default:"0"`
 	}
 	App struct {
-		Development  bool     `default:"false"`
-		LogLevel     LogLevel `default:"info"`
-		SingleNode   bool     `default:"true"`
-		Locale       Locale   `default:"en"`
-		RootAccount  string
-		DemoAccount  string `ignored:"true"`
-		DeployTarget DeployTarget
-		Retention    Retention `default:"6months"`
+		Development        bool      `default:"false"`
+		LogLevel           LogLevel  `default:"info"`
+		LogFormat          LogFormat `default:"text"`
+		SingleNode         bool      `default:"true"`
+		Locale             Locale    `default:"en"`
+		RootAccount        string
+		DemoAccount        string `ignored:"true"`
+		DeployTarget       DeployTarget
+		Retention          Retention `default:"6months"`
+		Mailbox            EnvString
+		IngestionTokenTTL  time.Duration `default:"0"`
+		StreamPollInterval time.Duration `default:"1s"`
+		ExpireInterval     time.Duration `default:"1h"`
+		ExpireJitter       time.Duration `default:"5m"`
 	}
-	Secret Bytes
+	Secret Bytes `secret:"true"`
 	SMTP   struct {
-		Authtype string `default:"LOGIN"`
-		User     string
-		Password string
-		Host     string
-		Port     int    `default:"587"`
-		Sender   string `default:"no-reply@offen.dev"`
+		Authtype    string `default:"LOGIN"`
+		User        string
+		Password    string `secret:"true"`
+		Host        string
+		Port        int            `default:"587"`
+		Sender      string         `default:"no-reply@offen.dev"`
+		ImplicitTLS bool           `default:"false"`
+		StartTLS    StartTLSPolicy `default:"mandatory"`
+		RootCA      EnvString
+		Timeout     time.Duration `default:"15s"`
+		PoolSize    int           `default:"2"`
+		IdleTimeout time.Duration `default:"30s"`
+	}
+	Tracing struct {
+		Exporter    TracingExporter
+		SampleRatio float64 `default:"1"`
 	}
+	// sources records where each value has been sourced from
+	sources map[string]string
 }
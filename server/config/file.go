@@ -0,0 +1,277 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const configFileName = "offen.yaml"
+
+// The following values describe where a configuration value was sourced from.
+const (
+	SourceDefault     = "default"
+	SourceEnvironment = "environment"
+	SourceEnvFile     = "env file"
+	SourceConfigFile  = "config file"
+)
+
+// isConfigFile checks whether the given location is expected to point to
+// a structured configuration file instead of an env file.
+func isConfigFile(location string) bool {
+	switch strings.ToLower(filepath.Ext(location)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// readConfigFile reads the YAML configuration file at the given location and
+// maps its values onto the keys of the environment variables they
+// correspond to, so `server: {reverse_proxy: true}` is returned as
+// OFFEN_SERVER_REVERSEPROXY. Keys suffixed with `_file` are read from the
+// file they point to.
+func readConfigFile(location string) (map[string]string, error) {
+	b, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("config: error reading config file %s: %w", location, err)
+	}
+	var data map[interface{}]interface{}
+	if err := yaml.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("config: error parsing config file %s: %w", location, err)
+	}
+
+	known := knownKeys()
+	result := map[string]string{}
+	if err := flattenConfigFile("OFFEN", data, known, result); err != nil {
+		return nil, fmt.Errorf("config: error in config file %s: %w", location, err)
+	}
+	return result, nil
+}
+
+func flattenConfigFile(prefix string, data map[interface{}]interface{}, known map[string]bool, result map[string]string) error {
+	for rawKey, rawValue := range data {
+		name := fmt.Sprintf("%v", rawKey)
+		fromFile := strings.HasSuffix(strings.ToLower(name), "_file")
+		if fromFile {
+			name = name[:len(name)-len("_file")]
+		}
+		key := prefix + "_" + strings.ToUpper(strings.NewReplacer("_", "", "-", "").Replace(name))
+
+		if nested, ok := rawValue.(map[interface{}]interface{}); ok && !fromFile && !known[key] {
+			if err := flattenConfigFile(key, nested, known, result); err != nil {
+				return err
+			}
+			continue
+		}
+		if !known[key] {
+			return fmt.Errorf("unknown configuration key %s", name)
+		}
+		if _, ok := result[key]; ok {
+			return fmt.Errorf("both %s and %s_file are set", name, name)
+		}
+
+		value := configFileValue(rawValue)
+		if fromFile {
+			contents, err := os.ReadFile(value)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", value, err)
+			}
+			value = string(contents)
+		}
+		result[key] = value
+	}
+	return nil
+}
+
+// configFileValue formats the given value the same way it would be given
+// in an environment variable.
+func configFileValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			items = append(items, configFileValue(item))
+		}
+		return strings.Join(items, ",")
+	case map[interface{}]interface{}:
+		var items []string
+		for k, item := range value {
+			items = append(items, fmt.Sprintf("%v=%s", k, configFileValue(item)))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// knownKeys returns the keys of all environment variables that are used
+// for populating Config.
+func knownKeys() map[string]bool {
+	result := map[string]bool{}
+	for key := range fields(&Config{}) {
+		result[key] = true
+	}
+	return result
+}
+
+// fields returns all values of the given Config that are populated by
+// envconfig, keyed by the name of the environment variable they are
+// sourced from.
+func fields(c *Config) map[string]reflect.Value {
+	result := map[string]reflect.Value{}
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("ignored") == "true" {
+				continue
+			}
+			key := prefix + "_" + strings.ToUpper(field.Name)
+			// scopes are defined using anonymous structs
+			if field.Type.Kind() == reflect.Struct && field.Type.Name() == "" {
+				walk(key, v.Field(i))
+				continue
+			}
+			result[key] = v.Field(i)
+		}
+	}
+	walk("OFFEN", reflect.ValueOf(c).Elem())
+	return result
+}
+
+// Changes returns the keys of all values that differ between c and other,
+// sorted alphabetically.
+func (c *Config) Changes(other *Config) []string {
+	otherFields := fields(other)
+	var result []string
+	for key, value := range fields(c) {
+		if !reflect.DeepEqual(value.Interface(), otherFields[key].Interface()) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// resolver looks up configuration values, preferring values set in the
+// environment over values set in the env file, and values set in the env file
+// over values set in the config file. It keeps track of where each value has
+// been sourced from. Files are read into the resolver instead of being loaded
+// into the environment, so sourcing the configuration again picks up changes
+// made to them.
+type resolver struct {
+	envFile       string
+	envFileValues map[string]string
+	configFile    string
+	fileValues    map[string]string
+	sources       map[string]string
+	err           error
+}
+
+func (r *resolver) lookup(key string) (string, bool) {
+	if value, ok := r.lookupIn(key, os.LookupEnv, SourceEnvironment); ok {
+		return value, true
+	}
+	fromEnvFile := func(key string) (string, bool) {
+		value, ok := r.envFileValues[key]
+		return value, ok
+	}
+	if value, ok := r.lookupIn(key, fromEnvFile, fmt.Sprintf("%s %s", SourceEnvFile, r.envFile)); ok {
+		return value, true
+	}
+	if value, ok := r.fileValues[key]; ok {
+		r.sources[key] = fmt.Sprintf("%s %s", SourceConfigFile, r.configFile)
+		return value, true
+	}
+	return "", false
+}
+
+// lookupIn looks up the given key or the location of a file containing its
+// value using the given function. As envconfig does not allow lookups to
+// fail, errors are recorded and returned once all values have been looked up.
+func (r *resolver) lookupIn(key string, lookup func(string) (string, bool), source string) (string, bool) {
+	value, okValue := lookup(key)
+	location, okFile := lookup(key + "_FILE")
+	switch {
+	case okValue && !okFile: // only value
+		r.sources[key] = source
+		return value, true
+	case !okValue && okFile: // only file
+		contents, err := os.ReadFile(location)
+		if err != nil {
+			r.fail(fmt.Errorf("failed to read %s: %w", location, err))
+			return "", false
+		}
+		r.sources[key] = fmt.Sprintf("%s (%s_FILE)", source, key)
+		return string(contents), true
+	case okValue && okFile: // both
+		r.fail(fmt.Errorf("both %s and %s are set", key, key+"_FILE"))
+		return "", false
+	}
+	return "", false
+}
+
+var variableRe = regexp.MustCompile(`\$(\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// expand replaces references to variables that are defined in the env file
+// or the config file in all EnvString values of c. As these files are not
+// loaded into the environment, EnvString would not be able to expand them.
+// References to variables that are set in the environment are left for
+// EnvString to expand, so the environment takes precedence like it does
+// for all other values.
+func (r *resolver) expand(c *Config) {
+	envStringType := reflect.TypeOf(EnvString(""))
+	for _, value := range fields(c) {
+		if value.Type() != envStringType {
+			continue
+		}
+		expanded := variableRe.ReplaceAllStringFunc(value.String(), func(match string) string {
+			groups := variableRe.FindStringSubmatch(match)
+			name := groups[2] + groups[3]
+			if _, ok := os.LookupEnv(name); ok {
+				return match
+			}
+			if v, ok := r.envFileValues[name]; ok {
+				return v
+			}
+			if v, ok := r.fileValues[name]; ok {
+				return v
+			}
+			return match
+		})
+		value.SetString(expanded)
+	}
+}
+
+func (r *resolver) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Sources returns a description of where each configuration value has been
+// sourced from, keyed by the name of its environment variable.
+func (c *Config) Sources() map[string]string {
+	result := map[string]string{}
+	for key := range knownKeys() {
+		result[key] = SourceDefault
+		if source, ok := c.sources[key]; ok {
+			result[key] = source
+		}
+	}
+	return result
+}
@@ -0,0 +1,259 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNew_ConfigFile(t *testing.T) {
+	t.Setenv("OFFEN_SERVER_PORT", "9876")
+	unsetenv(t, "OFFEN_SERVER_AUTOTLS")
+
+	c, err := New(false, "./testdata/offen.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if c.Server.Port != 9876 {
+		t.Errorf("Unexpected port value %v", c.Server.Port)
+	}
+	if !c.Server.ReverseProxy {
+		t.Error("Expected reverse proxy to be enabled")
+	}
+	if !reflect.DeepEqual(c.Server.AutoTLS, []string{"analytics.offen.dev", "www.analytics.offen.dev"}) {
+		t.Errorf("Unexpected AutoTLS config %v", c.Server.AutoTLS)
+	}
+	if expected := (RateLimits{"login": 10 * time.Second, "postEvents": time.Second}); !reflect.DeepEqual(c.Server.RateLimits, expected) {
+		t.Errorf("Unexpected rate limits %v", c.Server.RateLimits)
+	}
+	if c.App.Locale != "de" {
+		t.Errorf("Unexpected locale %v", c.App.Locale)
+	}
+	if c.SMTP.Password != "secret-from-file" {
+		t.Errorf("Unexpected SMTP password %v", c.SMTP.Password)
+	}
+
+	sources := c.Sources()
+	for key, expected := range map[string]string{
+		"OFFEN_SERVER_PORT":         SourceEnvironment,
+		"OFFEN_SERVER_REVERSEPROXY": SourceConfigFile + " ./testdata/offen.yaml",
+		"OFFEN_SMTP_PASSWORD":       SourceConfigFile + " ./testdata/offen.yaml",
+		"OFFEN_SMTP_HOST":           SourceDefault,
+	} {
+		if sources[key] != expected {
+			t.Errorf("Expected source of %s to be %v, got %v", key, expected, sources[key])
+		}
+	}
+}
+
+func TestNew_ConfigFileIndirection(t *testing.T) {
+	t.Setenv("OFFEN_SMTP_PASSWORD_FILE", "./testdata/secret.txt")
+	unsetenv(t, "OFFEN_SERVER_PORT")
+	unsetenv(t, "OFFEN_SERVER_AUTOTLS")
+
+	c, err := New(false, "./testdata/offen.env")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.SMTP.Password != "secret-from-file" {
+		t.Errorf("Unexpected SMTP password %v", c.SMTP.Password)
+	}
+	if source := c.Sources()["OFFEN_SMTP_PASSWORD"]; source != "environment (OFFEN_SMTP_PASSWORD_FILE)" {
+		t.Errorf("Unexpected source %v", source)
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expected      map[string]string
+		expectedError string
+	}{
+		{
+			"ok",
+			"database:\n  dialect: postgres\n  connection-retries: 3\nsecret: abc\n",
+			map[string]string{
+				"OFFEN_DATABASE_DIALECT":           "postgres",
+				"OFFEN_DATABASE_CONNECTIONRETRIES": "3",
+				"OFFEN_SECRET":                     "abc",
+			},
+			"",
+		},
+		{
+			"empty",
+			"",
+			map[string]string{},
+			"",
+		},
+		{
+			"unknown key",
+			"server:\n  prot: 4000\n",
+			nil,
+			"unknown configuration key prot",
+		},
+		{
+			"ignored key",
+			"app:\n  demo_account: demo\n",
+			nil,
+			"unknown configuration key demo_account",
+		},
+		{
+			"bad syntax",
+			"server: [\n",
+			nil,
+			"error parsing config file",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location := filepath.Join(t.TempDir(), "offen.yaml")
+			if err := os.WriteFile(location, []byte(test.content), 0644); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			result, err := readConfigFile(location)
+			if test.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+					t.Errorf("Expected error containing %q, got %v", test.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(test.expected, result) {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestConfig_Changes(t *testing.T) {
+	a := &Config{}
+	a.Server.Port = 3000
+	a.App.Retention.Decode("6months")
+	a.Server.RateLimits = RateLimits{"postLogin": time.Second}
+
+	b := &Config{}
+	b.Server.Port = 3000
+	b.App.Retention.Decode("7days")
+	b.Server.RateLimits = RateLimits{"postLogin": time.Minute}
+	b.SMTP.Host = "smtp.offen.dev"
+
+	expected := []string{"OFFEN_APP_RETENTION", "OFFEN_SERVER_RATELIMITS", "OFFEN_SMTP_HOST"}
+	if changes := a.Changes(b); !reflect.DeepEqual(expected, changes) {
+		t.Errorf("Expected %v, got %v", expected, changes)
+	}
+	if changes := a.Changes(a); len(changes) != 0 {
+		t.Errorf("Unexpected changes %v", changes)
+	}
+}
+
+func TestNew_EnvFileChanges(t *testing.T) {
+	unsetenv(t, "OFFEN_SERVER_PORT")
+	unsetenv(t, "OFFEN_APP_LOGLEVEL")
+	envFile := filepath.Join(t.TempDir(), "offen.env")
+	write := func(content string) {
+		if err := os.WriteFile(envFile, []byte(content), 0600); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	write("OFFEN_SERVER_PORT=4000\nOFFEN_APP_LOGLEVEL=warn\n")
+	c, err := New(false, envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.Server.Port != 4000 || c.App.LogLevel.LogLevel() != logrus.WarnLevel {
+		t.Errorf("Unexpected values %v %v", c.Server.Port, c.App.LogLevel)
+	}
+	if _, ok := os.LookupEnv("OFFEN_SERVER_PORT"); ok {
+		t.Error("Expected env file not to be loaded into the environment")
+	}
+
+	write("OFFEN_SERVER_PORT=5000\n")
+	c, err = New(false, envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.Server.Port != 5000 || c.App.LogLevel.LogLevel() != logrus.InfoLevel {
+		t.Errorf("Unexpected values after change %v %v", c.Server.Port, c.App.LogLevel)
+	}
+	if source := c.Sources()["OFFEN_SERVER_PORT"]; source != SourceEnvFile+" "+envFile {
+		t.Errorf("Unexpected source %s", source)
+	}
+
+	t.Setenv("OFFEN_SERVER_PORT", "6000")
+	c, err = New(false, envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.Server.Port != 6000 || c.Sources()["OFFEN_SERVER_PORT"] != SourceEnvironment {
+		t.Errorf("Expected environment to take precedence, got %v", c.Server.Port)
+	}
+}
+
+func TestNew_EnvFileExpansion(t *testing.T) {
+	unsetenv(t, "CERT_DIR")
+	unsetenv(t, "OFFEN_SERVER_SSLCERTIFICATE")
+	unsetenv(t, "OFFEN_SERVER_SSLKEY")
+	unsetenv(t, "OFFEN_SERVER_CERTIFICATECACHE")
+	unsetenv(t, "OFFEN_APP_RETENTION")
+	t.Setenv("CACHE_DIR", "/var/cache")
+	envFile := filepath.Join(t.TempDir(), "offen.env")
+	if err := os.WriteFile(envFile, []byte(strings.Join([]string{
+		"OFFEN_SERVER_SSLCERTIFICATE='$CERT_DIR/cert.pem'",
+		"OFFEN_SERVER_SSLKEY='${CERT_DIR}/key.pem'",
+		"OFFEN_SERVER_CERTIFICATECACHE='$CACHE_DIR/$UNKNOWN_DIR'",
+		"OFFEN_APP_RETENTION=7days",
+		"CERT_DIR=/etc/offen",
+		"CACHE_DIR=/tmp",
+	}, "\n")), 0600); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	before := EventRetention
+	c, err := New(false, envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if value := c.Server.SSLCertificate.RawString(); value != "/etc/offen/cert.pem" {
+		t.Errorf("Unexpected certificate %v", value)
+	}
+	if value := c.Server.SSLKey.RawString(); value != "/etc/offen/key.pem" {
+		t.Errorf("Unexpected key %v", value)
+	}
+	// variables set in the environment are expanded by EnvString
+	if value := c.Server.CertificateCache.RawString(); value != "$CACHE_DIR/$UNKNOWN_DIR" {
+		t.Errorf("Unexpected certificate cache %v", value)
+	}
+	if EventRetention != before {
+		t.Errorf("Expected sourcing the configuration not to change the event retention, got %v", EventRetention)
+	}
+}
+
+func TestNew_UnreadableFile(t *testing.T) {
+	unsetenv(t, "OFFEN_SERVER_PORT")
+	envFile := filepath.Join(t.TempDir(), "offen.env")
+	if err := os.WriteFile(envFile, []byte("OFFEN_SMTP_PASSWORD_FILE=/does/not/exist\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := New(false, envFile); err == nil {
+		t.Error("Expected error for unreadable file")
+	}
+
+	t.Setenv("OFFEN_SMTP_PASSWORD", "secret")
+	t.Setenv("OFFEN_SMTP_PASSWORD_FILE", envFile)
+	if _, err := New(false, envFile); err == nil {
+		t.Error("Expected error when both value and file are set")
+	}
+}
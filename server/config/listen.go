@@ -0,0 +1,134 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const unixPrefix = "unix:"
+
+// ListenAddress is an address the server can bind to. It is either a TCP
+// address like `127.0.0.1:3000` or `:3000`, or the location of a UNIX
+// domain socket prefixed with `unix:`.
+type ListenAddress struct {
+	Network string
+	Address string
+}
+
+// Decode validates and assigns v.
+func (l *ListenAddress) Decode(v string) error {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		*l = ListenAddress{}
+		return nil
+	}
+	if strings.HasPrefix(v, unixPrefix) {
+		location := strings.TrimPrefix(v, unixPrefix)
+		if location == "" {
+			return fmt.Errorf("missing socket location in listen address %s", v)
+		}
+		*l = ListenAddress{Network: "unix", Address: location}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(v); err != nil {
+		return fmt.Errorf("unable to parse listen address %s: %w", v, err)
+	}
+	*l = ListenAddress{Network: "tcp", Address: v}
+	return nil
+}
+
+func (l ListenAddress) String() string {
+	if l.Network == "unix" {
+		return unixPrefix + l.Address
+	}
+	return l.Address
+}
+
+// IsZero checks whether an address has been configured.
+func (l ListenAddress) IsZero() bool {
+	return l.Address == ""
+}
+
+// Port returns the port of a TCP address, or an empty string for sockets.
+func (l ListenAddress) Port() string {
+	if l.Network != "tcp" {
+		return ""
+	}
+	_, port, _ := net.SplitHostPort(l.Address)
+	return port
+}
+
+// ListenAddresses is a comma separated list of addresses the server
+// binds to.
+type ListenAddresses []ListenAddress
+
+// Decode validates and assigns v.
+func (l *ListenAddresses) Decode(v string) error {
+	var result ListenAddresses
+	for _, value := range strings.Split(v, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		var addr ListenAddress
+		if err := addr.Decode(value); err != nil {
+			return err
+		}
+		result = append(result, addr)
+	}
+	*l = result
+	return nil
+}
+
+func (l ListenAddresses) String() string {
+	var values []string
+	for _, addr := range l {
+		values = append(values, addr.String())
+	}
+	return strings.Join(values, ",")
+}
+
+// ListenAddresses returns the addresses the server is expected to bind to.
+// In case none are configured, all interfaces are bound using the configured
+// port, or the HTTPS port when using AutoTLS.
+func (c *Config) ListenAddresses() ListenAddresses {
+	if len(c.Server.Listen) != 0 {
+		return c.Server.Listen
+	}
+	if c.autoTLS() {
+		return ListenAddresses{{Network: "tcp", Address: ":https"}}
+	}
+	return ListenAddresses{{Network: "tcp", Address: fmt.Sprintf("0.0.0.0:%d", c.Server.Port)}}
+}
+
+// RedirectAddress returns the address of the server that redirects plain
+// HTTP requests to HTTPS. AutoTLS requires a server on the HTTP port for
+// solving challenges, so it is used by default. The returned address is
+// empty in case no such server is used.
+func (c *Config) RedirectAddress() ListenAddress {
+	if !c.Server.RedirectListen.IsZero() {
+		return c.Server.RedirectListen
+	}
+	if c.autoTLS() {
+		return ListenAddress{Network: "tcp", Address: ":http"}
+	}
+	return ListenAddress{}
+}
+
+// TLS checks whether the server is serving requests using TLS.
+func (c *Config) TLS() bool {
+	return c.manualTLS() || c.autoTLS()
+}
+
+func (c *Config) manualTLS() bool {
+	return c.Server.SSLCertificate != "" && c.Server.SSLKey != ""
+}
+
+// autoTLS checks whether certificates are acquired using AutoTLS, which is
+// only the case if no certificate is given.
+func (c *Config) autoTLS() bool {
+	return len(c.Server.AutoTLS) != 0 && !c.manualTLS()
+}
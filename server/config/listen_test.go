@@ -0,0 +1,77 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListenAddresses(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var l ListenAddresses
+		if err := l.Decode("127.0.0.1:3000, :8080,unix:/run/offen/offen.sock"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		expected := ListenAddresses{
+			{Network: "tcp", Address: "127.0.0.1:3000"},
+			{Network: "tcp", Address: ":8080"},
+			{Network: "unix", Address: "/run/offen/offen.sock"},
+		}
+		if !reflect.DeepEqual(expected, l) {
+			t.Errorf("Expected %v, got %v", expected, l)
+		}
+		if s := l.String(); s != "127.0.0.1:3000,:8080,unix:/run/offen/offen.sock" {
+			t.Errorf("Unexpected string value %s", s)
+		}
+		if l[0].Port() != "3000" || l[2].Port() != "" {
+			t.Errorf("Unexpected ports %s %s", l[0].Port(), l[2].Port())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, value := range []string{"3000", "unix:", "localhost"} {
+			var l ListenAddresses
+			if err := l.Decode(value); err == nil {
+				t.Errorf("Expected error for %s", value)
+			}
+		}
+	})
+}
+
+func TestConfig_ListenAddresses(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c := &Config{}
+		c.Server.Port = 3000
+		if s := c.ListenAddresses().String(); s != "0.0.0.0:3000" {
+			t.Errorf("Unexpected addresses %s", s)
+		}
+		if !c.RedirectAddress().IsZero() {
+			t.Errorf("Unexpected redirect address %v", c.RedirectAddress())
+		}
+	})
+	t.Run("autotls", func(t *testing.T) {
+		c := &Config{}
+		c.Server.AutoTLS = []string{"offen.example.com"}
+		if s := c.ListenAddresses().String(); s != ":https" {
+			t.Errorf("Unexpected addresses %s", s)
+		}
+		redirect := c.RedirectAddress()
+		if s := redirect.String(); s != ":http" {
+			t.Errorf("Unexpected redirect address %s", s)
+		}
+	})
+	t.Run("configured", func(t *testing.T) {
+		c := &Config{}
+		c.Server.AutoTLS = []string{"offen.example.com"}
+		c.Server.Listen.Decode("127.0.0.1:8443")
+		c.Server.RedirectListen.Decode("127.0.0.1:8080")
+		if s := c.ListenAddresses().String(); s != "127.0.0.1:8443" {
+			t.Errorf("Unexpected addresses %s", s)
+		}
+		redirect := c.RedirectAddress()
+		if s := redirect.String(); s != "127.0.0.1:8080" {
+			t.Errorf("Unexpected redirect address %s", s)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogFormat defines how log lines are formatted.
+type LogFormat string
+
+// Decode validates and assigns v.
+func (l *LogFormat) Decode(v string) error {
+	switch v {
+	case "text", "json":
+		*l = LogFormat(v)
+	default:
+		return fmt.Errorf("unknown or unsupported log format %s", v)
+	}
+	return nil
+}
+
+func (l *LogFormat) String() string {
+	return string(*l)
+}
+
+// Formatter returns the logrus formatter for l.
+func (l *LogFormat) Formatter() logrus.Formatter {
+	if *l == "json" {
+		return &logrus.JSONFormatter{}
+	}
+	return &logrus.TextFormatter{}
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RateLimitMode defines how requests exceeding a rate limit are handled.
+type RateLimitMode string
+
+// Decode validates and assigns v.
+func (r *RateLimitMode) Decode(v string) error {
+	switch v {
+	case "delay", "reject":
+		*r = RateLimitMode(v)
+	default:
+		return fmt.Errorf("unknown or unsupported rate limit mode %s", v)
+	}
+	return nil
+}
+
+func (r *RateLimitMode) String() string {
+	return string(*r)
+}
+
+// Reject returns true if requests exceeding a rate limit are supposed
+// to be rejected instead of delayed.
+func (r *RateLimitMode) Reject() bool {
+	return *r == "reject"
+}
+
+// RateLimits maps the names of rate limited operations to the minimum
+// interval between two calls.
+type RateLimits map[string]time.Duration
+
+// Decode parses a comma separated list of name=duration pairs and
+// assigns the result to r.
+func (r *RateLimits) Decode(v string) error {
+	result := RateLimits{}
+	for _, pair := range strings.Split(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected rate limit in the form of name=duration, got %s", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("error parsing rate limit for %s: %w", name, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("rate limit for %s must not be negative, got %s", name, value)
+		}
+		result[strings.TrimSpace(name)] = d
+	}
+	*r = result
+	return nil
+}
+
+func (r *RateLimits) String() string {
+	var pairs []string
+	for name, d := range *r {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, d))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
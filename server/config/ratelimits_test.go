@@ -0,0 +1,55 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMode(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var r RateLimitMode
+		if err := r.Decode("reject"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !r.Reject() {
+			t.Error("Expected mode to reject")
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var r RateLimitMode
+		if err := r.Decode("drop"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
+
+func TestRateLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedResult RateLimits
+		expectError    bool
+	}{
+		{"empty", "", RateLimits{}, false},
+		{"ok", "postEvents=100ms, postLogin-*=2s,", RateLimits{"postEvents": time.Millisecond * 100, "postLogin-*": time.Second * 2}, false},
+		{"missing duration", "postEvents", nil, true},
+		{"bad duration", "postEvents=fast", nil, true},
+		{"negative duration", "postEvents=-1s", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var r RateLimits
+			err := r.Decode(test.value)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !test.expectError && !reflect.DeepEqual(r, test.expectedResult) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, r)
+			}
+		})
+	}
+}
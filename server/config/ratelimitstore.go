@@ -0,0 +1,36 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// RateLimitStore defines where the state of rate limits is kept. Rate
+// limiting can be disabled by using "none".
+type RateLimitStore string
+
+// Decode validates and assigns v.
+func (r *RateLimitStore) Decode(v string) error {
+	switch v {
+	case "memory", "database", "none":
+		*r = RateLimitStore(v)
+	default:
+		return fmt.Errorf("unknown or unsupported rate limit store %s", v)
+	}
+	return nil
+}
+
+func (r *RateLimitStore) String() string {
+	return string(*r)
+}
+
+// Shared returns true if rate limits are shared by all instances
+// using the same database.
+func (r *RateLimitStore) Shared() bool {
+	return *r == "database"
+}
+
+// Disabled returns true if no rate limits are supposed to be applied.
+func (r *RateLimitStore) Disabled() bool {
+	return *r == "none"
+}
@@ -0,0 +1,33 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestRateLimitStore(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var r RateLimitStore
+		if err := r.Decode("database"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !r.Shared() {
+			t.Error("Expected database store to be shared")
+		}
+	})
+	t.Run("none", func(t *testing.T) {
+		var r RateLimitStore
+		if err := r.Decode("none"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !r.Disabled() || r.Shared() {
+			t.Error("Expected rate limiting to be disabled")
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var r RateLimitStore
+		if err := r.Decode("redis"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
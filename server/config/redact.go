@@ -0,0 +1,50 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Redacted is used in place of secret values.
+const Redacted = "[redacted]"
+
+// Redacted returns the configuration in the shape it is encoded to JSON,
+// replacing the values of all non-empty fields that are tagged as secret.
+func (c *Config) Redacted() (map[string]interface{}, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("config: error encoding configuration: %w", err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("config: error decoding configuration: %w", err)
+	}
+	redact(result, reflect.ValueOf(c).Elem())
+	return result, nil
+}
+
+func redact(encoded map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Tag.Get("secret") == "true" {
+			if !v.Field(i).IsZero() {
+				encoded[field.Name] = Redacted
+			}
+			continue
+		}
+		// scopes are defined using anonymous structs
+		if field.Type.Kind() == reflect.Struct && field.Type.Name() == "" {
+			if scope, ok := encoded[field.Name].(map[string]interface{}); ok {
+				redact(scope, v.Field(i))
+			}
+		}
+	}
+}
@@ -5,49 +5,111 @@ package config
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"time"
 )
 
+const (
+	day = time.Hour * 24
+	// MinRetention is the shortest supported retention period.
+	MinRetention = day
+	// MaxRetention is the longest supported retention period. Users are
+	// promised that their data is deleted after 6 months at the latest.
+	MaxRetention = day * 6 * 31
+)
+
+// retentionPresets are the retention periods the Auditorium offers matching
+// ranges for, ordered by their duration.
+var retentionPresets = []struct {
+	name      string
+	retention time.Duration
+}{
+	{"7days", day * 7},
+	{"30days", day * 30},
+	{"6weeks", day * 7 * 6},
+	{"12weeks", day * 7 * 12},
+	{"6months", MaxRetention},
+}
+
+var retentionRe = regexp.MustCompile(`^(\d+)\s*(d|days?|w|weeks?|months?)$`)
+
 // Retention defines a data retention period.
 type Retention struct {
 	configured string
 	retention  time.Duration
 }
 
-// Decode validates and assigns v.
+// Decode validates and assigns v. Values can either be given as a number of
+// days, weeks or months (e.g. 90days, 10weeks or 3months, with a month
+// counting as 31 days) or as a duration (e.g. 720h).
 func (r *Retention) Decode(v string) error {
-	switch v {
-	case "6months":
-		*r = Retention{
-			configured: v,
-			retention:  time.Hour * 24 * 6 * 31,
-		}
-	case "12weeks":
-		*r = Retention{
-			configured: v,
-			retention:  time.Hour * 24 * 7 * 12,
-		}
-	case "6weeks":
-		*r = Retention{
-			configured: v,
-			retention:  time.Hour * 24 * 7 * 6,
+	retention, err := parseRetention(v)
+	if err != nil {
+		return err
+	}
+	if retention < MinRetention || retention > MaxRetention {
+		return errRetentionOutOfBounds(v)
+	}
+	*r = Retention{
+		configured: v,
+		retention:  retention,
+	}
+	return nil
+}
+
+func errRetentionOutOfBounds(v string) error {
+	return fmt.Errorf("retention period %s is out of bounds, expected a value between %s and %s", v, MinRetention, MaxRetention)
+}
+
+func parseRetention(v string) (time.Duration, error) {
+	if match := retentionRe.FindStringSubmatch(v); match != nil {
+		// the pattern only matches digits, so parsing can only fail for
+		// numbers that are too large
+		count, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, errRetentionOutOfBounds(v)
 		}
-	case "30days":
-		*r = Retention{
-			configured: v,
-			retention:  time.Hour * 24 * 30,
+		unit := day
+		switch match[2][0] {
+		case 'w':
+			unit = day * 7
+		case 'm':
+			unit = day * 31
 		}
-	case "7days":
-		*r = Retention{
-			configured: v,
-			retention:  time.Hour * 24 * 7,
+		// counts are checked before multiplying as large values would
+		// overflow and might end up within bounds
+		if count > int(MaxRetention/unit) {
+			return 0, errRetentionOutOfBounds(v)
 		}
-	default:
-		return fmt.Errorf("unknown or unsupported retention period %s", v)
+		return time.Duration(count) * unit, nil
 	}
-	return nil
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("unknown or unsupported retention period %s", v)
+	}
+	return d, nil
 }
 
 func (r *Retention) String() string {
 	return r.configured
 }
+
+// Duration returns the retention period as a duration.
+func (r *Retention) Duration() time.Duration {
+	return r.retention
+}
+
+// Preset returns the name of the longest preset retention period that does
+// not exceed the configured one. Clients use it for deciding which ranges
+// to offer. Retention periods shorter than any preset map to the shortest
+// preset.
+func (r *Retention) Preset() string {
+	result := retentionPresets[0].name
+	for _, preset := range retentionPresets {
+		if preset.retention <= r.retention {
+			result = preset.name
+		}
+	}
+	return result
+}
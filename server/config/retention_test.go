@@ -0,0 +1,60 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	tests := []struct {
+		value            string
+		expectError      bool
+		expectedDuration time.Duration
+		expectedPreset   string
+	}{
+		{"6months", false, time.Hour * 24 * 186, "6months"},
+		{"12weeks", false, time.Hour * 24 * 84, "12weeks"},
+		{"6weeks", false, time.Hour * 24 * 42, "6weeks"},
+		{"30days", false, time.Hour * 24 * 30, "30days"},
+		{"7days", false, time.Hour * 24 * 7, "7days"},
+		{"90days", false, time.Hour * 24 * 90, "12weeks"},
+		{"3months", false, time.Hour * 24 * 93, "12weeks"},
+		{"14d", false, time.Hour * 24 * 14, "7days"},
+		{"1day", false, time.Hour * 24, "7days"},
+		{"2w", false, time.Hour * 24 * 14, "7days"},
+		{"720h", false, time.Hour * 720, "30days"},
+		{"12h", true, 0, ""},
+		{"7months", true, 0, ""},
+		{"0days", true, 0, ""},
+		{"-720h", true, 0, ""},
+		{"forever", true, 0, ""},
+		// values that overflow when converted to a duration
+		{"281474976710686days", true, 0, ""},
+		{"99999999999999999999weeks", true, 0, ""},
+		{"", true, 0, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			var r Retention
+			err := r.Decode(test.value)
+			if test.expectError != (err != nil) {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if r.String() != test.value {
+				t.Errorf("Unexpected value %v", r.String())
+			}
+			if r.Duration() != test.expectedDuration {
+				t.Errorf("Expected duration %v, got %v", test.expectedDuration, r.Duration())
+			}
+			if r.Preset() != test.expectedPreset {
+				t.Errorf("Expected preset %v, got %v", test.expectedPreset, r.Preset())
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StartTLSPolicy defines whether STARTTLS is used when talking to a
+// SMTP server.
+type StartTLSPolicy string
+
+// Decode validates and assigns v.
+func (s *StartTLSPolicy) Decode(v string) error {
+	switch v := strings.ToLower(v); v {
+	case "mandatory", "opportunistic", "none":
+		*s = StartTLSPolicy(v)
+	default:
+		return fmt.Errorf("unknown or unsupported STARTTLS policy %s", v)
+	}
+	return nil
+}
+
+func (s *StartTLSPolicy) String() string {
+	return string(*s)
+}
@@ -0,0 +1,24 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestStartTLSPolicy(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var s StartTLSPolicy
+		if err := s.Decode("Opportunistic"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if s.String() != "opportunistic" {
+			t.Errorf("Unexpected value %v", s.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var s StartTLSPolicy
+		if err := s.Decode("sometimes"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
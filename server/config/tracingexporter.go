@@ -0,0 +1,28 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TracingExporter defines where traces are sent to. An empty value
+// disables tracing.
+type TracingExporter string
+
+// Decode validates and assigns v.
+func (t *TracingExporter) Decode(v string) error {
+	switch v := strings.ToLower(v); v {
+	case "", "otlp", "stdout":
+		*t = TracingExporter(v)
+	default:
+		return fmt.Errorf("unknown or unsupported tracing exporter %s", v)
+	}
+	return nil
+}
+
+func (t *TracingExporter) String() string {
+	return string(*t)
+}
@@ -0,0 +1,24 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestTracingExporter(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var e TracingExporter
+		if err := e.Decode("OTLP"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if e.String() != "otlp" {
+			t.Errorf("Unexpected value %v", e.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var e TracingExporter
+		if err := e.Decode("jaeger"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TrustedProxies is a list of networks that are allowed to pass information
+// about the original request, like the client address or the protocol used,
+// in forwarding headers or using the PROXY protocol.
+type TrustedProxies []*net.IPNet
+
+// Decode parses a comma separated list of CIDR ranges or single IP
+// addresses and assigns the result to t.
+func (t *TrustedProxies) Decode(v string) error {
+	var result TrustedProxies
+	for _, value := range strings.Split(v, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return fmt.Errorf("unable to parse trusted proxy address %s", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse trusted proxy range %s: %w", value, err)
+		}
+		result = append(result, network)
+	}
+	*t = result
+	return nil
+}
+
+func (t *TrustedProxies) String() string {
+	var values []string
+	for _, network := range *t {
+		values = append(values, network.String())
+	}
+	return strings.Join(values, ",")
+}
+
+// Strings returns the networks in t in CIDR notation.
+func (t *TrustedProxies) Strings() []string {
+	values := []string{}
+	for _, network := range *t {
+		values = append(values, network.String())
+	}
+	return values
+}
+
+// Contains checks whether the given address is part of any of
+// the trusted networks. addr may contain a port.
+func (t *TrustedProxies) Contains(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range *t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestTrustedProxies(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var p TrustedProxies
+		if err := p.Decode("10.0.0.0/8, 192.168.1.1,::1"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if s := p.String(); s != "10.0.0.0/8,192.168.1.1/32,::1/128" {
+			t.Errorf("Unexpected string value %s", s)
+		}
+		for _, addr := range []string{"10.1.2.3", "10.1.2.3:8080", "192.168.1.1", "[::1]:443"} {
+			if !p.Contains(addr) {
+				t.Errorf("Expected %s to be trusted", addr)
+			}
+		}
+		for _, addr := range []string{"192.168.1.2", "", "not-an-ip"} {
+			if p.Contains(addr) {
+				t.Errorf("Expected %s not to be trusted", addr)
+			}
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		var p TrustedProxies
+		if err := p.Decode(""); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(p.Strings()) != 0 || p.Contains("127.0.0.1") {
+			t.Errorf("Expected no proxies to be trusted, got %v", p)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var p TrustedProxies
+		if err := p.Decode("10.0.0.0/33"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+		if err := p.Decode("proxy.local"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -5,6 +5,7 @@ package keys
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
@@ -12,6 +13,8 @@ import (
 	"runtime"
 	"strconv"
 
+	"github.com/offen/offen/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/argon2"
 )
 
@@ -30,11 +33,15 @@ const (
 
 // DeriveKey wraps package argon2 in order to derive a symmetric key from the
 // given value (most likely a password) and the given salt.
-func DeriveKey(value, versionedSalt string) ([]byte, error) {
+func DeriveKey(ctx context.Context, value, versionedSalt string) (key []byte, err error) {
+	_, span := tracing.Start(ctx, "keys.DeriveKey")
+	defer func() { tracing.End(span, err) }()
+
 	salt, saltErr := unmarshalVersionedCipher(versionedSalt)
 	if saltErr != nil {
 		return nil, fmt.Errorf("keys: error decoding salt into bytes: %w", saltErr)
 	}
+	span.SetAttributes(attribute.Int("keys.algo_version", salt.algoVersion))
 	switch salt.algoVersion {
 	case passwordAlgoArgon2:
 		key := defaultArgon2Hash([]byte(value), salt.cipher, DefaultEncryptionKeySize)
@@ -61,7 +68,10 @@ func NewSalt(len int) (*VersionedCipher, error) {
 }
 
 // HashString hashes the given string using argon2 using the latest configuration
-func HashString(s string) (*VersionedCipher, error) {
+func HashString(ctx context.Context, s string) (cipher *VersionedCipher, err error) {
+	_, span := tracing.Start(ctx, "keys.HashString")
+	defer func() { tracing.End(span, err) }()
+
 	if s == "" {
 		return nil, errors.New("keys: cannot hash an empty string")
 	}
@@ -74,7 +84,10 @@ func HashString(s string) (*VersionedCipher, error) {
 }
 
 // CompareString compares a string with a stored hash
-func CompareString(s, versionedCipher string) error {
+func CompareString(ctx context.Context, s, versionedCipher string) (err error) {
+	_, span := tracing.Start(ctx, "keys.CompareString")
+	defer func() { tracing.End(span, err) }()
+
 	if versionedCipher == "" {
 		return errors.New("keys: cannot compare against an empty cipher")
 	}
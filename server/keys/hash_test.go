@@ -3,17 +3,20 @@
 
 package keys
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestHashString(t *testing.T) {
-	hash, hashErr := HashString("s3cr3t")
+	hash, hashErr := HashString(context.Background(), "s3cr3t")
 	if hashErr != nil {
 		t.Fatalf("Unexpected error %v", hashErr)
 	}
-	if err := CompareString("s3cr3t", hash.Marshal()); err != nil {
+	if err := CompareString(context.Background(), "s3cr3t", hash.Marshal()); err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
-	if err := CompareString("other", hash.Marshal()); err == nil {
+	if err := CompareString(context.Background(), "other", hash.Marshal()); err == nil {
 		t.Errorf("Comparison unexpectedly passed for wrong password")
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"fmt"
+	"strings"
 )
 
 // GenerateRandomBytes generates a slice of bytes of the given size that is
@@ -67,3 +68,32 @@ func DecryptWith(key []byte, s string) ([]byte, error) {
 	}
 	return aesgcm.Open(nil, v.nonce, v.cipher, nil)
 }
+
+// aesGCMNonceSize and aesGCMTagSize are the sizes used by the Go standard
+// library as well as by clients encrypting data in the browser.
+const (
+	aesGCMNonceSize = 12
+	aesGCMTagSize   = 16
+)
+
+// ValidateSymmetricCipher checks whether the given string is a well-formed
+// versioned cipher as created by symmetric encryption, without decrypting it.
+func ValidateSymmetricCipher(s string) error {
+	v, err := unmarshalVersionedCipher(s)
+	if err != nil {
+		return err
+	}
+	if v.algoVersion != aesGCMAlgo {
+		return fmt.Errorf("keys: unsupported algorithm version %d", v.algoVersion)
+	}
+	if chunks := strings.Split(s, " "); len(chunks) != 3 {
+		return fmt.Errorf("keys: expected cipher and nonce, got %d chunks", len(chunks)-1)
+	}
+	if len(v.nonce) != aesGCMNonceSize {
+		return fmt.Errorf("keys: expected nonce of %d bytes, got %d", aesGCMNonceSize, len(v.nonce))
+	}
+	if len(v.cipher) < aesGCMTagSize {
+		return fmt.Errorf("keys: expected cipher of at least %d bytes, got %d", aesGCMTagSize, len(v.cipher))
+	}
+	return nil
+}
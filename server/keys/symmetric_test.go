@@ -4,6 +4,7 @@
 package keys
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -22,7 +23,7 @@ func TestSymmetricEncryption(t *testing.T) {
 		{
 			"derived",
 			func() ([]byte, error) {
-				return DeriveKey("mypassword", "{1,} XqiWf9CdPpmT3bu0aHkzjQ==")
+				return DeriveKey(context.Background(), "mypassword", "{1,} XqiWf9CdPpmT3bu0aHkzjQ==")
 			},
 		},
 	}
@@ -47,3 +48,33 @@ func TestSymmetricEncryption(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSymmetricCipher(t *testing.T) {
+	key, _ := GenerateRandomBytes(DefaultEncryptionKeySize)
+	valid, _ := EncryptWith(key, []byte("some value"))
+
+	tests := []struct {
+		name        string
+		cipher      string
+		expectError bool
+	}{
+		{"ok", valid.Marshal(), false},
+		{"from browser", "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M", false},
+		{"empty", "", true},
+		{"garbage", "o hai!", true},
+		{"asymmetric algo", "{2,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M", true},
+		{"missing nonce", "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU=", true},
+		{"bad nonce", "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= YWJj", true},
+		{"bad encoding", "{1,} Ae2MwPi40sKVmCsSDhlh*** O1RbpLcBVqHDVu+M", true},
+		{"short cipher", "{1,} YWJj O1RbpLcBVqHDVu+M", true},
+		{"trailing data", "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M YWJj", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSymmetricCipher(test.cipher)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
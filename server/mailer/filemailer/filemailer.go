@@ -0,0 +1,199 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package filemailer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/mailer"
+	"github.com/sirupsen/logrus"
+	"github.com/wneessen/go-mail"
+)
+
+const extension = ".eml"
+
+var messageIDRe = regexp.MustCompile(`^[0-9A-Za-z.\-]+$`)
+
+// Config is a function that adds a configuration option to the mailer
+type Config func(*fileMailer)
+
+// WithLogger sets the logger used for reporting messages that cannot be read.
+func WithLogger(logger *logrus.Logger) Config {
+	return func(f *fileMailer) {
+		f.logger = logger
+	}
+}
+
+// New creates a new Mailer that stores each message as an .eml file in the
+// given directory instead of sending actual email. Stored messages can be
+// read back using the mailer.Mailbox interface. It is supposed to be used
+// in development only.
+func New(directory string, configs ...Config) (mailer.Mailer, error) {
+	f := &fileMailer{directory: directory, logger: logrus.New()}
+	for _, config := range configs {
+		config(f)
+	}
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("filemailer: error creating mailbox directory: %w", err)
+	}
+	return f, nil
+}
+
+type fileMailer struct {
+	directory string
+	logger    *logrus.Logger
+}
+
+func (f *fileMailer) Send(from, to, subject, body string) error {
+	msg := mail.NewMsg()
+	if err := msg.From(from); err != nil {
+		return fmt.Errorf("failed to set mail FROM: %w", err)
+	}
+	if err := msg.To(to); err != nil {
+		return fmt.Errorf("failed to set mail TO: %w", err)
+	}
+	msg.Subject(subject)
+	msg.SetDate()
+	msg.SetBodyString(mail.TypeTextPlain, body)
+	msg.SetUserAgent("Offen Fair Web Analytics")
+
+	id, err := newMessageID()
+	if err != nil {
+		return fmt.Errorf("filemailer: error creating message id: %w", err)
+	}
+
+	// the message is written to a temporary file first so readers never
+	// see partially written messages
+	tmp, err := os.CreateTemp(f.directory, ".pending-*")
+	if err != nil {
+		return fmt.Errorf("filemailer: error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := msg.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("filemailer: error writing message: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("filemailer: error closing temporary file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(f.directory, id+extension)); err != nil {
+		return fmt.Errorf("filemailer: error storing message: %w", err)
+	}
+	return nil
+}
+
+// Messages returns all stored messages, newest first. Files that cannot be
+// read or parsed are skipped, so a single broken file does not hide all
+// other messages.
+func (f *fileMailer) Messages() ([]mailer.Message, error) {
+	entries, err := os.ReadDir(f.directory)
+	if err != nil {
+		return nil, fmt.Errorf("filemailer: error reading mailbox directory: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != extension {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, extension))
+	}
+	// ids start with a timestamp, so sorting them also sorts by date
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	result := []mailer.Message{}
+	for _, id := range ids {
+		msg, err := f.Message(id)
+		if err != nil {
+			f.logger.WithError(err).WithField("message", id).Warn("Skipping message that cannot be read from mailbox")
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+// Message returns the message with the given id.
+func (f *fileMailer) Message(id string) (mailer.Message, error) {
+	if !messageIDRe.MatchString(id) {
+		return mailer.Message{}, mailer.ErrUnknownMessage
+	}
+	file, err := os.Open(filepath.Join(f.directory, id+extension))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return mailer.Message{}, mailer.ErrUnknownMessage
+		}
+		return mailer.Message{}, fmt.Errorf("filemailer: error opening message %s: %w", id, err)
+	}
+	defer file.Close()
+
+	msg, err := parseMessage(file)
+	if err != nil {
+		return mailer.Message{}, fmt.Errorf("filemailer: error parsing message %s: %w", id, err)
+	}
+	msg.ID = id
+	return msg, nil
+}
+
+func parseMessage(r io.Reader) (mailer.Message, error) {
+	raw, err := netmail.ReadMessage(r)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	decoder := &mime.WordDecoder{}
+	decodeHeader := func(key string) string {
+		value := raw.Header.Get(key)
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+
+	var body io.Reader = raw.Body
+	switch strings.ToLower(raw.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return mailer.Message{}, fmt.Errorf("error reading message body: %w", err)
+	}
+
+	date, _ := raw.Header.Date()
+	return mailer.Message{
+		From:    decodeHeader("From"),
+		To:      decodeHeader("To"),
+		Subject: decodeHeader("Subject"),
+		Date:    date,
+		Body:    strings.ReplaceAll(string(content), "\r\n", "\n"),
+	}, nil
+}
+
+func newMessageID() (string, error) {
+	suffix, err := keys.GenerateRandomBytes(4)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"%s-%s",
+		time.Now().UTC().Format("20060102T150405.000000000"),
+		hex.EncodeToString(suffix),
+	), nil
+}
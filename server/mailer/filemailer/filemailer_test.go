@@ -0,0 +1,112 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package filemailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/offen/offen/server/mailer"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestFileMailer(t *testing.T) {
+	m, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := m.Send("develop@offen.dev", "a@offen.dev", "First", "Hello"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := m.Send("develop@offen.dev", "b@offen.dev", "Ümlaut", "Reset here: https://www.offen.dev/reset/?token=a=b"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	mailbox := m.(mailer.Mailbox)
+	messages, err := mailbox.Messages()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Unexpected number of messages %d", len(messages))
+	}
+
+	latest := messages[0]
+	if latest.Subject != "Ümlaut" {
+		t.Errorf("Unexpected subject %v", latest.Subject)
+	}
+	if latest.To != "<b@offen.dev>" {
+		t.Errorf("Unexpected recipient %v", latest.To)
+	}
+	if latest.Body != "Reset here: https://www.offen.dev/reset/?token=a=b" {
+		t.Errorf("Unexpected body %v", latest.Body)
+	}
+	if latest.Date.IsZero() {
+		t.Error("Expected date to be set")
+	}
+
+	single, err := mailbox.Message(latest.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if single.Subject != latest.Subject {
+		t.Errorf("Unexpected message %v", single)
+	}
+
+	for _, id := range []string{"unknown", "../../etc/passwd"} {
+		if _, err := mailbox.Message(id); !errors.Is(err, mailer.ErrUnknownMessage) {
+			t.Errorf("Unexpected error for %s: %v", id, err)
+		}
+	}
+}
+
+func TestFileMailer_Messages(t *testing.T) {
+	directory := t.TempDir()
+	logger, hook := test.NewNullLogger()
+	m, err := New(directory, WithLogger(logger))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := m.Send("develop@offen.dev", "a@offen.dev", "First", "Hello"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for name, content := range map[string]string{
+		"20000101T000000.000000000-corrupt.eml": "not a message",
+		"30000101T000000.000000000-corrupt.eml": "",
+	} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	// directories are not considered messages and are not reported
+	if err := os.Mkdir(filepath.Join(directory, "40000101T000000.000000000-directory.eml"), 0755); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := m.Send("develop@offen.dev", "b@offen.dev", "Second", "Hello"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	messages, err := m.(mailer.Mailbox).Messages()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Unexpected number of messages %d", len(messages))
+	}
+	if messages[0].Subject != "Second" || messages[1].Subject != "First" {
+		t.Errorf("Unexpected messages %v", messages)
+	}
+
+	if len(hook.Entries) != 2 {
+		t.Fatalf("Unexpected number of log entries %d", len(hook.Entries))
+	}
+	for _, entry := range hook.Entries {
+		if entry.Level != logrus.WarnLevel {
+			t.Errorf("Unexpected log level %v", entry.Level)
+		}
+	}
+}
@@ -3,7 +3,61 @@
 
 package mailer
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
 // Mailer is used to send transactional emails
 type Mailer interface {
 	Send(from, to, subject, body string) error
 }
+
+// Prober is implemented by mailers that can report on the connection
+// parameters they negotiated when delivering a message.
+type Prober interface {
+	Probe(from, to, subject, body string) (ProbeResult, error)
+}
+
+// Pinger is implemented by mailers that can check whether they are able
+// to deliver messages without actually sending one.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ProbeResult describes how a probe message has been delivered.
+type ProbeResult struct {
+	Server         string     `json:"server"`
+	ImplicitTLS    bool       `json:"implicitTLS"`
+	StartTLS       bool       `json:"startTLS"`
+	StartTLSPolicy string     `json:"startTLSPolicy"`
+	TLSVersion     string     `json:"tlsVersion,omitempty"`
+	CipherSuite    string     `json:"cipherSuite,omitempty"`
+	ServerName     string     `json:"serverName,omitempty"`
+	CertificateCN  string     `json:"certificateCommonName,omitempty"`
+	CertificateEnd *time.Time `json:"certificateNotAfter,omitempty"`
+	AuthType       string     `json:"authType"`
+	Duration       string     `json:"duration"`
+}
+
+// ErrUnknownMessage is returned by a Mailbox when asked for a message that
+// does not exist.
+var ErrUnknownMessage = errors.New("mailer: unknown message")
+
+// Mailbox is implemented by mailers that keep the messages they have sent
+// so they can be read back. This is supposed to be used in development only.
+type Mailbox interface {
+	Messages() ([]Message, error)
+	Message(id string) (Message, error)
+}
+
+// Message is a single message that has been stored in a Mailbox.
+type Message struct {
+	ID      string    `json:"id"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Date    time.Time `json:"date"`
+	Body    string    `json:"body"`
+}
@@ -5,61 +5,410 @@ package smtpmailer
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/wneessen/go-mail"
 
 	"github.com/offen/offen/server/mailer"
 )
 
+var errPoolClosed = errors.New("smtpmailer: mailer has already been closed")
+
+const (
+	// DefaultPoolSize is the number of connections kept open in case no
+	// pool size is configured.
+	DefaultPoolSize = 2
+	// DefaultIdleTimeout is the duration after which unused connections are
+	// closed in case no idle timeout is configured.
+	DefaultIdleTimeout = time.Second * 30
+)
+
+// Config is a function that adds a configuration option to the mailer
+type Config func(*smtpMailer)
+
+// WithImplicitTLS makes the mailer connect using TLS right away instead of
+// upgrading a plaintext connection using STARTTLS. This is what SMTP servers
+// listening on port 465 expect.
+func WithImplicitTLS(implicitTLS bool) Config {
+	return func(s *smtpMailer) {
+		s.implicitTLS = implicitTLS
+	}
+}
+
+// WithStartTLSPolicy defines whether STARTTLS is required ("mandatory"),
+// used if offered by the server ("opportunistic") or never used ("none").
+// The policy is ignored when implicit TLS is used.
+func WithStartTLSPolicy(policy string) Config {
+	return func(s *smtpMailer) {
+		s.startTLSPolicy = policy
+	}
+}
+
+// WithRootCA makes the mailer trust the PEM encoded certificates in the
+// given file in addition to the system's default roots.
+func WithRootCA(file string) Config {
+	return func(s *smtpMailer) {
+		s.rootCA = file
+	}
+}
+
+// WithTimeout sets the timeout used for dialing and for each command sent
+// to the SMTP server.
+func WithTimeout(timeout time.Duration) Config {
+	return func(s *smtpMailer) {
+		s.timeout = timeout
+	}
+}
+
+// WithPoolSize sets the maximum number of connections the mailer keeps open.
+func WithPoolSize(size int) Config {
+	return func(s *smtpMailer) {
+		s.poolSize = size
+	}
+}
+
+// WithIdleTimeout sets the duration after which an unused connection is
+// closed instead of being reused.
+func WithIdleTimeout(timeout time.Duration) Config {
+	return func(s *smtpMailer) {
+		s.idleTimeout = timeout
+	}
+}
+
 // New creates a new Mailer that sends email using the given SMTP configuration
-func New(endpoint, user, password, authtype string, port int) (mailer.Mailer, error) {
-	c, err := mail.NewClient(endpoint, mail.WithPort(port), mail.WithUsername(user),
-		mail.WithPassword(password))
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize SMTP client: %w", err)
+func New(endpoint, user, password, authtype string, port int, configs ...Config) (mailer.Mailer, error) {
+	s := &smtpMailer{
+		endpoint:       endpoint,
+		user:           user,
+		password:       password,
+		port:           port,
+		startTLSPolicy: "mandatory",
+		timeout:        mail.DefaultTimeout,
+		poolSize:       DefaultPoolSize,
+		idleTimeout:    DefaultIdleTimeout,
+	}
+	for _, config := range configs {
+		config(s)
 	}
 
 	// Set SMTP Auth type
 	switch strings.ToLower(authtype) {
 	case "login":
-		c.SetSMTPAuth(mail.SMTPAuthLogin)
+		s.authtype = mail.SMTPAuthLogin
 	case "plain":
-		c.SetSMTPAuth(mail.SMTPAuthPlain)
+		s.authtype = mail.SMTPAuthPlain
 	case "cram-md5":
-		c.SetSMTPAuth(mail.SMTPAuthCramMD5)
+		s.authtype = mail.SMTPAuthCramMD5
+	case "xoauth2":
+		s.authtype = mail.SMTPAuthXOAUTH2
 	case "noauth":
 	default:
 		return nil, fmt.Errorf("configured SMTP auth type %s is not supported", authtype)
 	}
 
-	return &smtpMailer{c}, nil
+	switch s.startTLSPolicy {
+	case "mandatory":
+		s.tlsPolicy = mail.TLSMandatory
+	case "opportunistic":
+		s.tlsPolicy = mail.TLSOpportunistic
+	case "none":
+		s.tlsPolicy = mail.NoTLS
+	default:
+		return nil, fmt.Errorf("configured STARTTLS policy %s is not supported", s.startTLSPolicy)
+	}
+
+	if s.poolSize < 1 {
+		return nil, fmt.Errorf("invalid SMTP connection pool size %d", s.poolSize)
+	}
+
+	s.tlsConfig = &tls.Config{
+		ServerName: endpoint,
+		MinVersion: mail.DefaultTLSMinVersion,
+	}
+	if s.rootCA != "" {
+		pem, err := os.ReadFile(s.rootCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SMTP root CA file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if ok := roots.AppendCertsFromPEM(pem); !ok {
+			return nil, fmt.Errorf("no valid certificates found in SMTP root CA file %s", s.rootCA)
+		}
+		s.tlsConfig.RootCAs = roots
+	}
+
+	s.closed = make(chan struct{})
+	s.pool = make(chan *conn, s.poolSize)
+	for i := 0; i < s.poolSize; i++ {
+		c, err := s.newConn()
+		if err != nil {
+			return nil, err
+		}
+		s.pool <- c
+	}
+	return s, nil
 }
 
 type smtpMailer struct {
-	*mail.Client
+	endpoint       string
+	user           string
+	password       string
+	authtype       mail.SMTPAuthType
+	port           int
+	implicitTLS    bool
+	startTLSPolicy string
+	tlsPolicy      mail.TLSPolicy
+	rootCA         string
+	tlsConfig      *tls.Config
+	timeout        time.Duration
+	poolSize       int
+	idleTimeout    time.Duration
+
+	pool      chan *conn
+	closeOnce sync.Once
+	closed    chan struct{}
 }
 
-func (s *smtpMailer) Send(from, to, subject, body string) error {
+// conn is a single pooled connection to the SMTP server. It is only ever
+// used by a single caller at a time.
+type conn struct {
+	client    *mail.Client
+	raw       net.Conn
+	tlsState  *tls.ConnectionState
+	connected bool
+	lastUsed  time.Time
+}
+
+func (s *smtpMailer) newConn() (*conn, error) {
+	c := &conn{}
+	tlsConfig := s.tlsConfig.Clone()
+	// VerifyConnection is called for both implicit TLS and STARTTLS, so it
+	// is used to learn about the parameters that have been negotiated.
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		c.tlsState = &state
+		return nil
+	}
+
+	opts := []mail.Option{
+		mail.WithPort(s.port),
+		mail.WithTimeout(s.timeout),
+		mail.WithTLSPolicy(s.tlsPolicy),
+		mail.WithTLSConfig(tlsConfig),
+		mail.WithDialContextFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := &net.Dialer{}
+			var raw net.Conn
+			var err error
+			if s.implicitTLS {
+				raw, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, network, address)
+			} else {
+				raw, err = dialer.DialContext(ctx, network, address)
+			}
+			c.raw = raw
+			return raw, err
+		}),
+	}
+	if s.implicitTLS {
+		// this option only skips STARTTLS as dialing is handled by the
+		// custom dial func
+		opts = append(opts, mail.WithSSL())
+	}
+	if s.authtype != "" {
+		opts = append(
+			opts,
+			mail.WithSMTPAuth(s.authtype),
+			mail.WithUsername(s.user),
+			mail.WithPassword(s.password),
+		)
+	}
+
+	client, err := mail.NewClient(s.endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize SMTP client: %w", err)
+	}
+	c.client = client
+	return c, nil
+}
+
+// ensure makes sure c is connected to the server and ready to accept a new
+// message, reusing an existing connection where possible.
+func (c *conn) ensure(ctx context.Context, idleTimeout time.Duration) error {
+	if c.connected {
+		if time.Since(c.lastUsed) < idleTimeout {
+			if err := c.client.Reset(); err == nil {
+				return nil
+			}
+		}
+		c.drop()
+	}
+	c.tlsState = nil
+	if err := c.client.DialWithContext(ctx); err != nil {
+		c.drop()
+		return err
+	}
+	c.connected = true
+	return nil
+}
+
+// drop closes the connection, making sure the underlying network connection
+// is released even if the server does not respond to QUIT anymore.
+func (c *conn) drop() {
+	if c.raw != nil {
+		_ = c.client.Close()
+		_ = c.raw.Close()
+		c.raw = nil
+	}
+	c.connected = false
+}
+
+func (s *smtpMailer) acquire() (*conn, error) {
+	select {
+	case <-s.closed:
+		return nil, errPoolClosed
+	default:
+	}
+	select {
+	case c := <-s.pool:
+		return c, nil
+	case <-s.closed:
+		return nil, errPoolClosed
+	case <-time.After(s.timeout):
+		return nil, errors.New("smtpmailer: timed out waiting for an idle connection")
+	}
+}
+
+func (s *smtpMailer) release(c *conn) {
+	select {
+	case <-s.closed:
+		c.drop()
+	default:
+		s.pool <- c
+	}
+}
+
+func newMessage(from, to, subject, body string) (*mail.Msg, error) {
 	msg := mail.NewMsg()
 	if err := msg.From(from); err != nil {
-		return fmt.Errorf("failed to set mail FROM: %w", err)
+		return nil, fmt.Errorf("failed to set mail FROM: %w", err)
 	}
 	if err := msg.To(to); err != nil {
-		return fmt.Errorf("failed to set mail TO: %w", err)
+		return nil, fmt.Errorf("failed to set mail TO: %w", err)
 	}
 	msg.Subject(subject)
 	msg.SetBodyString(mail.TypeTextPlain, body)
 	msg.SetUserAgent("Offen Fair Web Analytics")
+	return msg, nil
+}
+
+func (s *smtpMailer) Send(from, to, subject, body string) error {
+	msg, err := newMessage(from, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer s.release(c)
 
-	ctx := context.Background()
-	if err := s.Client.DialWithContext(ctx); err != nil {
+	if err := c.ensure(context.Background(), s.idleTimeout); err != nil {
 		return fmt.Errorf("failed to dial SMTP client: %w", err)
 	}
-	if err := s.Client.Send(msg); err != nil {
+	if err := c.client.Send(msg); err != nil {
+		// the connection is in an unknown state now, so it's safer to
+		// start over with a new one next time
+		c.drop()
 		return fmt.Errorf("failed to send message via SMTP: %w", err)
 	}
-	_ = s.Client.Close()
+	c.lastUsed = time.Now()
 	return nil
 }
+
+// Ping makes sure a pooled connection to the SMTP server is established,
+// which means the server is reachable and accepts the configured credentials.
+func (s *smtpMailer) Ping(ctx context.Context) error {
+	c, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer s.release(c)
+
+	if err := c.ensure(ctx, s.idleTimeout); err != nil {
+		return fmt.Errorf("failed to dial SMTP client: %w", err)
+	}
+	c.lastUsed = time.Now()
+	return nil
+}
+
+// Probe sends a message using a dedicated connection and reports on the
+// parameters that have been negotiated with the server.
+func (s *smtpMailer) Probe(from, to, subject, body string) (mailer.ProbeResult, error) {
+	result := mailer.ProbeResult{
+		Server:         net.JoinHostPort(s.endpoint, fmt.Sprintf("%d", s.port)),
+		ImplicitTLS:    s.implicitTLS,
+		StartTLSPolicy: s.startTLSPolicy,
+		AuthType:       string(s.authtype),
+	}
+	if result.AuthType == "" {
+		result.AuthType = "NOAUTH"
+	}
+
+	msg, err := newMessage(from, to, subject, body)
+	if err != nil {
+		return result, err
+	}
+	c, err := s.newConn()
+	if err != nil {
+		return result, err
+	}
+	defer c.drop()
+
+	start := time.Now()
+	if err := c.ensure(context.Background(), s.idleTimeout); err != nil {
+		return result, fmt.Errorf("failed to dial SMTP client: %w", err)
+	}
+	if state := c.tlsState; state != nil {
+		result.StartTLS = !s.implicitTLS
+		result.TLSVersion = tls.VersionName(state.Version)
+		result.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		result.ServerName = state.ServerName
+		if len(state.PeerCertificates) != 0 {
+			leaf := state.PeerCertificates[0]
+			result.CertificateCN = leaf.Subject.CommonName
+			result.CertificateEnd = &leaf.NotAfter
+		}
+	}
+	if err := c.client.Send(msg); err != nil {
+		return result, fmt.Errorf("failed to send message via SMTP: %w", err)
+	}
+	result.Duration = time.Since(start).String()
+	return result, nil
+}
+
+// Close closes all idle connections and stops the mailer from accepting
+// further messages. Connections that are currently in use are closed as soon
+// as they are released.
+func (s *smtpMailer) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	for {
+		select {
+		case c := <-s.pool:
+			c.drop()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,505 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package smtpmailer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/mailer"
+)
+
+// fakeServer is a minimal SMTP server that accepts any message and records
+// what it has been sent.
+type fakeServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	startTLS    bool
+
+	mu          sync.Mutex
+	connections int
+	quits       int
+	auth        []string
+	messages    []string
+}
+
+func newFakeServer(t *testing.T, implicitTLS, startTLS bool, cert tls.Certificate) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	s := &fakeServer{
+		listener:    listener,
+		tlsConfig:   &tls.Config{Certificates: []tls.Certificate{cert}},
+		implicitTLS: implicitTLS,
+		startTLS:    startTLS,
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.connections++
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeServer) stats() (connections, quits int, auth, messages []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections, s.quits, append([]string(nil), s.auth...), append([]string(nil), s.messages...)
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	encrypted := s.implicitTLS
+	if encrypted {
+		c = tls.Server(c, s.tlsConfig)
+	}
+	text := textproto.NewConn(c)
+	reply := func(lines ...string) error {
+		return text.PrintfLine("%s", strings.Join(lines, "\r\n"))
+	}
+	if err := reply("220 fake ESMTP"); err != nil {
+		return
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			lines := []string{"250-fake", "250-8BITMIME"}
+			if s.startTLS && !encrypted {
+				lines = append(lines, "250-STARTTLS")
+			}
+			err = reply(append(lines, "250 AUTH PLAIN XOAUTH2")...)
+		case "STARTTLS":
+			if !s.startTLS || encrypted {
+				err = reply("502 not supported")
+				break
+			}
+			if err := reply("220 ready"); err != nil {
+				return
+			}
+			tlsConn := tls.Server(c, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			c, encrypted = tlsConn, true
+			text = textproto.NewConn(c)
+		case "AUTH":
+			_, initial, _ := strings.Cut(arg, " ")
+			credentials, decodeErr := base64.StdEncoding.DecodeString(initial)
+			if decodeErr != nil {
+				err = reply("501 bad encoding")
+				break
+			}
+			s.mu.Lock()
+			s.auth = append(s.auth, string(credentials))
+			s.mu.Unlock()
+			if strings.Contains(string(credentials), "wrong") {
+				err = reply("535 authentication failed")
+				break
+			}
+			err = reply("235 ok")
+		case "DATA":
+			if err := reply("354 go ahead"); err != nil {
+				return
+			}
+			data, readErr := text.ReadDotBytes()
+			if readErr != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			err = reply("250 queued")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			err = reply("250 ok")
+		case "QUIT":
+			s.mu.Lock()
+			s.quits++
+			s.mu.Unlock()
+			_ = reply("221 bye")
+			return
+		default:
+			err = reply("502 unknown command")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// createCertificate creates a self-signed certificate that is valid for
+// 127.0.0.1 and writes it to a PEM file that can be used as a root CA.
+func createCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake-smtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, file
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		authtype    string
+		configs     []Config
+		expectError bool
+	}{
+		{"defaults", "plain", nil, false},
+		{"noauth", "noauth", nil, false},
+		{"bad authtype", "magic", nil, true},
+		{"bad policy", "plain", []Config{WithStartTLSPolicy("sometimes")}, true},
+		{"bad pool size", "plain", []Config{WithPoolSize(0)}, true},
+		{"missing root ca", "plain", []Config{WithRootCA(filepath.Join(t.TempDir(), "missing.pem"))}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := New("127.0.0.1", "user", "pass", test.authtype, 25, test.configs...)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if err != nil {
+				return
+			}
+			s := m.(*smtpMailer)
+			if s.poolSize != DefaultPoolSize || s.idleTimeout != DefaultIdleTimeout {
+				t.Errorf("Unexpected defaults %d %v", s.poolSize, s.idleTimeout)
+			}
+			if len(s.pool) != DefaultPoolSize {
+				t.Errorf("Expected %d pooled connections, got %d", DefaultPoolSize, len(s.pool))
+			}
+		})
+	}
+}
+
+func TestSMTPMailer_Connection(t *testing.T) {
+	cert, rootCA := createCertificate(t)
+	tests := []struct {
+		name           string
+		implicitTLS    bool
+		startTLS       bool
+		authtype       string
+		password       string
+		configs        []Config
+		expectError    bool
+		expectAuth     string
+		expectStartTLS bool
+		expectTLS      bool
+	}{
+		{
+			"starttls mandatory",
+			false, true,
+			"plain", "pass",
+			[]Config{WithRootCA(rootCA)},
+			false,
+			"\x00user\x00pass",
+			true, true,
+		},
+		{
+			"starttls mandatory not offered",
+			false, false,
+			"plain", "pass",
+			[]Config{WithRootCA(rootCA)},
+			true,
+			"",
+			false, false,
+		},
+		{
+			"starttls opportunistic offered",
+			false, true,
+			"plain", "pass",
+			[]Config{WithRootCA(rootCA), WithStartTLSPolicy("opportunistic")},
+			false,
+			"\x00user\x00pass",
+			true, true,
+		},
+		{
+			"starttls opportunistic not offered",
+			false, false,
+			"plain", "pass",
+			[]Config{WithStartTLSPolicy("opportunistic")},
+			false,
+			"\x00user\x00pass",
+			false, false,
+		},
+		{
+			"starttls none",
+			false, true,
+			"noauth", "",
+			[]Config{WithStartTLSPolicy("none")},
+			false,
+			"",
+			false, false,
+		},
+		{
+			"starttls untrusted certificate",
+			false, true,
+			"plain", "pass",
+			nil,
+			true,
+			"",
+			false, false,
+		},
+		{
+			"implicit tls",
+			true, false,
+			"plain", "pass",
+			[]Config{WithRootCA(rootCA), WithImplicitTLS(true)},
+			false,
+			"\x00user\x00pass",
+			false, true,
+		},
+		{
+			"implicit tls untrusted certificate",
+			true, false,
+			"plain", "pass",
+			[]Config{WithImplicitTLS(true)},
+			true,
+			"",
+			false, false,
+		},
+		{
+			"xoauth2",
+			false, true,
+			"xoauth2", "token",
+			[]Config{WithRootCA(rootCA)},
+			false,
+			"user=user\x01auth=Bearer token\x01\x01",
+			true, true,
+		},
+		{
+			"bad credentials",
+			false, true,
+			"plain", "wrong",
+			[]Config{WithRootCA(rootCA)},
+			true,
+			"\x00user\x00wrong",
+			false, false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(t, test.implicitTLS, test.startTLS, cert)
+			m, err := New(
+				"127.0.0.1", "user", test.password, test.authtype, server.port(),
+				append([]Config{WithTimeout(time.Second), WithPoolSize(1)}, test.configs...)...,
+			)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			defer m.(*smtpMailer).Close()
+
+			err = m.(mailer.Pinger).Ping(context.Background())
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if _, _, auth, _ := server.stats(); test.expectAuth != "" && (len(auth) == 0 || auth[0] != test.expectAuth) {
+				t.Errorf("Unexpected auth %q", auth)
+			}
+			if err != nil {
+				return
+			}
+
+			if err := m.Send("develop@offen.dev", "a@offen.dev", "Hello", "Send"); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			result, err := m.(mailer.Prober).Probe("develop@offen.dev", "b@offen.dev", "Hello", "Probe")
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if result.ImplicitTLS != test.implicitTLS || result.StartTLS != test.expectStartTLS {
+				t.Errorf("Unexpected TLS mode in %v", result)
+			}
+			if (result.TLSVersion != "") != test.expectTLS {
+				t.Errorf("Unexpected TLS version in %v", result)
+			}
+			if test.expectTLS && result.CertificateCN != "fake-smtp" {
+				t.Errorf("Unexpected certificate in %v", result)
+			}
+
+			connections, _, _, messages := server.stats()
+			if connections != 2 {
+				t.Errorf("Expected pooled and probe connection, got %d connections", connections)
+			}
+			if len(messages) != 2 || !strings.Contains(messages[0], "Send") || !strings.Contains(messages[1], "Probe") {
+				t.Errorf("Unexpected messages %v", messages)
+			}
+		})
+	}
+}
+
+func TestSMTPMailer_Pool(t *testing.T) {
+	cert, _ := createCertificate(t)
+	tests := []struct {
+		name                string
+		configs             []Config
+		sends               int
+		expectedConnections int
+	}{
+		{"single connection is reused", []Config{WithPoolSize(1)}, 3, 1},
+		{"connections are used in turn", []Config{WithPoolSize(2)}, 4, 2},
+		{"idle connections are replaced", []Config{WithPoolSize(1), WithIdleTimeout(time.Nanosecond)}, 3, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(t, false, false, cert)
+			m, err := New(
+				"127.0.0.1", "user", "pass", "noauth", server.port(),
+				append([]Config{WithTimeout(time.Second), WithStartTLSPolicy("none")}, test.configs...)...,
+			)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			defer m.(*smtpMailer).Close()
+
+			for i := 0; i < test.sends; i++ {
+				if err := m.Send("develop@offen.dev", "a@offen.dev", "Hello", fmt.Sprintf("Message %d", i)); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+			}
+			connections, _, _, messages := server.stats()
+			if connections != test.expectedConnections {
+				t.Errorf("Expected %d connections, got %d", test.expectedConnections, connections)
+			}
+			if len(messages) != test.sends {
+				t.Errorf("Expected %d messages, got %d", test.sends, len(messages))
+			}
+		})
+	}
+}
+
+func TestSMTPMailer_AcquireRelease(t *testing.T) {
+	cert, _ := createCertificate(t)
+	server := newFakeServer(t, false, false, cert)
+	m, err := New(
+		"127.0.0.1", "user", "pass", "noauth", server.port(),
+		WithTimeout(time.Millisecond*50), WithStartTLSPolicy("none"), WithPoolSize(1),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	s := m.(*smtpMailer)
+
+	held, err := s.acquire()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := s.Send("develop@offen.dev", "a@offen.dev", "Hello", "Blocked"); err == nil {
+		t.Error("Expected error when pool is exhausted")
+	}
+	s.release(held)
+	if err := s.Send("develop@offen.dev", "a@offen.dev", "Hello", "Released"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	held, err = s.acquire()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !held.connected {
+		t.Error("Expected connection in use to stay open until released")
+	}
+	s.release(held)
+	if held.connected {
+		t.Error("Expected connection to be closed when released after closing")
+	}
+	if _, quits, _, _ := server.stats(); quits != 1 {
+		t.Errorf("Expected connection to be quit, got %d", quits)
+	}
+
+	if err := s.Send("develop@offen.dev", "a@offen.dev", "Hello", "Closed"); !errors.Is(err, errPoolClosed) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := s.Ping(context.Background()); !errors.Is(err, errPoolClosed) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Unexpected error closing twice %v", err)
+	}
+}
+
+func TestSMTPMailer_Close(t *testing.T) {
+	cert, _ := createCertificate(t)
+	server := newFakeServer(t, false, false, cert)
+	m, err := New(
+		"127.0.0.1", "user", "pass", "noauth", server.port(),
+		WithTimeout(time.Second), WithStartTLSPolicy("none"), WithPoolSize(2),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	s := m.(*smtpMailer)
+	for i := 0; i < 2; i++ {
+		if err := s.Ping(context.Background()); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if connections, quits, _, _ := server.stats(); connections != 2 || quits != 2 {
+		t.Errorf("Expected all idle connections to be quit, got %d of %d", quits, connections)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package metrics collects operational metrics and exposes them in a format
+// that can be scraped by Prometheus. None of the collected values is allowed
+// to identify a visitor: requests are recorded by their route template, not
+// their actual path, and status codes are expected to be anonymized by the
+// caller before being recorded.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "offen"
+
+// Metrics collects operational metrics. All methods are safe to call on a nil
+// pointer in which case no metrics will be recorded.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	rateLimited     *prometheus.CounterVec
+	mailsSent       *prometheus.CounterVec
+	expireRuns      *prometheus.CounterVec
+	expiredEvents   prometheus.Counter
+	expireDuration  prometheus.Histogram
+	lastExpire      prometheus.Gauge
+	eventsIngested  *prometheus.CounterVec
+	ingestRejected  *prometheus.CounterVec
+}
+
+// New creates a new set of metrics that are registered with a dedicated
+// registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests handled, partitioned by route, method and anonymized status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests, partitioned by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ratelimiter_rejections_total",
+			Help:      "Number of requests rejected by the rate limiter, partitioned by route.",
+		}, []string{"route"}),
+		mailsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "mail_sent_total",
+			Help:      "Number of transactional emails sent, partitioned by outcome.",
+		}, []string{"outcome"}),
+		expireRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "expire_runs_total",
+			Help:      "Number of runs pruning expired events, partitioned by outcome.",
+		}, []string{"outcome"}),
+		expiredEvents: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "expire_removed_events_total",
+			Help:      "Number of expired events that have been removed.",
+		}),
+		expireDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "expire_duration_seconds",
+			Help:      "Duration of runs pruning expired events.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+		}),
+		lastExpire: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "expire_last_success_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful run pruning expired events.",
+		}),
+		eventsIngested: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_ingested_total",
+			Help:      "Number of events that have been stored, partitioned by account.",
+		}, []string{"account_id"}),
+		ingestRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ingestion_rejections_total",
+			Help:      "Number of requests rejected for violating the allowed origins or lacking a valid ingestion token, partitioned by account and reason.",
+		}, []string{"account_id", "reason"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.rateLimited,
+		m.mailsSent,
+		m.expireRuns,
+		m.expiredEvents,
+		m.expireDuration,
+		m.lastExpire,
+		m.eventsIngested,
+		m.ingestRejected,
+	)
+	return m
+}
+
+// Handler returns a handler that serves the collected metrics.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB adds statistics about the given database's connection pool.
+func (m *Metrics) RegisterDB(db *sql.DB) error {
+	if m == nil {
+		return nil
+	}
+	return m.registry.Register(collectors.NewDBStatsCollector(db, "offen"))
+}
+
+// ObserveRequest records a handled HTTP request. Callers are expected
+// to pass the route template instead of the actual path and to anonymize
+// the status code.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	method = normalizeMethod(method)
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+	if status == http.StatusTooManyRequests {
+		m.rateLimited.WithLabelValues(route).Inc()
+	}
+}
+
+// ObserveMail records the outcome of sending a transactional email.
+func (m *Metrics) ObserveMail(err error) {
+	if m == nil {
+		return
+	}
+	m.mailsSent.WithLabelValues(outcome(err)).Inc()
+}
+
+// ObserveExpire records a run pruning expired events.
+func (m *Metrics) ObserveExpire(removed int, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.expireRuns.WithLabelValues(outcome(err)).Inc()
+	m.expireDuration.Observe(duration.Seconds())
+	if err == nil {
+		m.expiredEvents.Add(float64(removed))
+		m.lastExpire.Set(float64(time.Now().Unix()))
+	}
+}
+
+// ObserveEvent records an event that has been stored for the given account.
+// Callers must only pass identifiers of accounts that are known to exist.
+func (m *Metrics) ObserveEvent(accountID string) {
+	if m == nil {
+		return
+	}
+	m.eventsIngested.WithLabelValues(accountID).Inc()
+}
+
+// Reasons for rejecting requests sending data for an account
+const (
+	RejectOrigin  = "origin"
+	RejectReferer = "referer"
+	RejectToken   = "ingestion_token"
+)
+
+// ObserveIngestRejection records a request that has been rejected for
+// violating the origins allowed by an account or for lacking a valid
+// ingestion token. Callers must only pass identifiers of accounts that are
+// known to exist.
+func (m *Metrics) ObserveIngestRejection(accountID, reason string) {
+	if m == nil {
+		return
+	}
+	m.ingestRejected.WithLabelValues(accountID, reason).Inc()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// normalizeMethod prevents arbitrary methods sent by clients from creating
+// new label values.
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		var m *Metrics
+		m.ObserveRequest("/", http.MethodGet, http.StatusOK, time.Second)
+		m.ObserveMail(nil)
+		m.ObserveExpire(12, time.Second, nil)
+		m.ObserveEvent("account-a")
+		m.ObserveIngestRejection("account-a", RejectOrigin)
+		if err := m.RegisterDB(nil); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("exposition", func(t *testing.T) {
+		m := New()
+		m.ObserveRequest("/api/events", http.MethodPost, http.StatusOK, time.Millisecond)
+		m.ObserveRequest("/api/login", http.MethodPost, http.StatusTooManyRequests, time.Millisecond)
+		m.ObserveRequest("/", "PROPFIND", http.StatusOK, time.Millisecond)
+		m.ObserveMail(errors.New("did not work"))
+		m.ObserveExpire(12, time.Second, nil)
+		m.ObserveEvent("account-a")
+		m.ObserveIngestRejection("account-a", RejectToken)
+
+		w := httptest.NewRecorder()
+		m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		for _, expected := range []string{
+			`offen_http_requests_total{method="POST",route="/api/events",status="200"} 1`,
+			`offen_ratelimiter_rejections_total{route="/api/login"} 1`,
+			`offen_http_requests_total{method="OTHER",route="/",status="200"} 1`,
+			`offen_mail_sent_total{outcome="failure"} 1`,
+			`offen_expire_runs_total{outcome="success"} 1`,
+			`offen_expire_removed_events_total 12`,
+			`offen_expire_duration_seconds_count 1`,
+			`offen_events_ingested_total{account_id="account-a"} 1`,
+			`offen_ingestion_rejections_total{account_id="account-a",reason="ingestion_token"} 1`,
+		} {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("Expected output to contain %s", expected)
+			}
+		}
+	})
+}
@@ -4,23 +4,27 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/gofrs/uuid"
 	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/tracing"
 )
 
-func (p *persistenceLayer) GetAccount(accountID string, includeStyles, includeEvents bool, eventsSince string) (AccountResult, error) {
+func (p *persistenceLayer) GetAccount(ctx context.Context, accountID string, includeStyles, includeEvents bool, eventsSince string) (_ AccountResult, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.GetAccount")
+	defer func() { tracing.End(span, err) }()
+
 	var account Account
-	var err error
 	if includeEvents {
-		account, err = p.dal.FindAccount(FindAccountQueryIncludeEvents{
+		account, err = p.dal.FindAccount(ctx, FindAccountQueryIncludeEvents{
 			AccountID: accountID,
 			Since:     eventsSince,
 		})
 	} else {
-		account, err = p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+		account, err = p.dal.FindAccount(ctx, FindAccountQueryActiveByID(accountID))
 	}
 	if err != nil {
 		return AccountResult{}, fmt.Errorf("persistence: error looking up account data: %w", err)
@@ -32,8 +36,11 @@ func (p *persistenceLayer) GetAccount(accountID string, includeStyles, includeEv
 		Created:   account.Created,
 	}
 
+	// allowed origins are considered part of the account's styling as they
+	// are only relevant when embedding the vault
 	if includeStyles {
 		result.AccountStyles = account.AccountStyles
+		result.AllowedOrigins = account.AllowedOrigins
 	}
 
 	key, err := account.WrapPublicKey()
@@ -72,7 +79,7 @@ func (p *persistenceLayer) GetAccount(accountID string, includeStyles, includeEv
 	}
 
 	if eventsSince != "" {
-		pruned, err := p.dal.FindTombstones(FindTombstonesQueryByAccounts{
+		pruned, err := p.dal.FindTombstones(ctx, FindTombstonesQueryByAccounts{
 			AccountIDs: []string{accountID},
 			Since:      eventsSince,
 		})
@@ -93,8 +100,11 @@ func (p *persistenceLayer) GetAccount(accountID string, includeStyles, includeEv
 	return result, nil
 }
 
-func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
-	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+func (p *persistenceLayer) AssociateUserSecret(ctx context.Context, accountID, userID, encryptedUserSecret string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.AssociateUserSecret")
+	defer func() { tracing.End(span, err) }()
+
+	account, err := p.dal.FindAccount(ctx, FindAccountQueryActiveByID(accountID))
 	if err != nil {
 		return fmt.Errorf(`persistence: error looking up account with id "%s": %w`, accountID, err)
 	}
@@ -104,7 +114,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 		return fmt.Errorf("persistence: erro hashing user id: %w", err)
 	}
 
-	secret, err := p.dal.FindSecret(FindSecretQueryBySecretID(hashedUserID))
+	secret, err := p.dal.FindSecret(ctx, FindSecretQueryBySecretID(hashedUserID))
 	if err != nil {
 		var notFound ErrUnknownSecret
 		if !errors.As(err, &notFound) {
@@ -129,11 +139,11 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 			return fmt.Errorf("persistence: error hashing parked id: %v", parkErr)
 		}
 
-		txn, err := p.dal.Transaction()
+		txn, err := p.dal.Transaction(ctx)
 		if err != nil {
 			return fmt.Errorf("persistence: error creating transaction: %w", err)
 		}
-		if err := txn.CreateSecret(&Secret{
+		if err := txn.CreateSecret(ctx, &Secret{
 			SecretID:        parkedHash,
 			EncryptedSecret: secret.EncryptedSecret,
 		}); err != nil {
@@ -141,7 +151,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 			return fmt.Errorf("persistence: error creating user for use as migration target: %w", err)
 		}
 
-		if err := txn.DeleteSecret(DeleteSecretQueryBySecretID(secret.SecretID)); err != nil {
+		if err := txn.DeleteSecret(ctx, DeleteSecretQueryBySecretID(secret.SecretID)); err != nil {
 			txn.Rollback()
 			return fmt.Errorf("persistence: error deleting existing user: %v", err)
 		}
@@ -149,7 +159,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 		// The previous user is now deleted so all orphaned events need to be
 		// copied over to the one used for parking the events.
 		var idsToDelete []string
-		orphanedEvents, err := txn.FindEvents(FindEventsQueryForSecretIDs{
+		orphanedEvents, err := txn.FindEvents(ctx, FindEventsQueryForSecretIDs{
 			SecretIDs: []string{hashedUserID},
 		})
 		if err != nil {
@@ -167,7 +177,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 				return fmt.Errorf("persistence: error creating new event id: %w", err)
 			}
 
-			if err := txn.CreateEvent(&Event{
+			if err := txn.CreateEvent(ctx, &Event{
 				EventID:   newID,
 				Sequence:  sequence,
 				AccountID: orphan.AccountID,
@@ -177,7 +187,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 				return fmt.Errorf("persistence: error migrating an existing event: %w", err)
 			}
 
-			if err := txn.CreateTombstone(&Tombstone{
+			if err := txn.CreateTombstone(ctx, &Tombstone{
 				EventID:   orphan.EventID,
 				AccountID: orphan.AccountID,
 				SecretID:  orphan.SecretID,
@@ -188,7 +198,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 
 			idsToDelete = append(idsToDelete, orphan.EventID)
 		}
-		if _, err := txn.DeleteEvents(DeleteEventsQueryByEventIDs(idsToDelete)); err != nil {
+		if _, err := txn.DeleteEvents(ctx, DeleteEventsQueryByEventIDs(idsToDelete)); err != nil {
 			txn.Rollback()
 			return fmt.Errorf("persistence: error deleting orphaned events: %w", err)
 		}
@@ -197,7 +207,7 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 		}
 	}
 
-	if err := p.dal.CreateSecret(&Secret{
+	if err := p.dal.CreateSecret(ctx, &Secret{
 		SecretID:        hashedUserID,
 		EncryptedSecret: encryptedUserSecret,
 	}); err != nil {
@@ -206,21 +216,24 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 	return nil
 }
 
-func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) error {
-	accountUsers, err := p.dal.FindAccountUsers(FindAccountUsersQueryAllAccountUsers{true, false})
+func (p *persistenceLayer) CreateAccount(ctx context.Context, name, emailAddress, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.CreateAccount")
+	defer func() { tracing.End(span, err) }()
+
+	accountUsers, err := p.dal.FindAccountUsers(ctx, FindAccountUsersQueryAllAccountUsers{true, false})
 	if err != nil {
 		return fmt.Errorf("persistence: error looking up account users: %w", err)
 	}
-	match, err := selectAccountUser(accountUsers, emailAddress)
+	match, err := selectAccountUser(ctx, accountUsers, emailAddress)
 	if err != nil {
 		return fmt.Errorf("persistence: error looking up account user %s: %w", emailAddress, err)
 	}
 
-	if err := keys.CompareString(password, match.HashedPassword); err != nil {
+	if err := keys.CompareString(ctx, password, match.HashedPassword); err != nil {
 		return fmt.Errorf("persistence: passwords did not match: %w", err)
 	}
 
-	allAccounts, allAccountsErr := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	allAccounts, allAccountsErr := p.dal.FindAccounts(ctx, FindAccountsQueryAllAccounts{})
 	if allAccountsErr != nil {
 		return fmt.Errorf("persistence: error looking up all existing accounts: %w", err)
 	}
@@ -238,22 +251,22 @@ func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) er
 	if err != nil {
 		return fmt.Errorf("persistence: error creating relationship: %w", err)
 	}
-	if err := relationship.addEmailEncryptedKey(key, match.Salt, emailAddress); err != nil {
+	if err := relationship.addEmailEncryptedKey(ctx, key, match.Salt, emailAddress); err != nil {
 		return fmt.Errorf("persistence: error adding email encrypted key: %w", err)
 	}
-	if err := relationship.addPasswordEncryptedKey(key, match.Salt, password); err != nil {
+	if err := relationship.addPasswordEncryptedKey(ctx, key, match.Salt, password); err != nil {
 		return fmt.Errorf("persistence: error adding password encrypted key: %w", err)
 	}
 
-	txn, err := p.dal.Transaction()
+	txn, err := p.dal.Transaction(ctx)
 	if err != nil {
 		return fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
-	if err := txn.CreateAccount(account); err != nil {
+	if err := txn.CreateAccount(ctx, account); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error persisting account: %w", err)
 	}
-	if err := txn.CreateAccountUserRelationship(relationship); err != nil {
+	if err := txn.CreateAccountUserRelationship(ctx, relationship); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error persisting relationship: %w", err)
 	}
@@ -264,24 +277,27 @@ func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) er
 	return nil
 }
 
-func (p *persistenceLayer) RetireAccount(accountID string) error {
-	account, lookupErr := p.dal.FindAccount(FindAccountQueryByID(accountID))
+func (p *persistenceLayer) RetireAccount(ctx context.Context, accountID string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.RetireAccount")
+	defer func() { tracing.End(span, err) }()
+
+	account, lookupErr := p.dal.FindAccount(ctx, FindAccountQueryByID(accountID))
 	if lookupErr != nil {
 		return fmt.Errorf("persistence: error looking up account to retire: %w", lookupErr)
 	}
 	if account.Retired {
 		return ErrUnknownAccount(fmt.Sprintf("persistence: account %s already retired", accountID))
 	}
-	txn, txnErr := p.dal.Transaction()
+	txn, txnErr := p.dal.Transaction(ctx)
 	if txnErr != nil {
 		return fmt.Errorf("persistence: error creating transaction: %w", txnErr)
 	}
 	account.Retired = true
-	if err := txn.UpdateAccount(&account); err != nil {
+	if err := txn.UpdateAccount(ctx, &account); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error retiring account %s: %w", accountID, err)
 	}
-	if err := txn.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryByAccountID(accountID)); err != nil {
+	if err := txn.DeleteAccountUserRelationships(ctx, DeleteAccountUserRelationshipsQueryByAccountID(accountID)); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error deleting account user relationships for retired account %s: %w", accountID, err)
 	}
@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -34,12 +35,12 @@ type mockGetAccountDatabase struct {
 	methodArgs        []interface{}
 }
 
-func (m *mockGetAccountDatabase) FindAccount(q interface{}) (Account, error) {
+func (m *mockGetAccountDatabase) FindAccount(ctx context.Context, q interface{}) (Account, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.findAccountResult, m.findAccountErr
 }
 
-func (m *mockGetAccountDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+func (m *mockGetAccountDatabase) FindTombstones(ctx context.Context, q interface{}) ([]Tombstone, error) {
 	return nil, nil
 }
 
@@ -173,7 +174,7 @@ func TestPersistenceLayer_GetAccount(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			p := &persistenceLayer{dal: test.persistence}
 
-			result, err := p.GetAccount("account-id", false, test.includeEvents, test.since)
+			result, err := p.GetAccount(context.Background(), "account-id", false, test.includeEvents, test.since)
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %#v, got %#v", test.expectedResult, result)
 			}
@@ -212,7 +213,7 @@ func TestPersistenceLayer_AssociateUserSecret(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			p := &persistenceLayer{dal: test.dal}
 
-			err := p.AssociateUserSecret("account-id", "user-id", "encrypted-user-secret")
+			err := p.AssociateUserSecret(context.Background(), "account-id", "user-id", "encrypted-user-secret")
 
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
@@ -238,14 +239,14 @@ type mockRetireAccountDatabase struct {
 	findAccountErr    error
 }
 
-func (m *mockRetireAccountDatabase) UpdateAccount(*Account) error {
+func (m *mockRetireAccountDatabase) UpdateAccount(context.Context, *Account) error {
 	return m.updateErr
 }
 
-func (m *mockRetireAccountDatabase) DeleteAccountUserRelationships(interface{}) error {
+func (m *mockRetireAccountDatabase) DeleteAccountUserRelationships(context.Context, interface{}) error {
 	return m.deleteErr
 }
-func (m *mockRetireAccountDatabase) FindAccount(interface{}) (Account, error) {
+func (m *mockRetireAccountDatabase) FindAccount(context.Context, interface{}) (Account, error) {
 	return m.findAccountResult, m.findAccountErr
 }
 
@@ -257,7 +258,7 @@ func (m *mockRetireAccountDatabase) Rollback() error {
 	return nil
 }
 
-func (m *mockRetireAccountDatabase) Transaction() (Transaction, error) {
+func (m *mockRetireAccountDatabase) Transaction(context.Context) (Transaction, error) {
 	return m, m.txnErr
 }
 
@@ -296,8 +297,8 @@ func TestPersistenceLayer_RetireAccount(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := persistenceLayer{test.db}
-			err := p.RetireAccount("account-a")
+			p := persistenceLayer{dal: test.db}
+			err := p.RetireAccount(context.Background(), "account-a")
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value: %v", err)
 			}
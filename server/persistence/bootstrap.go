@@ -4,17 +4,22 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	uuid "github.com/gofrs/uuid"
 	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/tracing"
 )
 
 // ProbeEmpty checks whether the connected database is empty
-func (p *persistenceLayer) ProbeEmpty() bool {
-	return p.dal.ProbeEmpty()
+func (p *persistenceLayer) ProbeEmpty(ctx context.Context) bool {
+	ctx, span := tracing.Start(ctx, "persistence.ProbeEmpty")
+	defer span.End()
+
+	return p.dal.ProbeEmpty(ctx)
 }
 
 // BootstrapConfig contains data about accounts and account users that is used
@@ -49,7 +54,10 @@ type accountCreation struct {
 
 // Bootstrap seeds a blank database with the given account and user
 // data. This is likely only ever used in development.
-func (p *persistenceLayer) Bootstrap(config BootstrapConfig) error {
+func (p *persistenceLayer) Bootstrap(ctx context.Context, config BootstrapConfig) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Bootstrap")
+	defer func() { tracing.End(span, err) }()
+
 	for _, user := range config.AccountUsers {
 		if user.AllowInsecurePassword {
 			continue
@@ -59,43 +67,43 @@ func (p *persistenceLayer) Bootstrap(config BootstrapConfig) error {
 		}
 	}
 	if !config.Force {
-		if !p.dal.ProbeEmpty() {
+		if !p.dal.ProbeEmpty(ctx) {
 			return errors.New("persistence: action would overwrite existing data - not allowed")
 		}
 	}
-	txn, err := p.dal.Transaction()
+	txn, err := p.dal.Transaction(ctx)
 	if err != nil {
 		return fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
-	if err := txn.DropAll(); err != nil {
+	if err := txn.DropAll(ctx); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error dropping tables before inserting seed data: %w", err)
 	}
 
-	if err := txn.ApplyMigrations(); err != nil {
+	if err := txn.ApplyMigrations(ctx); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error applying initial migrations: %w", err)
 	}
 
-	accounts, accountUsers, relationships, err := bootstrapAccounts(&config)
+	accounts, accountUsers, relationships, err := bootstrapAccounts(ctx, &config)
 	if err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error creating seed data: %w", err)
 	}
 	for _, account := range accounts {
-		if err := txn.CreateAccount(&account); err != nil {
+		if err := txn.CreateAccount(ctx, &account); err != nil {
 			txn.Rollback()
 			return fmt.Errorf("persistence: error creating account: %w", err)
 		}
 	}
 	for _, accountUser := range accountUsers {
-		if err := txn.CreateAccountUser(&accountUser); err != nil {
+		if err := txn.CreateAccountUser(ctx, &accountUser); err != nil {
 			txn.Rollback()
 			return fmt.Errorf("persistence: error creating account user: %w", err)
 		}
 	}
 	for _, relationship := range relationships {
-		if err := txn.CreateAccountUserRelationship(&relationship); err != nil {
+		if err := txn.CreateAccountUserRelationship(ctx, &relationship); err != nil {
 			txn.Rollback()
 			return fmt.Errorf("persistence: error creating account user relationship: %w", err)
 		}
@@ -106,7 +114,7 @@ func (p *persistenceLayer) Bootstrap(config BootstrapConfig) error {
 	return nil
 }
 
-func bootstrapAccounts(config *BootstrapConfig) ([]Account, []AccountUser, []AccountUserRelationship, error) {
+func bootstrapAccounts(ctx context.Context, config *BootstrapConfig) ([]Account, []AccountUser, []AccountUserRelationship, error) {
 	accountCreations := []accountCreation{}
 	for _, account := range config.Accounts {
 		record, encryptionKey, err := newAccount(account.Name, account.AccountID)
@@ -123,7 +131,7 @@ func bootstrapAccounts(config *BootstrapConfig) ([]Account, []AccountUser, []Acc
 	relationshipCreations := []AccountUserRelationship{}
 
 	for _, accountUserData := range config.AccountUsers {
-		accountUser, err := newAccountUser(accountUserData.Email, accountUserData.Password, accountUserData.AdminLevel)
+		accountUser, err := newAccountUser(ctx, accountUserData.Email, accountUserData.Password, accountUserData.AdminLevel)
 		if err != nil {
 			return nil, nil, nil, err
 		}
@@ -145,10 +153,10 @@ func bootstrapAccounts(config *BootstrapConfig) ([]Account, []AccountUser, []Acc
 			if err != nil {
 				return nil, nil, nil, fmt.Errorf("persistence: error creating account user relationship: %w", err)
 			}
-			if err := r.addPasswordEncryptedKey(encryptionKey, accountUser.Salt, accountUserData.Password); err != nil {
+			if err := r.addPasswordEncryptedKey(ctx, encryptionKey, accountUser.Salt, accountUserData.Password); err != nil {
 				return nil, nil, nil, fmt.Errorf("persistence: error adding password encrypted key: %w", err)
 			}
-			if err := r.addEmailEncryptedKey(encryptionKey, accountUser.Salt, accountUserData.Email); err != nil {
+			if err := r.addEmailEncryptedKey(ctx, encryptionKey, accountUser.Salt, accountUserData.Email); err != nil {
 				return nil, nil, nil, fmt.Errorf("persistence: error adding email encrypted key: %w", err)
 			}
 
@@ -162,7 +170,7 @@ func bootstrapAccounts(config *BootstrapConfig) ([]Account, []AccountUser, []Acc
 	return accounts, accountUserCreations, relationshipCreations, nil
 }
 
-func newAccountUser(email, password string, adminLevel interface{}) (*AccountUser, error) {
+func newAccountUser(ctx context.Context, email, password string, adminLevel interface{}) (*AccountUser, error) {
 	var level AccountUserAdminLevel
 	switch c := adminLevel.(type) {
 	case int:
@@ -177,7 +185,7 @@ func newAccountUser(email, password string, adminLevel interface{}) (*AccountUse
 	if idErr != nil {
 		return nil, idErr
 	}
-	hashedEmail, hashedEmailErr := keys.HashString(email)
+	hashedEmail, hashedEmailErr := keys.HashString(ctx, email)
 	if hashedEmailErr != nil {
 		return nil, hashedEmailErr
 	}
@@ -193,7 +201,7 @@ func newAccountUser(email, password string, adminLevel interface{}) (*AccountUse
 	}
 
 	if password != "" {
-		hashedPw, hashedPwErr := keys.HashString(password)
+		hashedPw, hashedPwErr := keys.HashString(ctx, password)
 		if hashedPwErr != nil {
 			return nil, hashedPwErr
 		}
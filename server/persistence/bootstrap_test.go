@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"strings"
 	"testing"
 )
@@ -13,13 +14,13 @@ type mockProbeDatabase struct {
 	result bool
 }
 
-func (m *mockProbeDatabase) ProbeEmpty() bool {
+func (m *mockProbeDatabase) ProbeEmpty(context.Context) bool {
 	return m.result
 }
 
 func TestProbeEmpty(t *testing.T) {
-	p := persistenceLayer{&mockProbeDatabase{result: true}}
-	result := p.ProbeEmpty()
+	p := persistenceLayer{dal: &mockProbeDatabase{result: true}}
+	result := p.ProbeEmpty(context.Background())
 	if result != true {
 		t.Errorf("Expected true, got %v", result)
 	}
@@ -49,7 +50,7 @@ func TestBootstrapAccounts(t *testing.T) {
 			},
 		},
 	}
-	accounts, accountUsers, relationships, err := bootstrapAccounts(&config)
+	accounts, accountUsers, relationships, err := bootstrapAccounts(context.Background(), &config)
 
 	if err != nil {
 		t.Fatalf("Unexpected error %v", err)
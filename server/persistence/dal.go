@@ -3,35 +3,46 @@
 
 package persistence
 
+import (
+	"context"
+	"time"
+)
+
 // DataAccessLayer provides a database agnostic interface for storing data. All
 // query methods expect certain types to be passed. In case a unknown query is
 // passed, an error can be returned early.
 type DataAccessLayer interface {
-	CreateEvent(*Event) error
-	FindEvents(interface{}) ([]Event, error)
-	DeleteEvents(interface{}) (int64, error)
-	CreateSecret(*Secret) error
-	FindSecret(interface{}) (Secret, error)
-	DeleteSecret(interface{}) error
-	CreateAccount(*Account) error
-	UpdateAccount(*Account) error
-	FindAccount(interface{}) (Account, error)
-	FindAccounts(interface{}) ([]Account, error)
-	CreateAccountUser(*AccountUser) error
-	FindAccountUser(interface{}) (AccountUser, error)
-	FindAccountUsers(interface{}) ([]AccountUser, error)
-	UpdateAccountUser(*AccountUser) error
-	CreateAccountUserRelationship(*AccountUserRelationship) error
-	UpdateAccountUserRelationship(*AccountUserRelationship) error
-	FindAccountUserRelationships(interface{}) ([]AccountUserRelationship, error)
-	DeleteAccountUserRelationships(interface{}) error
-	CreateTombstone(*Tombstone) error
-	FindTombstones(interface{}) ([]Tombstone, error)
-	Transaction() (Transaction, error)
-	ApplyMigrations() error
-	DropAll() error
-	ProbeEmpty() bool
-	Ping() error
+	CreateEvent(context.Context, *Event) error
+	FindEvents(context.Context, interface{}) ([]Event, error)
+	DeleteEvents(context.Context, interface{}) (int64, error)
+	CreateSecret(context.Context, *Secret) error
+	FindSecret(context.Context, interface{}) (Secret, error)
+	DeleteSecret(context.Context, interface{}) error
+	CreateAccount(context.Context, *Account) error
+	UpdateAccount(context.Context, *Account) error
+	FindAccount(context.Context, interface{}) (Account, error)
+	FindAccounts(context.Context, interface{}) ([]Account, error)
+	CreateAccountUser(context.Context, *AccountUser) error
+	FindAccountUser(context.Context, interface{}) (AccountUser, error)
+	FindAccountUsers(context.Context, interface{}) ([]AccountUser, error)
+	UpdateAccountUser(context.Context, *AccountUser) error
+	CreateAccountUserRelationship(context.Context, *AccountUserRelationship) error
+	UpdateAccountUserRelationship(context.Context, *AccountUserRelationship) error
+	FindAccountUserRelationships(context.Context, interface{}) ([]AccountUserRelationship, error)
+	DeleteAccountUserRelationships(context.Context, interface{}) error
+	CreateTombstone(context.Context, *Tombstone) error
+	FindTombstones(context.Context, interface{}) ([]Tombstone, error)
+	CreateRateLimit(context.Context, *RateLimit) error
+	UpdateRateLimit(context.Context, *RateLimit) error
+	FindRateLimit(context.Context, interface{}) (RateLimit, error)
+	DeleteRateLimits(context.Context, interface{}) (int64, error)
+	Transaction(context.Context) (Transaction, error)
+	ApplyMigrations(context.Context) error
+	PendingMigrations(context.Context) ([]string, error)
+	DropAll(context.Context) error
+	ProbeEmpty(context.Context) bool
+	Ping(context.Context) error
+	TryLock(context.Context, string) (Lock, bool, error)
 }
 
 // FindEventsQueryForSecretIDs requests all events that match the list of
@@ -49,6 +60,20 @@ type FindEventsQueryByEventIDs []string
 // FindEventsQueryOlderThan looks up all events older than the given event id
 type FindEventsQueryOlderThan string
 
+// FindEventsQueryLatest looks up the event with the newest sequence.
+type FindEventsQueryLatest struct{}
+
+// FindEventsQueryNewerThan looks up the events of the given accounts that
+// have a sequence newer than Since, ordered by their sequence. In case Limit
+// is positive, no more than Limit events are returned. OmitPayload skips
+// loading the payloads of the events.
+type FindEventsQueryNewerThan struct {
+	Since       string
+	AccountIDs  []string
+	Limit       int
+	OmitPayload bool
+}
+
 // DeleteEventsQueryBySecretIDs requests deletion of all events that match
 // the given identifiers.
 type DeleteEventsQueryBySecretIDs []string
@@ -120,6 +145,27 @@ type FindTombstonesQueryBySecrets struct {
 	SecretIDs []string
 }
 
+// FindTombstonesQueryLatest requests the tombstone with the newest sequence.
+type FindTombstonesQueryLatest struct{}
+
+// FindTombstonesQueryNewerThan requests the tombstones of the given accounts
+// that have a sequence newer than Since, ordered by their sequence. In case
+// Limit is positive, no more than Limit tombstones are returned.
+type FindTombstonesQueryNewerThan struct {
+	Since      string
+	AccountIDs []string
+	Limit      int
+}
+
+// FindRateLimitQueryForUpdate requests the rate limit stored for the given identifier.
+// In case the underlying database supports it, the record is locked until the
+// surrounding transaction is committed or rolled back.
+type FindRateLimitQueryForUpdate string
+
+// DeleteRateLimitsQueryExpired requests deletion of all rate limits that
+// expired before the given time.
+type DeleteRateLimitsQueryExpired time.Time
+
 // Transaction is a data access layer that does not persist data until commit
 // is called. In case rollback is called before, the underlying database will
 // remain in the same state as before.
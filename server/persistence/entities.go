@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -33,6 +34,15 @@ type Tombstone struct {
 	Sequence  string
 }
 
+// A RateLimit stores the rate limiting state for a hashed identifier so that
+// it can be shared by multiple instances.
+type RateLimit struct {
+	Identifier  string
+	BlockUntil  time.Time
+	QueueLength int64
+	Expires     time.Time
+}
+
 // Secret associates a hashed user id - which ties a user and account together
 // uniquely - with the encrypted user secret the account owner can use
 // to decrypt events stored for that user.
@@ -116,11 +126,11 @@ func (a *AccountUserRelationship) addOneTimeEncryptedKey(encryptionKey, oneTimeK
 	return nil
 }
 
-func (a *AccountUserRelationship) addEmailEncryptedKey(encryptionKey []byte, versionedSalt, emailAddress string) error {
+func (a *AccountUserRelationship) addEmailEncryptedKey(ctx context.Context, encryptionKey []byte, versionedSalt, emailAddress string) error {
 	emailDerivedKey := a.getCacheItem(emailAddress + versionedSalt)
 	if emailDerivedKey == nil {
 		var err error
-		emailDerivedKey, err = keys.DeriveKey(emailAddress, versionedSalt)
+		emailDerivedKey, err = keys.DeriveKey(ctx, emailAddress, versionedSalt)
 		if err != nil {
 			return fmt.Errorf("persistence: error deriving key from email: %w", err)
 		}
@@ -134,11 +144,11 @@ func (a *AccountUserRelationship) addEmailEncryptedKey(encryptionKey []byte, ver
 	return nil
 }
 
-func (a *AccountUserRelationship) addPasswordEncryptedKey(encryptionKey []byte, versionedSalt, password string) error {
+func (a *AccountUserRelationship) addPasswordEncryptedKey(ctx context.Context, encryptionKey []byte, versionedSalt, password string) error {
 	passwordDerivedKey := a.getCacheItem(password + versionedSalt)
 	if passwordDerivedKey == nil {
 		var err error
-		passwordDerivedKey, err = keys.DeriveKey(password, versionedSalt)
+		passwordDerivedKey, err = keys.DeriveKey(ctx, password, versionedSalt)
 		if err != nil {
 			return fmt.Errorf("persistence: error deriving key from password: %w", err)
 		}
@@ -161,6 +171,7 @@ type Account struct {
 	UserSalt            string
 	Retired             bool
 	AccountStyles       string
+	AllowedOrigins      []string
 	Created             time.Time
 	Events              []Event
 }
@@ -21,5 +21,13 @@ func (e ErrUnknownSecret) Error() string {
 	return string(e)
 }
 
+// ErrUnknownRateLimit will be returned when no rate limit is stored
+// for a given key
+type ErrUnknownRateLimit string
+
+func (e ErrUnknownRateLimit) Error() string {
+	return string(e)
+}
+
 // ErrBadQuery is returned when a DAL method cannot handle the given query
 var ErrBadQuery = errors.New("persistence: could not match query")
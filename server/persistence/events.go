@@ -4,11 +4,18 @@
 package persistence
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/offen/offen/server/tracing"
 )
 
-func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride *string) error {
+func (p *persistenceLayer) Insert(ctx context.Context, userID, accountID, payload string, idOverride *string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Insert")
+	defer func() { tracing.End(span, err) }()
+
 	var eventID string
 	if idOverride == nil {
 		var err error
@@ -20,7 +27,7 @@ func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride
 		eventID = *idOverride
 	}
 
-	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	account, err := p.dal.FindAccount(ctx, FindAccountQueryActiveByID(accountID))
 	if err != nil {
 		return fmt.Errorf("persistence: error looking up matching account for given event: %w", err)
 	}
@@ -37,7 +44,7 @@ func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride
 	// in case the event is not anonymous, we need to check that the user
 	// already exists for the account so events can be decrypted lateron
 	if hashedUserID != nil {
-		if _, err := p.dal.FindSecret(FindSecretQueryBySecretID(*hashedUserID)); err != nil {
+		if _, err := p.dal.FindSecret(ctx, FindSecretQueryBySecretID(*hashedUserID)); err != nil {
 			return fmt.Errorf("persistence: error finding secret for given event: %w", err)
 		}
 	}
@@ -47,19 +54,118 @@ func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride
 		return fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
 	}
 
-	insertErr := p.dal.CreateEvent(&Event{
+	evt := &Event{
 		AccountID: accountID,
 		SecretID:  hashedUserID,
 		Payload:   payload,
 		EventID:   eventID,
 		Sequence:  sequence,
-	})
-	if insertErr != nil {
+	}
+	if insertErr := p.dal.CreateEvent(ctx, evt); insertErr != nil {
 		return fmt.Errorf("persistence: error inserting event: %w", insertErr)
 	}
+	p.publish([]Change{eventChange(*evt)})
 	return nil
 }
 
+// PendingEvent is an event that is about to be inserted for the account
+// of the given identifier.
+type PendingEvent struct {
+	AccountID string
+	Payload   string
+}
+
+func (p *persistenceLayer) InsertEvents(ctx context.Context, userID string, events []PendingEvent) (_ []error, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.InsertEvents")
+	defer func() { tracing.End(span, err) }()
+
+	eventErrors := make([]error, len(events))
+	// accounts and secrets are looked up only once per account, no matter
+	// how many events are inserted for it
+	hashedUserIDs := map[string]*string{}
+	lookupErrors := map[string]error{}
+	lookup := func(accountID string) (*string, error) {
+		if hashedUserID, ok := hashedUserIDs[accountID]; ok {
+			return hashedUserID, nil
+		}
+		if err, ok := lookupErrors[accountID]; ok {
+			return nil, err
+		}
+
+		account, err := p.dal.FindAccount(ctx, FindAccountQueryActiveByID(accountID))
+		if err != nil {
+			lookupErrors[accountID] = fmt.Errorf("persistence: error looking up matching account for given event: %w", err)
+			return nil, lookupErrors[accountID]
+		}
+
+		var hashedUserID *string
+		if userID != "" {
+			hash, err := account.HashUserID(userID)
+			if err != nil {
+				lookupErrors[accountID] = fmt.Errorf("persistence: error hashing user id: %w", err)
+				return nil, lookupErrors[accountID]
+			}
+			if _, err := p.dal.FindSecret(ctx, FindSecretQueryBySecretID(hash)); err != nil {
+				lookupErrors[accountID] = fmt.Errorf("persistence: error finding secret for given event: %w", err)
+				return nil, lookupErrors[accountID]
+			}
+			hashedUserID = &hash
+		}
+		hashedUserIDs[accountID] = hashedUserID
+		return hashedUserID, nil
+	}
+
+	var pending []*Event
+	for i, evt := range events {
+		hashedUserID, err := lookup(evt.AccountID)
+		if err != nil {
+			eventErrors[i] = err
+			continue
+		}
+
+		eventID, err := NewULID()
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error creating new event identifier: %w", err)
+		}
+		sequence, err := NewULID()
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error creating sequence number: %w", err)
+		}
+		pending = append(pending, &Event{
+			AccountID: evt.AccountID,
+			SecretID:  hashedUserID,
+			Payload:   evt.Payload,
+			EventID:   eventID,
+			Sequence:  sequence,
+		})
+	}
+
+	if len(pending) == 0 {
+		return eventErrors, nil
+	}
+
+	txn, err := p.dal.Transaction(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	for _, evt := range pending {
+		if err := txn.CreateEvent(ctx, evt); err != nil {
+			txn.Rollback()
+			return nil, fmt.Errorf("persistence: error inserting event: %w", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+
+	changes := make([]Change, len(pending))
+	for i, evt := range pending {
+		changes[i] = eventChange(*evt)
+	}
+	p.publish(changes)
+	return eventErrors, nil
+}
+
 // Query defines a set of filters to limit the set of results to be returned
 // In case a field has the zero value, its filter will not be applied.
 type Query struct {
@@ -67,14 +173,17 @@ type Query struct {
 	Since  string
 }
 
-func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
+func (p *persistenceLayer) Query(ctx context.Context, query Query) (_ EventsResult, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Query")
+	defer func() { tracing.End(span, err) }()
+
 	var accounts []Account
-	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	accounts, err = p.dal.FindAccounts(ctx, FindAccountsQueryAllAccounts{})
 	if err != nil {
 		return EventsResult{}, fmt.Errorf("persistence: error looking up all accounts: %v", err)
 	}
 
-	results, err := p.dal.FindEvents(FindEventsQueryForSecretIDs{
+	results, err := p.dal.FindEvents(ctx, FindEventsQueryForSecretIDs{
 		SecretIDs: hashUserIDForAccounts(query.UserID, accounts),
 		Since:     query.Since,
 	})
@@ -95,7 +204,7 @@ func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
 	out.Events = &eventResults
 
 	if query.Since != "" {
-		pruned, err := p.dal.FindTombstones(FindTombstonesQueryBySecrets{
+		pruned, err := p.dal.FindTombstones(ctx, FindTombstonesQueryBySecrets{
 			SecretIDs: hashUserIDForAccounts(query.UserID, accounts),
 			Since:     query.Since,
 		})
@@ -115,18 +224,21 @@ func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
 	return out, nil
 }
 
-func (p *persistenceLayer) Purge(userID string) error {
+func (p *persistenceLayer) Purge(ctx context.Context, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Purge")
+	defer func() { tracing.End(span, err) }()
+
 	sequence, err := NewULID()
 	if err != nil {
 		return fmt.Errorf("persistence: error creating sequence number: %w", err)
 	}
 
-	txn, err := p.dal.Transaction()
+	txn, err := p.dal.Transaction(ctx)
 	if err != nil {
 		return fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
 
-	accounts, err := txn.FindAccounts(FindAccountsQueryAllAccounts{})
+	accounts, err := txn.FindAccounts(ctx, FindAccountsQueryAllAccounts{})
 	if err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error retrieving available accounts: %w", err)
@@ -134,24 +246,27 @@ func (p *persistenceLayer) Purge(userID string) error {
 
 	hashedUserIDs := hashUserIDForAccounts(userID, accounts)
 
-	affectedEvents, err := txn.FindEvents(FindEventsQueryForSecretIDs{SecretIDs: hashedUserIDs})
+	affectedEvents, err := txn.FindEvents(ctx, FindEventsQueryForSecretIDs{SecretIDs: hashedUserIDs})
 	if err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error looking up events to purge: %w", err)
 	}
+	var changes []Change
 	for _, evt := range affectedEvents {
-		if err := txn.CreateTombstone(&Tombstone{
+		tombstone := Tombstone{
 			EventID:   evt.EventID,
 			AccountID: evt.AccountID,
 			SecretID:  evt.SecretID,
 			Sequence:  sequence,
-		}); err != nil {
+		}
+		if err := txn.CreateTombstone(ctx, &tombstone); err != nil {
 			txn.Rollback()
 			return fmt.Errorf("persistence: error creating tombstone for purged event: %w", err)
 		}
+		changes = append(changes, tombstoneChange(tombstone))
 	}
 
-	if _, err := txn.DeleteEvents(DeleteEventsQueryBySecretIDs(hashedUserIDs)); err != nil {
+	if _, err := txn.DeleteEvents(ctx, DeleteEventsQueryBySecretIDs(hashedUserIDs)); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error purging events: %w", err)
 	}
@@ -159,9 +274,159 @@ func (p *persistenceLayer) Purge(userID string) error {
 	if err := txn.Commit(); err != nil {
 		return fmt.Errorf("persistence: error committing pruning of events: %w", err)
 	}
+	p.publish(changes)
 	return nil
 }
 
+// ChangesQuery defines which changes are returned by Changes.
+type ChangesQuery struct {
+	// Since is the sequence after which changes are returned.
+	Since string
+	// AccountIDs limits the result to changes for the given accounts.
+	AccountIDs []string
+	// Limit defines the maximum number of changes returned in case it
+	// is positive.
+	Limit int
+	// OmitPayloads skips loading the payloads of events. They can be added
+	// later on using ResolveChanges.
+	OmitPayloads bool
+}
+
+// Changes returns the events and tombstones matching the given query,
+// ordered by their sequence.
+func (p *persistenceLayer) Changes(ctx context.Context, query ChangesQuery) (_ []Change, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Changes")
+	defer func() { tracing.End(span, err) }()
+
+	changes := []Change{}
+	if len(query.AccountIDs) == 0 {
+		return changes, nil
+	}
+
+	events, err := p.dal.FindEvents(ctx, FindEventsQueryNewerThan{
+		Since:       query.Since,
+		AccountIDs:  query.AccountIDs,
+		Limit:       query.Limit,
+		OmitPayload: query.OmitPayloads,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up new events: %w", err)
+	}
+	tombstones, err := p.dal.FindTombstones(ctx, FindTombstonesQueryNewerThan{
+		Since:      query.Since,
+		AccountIDs: query.AccountIDs,
+		Limit:      query.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up new tombstones: %w", err)
+	}
+
+	for _, evt := range events {
+		changes = append(changes, eventChange(evt))
+	}
+	for _, tombstone := range tombstones {
+		changes = append(changes, tombstoneChange(tombstone))
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Sequence < changes[j].Sequence
+	})
+	// both lists are limited on their own, so the merged result might
+	// contain more changes than requested
+	if query.Limit > 0 && len(changes) > query.Limit {
+		changes = changes[:query.Limit]
+	}
+	return changes, nil
+}
+
+// ResolveChanges adds the payloads of events to changes that have been
+// looked up using OmitPayloads. Events that have been deleted in the meantime
+// are skipped, as a tombstone will be returned for them.
+func (p *persistenceLayer) ResolveChanges(ctx context.Context, changes []Change) (_ []Change, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.ResolveChanges")
+	defer func() { tracing.End(span, err) }()
+
+	var eventIDs []string
+	for _, change := range changes {
+		if change.Event != nil {
+			eventIDs = append(eventIDs, change.Event.EventID)
+		}
+	}
+	if len(eventIDs) == 0 {
+		return changes, nil
+	}
+
+	events, err := p.dal.FindEvents(ctx, FindEventsQueryByEventIDs(eventIDs))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up events for changes: %w", err)
+	}
+	payloads := map[string]string{}
+	for _, evt := range events {
+		payloads[evt.EventID] = evt.Payload
+	}
+
+	result := []Change{}
+	for _, change := range changes {
+		if change.Event != nil {
+			payload, ok := payloads[change.Event.EventID]
+			if !ok {
+				continue
+			}
+			resolved := *change.Event
+			resolved.Payload = payload
+			change.Event = &resolved
+		}
+		result = append(result, change)
+	}
+	return result, nil
+}
+
+// LatestSequence returns the newest sequence of all stored events and
+// tombstones. As any change to stored events creates a new sequence, it can
+// be used to check whether anything has changed without querying all events.
+func (p *persistenceLayer) LatestSequence(ctx context.Context) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.LatestSequence")
+	defer func() { tracing.End(span, err) }()
+
+	events, err := p.dal.FindEvents(ctx, FindEventsQueryLatest{})
+	if err != nil {
+		return "", fmt.Errorf("persistence: error looking up latest event: %w", err)
+	}
+	tombstones, err := p.dal.FindTombstones(ctx, FindTombstonesQueryLatest{})
+	if err != nil {
+		return "", fmt.Errorf("persistence: error looking up latest tombstone: %w", err)
+	}
+
+	var seqs []string
+	for _, evt := range events {
+		seqs = append(seqs, evt.Sequence)
+	}
+	for _, tombstone := range tombstones {
+		seqs = append(seqs, tombstone.Sequence)
+	}
+	return getLatestSeq(seqs), nil
+}
+
+func eventChange(evt Event) Change {
+	return Change{
+		AccountID: evt.AccountID,
+		Sequence:  evt.Sequence,
+		Event: &EventResult{
+			AccountID: evt.AccountID,
+			SecretID:  evt.SecretID,
+			EventID:   evt.EventID,
+			Payload:   evt.Payload,
+		},
+	}
+}
+
+func tombstoneChange(t Tombstone) Change {
+	return Change{
+		AccountID:      t.AccountID,
+		Sequence:       t.Sequence,
+		DeletedEventID: t.EventID,
+	}
+}
+
 func hashUserIDForAccounts(userID string, accounts []Account) []string {
 	if len(accounts) == 0 {
 		return []string{}
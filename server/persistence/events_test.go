@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -22,17 +23,17 @@ type mockInsertEventDatabase struct {
 	methodArgs        []interface{}
 }
 
-func (m *mockInsertEventDatabase) FindAccount(q interface{}) (Account, error) {
+func (m *mockInsertEventDatabase) FindAccount(ctx context.Context, q interface{}) (Account, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.findAccountResult, m.findAccountErr
 }
 
-func (m *mockInsertEventDatabase) FindSecret(q interface{}) (Secret, error) {
+func (m *mockInsertEventDatabase) FindSecret(ctx context.Context, q interface{}) (Secret, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.findSecretResult, m.findSecretErr
 }
 
-func (m *mockInsertEventDatabase) CreateEvent(e *Event) error {
+func (m *mockInsertEventDatabase) CreateEvent(ctx context.Context, e *Event) error {
 	m.methodArgs = append(m.methodArgs, e)
 	return m.createEventErr
 }
@@ -216,7 +217,7 @@ func TestPersistenceLayer_Insert(t *testing.T) {
 			r := &persistenceLayer{
 				dal: test.db,
 			}
-			err := r.Insert(test.callArgs[0], test.callArgs[1], test.callArgs[2], nil)
+			err := r.Insert(context.Background(), test.callArgs[0], test.callArgs[1], test.callArgs[2], nil)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -232,6 +233,130 @@ func TestPersistenceLayer_Insert(t *testing.T) {
 	}
 }
 
+type mockInsertEventsDatabase struct {
+	DataAccessLayer
+	accounts       map[string]Account
+	findSecretErr  error
+	createEventErr error
+	findAccount    []interface{}
+	created        []*Event
+}
+
+func (m *mockInsertEventsDatabase) FindAccount(ctx context.Context, q interface{}) (Account, error) {
+	m.findAccount = append(m.findAccount, q)
+	if account, ok := m.accounts[string(q.(FindAccountQueryActiveByID))]; ok {
+		return account, nil
+	}
+	return Account{}, ErrUnknownAccount("did not work")
+}
+
+func (m *mockInsertEventsDatabase) FindSecret(ctx context.Context, q interface{}) (Secret, error) {
+	return Secret{}, m.findSecretErr
+}
+
+func (m *mockInsertEventsDatabase) CreateEvent(ctx context.Context, e *Event) error {
+	m.created = append(m.created, e)
+	return m.createEventErr
+}
+
+func (m *mockInsertEventsDatabase) Transaction(context.Context) (Transaction, error) {
+	return m, nil
+}
+
+func (m *mockInsertEventsDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockInsertEventsDatabase) Rollback() error {
+	return nil
+}
+
+func TestPersistenceLayer_InsertEvents(t *testing.T) {
+	accounts := map[string]Account{
+		"account-a": {AccountID: "account-a", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="},
+		"account-b": {AccountID: "account-b", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="},
+	}
+	events := []PendingEvent{
+		{AccountID: "account-a", Payload: "payload-1"},
+		{AccountID: "account-z", Payload: "payload-2"},
+		{AccountID: "account-a", Payload: "payload-3"},
+		{AccountID: "account-b", Payload: "payload-4"},
+	}
+	tests := []struct {
+		name                string
+		userID              string
+		db                  *mockInsertEventsDatabase
+		expectError         bool
+		expectedEventErrors []bool
+		expectedCreated     int
+	}{
+		{
+			"ok",
+			"user-id",
+			&mockInsertEventsDatabase{accounts: accounts},
+			false,
+			[]bool{false, true, false, false},
+			3,
+		},
+		{
+			"unknown user",
+			"user-id",
+			&mockInsertEventsDatabase{accounts: accounts, findSecretErr: ErrUnknownSecret("did not work")},
+			false,
+			[]bool{true, true, true, true},
+			0,
+		},
+		{
+			"anonymous",
+			"",
+			&mockInsertEventsDatabase{accounts: accounts, findSecretErr: errors.New("did not work")},
+			false,
+			[]bool{false, true, false, false},
+			3,
+		},
+		{
+			"insert error",
+			"user-id",
+			&mockInsertEventsDatabase{accounts: accounts, createEventErr: errors.New("did not work")},
+			true,
+			nil,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{
+				dal: test.db,
+			}
+			eventErrors, err := p.InsertEvents(context.Background(), test.userID, events)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if test.expectedEventErrors != nil {
+				if len(eventErrors) != len(test.expectedEventErrors) {
+					t.Fatalf("Unexpected number of event errors %d", len(eventErrors))
+				}
+				for i, expectError := range test.expectedEventErrors {
+					if (eventErrors[i] != nil) != expectError {
+						t.Errorf("Unexpected error value %v for event %d", eventErrors[i], i)
+					}
+				}
+			}
+			if len(test.db.findAccount) != 3 {
+				t.Errorf("Expected each account to be looked up once, got %d lookups", len(test.db.findAccount))
+			}
+			if len(test.db.created) != test.expectedCreated {
+				t.Errorf("Expected %d events to be created, got %d", test.expectedCreated, len(test.db.created))
+			}
+			for _, evt := range test.db.created {
+				if evt.EventID == "" || evt.Sequence == "" || (test.userID != "" && evt.SecretID == nil) {
+					t.Errorf("Unexpected event shape %v", evt)
+				}
+			}
+		})
+	}
+}
+
 type mockPurgeEventsDatabase struct {
 	DataAccessLayer
 	findAccountsResult []Account
@@ -241,17 +366,17 @@ type mockPurgeEventsDatabase struct {
 	methodArgs         []interface{}
 }
 
-func (m *mockPurgeEventsDatabase) FindAccounts(q interface{}) ([]Account, error) {
+func (m *mockPurgeEventsDatabase) FindAccounts(ctx context.Context, q interface{}) ([]Account, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.findAccountsResult, m.findAccountsErr
 }
 
-func (m *mockPurgeEventsDatabase) DeleteEvents(q interface{}) (int64, error) {
+func (m *mockPurgeEventsDatabase) DeleteEvents(ctx context.Context, q interface{}) (int64, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.deleteEventsResult, m.deleteEventsErr
 }
 
-func (m *mockPurgeEventsDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+func (m *mockPurgeEventsDatabase) FindTombstones(ctx context.Context, q interface{}) ([]Tombstone, error) {
 	return nil, nil
 }
 
@@ -263,11 +388,11 @@ func (m *mockPurgeEventsDatabase) Rollback() error {
 	return nil
 }
 
-func (m *mockPurgeEventsDatabase) Transaction() (Transaction, error) {
+func (m *mockPurgeEventsDatabase) Transaction(context.Context) (Transaction, error) {
 	return m, nil
 }
 
-func (m *mockPurgeEventsDatabase) FindEvents(q interface{}) ([]Event, error) {
+func (m *mockPurgeEventsDatabase) FindEvents(ctx context.Context, q interface{}) ([]Event, error) {
 	return nil, nil
 }
 
@@ -358,7 +483,7 @@ func TestPersistenceLayer_Purge(t *testing.T) {
 			r := &persistenceLayer{
 				dal: test.db,
 			}
-			err := r.Purge("user-id")
+			err := r.Purge(context.Background(), "user-id")
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -383,17 +508,17 @@ type mockQueryEventDatabase struct {
 	methodArgs         []interface{}
 }
 
-func (m *mockQueryEventDatabase) FindAccounts(q interface{}) ([]Account, error) {
+func (m *mockQueryEventDatabase) FindAccounts(ctx context.Context, q interface{}) ([]Account, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.findAccountsResult, m.findAccountsErr
 }
 
-func (m *mockQueryEventDatabase) FindEvents(q interface{}) ([]Event, error) {
+func (m *mockQueryEventDatabase) FindEvents(ctx context.Context, q interface{}) ([]Event, error) {
 	m.methodArgs = append(m.methodArgs, q)
 	return m.findEventsResult, m.findEventsErr
 }
 
-func (m *mockQueryEventDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+func (m *mockQueryEventDatabase) FindTombstones(ctx context.Context, q interface{}) ([]Tombstone, error) {
 	return nil, nil
 }
 
@@ -503,7 +628,7 @@ func TestPersistenceLayer_Query(t *testing.T) {
 			p := &persistenceLayer{
 				dal: test.db,
 			}
-			result, err := p.Query(Query{
+			result, err := p.Query(context.Background(), Query{
 				UserID: "user-id",
 				Since:  "yesterday",
 			})
@@ -535,3 +660,272 @@ func TestGetLatestSeq(t *testing.T) {
 		t.Errorf("Unexpected result %v", result)
 	}
 }
+
+type mockPublisher struct {
+	changes []Change
+}
+
+func (m *mockPublisher) Publish(changes []Change) {
+	m.changes = append(m.changes, changes...)
+}
+
+func TestPersistenceLayer_Insert_Publish(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		pub := &mockPublisher{}
+		p := &persistenceLayer{dal: &mockInsertEventDatabase{}, publisher: pub}
+		if err := p.Insert(context.Background(), "", "account-a", "payload", nil); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(pub.changes) != 1 {
+			t.Fatalf("Expected one change to be published, got %d", len(pub.changes))
+		}
+		change := pub.changes[0]
+		if change.AccountID != "account-a" || change.Sequence == "" || change.Event == nil || change.Event.Payload != "payload" {
+			t.Errorf("Unexpected change %v", change)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		pub := &mockPublisher{}
+		p := &persistenceLayer{dal: &mockInsertEventDatabase{createEventErr: errors.New("did not work")}, publisher: pub}
+		if err := p.Insert(context.Background(), "", "account-a", "payload", nil); err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+		if len(pub.changes) != 0 {
+			t.Errorf("Expected no changes to be published, got %v", pub.changes)
+		}
+	})
+}
+
+type mockChangesDatabase struct {
+	DataAccessLayer
+	findEventsResult     []Event
+	findEventsErr        error
+	findTombstonesResult []Tombstone
+	findTombstonesErr    error
+}
+
+func (m *mockChangesDatabase) FindEvents(ctx context.Context, q interface{}) ([]Event, error) {
+	switch q.(type) {
+	case FindEventsQueryNewerThan, FindEventsQueryByEventIDs:
+		return m.findEventsResult, m.findEventsErr
+	default:
+		return nil, ErrBadQuery
+	}
+}
+
+func (m *mockChangesDatabase) FindTombstones(ctx context.Context, q interface{}) ([]Tombstone, error) {
+	if _, ok := q.(FindTombstonesQueryNewerThan); !ok {
+		return nil, ErrBadQuery
+	}
+	return m.findTombstonesResult, m.findTombstonesErr
+}
+
+func TestPersistenceLayer_Changes(t *testing.T) {
+	tests := []struct {
+		name           string
+		dal            DataAccessLayer
+		query          ChangesQuery
+		expectedResult []Change
+		expectError    bool
+	}{
+		{
+			"events error",
+			&mockChangesDatabase{findEventsErr: errors.New("did not work")},
+			ChangesQuery{Since: "seq-0", AccountIDs: []string{"account-a"}},
+			nil,
+			true,
+		},
+		{
+			"tombstones error",
+			&mockChangesDatabase{findTombstonesErr: errors.New("did not work")},
+			ChangesQuery{Since: "seq-0", AccountIDs: []string{"account-a"}},
+			nil,
+			true,
+		},
+		{
+			"empty",
+			&mockChangesDatabase{},
+			ChangesQuery{Since: "seq-0", AccountIDs: []string{"account-a"}},
+			[]Change{},
+			false,
+		},
+		{
+			"no accounts",
+			&mockChangesDatabase{findEventsErr: errors.New("did not work")},
+			ChangesQuery{Since: "seq-0"},
+			[]Change{},
+			false,
+		},
+		{
+			"ok",
+			&mockChangesDatabase{
+				findEventsResult: []Event{
+					{EventID: "event-a", AccountID: "account-a", Sequence: "seq-a", Payload: "payload-a"},
+					{EventID: "event-c", AccountID: "account-b", Sequence: "seq-c", Payload: "payload-c"},
+				},
+				findTombstonesResult: []Tombstone{
+					{EventID: "event-z", AccountID: "account-a", Sequence: "seq-b"},
+				},
+			},
+			ChangesQuery{Since: "seq-0", AccountIDs: []string{"account-a", "account-b"}},
+			[]Change{
+				{AccountID: "account-a", Sequence: "seq-a", Event: &EventResult{AccountID: "account-a", EventID: "event-a", Payload: "payload-a"}},
+				{AccountID: "account-a", Sequence: "seq-b", DeletedEventID: "event-z"},
+				{AccountID: "account-b", Sequence: "seq-c", Event: &EventResult{AccountID: "account-b", EventID: "event-c", Payload: "payload-c"}},
+			},
+			false,
+		},
+		{
+			"limit",
+			&mockChangesDatabase{
+				findEventsResult: []Event{
+					{EventID: "event-a", AccountID: "account-a", Sequence: "seq-a", Payload: "payload-a"},
+					{EventID: "event-c", AccountID: "account-b", Sequence: "seq-c", Payload: "payload-c"},
+				},
+				findTombstonesResult: []Tombstone{
+					{EventID: "event-z", AccountID: "account-a", Sequence: "seq-b"},
+				},
+			},
+			ChangesQuery{Since: "seq-0", AccountIDs: []string{"account-a", "account-b"}, Limit: 2},
+			[]Change{
+				{AccountID: "account-a", Sequence: "seq-a", Event: &EventResult{AccountID: "account-a", EventID: "event-a", Payload: "payload-a"}},
+				{AccountID: "account-a", Sequence: "seq-b", DeletedEventID: "event-z"},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			result, err := p.Changes(context.Background(), test.query)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_ResolveChanges(t *testing.T) {
+	changes := []Change{
+		{AccountID: "account-a", Sequence: "seq-a", Event: &EventResult{AccountID: "account-a", EventID: "event-a"}},
+		{AccountID: "account-a", Sequence: "seq-b", DeletedEventID: "event-z"},
+		{AccountID: "account-a", Sequence: "seq-c", Event: &EventResult{AccountID: "account-a", EventID: "event-c"}},
+	}
+	tests := []struct {
+		name           string
+		dal            DataAccessLayer
+		expectedResult []Change
+		expectError    bool
+	}{
+		{
+			"error",
+			&mockChangesDatabase{findEventsErr: errors.New("did not work")},
+			nil,
+			true,
+		},
+		{
+			"ok",
+			&mockChangesDatabase{
+				findEventsResult: []Event{
+					{EventID: "event-a", AccountID: "account-a", Sequence: "seq-a", Payload: "payload-a"},
+				},
+			},
+			[]Change{
+				{AccountID: "account-a", Sequence: "seq-a", Event: &EventResult{AccountID: "account-a", EventID: "event-a", Payload: "payload-a"}},
+				{AccountID: "account-a", Sequence: "seq-b", DeletedEventID: "event-z"},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			result, err := p.ResolveChanges(context.Background(), changes)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+			if changes[0].Event.Payload != "" {
+				t.Error("Expected given changes not to be modified")
+			}
+		})
+	}
+}
+
+type mockLatestSequenceDatabase struct {
+	DataAccessLayer
+	findEventsResult     []Event
+	findEventsErr        error
+	findTombstonesResult []Tombstone
+}
+
+func (m *mockLatestSequenceDatabase) FindEvents(ctx context.Context, q interface{}) ([]Event, error) {
+	if _, ok := q.(FindEventsQueryLatest); !ok {
+		return nil, ErrBadQuery
+	}
+	return m.findEventsResult, m.findEventsErr
+}
+
+func (m *mockLatestSequenceDatabase) FindTombstones(ctx context.Context, q interface{}) ([]Tombstone, error) {
+	if _, ok := q.(FindTombstonesQueryLatest); !ok {
+		return nil, ErrBadQuery
+	}
+	return m.findTombstonesResult, nil
+}
+
+func TestPersistenceLayer_LatestSequence(t *testing.T) {
+	tests := []struct {
+		name           string
+		dal            DataAccessLayer
+		expectedResult string
+		expectError    bool
+	}{
+		{
+			"error",
+			&mockLatestSequenceDatabase{findEventsErr: errors.New("did not work")},
+			"",
+			true,
+		},
+		{
+			"empty",
+			&mockLatestSequenceDatabase{},
+			"",
+			false,
+		},
+		{
+			"event",
+			&mockLatestSequenceDatabase{
+				findEventsResult:     []Event{{Sequence: "seq-b"}},
+				findTombstonesResult: []Tombstone{{Sequence: "seq-a"}},
+			},
+			"seq-b",
+			false,
+		},
+		{
+			"tombstone",
+			&mockLatestSequenceDatabase{
+				findEventsResult:     []Event{{Sequence: "seq-b"}},
+				findTombstonesResult: []Tombstone{{Sequence: "seq-c"}},
+			},
+			"seq-c",
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.dal}
+			result, err := p.LatestSequence(context.Background())
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
@@ -4,13 +4,19 @@
 package persistence
 
 import (
+	"context"
 	"fmt"
 	"time"
+
+	"github.com/offen/offen/server/tracing"
 )
 
 // Expire deletes all events in the give database that are older than the given
 // retention threshold.
-func (p *persistenceLayer) Expire(retention time.Duration) (int, error) {
+func (p *persistenceLayer) Expire(ctx context.Context, retention time.Duration) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Expire")
+	defer func() { tracing.End(span, err) }()
+
 	limit := time.Now().Add(-retention)
 	deadline, deadlineErr := EventIDAt(limit)
 	if deadlineErr != nil {
@@ -22,29 +28,32 @@ func (p *persistenceLayer) Expire(retention time.Duration) (int, error) {
 		return 0, fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
 	}
 
-	txn, err := p.dal.Transaction()
+	txn, err := p.dal.Transaction(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
-	expiredEvents, err := txn.FindEvents(FindEventsQueryOlderThan(deadline))
+	expiredEvents, err := txn.FindEvents(ctx, FindEventsQueryOlderThan(deadline))
 	if err != nil {
 		txn.Rollback()
 		return 0, fmt.Errorf("persistence: error looking up expired events: %w", err)
 	}
 
+	var changes []Change
 	for _, evt := range expiredEvents {
-		if err := txn.CreateTombstone(&Tombstone{
+		tombstone := Tombstone{
 			AccountID: evt.AccountID,
 			EventID:   evt.EventID,
 			SecretID:  evt.SecretID,
 			Sequence:  sequence,
-		}); err != nil {
+		}
+		if err := txn.CreateTombstone(ctx, &tombstone); err != nil {
 			txn.Rollback()
 			return 0, fmt.Errorf("persistence: error creating tombstone: %w", err)
 		}
+		changes = append(changes, tombstoneChange(tombstone))
 	}
 
-	eventsAffected, err := txn.DeleteEvents(DeleteEventsQueryOlderThan(deadline))
+	eventsAffected, err := txn.DeleteEvents(ctx, DeleteEventsQueryOlderThan(deadline))
 	if err != nil {
 		txn.Rollback()
 		return 0, fmt.Errorf("persistence: error deleting expired events: %w", err)
@@ -53,5 +62,6 @@ func (p *persistenceLayer) Expire(retention time.Duration) (int, error) {
 	if err := txn.Commit(); err != nil {
 		return 0, fmt.Errorf("persistence: error expiring events: %w", err)
 	}
+	p.publish(changes)
 	return int(eventsAffected), nil
 }
@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -15,15 +16,15 @@ type mockExpireDatabase struct {
 	affected int64
 }
 
-func (m *mockExpireDatabase) DeleteEvents(q interface{}) (int64, error) {
+func (m *mockExpireDatabase) DeleteEvents(ctx context.Context, q interface{}) (int64, error) {
 	return m.affected, m.err
 }
 
-func (m *mockExpireDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+func (m *mockExpireDatabase) FindTombstones(ctx context.Context, q interface{}) ([]Tombstone, error) {
 	return nil, m.err
 }
 
-func (m *mockExpireDatabase) FindEvents(q interface{}) ([]Event, error) {
+func (m *mockExpireDatabase) FindEvents(ctx context.Context, q interface{}) ([]Event, error) {
 	return nil, m.err
 }
 
@@ -35,7 +36,7 @@ func (m *mockExpireDatabase) Rollback() error {
 	return nil
 }
 
-func (m *mockExpireDatabase) Transaction() (Transaction, error) {
+func (m *mockExpireDatabase) Transaction(context.Context) (Transaction, error) {
 	return m, nil
 }
 
@@ -47,7 +48,7 @@ func TestPersistenceLayer_Expire(t *testing.T) {
 				affected: 9876,
 			},
 		}
-		affected, err := r.Expire(time.Second)
+		affected, err := r.Expire(context.Background(), time.Second)
 		if err != nil {
 			t.Errorf("Unexpected error %v", err)
 		}
@@ -61,7 +62,7 @@ func TestPersistenceLayer_Expire(t *testing.T) {
 				err: errors.New("did not work"),
 			},
 		}
-		affected, err := r.Expire(time.Second)
+		affected, err := r.Expire(context.Background(), time.Second)
 		if err == nil {
 			t.Errorf("Unexpected error value %v", err)
 		}
@@ -3,7 +3,16 @@
 
 package persistence
 
+import (
+	"context"
+
+	"github.com/offen/offen/server/tracing"
+)
+
 // CheckHealth returns an error when the database connection is not working.
-func (p *persistenceLayer) CheckHealth() error {
-	return p.dal.Ping()
+func (p *persistenceLayer) CheckHealth(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.CheckHealth")
+	defer func() { tracing.End(span, err) }()
+
+	return p.dal.Ping(ctx)
 }
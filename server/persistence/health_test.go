@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"testing"
 )
@@ -13,14 +14,14 @@ type mockPingDatabase struct {
 	err error
 }
 
-func (m *mockPingDatabase) Ping() error {
+func (m *mockPingDatabase) Ping(context.Context) error {
 	return m.err
 }
 
 func TestPersistenceLayer_CheckHealth(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		r := &persistenceLayer{dal: &mockPingDatabase{err: errors.New("did not work")}}
-		if err := r.CheckHealth(); err == nil {
+		if err := r.CheckHealth(context.Background()); err == nil {
 			t.Error("Expected error, got nil")
 		}
 	})
@@ -0,0 +1,55 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// lockPollInterval is the delay between two attempts of acquiring a lock
+// that is currently held by another instance.
+var lockPollInterval = time.Second
+
+// Lock is a lock shared between all instances connected to the same
+// database.
+type Lock interface {
+	// Check returns an error in case the lock is not held anymore, e.g.
+	// because the database closed the connection that acquired it.
+	Check(ctx context.Context) error
+	// Unlock releases the lock and must be called once the caller is done.
+	Unlock() error
+}
+
+// TryLock acquires the lock of the given name in case no other instance
+// connected to the same database is holding it.
+func (p *persistenceLayer) TryLock(ctx context.Context, name string) (Lock, bool, error) {
+	lock, acquired, err := p.dal.TryLock(ctx, name)
+	if err != nil {
+		return nil, false, fmt.Errorf("persistence: error acquiring lock %s: %w", name, err)
+	}
+	return lock, acquired, nil
+}
+
+// Lock blocks until the lock of the given name has been acquired or the
+// given context is cancelled. The returned function releases the lock.
+func (p *persistenceLayer) Lock(ctx context.Context, name string) (func() error, error) {
+	for {
+		lock, acquired, err := p.TryLock(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return lock.Unlock, nil
+		}
+		timer := time.NewTimer(lockPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("persistence: error waiting for lock %s: %w", name, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockLockDatabase struct {
+	DataAccessLayer
+	attempts  int
+	available int
+	err       error
+}
+
+type mockLock struct{}
+
+func (*mockLock) Check(context.Context) error { return nil }
+func (*mockLock) Unlock() error               { return nil }
+
+func (m *mockLockDatabase) TryLock(context.Context, string) (Lock, bool, error) {
+	m.attempts++
+	if m.err != nil {
+		return nil, false, m.err
+	}
+	if m.attempts < m.available {
+		return nil, false, nil
+	}
+	return &mockLock{}, true, nil
+}
+
+func TestPersistenceLayer_Lock(t *testing.T) {
+	defer func(i time.Duration) { lockPollInterval = i }(lockPollInterval)
+	lockPollInterval = time.Millisecond
+
+	t.Run("ok", func(t *testing.T) {
+		dal := &mockLockDatabase{available: 3}
+		p := &persistenceLayer{dal: dal}
+		unlock, err := p.Lock(context.Background(), "migrate")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := unlock(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if dal.attempts != 3 {
+			t.Errorf("Expected 3 attempts, got %d", dal.attempts)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockLockDatabase{err: errors.New("did not work")}}
+		if _, err := p.Lock(context.Background(), "migrate"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockLockDatabase{available: 1000}}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+		if _, err := p.Lock(ctx, "migrate"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+	})
+}
@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -12,19 +13,23 @@ import (
 
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/tracing"
 )
 
-func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
-	accountUser, err := p.findAccountUser(email, true, true)
+func (p *persistenceLayer) Login(ctx context.Context, email, password string) (_ LoginResult, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Login")
+	defer func() { tracing.End(span, err) }()
+
+	accountUser, err := p.findAccountUser(ctx, email, true, true)
 	if err != nil {
 		return LoginResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
 	}
 
-	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+	if err := keys.CompareString(ctx, password, accountUser.HashedPassword); err != nil {
 		return LoginResult{}, fmt.Errorf("persistence: error comparing passwords: %w", err)
 	}
 
-	pwDerivedKey, pwDerivedKeyErr := keys.DeriveKey(password, accountUser.Salt)
+	pwDerivedKey, pwDerivedKeyErr := keys.DeriveKey(ctx, password, accountUser.Salt)
 	if pwDerivedKeyErr != nil {
 		return LoginResult{}, fmt.Errorf("persistence: error deriving key from password: %w", pwDerivedKeyErr)
 	}
@@ -38,7 +43,7 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 		}
 		if emailDerivedKey == nil {
 			var err error
-			emailDerivedKey, err = keys.DeriveKey(email, accountUser.Salt)
+			emailDerivedKey, err = keys.DeriveKey(ctx, email, accountUser.Salt)
 			if err != nil {
 				return LoginResult{}, fmt.Errorf("persistence: error deriving key from email: %w", err)
 			}
@@ -47,10 +52,10 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 		if keyErr != nil {
 			return LoginResult{}, fmt.Errorf("persistence: error decryption email encrypted key: %w", keyErr)
 		}
-		if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, password); err != nil {
+		if err := relationship.addPasswordEncryptedKey(ctx, key, accountUser.Salt, password); err != nil {
 			return LoginResult{}, fmt.Errorf("persistence: error encrypting key for pending invitation: %w", err)
 		}
-		if err := p.dal.UpdateAccountUserRelationship(&relationship); err != nil {
+		if err := p.dal.UpdateAccountUserRelationship(ctx, &relationship); err != nil {
 			return LoginResult{}, fmt.Errorf("persistence: error accepting pending invitation: %w", err)
 		}
 		accountUser.Relationships[idx] = relationship
@@ -67,7 +72,7 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 			return LoginResult{}, kErr
 		}
 
-		account, err := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
+		account, err := p.dal.FindAccount(ctx, FindAccountQueryByID(relationship.AccountID))
 		if err != nil {
 			return LoginResult{}, fmt.Errorf(`persistence: error looking up account with id "%s": %w`, relationship.AccountID, err)
 		}
@@ -88,8 +93,12 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 	}, nil
 }
 
-func (p *persistenceLayer) LookupAccountUser(accountUserID string) (LoginResult, error) {
+func (p *persistenceLayer) LookupAccountUser(ctx context.Context, accountUserID string) (_ LoginResult, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.LookupAccountUser")
+	defer func() { tracing.End(span, err) }()
+
 	accountUser, err := p.dal.FindAccountUser(
+		ctx,
 		FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID),
 	)
 	if err != nil {
@@ -108,15 +117,19 @@ func (p *persistenceLayer) LookupAccountUser(accountUserID string) (LoginResult,
 	return result, nil
 }
 
-func (p *persistenceLayer) ChangePassword(userID, currentPassword, changedPassword string) error {
+func (p *persistenceLayer) ChangePassword(ctx context.Context, userID, currentPassword, changedPassword string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.ChangePassword")
+	defer func() { tracing.End(span, err) }()
+
 	accountUser, err := p.dal.FindAccountUser(
+		ctx,
 		FindAccountUserQueryByAccountUserIDIncludeRelationships(userID),
 	)
 	if err != nil {
 		return fmt.Errorf("persistence: error looking up account user: %w", err)
 	}
 
-	if err := keys.CompareString(currentPassword, accountUser.HashedPassword); err != nil {
+	if err := keys.CompareString(ctx, currentPassword, accountUser.HashedPassword); err != nil {
 		return fmt.Errorf("persistence: current password did not match: %w", err)
 	}
 
@@ -124,12 +137,12 @@ func (p *persistenceLayer) ChangePassword(userID, currentPassword, changedPasswo
 		return fmt.Errorf("persistence: error validating new password: %w", err)
 	}
 
-	newPasswordHash, hashErr := keys.HashString(changedPassword)
+	newPasswordHash, hashErr := keys.HashString(ctx, changedPassword)
 	if hashErr != nil {
 		return fmt.Errorf("persistence: error hashing new password: %w", hashErr)
 	}
 	accountUser.HashedPassword = newPasswordHash.Marshal()
-	keyFromCurrentPassword, keyErr := keys.DeriveKey(currentPassword, accountUser.Salt)
+	keyFromCurrentPassword, keyErr := keys.DeriveKey(ctx, currentPassword, accountUser.Salt)
 	if keyErr != nil {
 		return fmt.Errorf("persistence: error deriving key from current password: %w", keyErr)
 	}
@@ -139,19 +152,22 @@ func (p *persistenceLayer) ChangePassword(userID, currentPassword, changedPasswo
 		if decryptErr != nil {
 			return fmt.Errorf("persistence: error decrypting key using password: %w", decryptErr)
 		}
-		if err := relationship.addPasswordEncryptedKey(decryptedKey, accountUser.Salt, changedPassword); err != nil {
+		if err := relationship.addPasswordEncryptedKey(ctx, decryptedKey, accountUser.Salt, changedPassword); err != nil {
 			return fmt.Errorf("persistence: error updating password encrypted key: %w", err)
 		}
 		accountUser.Relationships[index] = relationship
 	}
-	if err := p.dal.UpdateAccountUser(&accountUser); err != nil {
+	if err := p.dal.UpdateAccountUser(ctx, &accountUser); err != nil {
 		return fmt.Errorf("persistence: error updating password for user: %w", err)
 	}
 	return nil
 }
 
-func (p *persistenceLayer) ResetPassword(emailAddress, password string, oneTimeKey []byte) error {
-	accountUser, err := p.findAccountUser(emailAddress, true, false)
+func (p *persistenceLayer) ResetPassword(ctx context.Context, emailAddress, password string, oneTimeKey []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.ResetPassword")
+	defer func() { tracing.End(span, err) }()
+
+	accountUser, err := p.findAccountUser(ctx, emailAddress, true, false)
 	if err != nil {
 		return fmt.Errorf("persistence: error looking up account user: %w", err)
 	}
@@ -165,25 +181,28 @@ func (p *persistenceLayer) ResetPassword(emailAddress, password string, oneTimeK
 		if decryptionErr != nil {
 			return fmt.Errorf("persistence: error decrypting key encryption key: %w", decryptionErr)
 		}
-		if err := relationship.addPasswordEncryptedKey(keyEncryptionKey, accountUser.Salt, password); err != nil {
+		if err := relationship.addPasswordEncryptedKey(ctx, keyEncryptionKey, accountUser.Salt, password); err != nil {
 			return fmt.Errorf("persistence: error adding password encrypted key to relationship: %w", err)
 		}
 		relationship.OneTimeEncryptedKeyEncryptionKey = ""
 		accountUser.Relationships[index] = relationship
 	}
-	passwordHash, hashErr := keys.HashString(password)
+	passwordHash, hashErr := keys.HashString(ctx, password)
 	if hashErr != nil {
 		return fmt.Errorf("persistence: error hashing password: %w", hashErr)
 	}
 	accountUser.HashedPassword = passwordHash.Marshal()
-	if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+	if err := p.dal.UpdateAccountUser(ctx, accountUser); err != nil {
 		return fmt.Errorf("persistence: error updating password on account user: %w", err)
 	}
 	return nil
 }
 
-func (p *persistenceLayer) ChangeEmail(userID, newEmailAddress, currentEmailAddress, password string) error {
-	accountUser, err := p.findAccountUser(currentEmailAddress, true, true)
+func (p *persistenceLayer) ChangeEmail(ctx context.Context, userID, newEmailAddress, currentEmailAddress, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.ChangeEmail")
+	defer func() { tracing.End(span, err) }()
+
+	accountUser, err := p.findAccountUser(ctx, currentEmailAddress, true, true)
 	if err != nil {
 		return fmt.Errorf("persistence: error looking up account user: %w", err)
 	}
@@ -192,25 +211,25 @@ func (p *persistenceLayer) ChangeEmail(userID, newEmailAddress, currentEmailAddr
 		return errors.New("persistence: current email did not match requester credentials")
 	}
 
-	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+	if err := keys.CompareString(ctx, password, accountUser.HashedPassword); err != nil {
 		return fmt.Errorf("persistence: passwords did not match: %w", err)
 	}
 
-	if err := keys.CompareString(currentEmailAddress, accountUser.HashedEmail); err != nil {
+	if err := keys.CompareString(ctx, currentEmailAddress, accountUser.HashedEmail); err != nil {
 		return fmt.Errorf("persistence: current email did not match: %w", err)
 	}
 
-	existing, _ := p.findAccountUser(newEmailAddress, false, false)
+	existing, _ := p.findAccountUser(ctx, newEmailAddress, false, false)
 	if existing != nil && existing.AccountUserID != userID {
 		return fmt.Errorf("persistence: given email %s is already in use", newEmailAddress)
 	}
 
-	keyFromCurrentEmail, keyErr := keys.DeriveKey(currentEmailAddress, accountUser.Salt)
+	keyFromCurrentEmail, keyErr := keys.DeriveKey(ctx, currentEmailAddress, accountUser.Salt)
 	if keyErr != nil {
 		return fmt.Errorf("persistence: error deriving key from email: %w", keyErr)
 	}
 
-	hashedEmail, hashErr := keys.HashString(newEmailAddress)
+	hashedEmail, hashErr := keys.HashString(ctx, newEmailAddress)
 	if hashErr != nil {
 		return fmt.Errorf("persistence: error hashing updated email address: %w", hashErr)
 	}
@@ -221,24 +240,27 @@ func (p *persistenceLayer) ChangeEmail(userID, newEmailAddress, currentEmailAddr
 		if decryptionErr != nil {
 			return decryptionErr
 		}
-		if err := relationship.addEmailEncryptedKey(decryptedKey, accountUser.Salt, newEmailAddress); err != nil {
+		if err := relationship.addEmailEncryptedKey(ctx, decryptedKey, accountUser.Salt, newEmailAddress); err != nil {
 			return fmt.Errorf("persistence: error adding email key to relationship: %w", err)
 		}
 		accountUser.Relationships[index] = relationship
 	}
-	if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+	if err := p.dal.UpdateAccountUser(ctx, accountUser); err != nil {
 		return fmt.Errorf("persistence: error updating hashed email on account user: %w", err)
 	}
 	return nil
 }
 
-func (p *persistenceLayer) GenerateOneTimeKey(emailAddress string) ([]byte, error) {
-	accountUser, err := p.findAccountUser(emailAddress, true, false)
+func (p *persistenceLayer) GenerateOneTimeKey(ctx context.Context, emailAddress string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.GenerateOneTimeKey")
+	defer func() { tracing.End(span, err) }()
+
+	accountUser, err := p.findAccountUser(ctx, emailAddress, true, false)
 	if err != nil {
 		return nil, fmt.Errorf("persistence: error looking up account user: %w", err)
 	}
 
-	emailDerivedKey, deriveErr := keys.DeriveKey(emailAddress, accountUser.Salt)
+	emailDerivedKey, deriveErr := keys.DeriveKey(ctx, emailAddress, accountUser.Salt)
 	if deriveErr != nil {
 		return nil, fmt.Errorf("error deriving key from email address: %w", deriveErr)
 	}
@@ -246,7 +268,7 @@ func (p *persistenceLayer) GenerateOneTimeKey(emailAddress string) ([]byte, erro
 	oneTimeKey, _ := keys.GenerateRandomValue(keys.DefaultEncryptionKeySize)
 	oneTimeKeyBytes, _ := base64.StdEncoding.DecodeString(oneTimeKey)
 
-	txn, err := p.dal.Transaction()
+	txn, err := p.dal.Transaction(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
@@ -260,7 +282,7 @@ func (p *persistenceLayer) GenerateOneTimeKey(emailAddress string) ([]byte, erro
 			txn.Rollback()
 			return nil, fmt.Errorf("persistence: erro adding one time key to relationship: %w", err)
 		}
-		if err := txn.UpdateAccountUserRelationship(&relationship); err != nil {
+		if err := txn.UpdateAccountUserRelationship(ctx, &relationship); err != nil {
 			txn.Rollback()
 			return nil, fmt.Errorf("persistence: error updating relationship record: %w", err)
 		}
@@ -271,22 +293,22 @@ func (p *persistenceLayer) GenerateOneTimeKey(emailAddress string) ([]byte, erro
 	return oneTimeKeyBytes, nil
 }
 
-func (p *persistenceLayer) findAccountUser(emailAddress string, includeRelationships, IncludeInvitations bool) (*AccountUser, error) {
-	accountUsers, err := p.dal.FindAccountUsers(FindAccountUsersQueryAllAccountUsers{
+func (p *persistenceLayer) findAccountUser(ctx context.Context, emailAddress string, includeRelationships, IncludeInvitations bool) (*AccountUser, error) {
+	accountUsers, err := p.dal.FindAccountUsers(ctx, FindAccountUsersQueryAllAccountUsers{
 		IncludeRelationships: includeRelationships,
 		IncludeInvitations:   IncludeInvitations,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("persistence: error looking up account users: %w", err)
 	}
-	match, err := selectAccountUser(accountUsers, emailAddress)
+	match, err := selectAccountUser(ctx, accountUsers, emailAddress)
 	if err != nil {
 		return nil, fmt.Errorf("persistence: could not find user with email %s: %w", emailAddress, err)
 	}
 	return match, nil
 }
 
-func selectAccountUser(available []AccountUser, email string) (*AccountUser, error) {
+func selectAccountUser(ctx context.Context, available []AccountUser, email string) (*AccountUser, error) {
 	// this is so that users that have signed up at a later point in time
 	// also get decent login times
 	rand.Seed(time.Now().UnixNano())
@@ -295,7 +317,7 @@ func selectAccountUser(available []AccountUser, email string) (*AccountUser, err
 	})
 
 	for _, user := range available {
-		if err := keys.CompareString(email, user.HashedEmail); err == nil {
+		if err := keys.CompareString(ctx, email, user.HashedEmail); err == nil {
 			return &user, nil
 		}
 	}
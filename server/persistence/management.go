@@ -4,39 +4,63 @@
 package persistence
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/tracing"
 )
 
-func (p *persistenceLayer) UpdateAccountStyles(accountID, accountStyles string) error {
-	a, err := p.dal.FindAccount(FindAccountQueryByID(accountID))
+func (p *persistenceLayer) UpdateAccountStyles(ctx context.Context, accountID, accountStyles string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.UpdateAccountStyles")
+	defer func() { tracing.End(span, err) }()
+
+	a, err := p.dal.FindAccount(ctx, FindAccountQueryByID(accountID))
 	if err != nil {
 		return fmt.Errorf("relational: error looking up account before updating custom styles: %w", err)
 	}
 
 	a.AccountStyles = accountStyles
-	if err := p.dal.UpdateAccount(&a); err != nil {
+	if err := p.dal.UpdateAccount(ctx, &a); err != nil {
 		return fmt.Errorf("relational: error updating account %s with custom styles: %w", accountID, err)
 	}
 	return nil
 }
 
-func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (ShareAccountResult, error) {
+func (p *persistenceLayer) UpdateAccountAllowedOrigins(ctx context.Context, accountID string, origins []string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.UpdateAccountAllowedOrigins")
+	defer func() { tracing.End(span, err) }()
+
+	a, err := p.dal.FindAccount(ctx, FindAccountQueryByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating allowed origins: %w", err)
+	}
+
+	a.AllowedOrigins = origins
+	if err := p.dal.UpdateAccount(ctx, &a); err != nil {
+		return fmt.Errorf("persistence: error updating account %s with allowed origins: %w", accountID, err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) ShareAccount(ctx context.Context, inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (_ ShareAccountResult, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.ShareAccount")
+	defer func() { tracing.End(span, err) }()
+
 	var result ShareAccountResult
 	var invitedAccountUser *AccountUser
 
-	accountUsers, err := p.dal.FindAccountUsers(FindAccountUsersQueryAllAccountUsers{true, false})
+	accountUsers, err := p.dal.FindAccountUsers(ctx, FindAccountUsersQueryAllAccountUsers{true, false})
 	if err != nil {
 		return result, fmt.Errorf("persistence: error looking up account users: %w", err)
 	}
 
 	// First, we need to check if the provider has given valid credentials
-	provider, findErr := selectAccountUser(accountUsers, providerEmailAddress)
+	provider, findErr := selectAccountUser(ctx, accountUsers, providerEmailAddress)
 	if findErr != nil {
 		return result, fmt.Errorf("persistence: error looking up account user: %w", findErr)
 	}
-	if err := keys.CompareString(providerPassword, provider.HashedPassword); err != nil {
+	if err := keys.CompareString(ctx, providerPassword, provider.HashedPassword); err != nil {
 		return result, fmt.Errorf("persistence: error comparing passwords: %w", err)
 	}
 
@@ -46,29 +70,29 @@ func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddres
 	}
 	// Next, we need to check whether the given address is already associated
 	// with an existing account.
-	if match, err := selectAccountUser(accountUsers, inviteeEmailAddress); err == nil {
+	if match, err := selectAccountUser(ctx, accountUsers, inviteeEmailAddress); err == nil {
 		if match.HashedPassword != "" {
 			result.UserExistsWithPassword = true
 		}
 		invitedAccountUser = match
 		if match.AdminLevel != targetAdminLevel {
 			invitedAccountUser.AdminLevel = targetAdminLevel
-			if err := p.dal.UpdateAccountUser(invitedAccountUser); err != nil {
+			if err := p.dal.UpdateAccountUser(ctx, invitedAccountUser); err != nil {
 				return result, fmt.Errorf("persistence: error updating admin level on previously non-admin user: %w", err)
 			}
 		}
 	} else {
-		newAccountUserRecord, err := newAccountUser(inviteeEmailAddress, "", targetAdminLevel)
+		newAccountUserRecord, err := newAccountUser(ctx, inviteeEmailAddress, "", targetAdminLevel)
 		if err != nil {
 			return result, fmt.Errorf("persistence: error creating new account user for invitee: %w", err)
 		}
 		invitedAccountUser = newAccountUserRecord
-		if err := p.dal.CreateAccountUser(invitedAccountUser); err != nil {
+		if err := p.dal.CreateAccountUser(ctx, invitedAccountUser); err != nil {
 			return result, fmt.Errorf("persistence: error persisting new account user for invitee: %w", err)
 		}
 	}
 
-	providerKey, deriveKeyErr := keys.DeriveKey(providerPassword, provider.Salt)
+	providerKey, deriveKeyErr := keys.DeriveKey(ctx, providerPassword, provider.Salt)
 	if deriveKeyErr != nil {
 		return result, fmt.Errorf("persistence: error deriving key from email address: %w", deriveKeyErr)
 	}
@@ -86,7 +110,7 @@ outer:
 		if accountID == "" || relationship.AccountID == accountID {
 			// with no filter given, the invitee inherits all relationships from
 			// the provider
-			account, accountErr := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
+			account, accountErr := p.dal.FindAccount(ctx, FindAccountQueryByID(relationship.AccountID))
 			if accountErr != nil {
 				return result, fmt.Errorf("persistence: error looking up account info for relationship %s: %w", relationship.RelationshipID, err)
 			}
@@ -95,7 +119,7 @@ outer:
 		}
 	}
 
-	txn, err := p.dal.Transaction()
+	txn, err := p.dal.Transaction(ctx)
 	if err != nil {
 		return result, fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
@@ -114,12 +138,12 @@ outer:
 			return result, fmt.Errorf("persistence: error decrypting email encrypted key: %w", decryptErr)
 		}
 
-		if err := inviteeRelationship.addEmailEncryptedKey(decryptedKey, invitedAccountUser.Salt, inviteeEmailAddress); err != nil {
+		if err := inviteeRelationship.addEmailEncryptedKey(ctx, decryptedKey, invitedAccountUser.Salt, inviteeEmailAddress); err != nil {
 			txn.Rollback()
 			return result, fmt.Errorf("persistence: error adding email encrypted key: %w", err)
 		}
 
-		if err := txn.CreateAccountUserRelationship(inviteeRelationship); err != nil {
+		if err := txn.CreateAccountUserRelationship(ctx, inviteeRelationship); err != nil {
 			return result, fmt.Errorf("persistence: error persisting account user relationship: %w", err)
 		}
 	}
@@ -129,8 +153,11 @@ outer:
 	return result, nil
 }
 
-func (p *persistenceLayer) Join(emailAddress, password string) error {
-	match, err := p.findAccountUser(emailAddress, true, true)
+func (p *persistenceLayer) Join(ctx context.Context, emailAddress, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Join")
+	defer func() { tracing.End(span, err) }()
+
+	match, err := p.findAccountUser(ctx, emailAddress, true, true)
 	if err != nil {
 		return fmt.Errorf("persistence: could not find user with email %s: %w", emailAddress, err)
 	}
@@ -143,13 +170,13 @@ func (p *persistenceLayer) Join(emailAddress, password string) error {
 		return fmt.Errorf("persistence: error validating password: %w", err)
 	}
 
-	cipher, err := keys.HashString(password)
+	cipher, err := keys.HashString(ctx, password)
 	if err != nil {
 		return fmt.Errorf("persistence: hashing given password: %w", err)
 	}
 	match.HashedPassword = cipher.Marshal()
 
-	emailDerivedKey, deriveErr := keys.DeriveKey(emailAddress, match.Salt)
+	emailDerivedKey, deriveErr := keys.DeriveKey(ctx, emailAddress, match.Salt)
 	if deriveErr != nil {
 		return fmt.Errorf("persistence: error deriving key from email: %w", deriveErr)
 	}
@@ -160,13 +187,13 @@ func (p *persistenceLayer) Join(emailAddress, password string) error {
 			return fmt.Errorf("persistence: error decrypting email encrypted key: %w", keyErr)
 		}
 
-		if err := relationship.addPasswordEncryptedKey(key, match.Salt, password); err != nil {
+		if err := relationship.addPasswordEncryptedKey(ctx, key, match.Salt, password); err != nil {
 			return fmt.Errorf("persistence: error adding password encrypted key: %w", err)
 		}
 		match.Relationships[index] = relationship
 	}
 
-	if err := p.dal.UpdateAccountUser(match); err != nil {
+	if err := p.dal.UpdateAccountUser(ctx, match); err != nil {
 		return fmt.Errorf("persistence: failed to update account user: %w", err)
 	}
 	return nil
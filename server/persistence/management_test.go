@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"testing"
@@ -21,15 +22,15 @@ type mockShareAccountDatabase struct {
 	transactionErr          error
 }
 
-func (m *mockShareAccountDatabase) FindAccountUsers(interface{}) ([]AccountUser, error) {
+func (m *mockShareAccountDatabase) FindAccountUsers(context.Context, interface{}) ([]AccountUser, error) {
 	return m.findAcccountUsersResult, m.findAccountUsersErr
 }
 
-func (m *mockShareAccountDatabase) CreateAccountUser(*AccountUser) error {
+func (m *mockShareAccountDatabase) CreateAccountUser(context.Context, *AccountUser) error {
 	return m.createAccountUserErr
 }
 
-func (m *mockShareAccountDatabase) CreateAccountUserRelationship(*AccountUserRelationship) error {
+func (m *mockShareAccountDatabase) CreateAccountUserRelationship(context.Context, *AccountUserRelationship) error {
 	return m.createRelationshipErr
 }
 
@@ -41,11 +42,11 @@ func (m *mockShareAccountDatabase) Rollback() error {
 	return nil
 }
 
-func (m *mockShareAccountDatabase) Transaction() (Transaction, error) {
+func (m *mockShareAccountDatabase) Transaction(context.Context) (Transaction, error) {
 	return m, m.transactionErr
 }
 
-func (m *mockShareAccountDatabase) FindAccount(interface{}) (Account, error) {
+func (m *mockShareAccountDatabase) FindAccount(context.Context, interface{}) (Account, error) {
 	return Account{Name: "account-name", AccountID: "account-id"}, nil
 }
 
@@ -77,7 +78,7 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 			&mockShareAccountDatabase{
 				findAcccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("hioffen@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
+						a, _ := newAccountUser(context.Background(), "hioffen@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
 						return *a
 					})(),
 				},
@@ -94,7 +95,7 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 			&mockShareAccountDatabase{
 				findAcccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("develop@offen.dev", "d3v3lop", AccountUserAdminLevelSuperAdmin)
+						a, _ := newAccountUser(context.Background(), "develop@offen.dev", "d3v3lop", AccountUserAdminLevelSuperAdmin)
 						return *a
 					})(),
 				},
@@ -111,7 +112,7 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 			&mockShareAccountDatabase{
 				findAcccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
+						a, _ := newAccountUser(context.Background(), "develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
 						return *a
 					})(),
 				},
@@ -129,10 +130,10 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 			&mockShareAccountDatabase{
 				findAcccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
+						a, _ := newAccountUser(context.Background(), "develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
 
-						emailDerivedKey, _ := keys.DeriveKey("develop@offen.dev", a.Salt)
-						passwordDerivedKey, _ := keys.DeriveKey("develop", a.Salt)
+						emailDerivedKey, _ := keys.DeriveKey(context.Background(), "develop@offen.dev", a.Salt)
+						passwordDerivedKey, _ := keys.DeriveKey(context.Background(), "develop", a.Salt)
 
 						key := []byte("key")
 						e, _ := keys.EncryptWith(emailDerivedKey, key)
@@ -149,7 +150,7 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 						return *a
 					})(),
 					(func() AccountUser {
-						a, _ := newAccountUser("invitee@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
+						a, _ := newAccountUser(context.Background(), "invitee@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
 						return *a
 					})(),
 				},
@@ -169,10 +170,10 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 			&mockShareAccountDatabase{
 				findAcccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
+						a, _ := newAccountUser(context.Background(), "develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
 
-						emailDerivedKey, _ := keys.DeriveKey("develop@offen.dev", a.Salt)
-						passwordDerivedKey, _ := keys.DeriveKey("develop", a.Salt)
+						emailDerivedKey, _ := keys.DeriveKey(context.Background(), "develop@offen.dev", a.Salt)
+						passwordDerivedKey, _ := keys.DeriveKey(context.Background(), "develop", a.Salt)
 
 						key := []byte("key")
 						e, _ := keys.EncryptWith(emailDerivedKey, key)
@@ -203,8 +204,8 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := persistenceLayer{test.dal}
-			result, err := p.ShareAccount(test.invitee, test.email, test.password, test.accountID, true)
+			p := persistenceLayer{dal: test.dal}
+			result, err := p.ShareAccount(context.Background(), test.invitee, test.email, test.password, test.accountID, true)
 
 			if test.expectErr != (err != nil) {
 				t.Errorf("Unexpected error value %v", err)
@@ -227,7 +228,7 @@ type mockJoinDatabase struct {
 	commitErr              error
 }
 
-func (m *mockJoinDatabase) FindAccountUsers(interface{}) ([]AccountUser, error) {
+func (m *mockJoinDatabase) FindAccountUsers(context.Context, interface{}) ([]AccountUser, error) {
 	return m.findAccountUsersResult, m.findAccountUserErr
 }
 
@@ -239,15 +240,15 @@ func (m *mockJoinDatabase) Rollback() error {
 	return nil
 }
 
-func (m *mockJoinDatabase) Transaction() (Transaction, error) {
+func (m *mockJoinDatabase) Transaction(context.Context) (Transaction, error) {
 	return m, m.transactionErr
 }
 
-func (m *mockJoinDatabase) UpdateAccountUserRelationship(*AccountUserRelationship) error {
+func (m *mockJoinDatabase) UpdateAccountUserRelationship(context.Context, *AccountUserRelationship) error {
 	return m.updateRelationshipErr
 }
 
-func (m *mockJoinDatabase) UpdateAccountUser(*AccountUser) error {
+func (m *mockJoinDatabase) UpdateAccountUser(context.Context, *AccountUser) error {
 	return m.updateAccountUserErr
 }
 
@@ -282,7 +283,7 @@ func TestPersistenceLayer_Join(t *testing.T) {
 			&mockJoinDatabase{
 				findAccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("foo@bar.com", "s3cret", 0)
+						a, _ := newAccountUser(context.Background(), "foo@bar.com", "s3cret", 0)
 						return *a
 					})(),
 				},
@@ -296,7 +297,7 @@ func TestPersistenceLayer_Join(t *testing.T) {
 			&mockJoinDatabase{
 				findAccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("foo@bar.com", "secret", 0)
+						a, _ := newAccountUser(context.Background(), "foo@bar.com", "secret", 0)
 						return *a
 					})(),
 				},
@@ -311,8 +312,8 @@ func TestPersistenceLayer_Join(t *testing.T) {
 			&mockJoinDatabase{
 				findAccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("foo@bar.com", "secret", 0)
-						emailDerivedKey, _ := keys.DeriveKey("foo@bar.com", a.Salt)
+						a, _ := newAccountUser(context.Background(), "foo@bar.com", "secret", 0)
+						emailDerivedKey, _ := keys.DeriveKey(context.Background(), "foo@bar.com", a.Salt)
 
 						key := []byte("key")
 						c, _ := keys.EncryptWith(emailDerivedKey, key)
@@ -338,8 +339,8 @@ func TestPersistenceLayer_Join(t *testing.T) {
 			&mockJoinDatabase{
 				findAccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("foo@bar.com", "secret", 0)
-						emailDerivedKey, _ := keys.DeriveKey("foo@bar.com", a.Salt)
+						a, _ := newAccountUser(context.Background(), "foo@bar.com", "secret", 0)
+						emailDerivedKey, _ := keys.DeriveKey(context.Background(), "foo@bar.com", a.Salt)
 
 						key := []byte("key")
 						c, _ := keys.EncryptWith(emailDerivedKey, key)
@@ -365,8 +366,8 @@ func TestPersistenceLayer_Join(t *testing.T) {
 			&mockJoinDatabase{
 				findAccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("foo@bar.com", "secret", 0)
-						emailDerivedKey, _ := keys.DeriveKey("foo@bar.com", a.Salt)
+						a, _ := newAccountUser(context.Background(), "foo@bar.com", "secret", 0)
+						emailDerivedKey, _ := keys.DeriveKey(context.Background(), "foo@bar.com", a.Salt)
 
 						key := []byte("key")
 						c, _ := keys.EncryptWith(emailDerivedKey, key)
@@ -391,9 +392,9 @@ func TestPersistenceLayer_Join(t *testing.T) {
 			&mockJoinDatabase{
 				findAccountUsersResult: []AccountUser{
 					(func() AccountUser {
-						a, _ := newAccountUser("foo@bar.com", "secretsecretsosecret", 0)
+						a, _ := newAccountUser(context.Background(), "foo@bar.com", "secretsecretsosecret", 0)
 						a.HashedPassword = ""
-						emailDerivedKey, _ := keys.DeriveKey("foo@bar.com", a.Salt)
+						emailDerivedKey, _ := keys.DeriveKey(context.Background(), "foo@bar.com", a.Salt)
 
 						key := []byte("key")
 						c, _ := keys.EncryptWith(emailDerivedKey, key)
@@ -416,8 +417,8 @@ func TestPersistenceLayer_Join(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := &persistenceLayer{test.dal}
-			err := p.Join(test.emailArg, test.pwArg)
+			p := &persistenceLayer{dal: test.dal}
+			err := p.Join(context.Background(), test.emailArg, test.pwArg)
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value: %v", err)
 			}
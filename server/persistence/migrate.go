@@ -3,8 +3,26 @@
 
 package persistence
 
+import (
+	"context"
+
+	"github.com/offen/offen/server/tracing"
+)
+
 // Migrate runs the defined database migrations in the given db or initializes it
 // from the latest definition if it is still blank.
-func (p *persistenceLayer) Migrate() error {
-	return p.dal.ApplyMigrations()
+func (p *persistenceLayer) Migrate(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.Migrate")
+	defer func() { tracing.End(span, err) }()
+
+	return p.dal.ApplyMigrations(ctx)
+}
+
+// PendingMigrations returns the identifiers of all database migrations that
+// have not been applied yet.
+func (p *persistenceLayer) PendingMigrations(ctx context.Context) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "persistence.PendingMigrations")
+	defer func() { tracing.End(span, err) }()
+
+	return p.dal.PendingMigrations(ctx)
 }
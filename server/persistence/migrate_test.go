@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"errors"
 	"testing"
 )
@@ -13,14 +14,14 @@ type mockMigrateDatabase struct {
 	err error
 }
 
-func (m *mockMigrateDatabase) ApplyMigrations() error {
+func (m *mockMigrateDatabase) ApplyMigrations(context.Context) error {
 	return m.err
 }
 
 func TestPersistenceLayer_Migrate(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		r := &persistenceLayer{dal: &mockMigrateDatabase{err: errors.New("did not work")}}
-		if err := r.Migrate(); err == nil {
+		if err := r.Migrate(context.Background()); err == nil {
 			t.Error("Expected error, got nil")
 		}
 	})
@@ -4,6 +4,7 @@
 package persistence
 
 import (
+	"context"
 	"time"
 )
 
@@ -11,31 +12,46 @@ import (
 // layer. It does not make any assumptions about how data is being modelled
 // and stored.
 type Service interface {
-	Insert(userID, accountID, payload string, eventID *string) error
-	Query(Query) (EventsResult, error)
-	GetAccount(accountID string, styles, events bool, eventsSince string) (AccountResult, error)
-	CreateAccount(name, creatorEmailAddress, creatorPassword string) error
-	RetireAccount(accountID string) error
-	AssociateUserSecret(accountID, userID, encryptedUserSecret string) error
-	Purge(userID string) error
-	Login(email, password string) (LoginResult, error)
-	LookupAccountUser(userID string) (LoginResult, error)
-	ChangePassword(userID, currentPassword, changedPassword string) error
-	ChangeEmail(userID, emailAddress, emailCurrent, password string) error
-	GenerateOneTimeKey(emailAddress string) ([]byte, error)
-	ResetPassword(emailAddress, password string, oneTimeKey []byte) error
-	ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (ShareAccountResult, error)
-	UpdateAccountStyles(accountID, styles string) error
-	Join(emailAddress, password string) error
-	Expire(retention time.Duration) (int, error)
-	Bootstrap(data BootstrapConfig) error
-	ProbeEmpty() bool
-	CheckHealth() error
-	Migrate() error
+	Insert(ctx context.Context, userID, accountID, payload string, eventID *string) error
+	InsertEvents(ctx context.Context, userID string, events []PendingEvent) ([]error, error)
+	Query(context.Context, Query) (EventsResult, error)
+	GetAccount(ctx context.Context, accountID string, styles, events bool, eventsSince string) (AccountResult, error)
+	CreateAccount(ctx context.Context, name, creatorEmailAddress, creatorPassword string) error
+	RetireAccount(ctx context.Context, accountID string) error
+	AssociateUserSecret(ctx context.Context, accountID, userID, encryptedUserSecret string) error
+	Purge(ctx context.Context, userID string) error
+	Changes(ctx context.Context, query ChangesQuery) ([]Change, error)
+	ResolveChanges(ctx context.Context, changes []Change) ([]Change, error)
+	LatestSequence(ctx context.Context) (string, error)
+	Login(ctx context.Context, email, password string) (LoginResult, error)
+	LookupAccountUser(ctx context.Context, userID string) (LoginResult, error)
+	ChangePassword(ctx context.Context, userID, currentPassword, changedPassword string) error
+	ChangeEmail(ctx context.Context, userID, emailAddress, emailCurrent, password string) error
+	GenerateOneTimeKey(ctx context.Context, emailAddress string) ([]byte, error)
+	ResetPassword(ctx context.Context, emailAddress, password string, oneTimeKey []byte) error
+	ShareAccount(ctx context.Context, inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (ShareAccountResult, error)
+	UpdateAccountStyles(ctx context.Context, accountID, styles string) error
+	UpdateAccountAllowedOrigins(ctx context.Context, accountID string, origins []string) error
+	Join(ctx context.Context, emailAddress, password string) error
+	Expire(ctx context.Context, retention time.Duration) (int, error)
+	Bootstrap(ctx context.Context, data BootstrapConfig) error
+	ProbeEmpty(ctx context.Context) bool
+	CheckHealth(ctx context.Context) error
+	Migrate(ctx context.Context) error
+	PendingMigrations(ctx context.Context) ([]string, error)
+	Lock(ctx context.Context, name string) (func() error, error)
+	TryLock(ctx context.Context, name string) (Lock, bool, error)
 }
 
 type persistenceLayer struct {
-	dal DataAccessLayer
+	dal       DataAccessLayer
+	publisher Publisher
+}
+
+// Publisher is notified about all changes to stored events that are made
+// by the persistence layer, once they have been committed.
+type Publisher interface {
+	Publish([]Change)
 }
 
 // New creates a persistence service that connects to any database using
@@ -50,3 +66,18 @@ func New(dal DataAccessLayer, configs ...Config) (Service, error) {
 
 // Config is a function that adds a configuration option to the constructor
 type Config func(*persistenceLayer)
+
+// WithPublisher makes the persistence layer notify the given publisher about
+// all events that are inserted or deleted.
+func WithPublisher(p Publisher) Config {
+	return func(db *persistenceLayer) {
+		db.publisher = p
+	}
+}
+
+func (p *persistenceLayer) publish(changes []Change) {
+	if p.publisher == nil || len(changes) == 0 {
+		return
+	}
+	p.publisher.Publish(changes)
+}
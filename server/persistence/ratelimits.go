@@ -0,0 +1,127 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+	"github.com/offen/offen/server/tracing"
+)
+
+const (
+	rateLimitCleanupInterval = time.Minute
+	rateLimitCreateRetries   = 3
+)
+
+var errRateLimitConflict = errors.New("persistence: rate limit has been created concurrently")
+
+type rateLimitStore struct {
+	dal         DataAccessLayer
+	lock        sync.Mutex
+	lastCleanup time.Time
+}
+
+// NewRateLimitStore returns a ratelimiter.Store that persists its state using
+// the given data access layer, so that rate limits are shared by all instances
+// that use the same database. Expired records are removed periodically.
+func NewRateLimitStore(dal DataAccessLayer) ratelimiter.Store {
+	return &rateLimitStore{dal: dal}
+}
+
+func (s *rateLimitStore) Update(ctx context.Context, identifier string, fn func(*ratelimiter.State) (*ratelimiter.State, error)) (err error) {
+	ctx, span := tracing.Start(ctx, "persistence.UpdateRateLimit")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.cleanup(ctx); err != nil {
+		return err
+	}
+
+	// In case no record exists yet, concurrent callers cannot lock it and
+	// might try to create it at the same time. Only one of them succeeds
+	// and all others can retry, finding the existing record.
+	for attempt := 1; ; attempt++ {
+		err = s.update(ctx, identifier, fn)
+		if !errors.Is(err, errRateLimitConflict) || attempt == rateLimitCreateRetries {
+			return err
+		}
+	}
+}
+
+func (s *rateLimitStore) update(ctx context.Context, identifier string, fn func(*ratelimiter.State) (*ratelimiter.State, error)) error {
+	txn, err := s.dal.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+
+	found := true
+	existing, err := txn.FindRateLimit(ctx, FindRateLimitQueryForUpdate(identifier))
+	if err != nil {
+		var unknown ErrUnknownRateLimit
+		if !errors.As(err, &unknown) {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error looking up rate limit: %w", err)
+		}
+		found = false
+	}
+
+	var current *ratelimiter.State
+	if found && time.Now().Before(existing.Expires) {
+		current = &ratelimiter.State{
+			BlockUntil:  existing.BlockUntil,
+			QueueLength: existing.QueueLength,
+			Expires:     existing.Expires,
+		}
+	}
+
+	next, err := fn(current)
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	record := &RateLimit{
+		Identifier:  identifier,
+		BlockUntil:  next.BlockUntil,
+		QueueLength: next.QueueLength,
+		Expires:     next.Expires,
+	}
+	if found {
+		if err := txn.UpdateRateLimit(ctx, record); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error updating rate limit: %w", err)
+		}
+	} else {
+		if err := txn.CreateRateLimit(ctx, record); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("%w: %v", errRateLimitConflict, err)
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// cleanup deletes expired records in case the last cleanup happened
+// longer ago than the configured interval.
+func (s *rateLimitStore) cleanup(ctx context.Context) error {
+	s.lock.Lock()
+	if time.Since(s.lastCleanup) < rateLimitCleanupInterval {
+		s.lock.Unlock()
+		return nil
+	}
+	s.lastCleanup = time.Now()
+	s.lock.Unlock()
+
+	if _, err := s.dal.DeleteRateLimits(ctx, DeleteRateLimitsQueryExpired(time.Now())); err != nil {
+		return fmt.Errorf("persistence: error deleting expired rate limits: %w", err)
+	}
+	return nil
+}
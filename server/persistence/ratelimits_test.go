@@ -0,0 +1,154 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+type mockRateLimitDatabase struct {
+	DataAccessLayer
+	findResult RateLimit
+	findErr    error
+	createErr  error
+	created    []RateLimit
+	updated    []RateLimit
+	deleted    []interface{}
+	rolledBack bool
+	committed  bool
+}
+
+func (m *mockRateLimitDatabase) FindRateLimit(ctx context.Context, q interface{}) (RateLimit, error) {
+	return m.findResult, m.findErr
+}
+
+func (m *mockRateLimitDatabase) CreateRateLimit(ctx context.Context, r *RateLimit) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	m.created = append(m.created, *r)
+	return nil
+}
+
+func (m *mockRateLimitDatabase) UpdateRateLimit(ctx context.Context, r *RateLimit) error {
+	m.updated = append(m.updated, *r)
+	return nil
+}
+
+func (m *mockRateLimitDatabase) DeleteRateLimits(ctx context.Context, q interface{}) (int64, error) {
+	m.deleted = append(m.deleted, q)
+	return 0, nil
+}
+
+func (m *mockRateLimitDatabase) Transaction(context.Context) (Transaction, error) {
+	return m, nil
+}
+
+func (m *mockRateLimitDatabase) Commit() error {
+	m.committed = true
+	return nil
+}
+
+func (m *mockRateLimitDatabase) Rollback() error {
+	m.rolledBack = true
+	return nil
+}
+
+func TestRateLimitStore_Update(t *testing.T) {
+	now := time.Now()
+	next := &ratelimiter.State{BlockUntil: now.Add(time.Second), QueueLength: 2, Expires: now.Add(time.Second)}
+
+	t.Run("create", func(t *testing.T) {
+		db := &mockRateLimitDatabase{findErr: ErrUnknownRateLimit("not found")}
+		store := NewRateLimitStore(db)
+		if err := store.Update(context.Background(), "key", func(current *ratelimiter.State) (*ratelimiter.State, error) {
+			if current != nil {
+				t.Errorf("Unexpected current state %v", current)
+			}
+			return next, nil
+		}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.created) != 1 || db.created[0].Identifier != "key" || db.created[0].QueueLength != 2 {
+			t.Errorf("Unexpected records created %v", db.created)
+		}
+		if !db.committed {
+			t.Error("Expected transaction to be committed")
+		}
+		if len(db.deleted) != 1 {
+			t.Errorf("Expected expired rate limits to be deleted, got %v", db.deleted)
+		}
+	})
+	t.Run("update", func(t *testing.T) {
+		db := &mockRateLimitDatabase{findResult: RateLimit{Identifier: "key", QueueLength: 1, Expires: now.Add(time.Hour)}}
+		store := NewRateLimitStore(db)
+		if err := store.Update(context.Background(), "key", func(current *ratelimiter.State) (*ratelimiter.State, error) {
+			if current == nil || current.QueueLength != 1 {
+				t.Errorf("Unexpected current state %v", current)
+			}
+			return next, nil
+		}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || len(db.created) != 0 {
+			t.Errorf("Unexpected records updated %v and created %v", db.updated, db.created)
+		}
+	})
+	t.Run("expired", func(t *testing.T) {
+		db := &mockRateLimitDatabase{findResult: RateLimit{Identifier: "key", QueueLength: 1, Expires: now.Add(-time.Hour)}}
+		store := NewRateLimitStore(db)
+		if err := store.Update(context.Background(), "key", func(current *ratelimiter.State) (*ratelimiter.State, error) {
+			if current != nil {
+				t.Errorf("Expected expired state to be skipped, got %v", current)
+			}
+			return next, nil
+		}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 {
+			t.Errorf("Unexpected records updated %v", db.updated)
+		}
+	})
+	t.Run("rejected", func(t *testing.T) {
+		db := &mockRateLimitDatabase{findErr: ErrUnknownRateLimit("not found")}
+		store := NewRateLimitStore(db)
+		if err := store.Update(context.Background(), "key", func(current *ratelimiter.State) (*ratelimiter.State, error) {
+			return nil, errors.New("did not work")
+		}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if !db.rolledBack || db.committed || len(db.created) != 0 {
+			t.Error("Expected transaction to be rolled back")
+		}
+	})
+	t.Run("lookup error", func(t *testing.T) {
+		db := &mockRateLimitDatabase{findErr: errors.New("did not work")}
+		store := NewRateLimitStore(db)
+		if err := store.Update(context.Background(), "key", func(current *ratelimiter.State) (*ratelimiter.State, error) {
+			t.Error("Unexpected call of update function")
+			return next, nil
+		}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("conflict", func(t *testing.T) {
+		db := &mockRateLimitDatabase{findErr: ErrUnknownRateLimit("not found"), createErr: errors.New("duplicate key")}
+		store := NewRateLimitStore(db)
+		calls := 0
+		if err := store.Update(context.Background(), "key", func(current *ratelimiter.State) (*ratelimiter.State, error) {
+			calls++
+			return next, nil
+		}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if calls != rateLimitCreateRetries {
+			t.Errorf("Expected %d attempts, got %d", rateLimitCreateRetries, calls)
+		}
+	})
+}
@@ -4,34 +4,48 @@
 package relational
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
 	"gorm.io/gorm"
 )
 
-func (r *relationalDAL) CreateAccount(a *persistence.Account) error {
+func (r *relationalDAL) CreateAccount(ctx context.Context, a *persistence.Account) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.CreateAccount")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importAccount(a)
-	if err := r.db.Create(&local).Error; err != nil {
+	if err := db.Create(&local).Error; err != nil {
 		return fmt.Errorf("relational: error creating account: %w", err)
 	}
 	return nil
 }
 
-func (r *relationalDAL) UpdateAccount(a *persistence.Account) error {
+func (r *relationalDAL) UpdateAccount(ctx context.Context, a *persistence.Account) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.UpdateAccount")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importAccount(a)
-	if err := r.db.Save(&local).Error; err != nil {
+	if err := db.Save(&local).Error; err != nil {
 		return fmt.Errorf("relational: error saving account: %w", err)
 	}
 	return nil
 }
 
-func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error) {
+func (r *relationalDAL) FindAccount(ctx context.Context, q interface{}) (_ persistence.Account, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindAccount", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	var account Account
 	switch query := q.(type) {
 	case persistence.FindAccountQueryIncludeEvents:
-		if err := r.db.First(&account, "account_id = ?", query.AccountID).Error; err != nil {
+		if err := db.First(&account, "account_id = ?", query.AccountID).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return account.export(), persistence.ErrUnknownAccount(fmt.Sprintf(`relational: account id "%s" unknown`, query.AccountID))
 			}
@@ -40,7 +54,7 @@ func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error)
 		var limit int = 500
 		var offset int
 		var events []Event
-		queryDB := r.db.Preload("Secret").Limit(limit)
+		queryDB := db.Preload("Secret").Limit(limit)
 		for {
 			var nextEvents []Event
 			var found int64
@@ -59,7 +73,7 @@ func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error)
 		account.Events = events
 		return account.export(), nil
 	case persistence.FindAccountQueryByID:
-		if err := r.db.Where("account_id = ?", string(query)).First(&account).Error; err != nil {
+		if err := db.Where("account_id = ?", string(query)).First(&account).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return account.export(), persistence.ErrUnknownAccount("relational: no matching account found")
 			}
@@ -67,7 +81,7 @@ func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error)
 		}
 		return account.export(), nil
 	case persistence.FindAccountQueryActiveByID:
-		if err := r.db.Where(
+		if err := db.Where(
 			"account_id = ? AND retired = ?",
 			string(query),
 			false,
@@ -83,11 +97,15 @@ func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error)
 	}
 }
 
-func (r *relationalDAL) FindAccounts(q interface{}) ([]persistence.Account, error) {
+func (r *relationalDAL) FindAccounts(ctx context.Context, q interface{}) (_ []persistence.Account, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindAccounts", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	var accounts []Account
 	switch q.(type) {
 	case persistence.FindAccountsQueryAllAccounts:
-		if err := r.db.Find(&accounts).Error; err != nil {
+		if err := db.Find(&accounts).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up all accounts: %w", err)
 		}
 		result := []persistence.Account{}
@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -41,7 +42,7 @@ func TestRelationalDAL_CreateAccount(t *testing.T) {
 			defer closeDB()
 			dal := NewRelationalDAL(db)
 
-			err := dal.CreateAccount(test.arg)
+			err := dal.CreateAccount(context.Background(), test.arg)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -116,7 +117,7 @@ func TestRelationalDAL_UpdateAccount(t *testing.T) {
 				t.Fatalf("Error setting up test: %v", err)
 			}
 
-			err := dal.UpdateAccount(test.arg)
+			err := dal.UpdateAccount(context.Background(), test.arg)
 
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value: %v", err)
@@ -327,7 +328,7 @@ func TestRelationalDAL_FindAccount(t *testing.T) {
 				t.Fatalf("Error setting up test: %v", err)
 			}
 
-			result, err := dal.FindAccount(test.arg)
+			result, err := dal.FindAccount(context.Background(), test.arg)
 
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %v, got %v", test.expectedResult, result)
@@ -387,7 +388,7 @@ func TestRelationalDAL_FindAccounts(t *testing.T) {
 				t.Fatalf("Error setting up test: %v", err)
 			}
 
-			result, err := dal.FindAccounts(test.arg)
+			result, err := dal.FindAccounts(context.Background(), test.arg)
 
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %v, got %v", test.expectedResult, result)
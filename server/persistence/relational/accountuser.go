@@ -4,24 +4,34 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
 )
 
-func (r *relationalDAL) CreateAccountUser(u *persistence.AccountUser) error {
+func (r *relationalDAL) CreateAccountUser(ctx context.Context, u *persistence.AccountUser) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.CreateAccountUser")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importAccountUser(u)
-	if err := r.db.Create(&local).Error; err != nil {
+	if err := db.Create(&local).Error; err != nil {
 		return fmt.Errorf("relational: error creating account user: %w", err)
 	}
 	return nil
 }
 
-func (r *relationalDAL) FindAccountUser(q interface{}) (persistence.AccountUser, error) {
+func (r *relationalDAL) FindAccountUser(ctx context.Context, q interface{}) (_ persistence.AccountUser, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindAccountUser", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	var accountUser AccountUser
 	switch query := q.(type) {
 	case persistence.FindAccountUserQueryByAccountUserIDIncludeRelationships:
-		if err := r.db.Preload("Relationships", "password_encrypted_key_encryption_key <> ?", "").Where("account_user_id = ?", string(query)).First(&accountUser).Error; err != nil {
+		if err := db.Preload("Relationships", "password_encrypted_key_encryption_key <> ?", "").Where("account_user_id = ?", string(query)).First(&accountUser).Error; err != nil {
 			return accountUser.export(), fmt.Errorf("relational: error looking up account user by user id: %w", err)
 		}
 		return accountUser.export(), nil
@@ -30,23 +40,30 @@ func (r *relationalDAL) FindAccountUser(q interface{}) (persistence.AccountUser,
 	}
 }
 
-func (r *relationalDAL) UpdateAccountUser(u *persistence.AccountUser) error {
+func (r *relationalDAL) UpdateAccountUser(ctx context.Context, u *persistence.AccountUser) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.UpdateAccountUser")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importAccountUser(u)
-	exists := r.db.Where("account_user_id = ?", local.AccountUserID).First(&AccountUser{}).Error
+	exists := db.Where("account_user_id = ?", local.AccountUserID).First(&AccountUser{}).Error
 	if exists != nil {
 		return fmt.Errorf("relational: error looking up account user for update: %w", exists)
 	}
-	if err := r.db.Save(&local).Error; err != nil {
+	if err := db.Save(&local).Error; err != nil {
 		return fmt.Errorf("relational: error updating account user: %w", err)
 	}
 	return nil
 }
 
-func (r *relationalDAL) FindAccountUsers(q interface{}) ([]persistence.AccountUser, error) {
+func (r *relationalDAL) FindAccountUsers(ctx context.Context, q interface{}) (_ []persistence.AccountUser, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindAccountUsers", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	var accountUsers []AccountUser
 	switch query := q.(type) {
 	case persistence.FindAccountUsersQueryAllAccountUsers:
-		db := r.db
 		if query.IncludeRelationships {
 			if query.IncludeInvitations {
 				db = db.Preload("Relationships")
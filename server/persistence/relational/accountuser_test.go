@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -41,7 +42,7 @@ func TestRelationalDAL_CreateAccountUser(t *testing.T) {
 
 			dal := NewRelationalDAL(db)
 
-			err := dal.CreateAccountUser(test.arg)
+			err := dal.CreateAccountUser(context.Background(), test.arg)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -137,7 +138,7 @@ func TestRelationalDAL_FindAccountUser(t *testing.T) {
 				t.Fatalf("Error setting up test: %v", err)
 			}
 
-			result, err := dal.FindAccountUser(test.query)
+			result, err := dal.FindAccountUser(context.Background(), test.query)
 
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %v, got %v", test.expectedResult, result)
@@ -225,7 +226,7 @@ func TestRelationalDAL_UpdateAccountUser(t *testing.T) {
 				t.Fatalf("Error setting up test: %v", err)
 			}
 
-			err := dal.UpdateAccountUser(test.arg)
+			err := dal.UpdateAccountUser(context.Background(), test.arg)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -302,7 +303,7 @@ func TestRelationalDAL_FindAccountUsers(t *testing.T) {
 
 			dal := NewRelationalDAL(db)
 
-			result, err := dal.FindAccountUsers(test.arg)
+			result, err := dal.FindAccountUsers(context.Background(), test.arg)
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -4,14 +4,20 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
 )
 
-func (r *relationalDAL) CreateEvent(e *persistence.Event) error {
+func (r *relationalDAL) CreateEvent(ctx context.Context, e *persistence.Event) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.CreateEvent")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importEvent(e)
-	if err := r.db.Create(&local).Error; err != nil {
+	if err := db.Create(&local).Error; err != nil {
 		return fmt.Errorf("relational: error creating event: %w", err)
 	}
 	return nil
@@ -25,14 +31,35 @@ func exportEvents(evts []Event) []persistence.Event {
 	return result
 }
 
-func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
+func (r *relationalDAL) FindEvents(ctx context.Context, q interface{}) (_ []persistence.Event, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindEvents", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	var events []Event
 	switch query := q.(type) {
 	case persistence.FindEventsQueryOlderThan:
-		if err := r.db.Find(&events, "event_id < ?", query).Error; err != nil {
+		if err := db.Find(&events, "event_id < ?", query).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up events by age: %w", err)
 		}
 		return exportEvents(events), nil
+	case persistence.FindEventsQueryLatest:
+		if err := db.Order("sequence DESC").Limit(1).Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up latest event: %w", err)
+		}
+		return exportEvents(events), nil
+	case persistence.FindEventsQueryNewerThan:
+		lookup := db.Order("sequence").Where("sequence > ? AND account_id IN (?)", query.Since, query.AccountIDs)
+		if query.Limit > 0 {
+			lookup = lookup.Limit(query.Limit)
+		}
+		if query.OmitPayload {
+			lookup = lookup.Select("event_id", "account_id", "secret_id", "sequence")
+		}
+		if err := lookup.Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up events by sequence: %w", err)
+		}
+		return exportEvents(events), nil
 	case persistence.FindEventsQueryForSecretIDs:
 		var eventConditions []interface{}
 		if query.Since != "" {
@@ -47,7 +74,7 @@ func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
 			}
 		}
 
-		if err := r.db.Find(&events, eventConditions...).Error; err != nil {
+		if err := db.Find(&events, eventConditions...).Error; err != nil {
 			return nil, fmt.Errorf("default: error looking up events: %w", err)
 		}
 		return exportEvents(events), nil
@@ -62,7 +89,7 @@ func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
 			} else {
 				chunk = query[offset:]
 			}
-			if err := r.db.Where("event_id IN (?)", chunk).Find(&nextEvents).Error; err != nil {
+			if err := db.Where("event_id IN (?)", chunk).Find(&nextEvents).Error; err != nil {
 				return nil, fmt.Errorf("relational: error looking up events: %w", err)
 			}
 			events = append(events, nextEvents...)
@@ -77,16 +104,20 @@ func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
 	}
 }
 
-func (r *relationalDAL) DeleteEvents(q interface{}) (int64, error) {
+func (r *relationalDAL) DeleteEvents(ctx context.Context, q interface{}) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "relational.DeleteEvents", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	switch query := q.(type) {
 	case persistence.DeleteEventsQueryByEventIDs:
-		deletion := r.db.Where("event_id in (?)", []string(query)).Delete(&Event{})
+		deletion := db.Where("event_id in (?)", []string(query)).Delete(&Event{})
 		if err := deletion.Error; err != nil {
 			return 0, fmt.Errorf("relational: error deleting events by event id: %w", err)
 		}
 		return deletion.RowsAffected, nil
 	case persistence.DeleteEventsQueryBySecretIDs:
-		deletion := r.db.Where(
+		deletion := db.Where(
 			"secret_id IN (?)",
 			[]string(query),
 		).Delete(&Event{})
@@ -95,7 +126,7 @@ func (r *relationalDAL) DeleteEvents(q interface{}) (int64, error) {
 		}
 		return deletion.RowsAffected, nil
 	case persistence.DeleteEventsQueryOlderThan:
-		deletion := r.db.Where("event_id < ?", query).Delete(&Event{})
+		deletion := db.Where("event_id < ?", query).Delete(&Event{})
 		if err := deletion.Error; err != nil {
 			return 0, fmt.Errorf("relational: error deleting events: %w", err)
 		}
@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -41,7 +42,7 @@ func TestRelationalDAL_CreateEvent(t *testing.T) {
 			defer closeDB()
 
 			dal := NewRelationalDAL(db)
-			err := dal.CreateEvent(test.arg)
+			err := dal.CreateEvent(context.Background(), test.arg)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -133,6 +134,73 @@ func TestRelationalDAL_FindEvents(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"newer than sequence",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"c", "a", "d", "b"} {
+					accountID := "account-a"
+					if token == "d" {
+						accountID = "account-b"
+					}
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: accountID,
+						Sequence:  fmt.Sprintf("seq-%s", token),
+						Payload:   fmt.Sprintf("payload-%s", token),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryNewerThan{Since: "seq-a", AccountIDs: []string{"account-a"}},
+			[]persistence.Event{
+				{EventID: "event-b", AccountID: "account-a", Sequence: "seq-b", Payload: "payload-b"},
+				{EventID: "event-c", AccountID: "account-a", Sequence: "seq-c", Payload: "payload-c"},
+			},
+			false,
+		},
+		{
+			"newer than sequence with limit and without payload",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"c", "a", "b"} {
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: "account-a",
+						Sequence:  fmt.Sprintf("seq-%s", token),
+						Payload:   fmt.Sprintf("payload-%s", token),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryNewerThan{Since: "seq-0", AccountIDs: []string{"account-a"}, Limit: 2, OmitPayload: true},
+			[]persistence.Event{
+				{EventID: "event-a", AccountID: "account-a", Sequence: "seq-a"},
+				{EventID: "event-b", AccountID: "account-a", Sequence: "seq-b"},
+			},
+			false,
+		},
+		{
+			"latest",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"b", "c", "a"} {
+					if err := db.Save(&Event{
+						EventID:  fmt.Sprintf("event-%s", token),
+						Sequence: fmt.Sprintf("seq-%s", token),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryLatest{},
+			[]persistence.Event{
+				{EventID: "event-c", Sequence: "seq-c"},
+			},
+			false,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -145,7 +213,7 @@ func TestRelationalDAL_FindEvents(t *testing.T) {
 				t.Fatalf("Error setting up test: %v", err)
 			}
 
-			result, err := dal.FindEvents(test.query)
+			result, err := dal.FindEvents(context.Background(), test.query)
 
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %v, got %v", test.expectedResult, result)
@@ -240,7 +308,7 @@ func TestRelationalDAL_DeleteEvents(t *testing.T) {
 				t.Fatalf("Unexpected error setting up test: %v", err)
 			}
 
-			affected, err := dal.DeleteEvents(test.query)
+			affected, err := dal.DeleteEvents(context.Background(), test.query)
 			if test.expectedAffected != affected {
 				t.Errorf("Expected %d, got %d", test.expectedAffected, affected)
 			}
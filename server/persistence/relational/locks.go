@@ -0,0 +1,210 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/driver/sqlite"
+)
+
+const lockPrefix = "offen:"
+
+// TryLock acquires a lock that is shared between all instances connected to
+// the same database. Postgres and MySQL use session level advisory locks that
+// are released by the database in case the holding connection is lost.
+// SQLite databases are locked using a file next to the database file.
+func (r *relationalDAL) TryLock(ctx context.Context, name string) (persistence.Lock, bool, error) {
+	switch r.db.Dialector.Name() {
+	case "postgres":
+		return r.tryAdvisoryLock(
+			ctx,
+			"SELECT pg_try_advisory_lock($1)",
+			"SELECT pg_advisory_unlock($1)",
+			advisoryLockKey(name),
+		)
+	case "mysql":
+		return r.tryAdvisoryLock(
+			ctx,
+			"SELECT COALESCE(GET_LOCK(?, 0), 0) = 1",
+			"SELECT RELEASE_LOCK(?)",
+			lockPrefix+name,
+		)
+	case "sqlite":
+		var dsn string
+		if d, ok := r.db.Dialector.(*sqlite.Dialector); ok {
+			dsn = d.DSN
+		}
+		location := sqliteLockFile(dsn, name)
+		if location == "" {
+			// in-memory databases cannot be shared between processes
+			lock, acquired := localLocks.tryLock(name)
+			return lock, acquired, nil
+		}
+		return tryLockFile(location)
+	default:
+		return nil, false, fmt.Errorf("relational: locks are not supported for dialect %s", r.db.Dialector.Name())
+	}
+}
+
+// tryAdvisoryLock acquires a lock using the given statements on a dedicated
+// connection, as advisory locks are bound to the session that acquired them.
+func (r *relationalDAL) tryAdvisoryLock(ctx context.Context, lockQuery, unlockQuery string, key interface{}) (persistence.Lock, bool, error) {
+	db, err := r.db.DB()
+	if err != nil {
+		return nil, false, fmt.Errorf("relational: error accessing underlying database: %w", err)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("relational: error acquiring connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, lockQuery, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("relational: error acquiring lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return &advisoryLock{conn: conn, unlockQuery: unlockQuery, key: key}, true, nil
+}
+
+// advisoryLock is held for as long as the session of its connection exists.
+type advisoryLock struct {
+	conn        *sql.Conn
+	unlockQuery string
+	key         interface{}
+}
+
+// Check makes sure the connection holding the lock is still alive. In case
+// it has been lost, the database has released the lock and other instances
+// might have acquired it already.
+func (a *advisoryLock) Check(ctx context.Context) error {
+	if err := a.conn.PingContext(ctx); err != nil {
+		return fmt.Errorf("relational: lost connection holding lock: %w", err)
+	}
+	return nil
+}
+
+func (a *advisoryLock) Unlock() error {
+	defer a.conn.Close()
+	var released sql.NullBool
+	if err := a.conn.QueryRowContext(context.Background(), a.unlockQuery, a.key).Scan(&released); err != nil {
+		// the connection is discarded so the database releases the
+		// lock when closing the session
+		a.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		return fmt.Errorf("relational: error releasing lock: %w", err)
+	}
+	return nil
+}
+
+// advisoryLockKey derives the numeric key Postgres expects from the given
+// lock name.
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(lockPrefix + name))
+	return int64(h.Sum64())
+}
+
+// sqliteLockFile returns the location of the file used for locking the
+// database with the given connection string. An empty string is returned for
+// in-memory databases.
+func sqliteLockFile(dsn, name string) string {
+	if strings.Contains(dsn, "mode=memory") {
+		return ""
+	}
+	location := strings.TrimPrefix(dsn, "file:")
+	if i := strings.Index(location, "?"); i >= 0 {
+		location = location[:i]
+	}
+	if location == "" || location == ":memory:" {
+		return ""
+	}
+	return fmt.Sprintf("%s.%s.lock", location, name)
+}
+
+func tryLockFile(location string) (persistence.Lock, bool, error) {
+	f, err := os.OpenFile(location, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, false, fmt.Errorf("relational: error opening lock file: %w", err)
+	}
+	acquired, err := lockFile(f)
+	if err != nil || !acquired {
+		f.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("relational: error locking %s: %w", location, err)
+		}
+		return nil, false, nil
+	}
+	return &fileLock{file: f, location: location}, true, nil
+}
+
+// fileLock is held for as long as its file is open.
+type fileLock struct {
+	file     *os.File
+	location string
+}
+
+// Check always succeeds as the lock is bound to the open file, which cannot
+// be lost without the process exiting.
+func (f *fileLock) Check(context.Context) error {
+	return nil
+}
+
+func (f *fileLock) Unlock() error {
+	// the file is not removed when unlocking as another instance might
+	// already be waiting for a lock on it
+	if err := unlockFile(f.file); err != nil {
+		f.file.Close()
+		return fmt.Errorf("relational: error unlocking %s: %w", f.location, err)
+	}
+	return f.file.Close()
+}
+
+// localLocks is used for databases that cannot be accessed by more than
+// one process.
+var localLocks = &processLocks{held: map[string]bool{}}
+
+type processLocks struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (p *processLocks) tryLock(name string) (persistence.Lock, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held[name] {
+		return nil, false
+	}
+	p.held[name] = true
+	return &processLock{locks: p, name: name}, true
+}
+
+type processLock struct {
+	locks *processLocks
+	name  string
+}
+
+// Check always succeeds as the lock is held in memory.
+func (p *processLock) Check(context.Context) error {
+	return nil
+}
+
+func (p *processLock) Unlock() error {
+	p.locks.mu.Lock()
+	defer p.locks.mu.Unlock()
+	delete(p.locks.held, p.name)
+	return nil
+}
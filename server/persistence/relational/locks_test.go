@@ -0,0 +1,89 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRelationalDAL_TryLock(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "offen.db")
+		open := func() *relationalDAL {
+			db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+				Logger: logger.Default.LogMode(logger.Silent),
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			return &relationalDAL{db: db}
+		}
+		first, second := open(), open()
+
+		lock, acquired, err := first.TryLock(context.Background(), "expire")
+		if err != nil || !acquired {
+			t.Fatalf("Expected lock to be acquired, got %v, %v", acquired, err)
+		}
+		if _, acquired, err := second.TryLock(context.Background(), "expire"); err != nil || acquired {
+			t.Errorf("Expected lock to be held, got %v, %v", acquired, err)
+		}
+		if _, acquired, err := second.TryLock(context.Background(), "migrate"); err != nil || !acquired {
+			t.Errorf("Expected unrelated lock to be acquired, got %v, %v", acquired, err)
+		}
+		if err := lock.Check(context.Background()); err != nil {
+			t.Errorf("Unexpected error checking lock %v", err)
+		}
+		if err := lock.Unlock(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, acquired, err := second.TryLock(context.Background(), "expire"); err != nil || !acquired {
+			t.Errorf("Expected lock to be acquired after unlocking, got %v, %v", acquired, err)
+		}
+	})
+	t.Run("memory", func(t *testing.T) {
+		db, closeDB := createTestDatabase()
+		defer closeDB()
+		r := &relationalDAL{db: db}
+
+		lock, acquired, err := r.TryLock(context.Background(), "expire")
+		if err != nil || !acquired {
+			t.Fatalf("Expected lock to be acquired, got %v, %v", acquired, err)
+		}
+		if _, acquired, err := r.TryLock(context.Background(), "expire"); err != nil || acquired {
+			t.Errorf("Expected lock to be held, got %v, %v", acquired, err)
+		}
+		lock.Unlock()
+		if lock, acquired, err := r.TryLock(context.Background(), "expire"); err != nil || !acquired {
+			t.Errorf("Expected lock to be acquired after unlocking, got %v, %v", acquired, err)
+		} else {
+			lock.Unlock()
+		}
+	})
+}
+
+func TestSqliteLockFile(t *testing.T) {
+	for _, test := range []struct {
+		dsn      string
+		expected string
+	}{
+		{"/var/opt/offen/offen.db", "/var/opt/offen/offen.db.migrate.lock"},
+		{"file:offen.db?cache=shared", "offen.db.migrate.lock"},
+		{":memory:", ""},
+		{"file::memory:?cache=shared", ""},
+		{"file:offen?mode=memory", ""},
+		{"", ""},
+	} {
+		t.Run(test.dsn, func(t *testing.T) {
+			if result := sqliteLockFile(test.dsn, "migrate"); result != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
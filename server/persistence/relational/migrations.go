@@ -4,17 +4,65 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
 	gormigrate "github.com/go-gormigrate/gormigrate/v2"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
 	"gorm.io/gorm"
 )
 
-func (r *relationalDAL) ApplyMigrations() error {
-	m := gormigrate.New(r.db, gormigrate.DefaultOptions, []*gormigrate.Migration{
+func (r *relationalDAL) ApplyMigrations(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.ApplyMigrations")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
+	m := gormigrate.New(db, gormigrate.DefaultOptions, migrations())
+	m.InitSchema(func(db *gorm.DB) error {
+		return db.AutoMigrate(knownTables...)
+	})
+
+	return m.Migrate()
+}
+
+func (r *relationalDAL) PendingMigrations(ctx context.Context) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "relational.PendingMigrations")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
+	var all []string
+	for _, migration := range migrations() {
+		all = append(all, migration.ID)
+	}
+
+	opts := gormigrate.DefaultOptions
+	if !db.Migrator().HasTable(opts.TableName) {
+		return all, nil
+	}
+
+	var applied []string
+	if err := db.Table(opts.TableName).Pluck(opts.IDColumnName, &applied).Error; err != nil {
+		return nil, fmt.Errorf("relational: error looking up applied migrations: %w", err)
+	}
+	isApplied := map[string]bool{}
+	for _, id := range applied {
+		isApplied[id] = true
+	}
+
+	pending := []string{}
+	for _, id := range all {
+		if !isApplied[id] {
+			pending = append(pending, id)
+		}
+	}
+	return pending, nil
+}
+
+func migrations() []*gormigrate.Migration {
+	return []*gormigrate.Migration{
 		{
 			ID: "001_introduce_admin_level",
 			Migrate: func(db *gorm.DB) error {
@@ -350,11 +398,66 @@ func (r *relationalDAL) ApplyMigrations() error {
 				return db.Migrator().DropColumn("accounts", "account_styles")
 			},
 		},
-	})
-
-	m.InitSchema(func(db *gorm.DB) error {
-		return db.AutoMigrate(knownTables...)
-	})
-
-	return m.Migrate()
+		{
+			ID: "008_rate_limits",
+			Migrate: func(db *gorm.DB) error {
+				type RateLimit struct {
+					Identifier  string `gorm:"primary_key;size:64"`
+					BlockUntil  time.Time
+					QueueLength int64
+					Expires     time.Time `gorm:"index"`
+				}
+				return db.AutoMigrate(&RateLimit{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("rate_limits")
+			},
+		},
+		{
+			ID: "009_account_allowedOrigins",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					AccountStyles       string `gorm:"type:text"`
+					AllowedOrigins      string `gorm:"type:text"`
+					Created             time.Time
+					Events              []Event `gorm:"foreignkey:AccountID;association_foreignkey:AccountID"`
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "allowed_origins")
+			},
+		},
+		{
+			ID: "010_sequence_indices",
+			Migrate: func(db *gorm.DB) error {
+				type Event struct {
+					EventID   string  `gorm:"primary_key;size:26;unique"`
+					Sequence  string  `gorm:"size:26;index"`
+					AccountID string  `gorm:"size:36"`
+					SecretID  *string `gorm:"size:64"`
+					Payload   string  `gorm:"type:text"`
+				}
+				type Tombstone struct {
+					EventID   string  `gorm:"primary_key"`
+					AccountID string  `gorm:"size:36"`
+					SecretID  *string `gorm:"size:64"`
+					Sequence  string  `gorm:"size:26;index"`
+				}
+				return db.AutoMigrate(&Event{}, &Tombstone{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropIndex("events", "idx_events_sequence"); err != nil {
+					return err
+				}
+				return db.Migrator().DropIndex("tombstones", "idx_tombstones_sequence")
+			},
+		},
+	}
 }
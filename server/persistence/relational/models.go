@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"strings"
 	"time"
 
 	"github.com/offen/offen/server/persistence"
@@ -13,7 +14,7 @@ import (
 // uniquely tied to an Account and a Secret model.
 type Event struct {
 	EventID   string `gorm:"primary_key;size:26;unique"`
-	Sequence  string `gorm:"size:26"`
+	Sequence  string `gorm:"size:26;index"`
 	AccountID string `gorm:"size:36"`
 	// the secret id is nullable for anonymous events
 	SecretID *string `gorm:"size:64"`
@@ -26,7 +27,15 @@ type Tombstone struct {
 	EventID   string  `gorm:"primary_key"`
 	AccountID string  `gorm:"size:36"`
 	SecretID  *string `gorm:"size:64"`
-	Sequence  string  `gorm:"size:26"`
+	Sequence  string  `gorm:"size:26;index"`
+}
+
+// RateLimit stores the rate limiting state for a hashed identifier.
+type RateLimit struct {
+	Identifier  string `gorm:"primary_key;size:64"`
+	BlockUntil  time.Time
+	QueueLength int64
+	Expires     time.Time `gorm:"index"`
 }
 
 // Secret associates a hashed user id - which ties a user and account together
@@ -46,6 +55,7 @@ type Account struct {
 	UserSalt            string
 	Retired             bool
 	AccountStyles       string `gorm:"type:text"`
+	AllowedOrigins      string `gorm:"type:text"`
 	Created             time.Time
 	Events              []Event `gorm:"foreignkey:AccountID;association_foreignkey:AccountID"`
 }
@@ -103,6 +113,24 @@ func (t *Tombstone) export() persistence.Tombstone {
 	}
 }
 
+func (r *RateLimit) export() persistence.RateLimit {
+	return persistence.RateLimit{
+		Identifier:  r.Identifier,
+		BlockUntil:  r.BlockUntil,
+		QueueLength: r.QueueLength,
+		Expires:     r.Expires,
+	}
+}
+
+func importRateLimit(r *persistence.RateLimit) *RateLimit {
+	return &RateLimit{
+		Identifier:  r.Identifier,
+		BlockUntil:  r.BlockUntil,
+		QueueLength: r.QueueLength,
+		Expires:     r.Expires,
+	}
+}
+
 func importTombstone(t *persistence.Tombstone) *Tombstone {
 	return &Tombstone{
 		EventID:   t.EventID,
@@ -193,7 +221,15 @@ func (a *Account) export() persistence.Account {
 		Created:             a.Created,
 		Events:              events,
 		AccountStyles:       a.AccountStyles,
+		AllowedOrigins:      splitOrigins(a.AllowedOrigins),
+	}
+}
+
+func splitOrigins(s string) []string {
+	if s == "" {
+		return nil
 	}
+	return strings.Fields(s)
 }
 
 func importAccount(a *persistence.Account) Account {
@@ -211,5 +247,6 @@ func importAccount(a *persistence.Account) Account {
 		Created:             a.Created,
 		Events:              events,
 		AccountStyles:       a.AccountStyles,
+		AllowedOrigins:      strings.Join(a.AllowedOrigins, " "),
 	}
 }
@@ -0,0 +1,82 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *relationalDAL) CreateRateLimit(ctx context.Context, l *persistence.RateLimit) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.CreateRateLimit")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
+	local := importRateLimit(l)
+	if err := db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating rate limit: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) UpdateRateLimit(ctx context.Context, l *persistence.RateLimit) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.UpdateRateLimit")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
+	local := importRateLimit(l)
+	if err := db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating rate limit: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindRateLimit(ctx context.Context, q interface{}) (_ persistence.RateLimit, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindRateLimit", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
+	var rateLimit RateLimit
+	switch query := q.(type) {
+	case persistence.FindRateLimitQueryForUpdate:
+		// SQLite does not support row level locking and will skip this clause,
+		// which is fine as it serializes all writes anyways
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Where(
+			"identifier = ?",
+			string(query),
+		).First(&rateLimit).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return rateLimit.export(), persistence.ErrUnknownRateLimit("relational: no matching rate limit found")
+			}
+			return rateLimit.export(), fmt.Errorf("relational: error looking up rate limit: %w", err)
+		}
+		return rateLimit.export(), nil
+	default:
+		return rateLimit.export(), persistence.ErrBadQuery
+	}
+}
+
+func (r *relationalDAL) DeleteRateLimits(ctx context.Context, q interface{}) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "relational.DeleteRateLimits", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
+	switch query := q.(type) {
+	case persistence.DeleteRateLimitsQueryExpired:
+		result := db.Where("expires < ?", time.Time(query)).Delete(&RateLimit{})
+		if err := result.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting expired rate limits: %w", err)
+		}
+		return result.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_RateLimits(t *testing.T) {
+	db, dbClose := createTestDatabase()
+	defer dbClose()
+	dal := NewRelationalDAL(db)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := dal.FindRateLimit(ctx, persistence.FindRateLimitQueryForUpdate("key-a")); !errors.As(err, new(persistence.ErrUnknownRateLimit)) {
+		t.Errorf("Expected unknown rate limit error, got %v", err)
+	}
+
+	if err := dal.CreateRateLimit(ctx, &persistence.RateLimit{
+		Identifier: "key-a", BlockUntil: now, QueueLength: 1, Expires: now.Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("Unexpected error creating rate limit: %v", err)
+	}
+	if err := dal.CreateRateLimit(ctx, &persistence.RateLimit{
+		Identifier: "key-a", BlockUntil: now, QueueLength: 1, Expires: now,
+	}); err == nil {
+		t.Error("Expected error when creating duplicate rate limit")
+	}
+	if err := dal.CreateRateLimit(ctx, &persistence.RateLimit{
+		Identifier: "key-b", BlockUntil: now, QueueLength: 1, Expires: now.Add(time.Minute),
+	}); err != nil {
+		t.Fatalf("Unexpected error creating rate limit: %v", err)
+	}
+
+	if err := dal.UpdateRateLimit(ctx, &persistence.RateLimit{
+		Identifier: "key-b", BlockUntil: now.Add(time.Second), QueueLength: 2, Expires: now.Add(time.Minute),
+	}); err != nil {
+		t.Fatalf("Unexpected error updating rate limit: %v", err)
+	}
+	result, err := dal.FindRateLimit(ctx, persistence.FindRateLimitQueryForUpdate("key-b"))
+	if err != nil {
+		t.Fatalf("Unexpected error looking up rate limit: %v", err)
+	}
+	if result.QueueLength != 2 || !result.BlockUntil.Equal(now.Add(time.Second)) {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	affected, err := dal.DeleteRateLimits(ctx, persistence.DeleteRateLimitsQueryExpired(now))
+	if err != nil {
+		t.Fatalf("Unexpected error deleting rate limits: %v", err)
+	}
+	if affected != 1 {
+		t.Errorf("Expected one expired rate limit to be deleted, got %d", affected)
+	}
+
+	if _, err := dal.FindRateLimit(ctx, 12); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+}
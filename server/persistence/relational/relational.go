@@ -4,9 +4,12 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 
 	// GORM imports the dialects for side effects only
@@ -27,8 +30,8 @@ func NewRelationalDAL(db *gorm.DB) persistence.DataAccessLayer {
 	}
 }
 
-func (r *relationalDAL) Transaction() (persistence.Transaction, error) {
-	txn := r.db.Begin()
+func (r *relationalDAL) Transaction(ctx context.Context) (persistence.Transaction, error) {
+	txn := r.db.WithContext(ctx).Begin()
 	if err := txn.Error; err != nil {
 		return nil, fmt.Errorf("relational: begun transaction in error state: %w", err)
 	}
@@ -36,6 +39,12 @@ func (r *relationalDAL) Transaction() (persistence.Transaction, error) {
 	return &transaction{&dal}, nil
 }
 
+// queryAttribute describes the type of the given query so spans can be
+// told apart without recording any of the query's values.
+func queryAttribute(q interface{}) attribute.KeyValue {
+	return attribute.String("offen.query", fmt.Sprintf("%T", q))
+}
+
 var knownTables = []interface{}{
 	&Account{},
 	&AccountUser{},
@@ -45,10 +54,14 @@ var knownTables = []interface{}{
 	&Tombstone{},
 }
 
-func (r *relationalDAL) ProbeEmpty() bool {
+func (r *relationalDAL) ProbeEmpty(ctx context.Context) bool {
+	ctx, span := tracing.Start(ctx, "relational.ProbeEmpty")
+	defer span.End()
+	db := r.db.WithContext(ctx)
+
 	for _, table := range knownTables {
 		var count int64
-		if err := r.db.Model(table).Count(&count).Error; err != nil {
+		if err := db.Model(table).Count(&count).Error; err != nil {
 			return false
 		}
 		if count != 0 {
@@ -58,24 +71,31 @@ func (r *relationalDAL) ProbeEmpty() bool {
 	return true
 }
 
-func (r *relationalDAL) Ping() error {
+func (r *relationalDAL) Ping(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.Ping")
+	defer func() { tracing.End(span, err) }()
 	db, err := r.db.DB()
 	if err != nil {
 		return fmt.Errorf("relational: error accessing underlying database connection: %w", err)
 	}
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return fmt.Errorf("relational: error pinging database: %w", err)
 	}
 	return err
 }
 
-func (r *relationalDAL) DropAll() error {
-	if err := r.db.Migrator().DropTable(
+func (r *relationalDAL) DropAll(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.DropAll")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
+	if err := db.Migrator().DropTable(
 		&Event{},
 		&Account{},
 		&Secret{},
 		&AccountUser{},
 		&AccountUserRelationship{},
+		&RateLimit{},
 		"migrations",
 	); err != nil {
 		return fmt.Errorf("relational: error dropping tables: %w,", err)
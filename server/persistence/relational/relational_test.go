@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -19,7 +20,7 @@ func createTestDatabase() (*gorm.DB, func() error) {
 	if err != nil {
 		panic(err)
 	}
-	if err := db.AutoMigrate(&Event{}, &Account{}, &Secret{}, &AccountUser{}, &AccountUserRelationship{}, &Tombstone{}); err != nil {
+	if err := db.AutoMigrate(&Event{}, &Account{}, &Secret{}, &AccountUser{}, &AccountUserRelationship{}, &Tombstone{}, &RateLimit{}); err != nil {
 		panic(err)
 	}
 	d, _ := db.DB()
@@ -37,7 +38,7 @@ func TestRelationalDAL_Ping(t *testing.T) {
 	defer closeDB()
 
 	dal := NewRelationalDAL(db)
-	if err := dal.Ping(); err != nil {
+	if err := dal.Ping(context.Background()); err != nil {
 		t.Errorf("Unexpected error pinging database: %v", err)
 	}
 }
@@ -54,11 +55,11 @@ func TestRelationalDAL_DropAll(t *testing.T) {
 	}
 
 	dal := NewRelationalDAL(db)
-	if err := dal.DropAll(); err != nil {
+	if err := dal.DropAll(context.Background()); err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
 
-	if err := dal.ApplyMigrations(); err != nil {
+	if err := dal.ApplyMigrations(context.Background()); err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
 
@@ -74,7 +75,34 @@ func TestRelationalDAL_ApplyMigrations(t *testing.T) {
 
 	dal := NewRelationalDAL(db)
 
-	if err := dal.ApplyMigrations(); err != nil {
+	if err := dal.ApplyMigrations(context.Background()); err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
 }
+
+func TestRelationalDAL_PendingMigrations(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	dal := NewRelationalDAL(db)
+
+	pending, err := dal.PendingMigrations(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pending) != len(migrations()) {
+		t.Errorf("Expected all migrations to be pending, got %v", pending)
+	}
+
+	if err := dal.ApplyMigrations(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pending, err = dal.PendingMigrations(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending migrations, got %v", pending)
+	}
+}
@@ -4,23 +4,33 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
 )
 
-func (r *relationalDAL) CreateAccountUserRelationship(a *persistence.AccountUserRelationship) error {
+func (r *relationalDAL) CreateAccountUserRelationship(ctx context.Context, a *persistence.AccountUserRelationship) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.CreateAccountUserRelationship")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importAccountUserRelationship(a)
-	if err := r.db.Create(&local).Error; err != nil {
+	if err := db.Create(&local).Error; err != nil {
 		return fmt.Errorf("relational: error creating account user relationship: %w", err)
 	}
 	return nil
 }
 
-func (r *relationalDAL) DeleteAccountUserRelationships(q interface{}) error {
+func (r *relationalDAL) DeleteAccountUserRelationships(ctx context.Context, q interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.DeleteAccountUserRelationships", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	switch query := q.(type) {
 	case persistence.DeleteAccountUserRelationshipsQueryByAccountID:
-		if err := r.db.Where("account_id = ?", query).Delete(&AccountUserRelationship{}).Error; err != nil {
+		if err := db.Where("account_id = ?", query).Delete(&AccountUserRelationship{}).Error; err != nil {
 			return fmt.Errorf("relational: error deleting relationships for account %s: %w", query, err)
 		}
 		return nil
@@ -29,11 +39,15 @@ func (r *relationalDAL) DeleteAccountUserRelationships(q interface{}) error {
 	}
 }
 
-func (r *relationalDAL) FindAccountUserRelationships(q interface{}) ([]persistence.AccountUserRelationship, error) {
+func (r *relationalDAL) FindAccountUserRelationships(ctx context.Context, q interface{}) (_ []persistence.AccountUserRelationship, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindAccountUserRelationships", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	var relationships []AccountUserRelationship
 	switch query := q.(type) {
 	case persistence.FindAccountUserRelationshipsQueryByAccountUserID:
-		if err := r.db.Where("account_user_id = ?", string(query)).Find(&relationships).Error; err != nil {
+		if err := db.Where("account_user_id = ?", string(query)).Find(&relationships).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up account to account user relationships: %w", err)
 		}
 		result := []persistence.AccountUserRelationship{}
@@ -46,13 +60,17 @@ func (r *relationalDAL) FindAccountUserRelationships(q interface{}) ([]persisten
 	}
 }
 
-func (r *relationalDAL) UpdateAccountUserRelationship(a *persistence.AccountUserRelationship) error {
+func (r *relationalDAL) UpdateAccountUserRelationship(ctx context.Context, a *persistence.AccountUserRelationship) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.UpdateAccountUserRelationship")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importAccountUserRelationship(a)
-	exists := r.db.Where("relationship_id = ?", local.RelationshipID).First(&AccountUserRelationship{}).Error
+	exists := db.Where("relationship_id = ?", local.RelationshipID).First(&AccountUserRelationship{}).Error
 	if exists != nil {
 		return fmt.Errorf("relational: error looking up relationship to update: %w", exists)
 	}
-	if err := r.db.Save(&local).Error; err != nil {
+	if err := db.Save(&local).Error; err != nil {
 		return fmt.Errorf("relational: error updating account user relationship: %w", err)
 	}
 	return nil
@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -41,7 +42,7 @@ func TestRelationalDAL_CreateAccountUserRelationship(t *testing.T) {
 
 			dal := NewRelationalDAL(db)
 
-			err := dal.CreateAccountUserRelationship(test.arg)
+			err := dal.CreateAccountUserRelationship(context.Background(), test.arg)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -108,7 +109,7 @@ func TestRelationalDAL_FindAccountUserRelationships(t *testing.T) {
 				t.Fatalf("Unexpected error setting up test: %v", err)
 			}
 
-			result, err := dal.FindAccountUserRelationships(test.query)
+			result, err := dal.FindAccountUserRelationships(context.Background(), test.query)
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %v, got %v", test.expectedResult, result)
 			}
@@ -181,7 +182,7 @@ func TestRelationalDAL_UpdateAccountUserRelationship(t *testing.T) {
 				t.Fatalf("Unexpected error setting up test: %v", err)
 			}
 
-			err := dal.UpdateAccountUserRelationship(test.arg)
+			err := dal.UpdateAccountUserRelationship(context.Background(), test.arg)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -4,25 +4,35 @@
 package relational
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
 	"gorm.io/gorm"
 )
 
-func (r *relationalDAL) CreateSecret(s *persistence.Secret) error {
+func (r *relationalDAL) CreateSecret(ctx context.Context, s *persistence.Secret) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.CreateSecret")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importSecret(s)
-	if err := r.db.Create(&local).Error; err != nil {
+	if err := db.Create(&local).Error; err != nil {
 		return fmt.Errorf("relational: error creating secret: %w", err)
 	}
 	return nil
 }
 
-func (r *relationalDAL) DeleteSecret(q interface{}) error {
+func (r *relationalDAL) DeleteSecret(ctx context.Context, q interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.DeleteSecret", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	switch query := q.(type) {
 	case persistence.DeleteSecretQueryBySecretID:
-		if err := r.db.Where("secret_id = ?", string(query)).Delete(&Secret{}).Error; err != nil {
+		if err := db.Where("secret_id = ?", string(query)).Delete(&Secret{}).Error; err != nil {
 			return fmt.Errorf("relational: error deleting secret: %w", err)
 		}
 		return nil
@@ -31,11 +41,15 @@ func (r *relationalDAL) DeleteSecret(q interface{}) error {
 	}
 }
 
-func (r *relationalDAL) FindSecret(q interface{}) (persistence.Secret, error) {
+func (r *relationalDAL) FindSecret(ctx context.Context, q interface{}) (_ persistence.Secret, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindSecret", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	var secret Secret
 	switch query := q.(type) {
 	case persistence.FindSecretQueryBySecretID:
-		if err := r.db.Where(
+		if err := db.Where(
 			"secret_id = ?",
 			string(query),
 		).First(&secret).Error; err != nil {
@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -48,7 +49,7 @@ func TestRelationalDAL_CreateSecret(t *testing.T) {
 			if err := test.setup(db); err != nil {
 				t.Fatalf("Unexpected error running setup: %v", err)
 			}
-			if err := dal.CreateSecret(test.secret); err != nil {
+			if err := dal.CreateSecret(context.Background(), test.secret); err != nil {
 				t.Errorf("Unexpected error creating secret: %v", err)
 			}
 			if err := test.assertion(db); err != nil {
@@ -120,7 +121,7 @@ func TestRelationalDAL_DeleteSecret(t *testing.T) {
 				t.Fatalf("Unexpected error setting up test: %v", err)
 			}
 
-			err := dal.DeleteSecret(test.arg)
+			err := dal.DeleteSecret(context.Background(), test.arg)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -185,7 +186,7 @@ func TestRelationalDAL_FindSecret(t *testing.T) {
 				t.Fatalf("Unexpected error setting up test: %v", err)
 			}
 
-			result, err := dal.FindSecret(test.arg)
+			result, err := dal.FindSecret(context.Background(), test.arg)
 
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %v, got %v", test.expectedResult, result)
@@ -4,24 +4,34 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
 )
 
-func (r *relationalDAL) CreateTombstone(t *persistence.Tombstone) error {
+func (r *relationalDAL) CreateTombstone(ctx context.Context, t *persistence.Tombstone) (err error) {
+	ctx, span := tracing.Start(ctx, "relational.CreateTombstone")
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	local := importTombstone(t)
-	if err := r.db.Create(&local).Error; err != nil {
+	if err := db.Create(&local).Error; err != nil {
 		return fmt.Errorf("relational: error creating tombstone: %w", err)
 	}
 	return nil
 }
 
-func (r *relationalDAL) FindTombstones(q interface{}) ([]persistence.Tombstone, error) {
+func (r *relationalDAL) FindTombstones(ctx context.Context, q interface{}) (_ []persistence.Tombstone, err error) {
+	ctx, span := tracing.Start(ctx, "relational.FindTombstones", queryAttribute(q))
+	defer func() { tracing.End(span, err) }()
+	db := r.db.WithContext(ctx)
+
 	switch query := q.(type) {
 	case persistence.FindTombstonesQueryByAccounts:
 		var result []Tombstone
-		if err := r.db.Find(&result, "account_id IN (?) AND sequence > ?", query.AccountIDs, query.Since).Error; err != nil {
+		if err := db.Find(&result, "account_id IN (?) AND sequence > ?", query.AccountIDs, query.Since).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up tombstones by account ids: %w", err)
 		}
 		var export []persistence.Tombstone
@@ -31,7 +41,7 @@ func (r *relationalDAL) FindTombstones(q interface{}) ([]persistence.Tombstone,
 		return export, nil
 	case persistence.FindTombstonesQueryBySecrets:
 		var result []Tombstone
-		if err := r.db.Find(&result, "secret_id IN (?) AND sequence > ?", query.SecretIDs, query.Since).Error; err != nil {
+		if err := db.Find(&result, "secret_id IN (?) AND sequence > ?", query.SecretIDs, query.Since).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up tombstones by secret ids: %w", err)
 		}
 		var export []persistence.Tombstone
@@ -39,6 +49,30 @@ func (r *relationalDAL) FindTombstones(q interface{}) ([]persistence.Tombstone,
 			export = append(export, t.export())
 		}
 		return export, nil
+	case persistence.FindTombstonesQueryLatest:
+		var result []Tombstone
+		if err := db.Order("sequence DESC").Limit(1).Find(&result).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up latest tombstone: %w", err)
+		}
+		var export []persistence.Tombstone
+		for _, t := range result {
+			export = append(export, t.export())
+		}
+		return export, nil
+	case persistence.FindTombstonesQueryNewerThan:
+		var result []Tombstone
+		lookup := db.Order("sequence").Where("sequence > ? AND account_id IN (?)", query.Since, query.AccountIDs)
+		if query.Limit > 0 {
+			lookup = lookup.Limit(query.Limit)
+		}
+		if err := lookup.Find(&result).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up tombstones by sequence: %w", err)
+		}
+		var export []persistence.Tombstone
+		for _, t := range result {
+			export = append(export, t.export())
+		}
+		return export, nil
 	default:
 		return nil, persistence.ErrBadQuery
 	}
@@ -3,6 +3,7 @@
 package relational
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -54,7 +55,7 @@ func TestRelationalDAL_CreateTombstone(t *testing.T) {
 			defer closeDB()
 			dal := NewRelationalDAL(db)
 
-			err := dal.CreateTombstone(&test.input)
+			err := dal.CreateTombstone(context.Background(), &test.input)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -167,6 +168,72 @@ func TestRelationalDAL_FindTombstones(t *testing.T) {
 				},
 			},
 		},
+		{
+			"query newer than sequence",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"c", "a", "d", "b"} {
+					accountID := "account-a"
+					if token == "d" {
+						accountID = "account-b"
+					}
+					if err := db.Save(&Tombstone{
+						EventID:   "event-" + token,
+						AccountID: accountID,
+						Sequence:  "sequence-" + token,
+					}).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			persistence.FindTombstonesQueryNewerThan{Since: "sequence-a", AccountIDs: []string{"account-a"}},
+			false,
+			[]persistence.Tombstone{
+				{EventID: "event-b", AccountID: "account-a", Sequence: "sequence-b"},
+				{EventID: "event-c", AccountID: "account-a", Sequence: "sequence-c"},
+			},
+		},
+		{
+			"query newer than sequence with limit",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"c", "a", "b"} {
+					if err := db.Save(&Tombstone{
+						EventID:   "event-" + token,
+						AccountID: "account-a",
+						Sequence:  "sequence-" + token,
+					}).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			persistence.FindTombstonesQueryNewerThan{Since: "sequence-0", AccountIDs: []string{"account-a"}, Limit: 2},
+			false,
+			[]persistence.Tombstone{
+				{EventID: "event-a", AccountID: "account-a", Sequence: "sequence-a"},
+				{EventID: "event-b", AccountID: "account-a", Sequence: "sequence-b"},
+			},
+		},
+		{
+			"query latest",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"b", "c", "a"} {
+					if err := db.Save(&Tombstone{
+						EventID:   "event-" + token,
+						AccountID: "account-a",
+						Sequence:  "sequence-" + token,
+					}).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			persistence.FindTombstonesQueryLatest{},
+			false,
+			[]persistence.Tombstone{
+				{EventID: "event-c", AccountID: "account-a", Sequence: "sequence-c"},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -179,7 +246,7 @@ func TestRelationalDAL_FindTombstones(t *testing.T) {
 			}
 			dal := NewRelationalDAL(db)
 
-			result, err := dal.FindTombstones(test.query)
+			result, err := dal.FindTombstones(context.Background(), test.query)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -28,10 +29,10 @@ func (t *transaction) Commit() error {
 	return nil
 }
 
-func (t *transaction) Transaction() (persistence.Transaction, error) {
+func (t *transaction) Transaction(context.Context) (persistence.Transaction, error) {
 	return nil, errors.New("relational: cannot call transaction on a transaction")
 }
 
-func (t *transaction) Ping() error {
+func (t *transaction) Ping(context.Context) error {
 	return errors.New("relational: cannot call ping on a transaction")
 }
@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -17,24 +18,24 @@ func TestRelationalDAL_Transaction(t *testing.T) {
 
 	dal := NewRelationalDAL(db)
 
-	txn, err := dal.Transaction()
+	txn, err := dal.Transaction(context.Background())
 	if err != nil {
 		t.Errorf("Unexpected error creating transaction %v", err)
 	}
 
-	if _, err := txn.Transaction(); err == nil {
+	if _, err := txn.Transaction(context.Background()); err == nil {
 		t.Error("Expected error when creating transaction off another transaction")
 	}
 
-	if err := txn.Ping(); err == nil {
+	if err := txn.Ping(context.Background()); err == nil {
 		t.Error("Expected error when using transaction to ping")
 	}
 
-	if err := txn.ApplyMigrations(); err != nil {
+	if err := txn.ApplyMigrations(context.Background()); err != nil {
 		t.Errorf("Unexpected error when applying migrations to a transaction")
 	}
 
-	if err := txn.CreateEvent(&persistence.Event{
+	if err := txn.CreateEvent(context.Background(), &persistence.Event{
 		EventID: "event-a",
 		Payload: "payload-xxx",
 	}); err != nil {
@@ -49,11 +50,11 @@ func TestRelationalDAL_Transaction(t *testing.T) {
 		t.Errorf("Unexpected error value looking up record post-commit: %v", err)
 	}
 
-	txn2, err := dal.Transaction()
+	txn2, err := dal.Transaction(context.Background())
 	if err != nil {
 		t.Fatalf("Unexpected error creating transaction: %v", txn2)
 	}
-	if err := txn2.CreateEvent(&persistence.Event{
+	if err := txn2.CreateEvent(context.Background(), &persistence.Event{
 		EventID: "event-b",
 		Payload: "payload-yyy",
 	}); err != nil {
@@ -47,6 +47,7 @@ type AccountResult struct {
 	Sequence            string                `json:"sequence,omitempty"`
 	Secrets             *EncryptedSecretsByID `json:"secrets,omitempty"`
 	AccountStyles       string                `json:"accountStyles,omitempty"`
+	AllowedOrigins      []string              `json:"allowedOrigins,omitempty"`
 	Created             time.Time             `json:"created,omitempty"`
 	RetentionPeriod     string                `json:"retentionPeriod,omitempty"`
 }
@@ -88,3 +89,13 @@ type LoginAccountResult struct {
 	KeyEncryptionKey interface{} `json:"keyEncryptionKey"`
 	Created          time.Time   `json:"created"`
 }
+
+// Change describes a single modification of the stored events. It either
+// contains an event that has been inserted or the identifier of an event that
+// has been deleted. Payloads are passed on in their encrypted form.
+type Change struct {
+	AccountID      string       `json:"accountId"`
+	Sequence       string       `json:"sequence"`
+	Event          *EventResult `json:"event,omitempty"`
+	DeletedEventID string       `json:"deletedEventId,omitempty"`
+}
@@ -13,6 +13,8 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sort"
+	"strings"
 )
 
 // FS provides static assets for the server to serve
@@ -69,6 +71,51 @@ func (l *LocalizedFS) Open(file string) (http.File, error) {
 	return nil, err
 }
 
+// Paths returns all locations that can be opened using the file system,
+// including the ones that are resolved from the configured or the default
+// locale.
+func (l *LocalizedFS) Paths() ([]string, error) {
+	seen := map[string]bool{}
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		f, err := l.root.Open(path.Join(l.prefix, dir))
+		if err != nil {
+			return fmt.Errorf("public: error opening directory %s: %w", dir, err)
+		}
+		defer f.Close()
+		infos, err := f.Readdir(-1)
+		if err != nil {
+			return fmt.Errorf("public: error reading directory %s: %w", dir, err)
+		}
+		for _, info := range infos {
+			location := path.Join(dir, info.Name())
+			if info.IsDir() {
+				if err := walk(location); err != nil {
+					return err
+				}
+				continue
+			}
+			seen[location] = true
+			for _, locale := range []string{l.locale, defaultLocale} {
+				if localized, ok := strings.CutPrefix(location, "/"+locale+"/"); ok {
+					seen["/"+localized] = true
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk("/"); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for location := range seen {
+		paths = append(paths, location)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
 // NewLocalizedFS returns a http.FileSystem that is locale aware. It will first
 // try to return the file in the given locale. In case this is not found, it tries
 // returning the asset in the default language, falling back to the root fs if
@@ -165,3 +165,34 @@ func TestLocalizedFS_getTemplate(t *testing.T) {
 		}
 	})
 }
+
+func TestLocalizedFS_Paths(t *testing.T) {
+	l := &LocalizedFS{
+		locale: "fr",
+		root:   http.FS(testFS),
+		prefix: "/testdata",
+	}
+	result, err := l.Paths()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []string{
+		"/en/file.txt",
+		"/file.txt",
+		"/fr/file.txt",
+		"/fr/rev-manifest.json",
+		"/fr/truc-abc123.txt",
+		"/rev-manifest.json",
+		"/template.go.html",
+		"/thing.txt",
+		"/truc-abc123.txt",
+	}
+	if fmt.Sprintf("%v", expected) != fmt.Sprintf("%v", result) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	for _, location := range result {
+		if _, err := l.Open(location); err != nil {
+			t.Errorf("Unexpected error opening %s: %v", location, err)
+		}
+	}
+}
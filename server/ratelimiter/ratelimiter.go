@@ -4,6 +4,7 @@
 package ratelimiter
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"errors"
@@ -16,6 +17,11 @@ var (
 	errWouldExceedDeadline = errors.New("ratelimiter: applicable rate limit would exceed give deadline")
 )
 
+// ErrRateLimited is returned by a non-blocking Limiter when a call has been
+// rejected. The Delay of the Result contains the time after which the call
+// would be admitted.
+var ErrRateLimited = errors.New("ratelimiter: rate limit exceeded")
+
 // GetSetter needs to be implemented by any cache that is
 // to be used for storing limits
 type GetSetter interface {
@@ -23,6 +29,22 @@ type GetSetter interface {
 	Set(key string, value interface{}, expiry time.Duration)
 }
 
+// Store can be implemented by caches that are shared by multiple processes,
+// e.g. a database. In contrast to GetSetter, reading and updating the state
+// stored for a key has to happen atomically. A nil State is passed to fn in
+// case no state exists for the key or the existing state has expired. In case
+// fn returns an error, the stored state must not be changed.
+type Store interface {
+	Update(ctx context.Context, key string, fn func(*State) (*State, error)) error
+}
+
+// State describes the rate limiting applied to a single identifier.
+type State struct {
+	BlockUntil  time.Time
+	QueueLength int64
+	Expires     time.Time
+}
+
 // Throttler needs to be implemented by any rate limiter
 type Throttler interface {
 	LinearThrottle(threshold time.Duration, identifier string) <-chan Result
@@ -32,15 +54,43 @@ type Throttler interface {
 // Limiter can be used to rate limit operations
 // based on an identifier and a threshold value
 type Limiter struct {
-	timeout time.Duration
-	cache   GetSetter
-	salt    []byte
+	timeout     time.Duration
+	cache       GetSetter
+	store       Store
+	salt        []byte
+	nonBlocking bool
+	burst       int64
 }
 
-// Result describes the outcome of a `Throttle` call
+// Option is used to configure a Limiter
+type Option func(*Limiter)
+
+// NonBlocking makes the Limiter reject calls that exceed the rate limit
+// instead of delaying them. Limits are enforced using a token bucket that
+// allows bursts of up to the given number of calls and is refilled at the
+// rate defined by the threshold passed to each call.
+func NonBlocking(burst int) Option {
+	return func(l *Limiter) {
+		if burst < 1 {
+			burst = 1
+		}
+		l.nonBlocking = true
+		l.burst = int64(burst)
+	}
+}
+
+// Result describes the outcome of a `Throttle` call. Limit, Remaining
+// and Reset are only populated by non-blocking limiters.
 type Result struct {
 	Error error
 	Delay time.Duration
+	// Limit is the number of calls allowed in a burst
+	Limit int64
+	// Remaining is the number of calls that would currently be admitted
+	// without being rate limited
+	Remaining int64
+	// Reset is the time after which the full burst is available again
+	Reset time.Duration
 }
 
 func (l *Limiter) hash(s string) string {
@@ -48,11 +98,6 @@ func (l *Limiter) hash(s string) string {
 	return fmt.Sprintf("%x", sha256.Sum256(joined))
 }
 
-type cacheItem struct {
-	blockUntil time.Time
-	queueLen   int64
-}
-
 // LinearThrottle returns a channel that blocks until the configured
 // rate limit has been satisfied. The channel will send a `Result` exactly
 // once before closing, containing information on the
@@ -71,59 +116,165 @@ func (l *Limiter) throttle(threshold time.Duration, identifier string, exponenti
 
 	out := make(chan Result)
 	go func() {
-		if value, found := l.cache.Get(hashedIdentifier); found {
-			if item, ok := value.(cacheItem); ok {
-				remaining := time.Until(item.blockUntil)
-				if remaining > l.timeout {
-					out <- Result{Error: errWouldExceedDeadline}
-					return
-				}
-
-				factor := time.Duration(1)
-				if exponential {
-					factor = time.Duration(item.queueLen)
-				}
-
-				l.cache.Set(
-					hashedIdentifier,
-					cacheItem{
-						blockUntil: item.blockUntil.Add(
-							threshold * factor,
-						),
-						queueLen: item.queueLen + 1,
-					},
-					remaining,
-				)
-				time.Sleep(remaining)
-				out <- Result{Delay: remaining}
-			} else {
-				out <- Result{Error: errInvalidCache}
-			}
-		} else {
-			l.cache.Set(hashedIdentifier, cacheItem{
-				blockUntil: time.Now().Add(threshold),
-				queueLen:   1,
-			}, threshold)
-			out <- Result{}
+		result := l.reserve(hashedIdentifier, threshold, exponential)
+		if result.Error == nil && result.Delay > 0 {
+			time.Sleep(result.Delay)
 		}
+		out <- result
 		close(out)
 	}()
 	return out
 }
 
+// reserve updates the state for the given key and returns the outcome
+// of the call.
+func (l *Limiter) reserve(key string, threshold time.Duration, exponential bool) Result {
+	now := time.Now()
+	if l.store != nil {
+		var result Result
+		err := l.store.Update(context.Background(), key, func(current *State) (*State, error) {
+			var next *State
+			next, result = l.advance(current, threshold, exponential, now)
+			return next, result.Error
+		})
+		if err != nil && result.Error == nil {
+			return Result{Error: err}
+		}
+		return result
+	}
+
+	var current *State
+	if value, found := l.cache.Get(key); found {
+		item, ok := value.(State)
+		if !ok {
+			return Result{Error: errInvalidCache}
+		}
+		current = &item
+	}
+	next, result := l.advance(current, threshold, exponential, now)
+	if result.Error == nil {
+		l.cache.Set(key, *next, next.Expires.Sub(now))
+	}
+	return result
+}
+
+// advance computes the state that follows the given one when another call
+// is made at the given time. In case the returned Result contains an error
+// the state is expected to be left untouched.
+func (l *Limiter) advance(current *State, threshold time.Duration, exponential bool, now time.Time) (*State, Result) {
+	if l.nonBlocking {
+		return l.advanceBucket(current, threshold, exponential, now)
+	}
+
+	if current == nil {
+		return &State{
+			BlockUntil:  now.Add(threshold),
+			QueueLength: 1,
+			Expires:     now.Add(threshold),
+		}, Result{}
+	}
+
+	remaining := current.BlockUntil.Sub(now)
+	if remaining > l.timeout {
+		return nil, Result{Error: errWouldExceedDeadline}
+	}
+
+	factor := time.Duration(1)
+	if exponential {
+		factor = time.Duration(current.QueueLength)
+	}
+
+	return &State{
+		BlockUntil:  current.BlockUntil.Add(threshold * factor),
+		QueueLength: current.QueueLength + 1,
+		Expires:     now.Add(remaining),
+	}, Result{Delay: remaining}
+}
+
+// advanceBucket implements a token bucket using the generic cell rate
+// algorithm. BlockUntil stores the theoretical arrival time of the next call,
+// i.e. the time at which the bucket will be full again.
+func (l *Limiter) advanceBucket(current *State, threshold time.Duration, exponential bool, now time.Time) (*State, Result) {
+	tat := now
+	var queueLength int64
+	if current != nil {
+		queueLength = current.QueueLength
+		if current.BlockUntil.After(now) {
+			tat = current.BlockUntil
+		}
+	}
+
+	tolerance := threshold * time.Duration(l.burst-1)
+	if wait := tat.Sub(now) - tolerance; wait > 0 {
+		return nil, Result{
+			Error: ErrRateLimited,
+			Delay: wait,
+			Limit: l.burst,
+			Reset: tat.Sub(now),
+		}
+	}
+
+	increment := threshold
+	if exponential && queueLength > 0 {
+		increment = threshold * time.Duration(queueLength)
+	}
+	next := tat.Add(increment)
+
+	var remaining int64
+	if threshold > 0 {
+		remaining = int64((tolerance - next.Sub(now)) / threshold)
+		if next.Sub(now) <= tolerance {
+			remaining++
+		}
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &State{
+		BlockUntil:  next,
+		QueueLength: queueLength + 1,
+		Expires:     next,
+	}, Result{
+		Limit:     l.burst,
+		Remaining: remaining,
+		Reset:     next.Sub(now),
+	}
+}
+
 // New creates a new Throttler using Limiter. `threshold` defines the
 // enforced minimum distance between two calls of the
 // instance's `Throttle` method using the same identifier
-func New(timeout time.Duration, cache GetSetter) Throttler {
+func New(timeout time.Duration, cache GetSetter, opts ...Option) Throttler {
 	salt, err := randomBytes(16)
 	if err != nil {
 		panic("cannot initialize rate limiter")
 	}
-	return &Limiter{
+	l := &Limiter{
 		cache:   cache,
 		timeout: timeout,
 		salt:    salt,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// NewWithStore creates a new Throttler using Limiter that keeps its state
+// in the given Store, so that limits can be shared by multiple processes.
+// Identifiers are hashed using the given salt before being stored, which
+// means all processes sharing a store need to use the same salt.
+func NewWithStore(timeout time.Duration, store Store, salt []byte, opts ...Option) Throttler {
+	l := &Limiter{
+		store:   store,
+		timeout: timeout,
+		salt:    salt,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // NoopRatelimiter implements Throttler without ever blocking
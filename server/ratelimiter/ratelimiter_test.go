@@ -4,6 +4,7 @@
 package ratelimiter
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
@@ -98,3 +99,101 @@ func ExampleNew() {
 	// true
 	// false
 }
+
+type mockStore struct {
+	states map[string]State
+	lock   sync.Mutex
+}
+
+func (m *mockStore) Update(ctx context.Context, key string, fn func(*State) (*State, error)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.states == nil {
+		m.states = map[string]State{}
+	}
+	var current *State
+	if s, ok := m.states[key]; ok && time.Now().Before(s.Expires) {
+		current = &s
+	}
+	next, err := fn(current)
+	if err != nil {
+		return err
+	}
+	m.states[key] = *next
+	return nil
+}
+
+func TestLinearThrottle_Store(t *testing.T) {
+	store := &mockStore{}
+	salt := []byte("salt")
+	a := NewWithStore(time.Hour, store, salt)
+	b := NewWithStore(time.Hour, store, salt)
+
+	if result := <-a.LinearThrottle(time.Second, "shared"); result.Delay != 0 {
+		t.Errorf("Unexpected delay on first call %v", result.Delay)
+	}
+	if result := <-b.LinearThrottle(time.Millisecond*50, "shared"); result.Delay <= 0 {
+		t.Errorf("Expected limit to be shared, got delay %v", result.Delay)
+	}
+}
+
+func TestLinearThrottle_Deadline(t *testing.T) {
+	limiter := NewWithStore(time.Millisecond, &mockStore{}, []byte("salt"))
+	<-limiter.LinearThrottle(time.Hour, "deadline")
+	if result := <-limiter.LinearThrottle(time.Hour, "deadline"); result.Error == nil {
+		t.Error("Expected error when exceeding deadline")
+	}
+}
+
+func TestLinearThrottle_NonBlocking(t *testing.T) {
+	limiter := New(time.Hour, &mockGetSetter{}, NonBlocking(3))
+	for i := int64(0); i < 3; i++ {
+		result := <-limiter.LinearThrottle(time.Minute, "burst")
+		if result.Error != nil {
+			t.Fatalf("Unexpected error on call %d: %v", i, result.Error)
+		}
+		if result.Delay != 0 {
+			t.Errorf("Unexpected delay on call %d: %v", i, result.Delay)
+		}
+		if result.Limit != 3 || result.Remaining != 2-i {
+			t.Errorf("Unexpected result on call %d: %v", i, result)
+		}
+	}
+
+	start := time.Now()
+	result := <-limiter.LinearThrottle(time.Minute, "burst")
+	if time.Since(start) > time.Second {
+		t.Error("Expected rejection to happen without blocking")
+	}
+	if result.Error != ErrRateLimited {
+		t.Errorf("Expected rate limit error, got %v", result.Error)
+	}
+	if result.Delay <= 0 || result.Delay > time.Minute {
+		t.Errorf("Unexpected retry delay %v", result.Delay)
+	}
+	if result.Remaining != 0 || result.Reset <= 2*time.Minute {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	if other := <-limiter.LinearThrottle(time.Minute, "other"); other.Error != nil {
+		t.Errorf("Unexpected error for other identifier %v", other.Error)
+	}
+}
+
+func TestExponentialThrottle_NonBlocking(t *testing.T) {
+	limiter := NewWithStore(time.Hour, &mockStore{}, []byte("salt"), NonBlocking(3))
+	for i := 0; i < 3; i++ {
+		if result := <-limiter.ExponentialThrottle(time.Minute, "exponential"); result.Error != nil {
+			t.Fatalf("Unexpected error on call %d: %v", i, result.Error)
+		}
+	}
+	// each admitted call consumes an increasing number of tokens, so callers
+	// have to wait longer than they would when throttled linearly
+	result := <-limiter.ExponentialThrottle(time.Minute, "exponential")
+	if result.Error != ErrRateLimited {
+		t.Errorf("Expected rate limit error, got %v", result.Error)
+	}
+	if result.Delay <= time.Minute {
+		t.Errorf("Unexpected retry delay %v", result.Delay)
+	}
+}
@@ -4,11 +4,11 @@
 package router
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/persistence"
@@ -16,11 +16,7 @@ import (
 
 func (rt *router) getAccount(c *gin.Context) {
 	accountID := c.Param("accountID")
-	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getAccount-%s", accountID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "getAccount", accountID) {
 		return
 	}
 	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
@@ -40,7 +36,16 @@ func (rt *router) getAccount(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.GetAccount(accountID, true, true, c.Query("since"))
+	// the account's own data is not covered by sequences, so changes to
+	// e.g. its name or styles need to invalidate the ETag as well
+	if account, err := rt.db.GetAccount(c.Request.Context(), accountID, true, false, ""); err == nil {
+		data, _ := json.Marshal(account)
+		if rt.notModified(c, "account", accountID, c.Query("since"), string(data)) {
+			return
+		}
+	}
+
+	result, err := rt.db.GetAccount(c.Request.Context(), accountID, true, true, c.Query("since"))
 	if err != nil {
 		var errUnknown persistence.ErrUnknownAccount
 		if errors.As(err, &errUnknown) {
@@ -56,18 +61,14 @@ func (rt *router) getAccount(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	result.RetentionPeriod = rt.config.App.Retention.String()
+	result.RetentionPeriod = rt.retention()
 	c.JSON(http.StatusOK, result)
 }
 
 func (rt *router) deleteAccount(c *gin.Context) {
 	accountID := c.Param("accountID")
 
-	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("deleteAccount-%s", accountID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "deleteAccount", accountID) {
 		return
 	}
 
@@ -88,7 +89,7 @@ func (rt *router) deleteAccount(c *gin.Context) {
 		return
 	}
 
-	err := rt.db.RetireAccount(accountID)
+	err := rt.db.RetireAccount(c.Request.Context(), accountID)
 	if err != nil {
 		var errUnknown persistence.ErrUnknownAccount
 		if errors.As(err, &errUnknown) {
@@ -132,15 +133,11 @@ func (rt *router) postAccount(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postAccount-%s", req.EmailAddress)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postAccount", req.EmailAddress) {
 		return
 	}
 
-	accountInRequest, err := rt.db.Login(req.EmailAddress, req.Password)
+	accountInRequest, err := rt.db.Login(c.Request.Context(), req.EmailAddress, req.Password)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error validating given credentials: %w", err),
@@ -166,7 +163,7 @@ func (rt *router) postAccount(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.CreateAccount(html.UnescapeString(rt.sanitizer.Sanitize(req.AccountName)), req.EmailAddress, req.Password); err != nil {
+	if err := rt.db.CreateAccount(c.Request.Context(), html.UnescapeString(rt.sanitizer.Sanitize(req.AccountName)), req.EmailAddress, req.Password); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error creating account %s: %w", req.AccountName, err),
 			http.StatusInternalServerError,
@@ -4,6 +4,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -25,10 +26,14 @@ type mockGetAccountDatabase struct {
 	err    error
 }
 
-func (m *mockGetAccountDatabase) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+func (m *mockGetAccountDatabase) GetAccount(context.Context, string, bool, bool, string) (persistence.AccountResult, error) {
 	return m.result, m.err
 }
 
+func (m *mockGetAccountDatabase) LatestSequence(context.Context) (string, error) {
+	return "", nil
+}
+
 func TestRouter_GetAccount(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -72,6 +77,7 @@ func TestRouter_GetAccount(t *testing.T) {
 				Name:  "auth",
 			})
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodGet, "/api/accounts/:accountID", r, w)
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
 			}
@@ -87,7 +93,7 @@ type mockDeleteAccountDatabase struct {
 	result error
 }
 
-func (m *mockDeleteAccountDatabase) RetireAccount(string) error {
+func (m *mockDeleteAccountDatabase) RetireAccount(context.Context, string) error {
 	return m.result
 }
 
@@ -156,6 +162,7 @@ func TestRouter_DeleteAccount(t *testing.T) {
 				Name:  "auth",
 			})
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodDelete, "/api/accounts/:accountID", r, w)
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
 			}
@@ -170,11 +177,11 @@ type mockPostAccountDatabase struct {
 	createAccountErr error
 }
 
-func (m *mockPostAccountDatabase) Login(string, string) (persistence.LoginResult, error) {
+func (m *mockPostAccountDatabase) Login(context.Context, string, string) (persistence.LoginResult, error) {
 	return m.loginResult, m.loginErr
 }
 
-func (m *mockPostAccountDatabase) CreateAccount(string, string, string) error {
+func (m *mockPostAccountDatabase) CreateAccount(context.Context, string, string, string) error {
 	return m.createAccountErr
 }
 
@@ -302,6 +309,7 @@ func TestRouter_postAccount(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/accounts", r, w)
 
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
@@ -0,0 +1,280 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+)
+
+// precompressedEncodings lists the encodings static assets are served in,
+// in order of preference, mapped to the suffix of files containing an already
+// compressed variant.
+var precompressedEncodings = []struct {
+	name   string
+	suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func precompressedEncodingNames() []string {
+	var names []string
+	for _, enc := range precompressedEncodings {
+		names = append(names, enc.name)
+	}
+	return names
+}
+
+// asset is a single file that can be served from the asset index.
+type asset struct {
+	name        string
+	content     []byte
+	contentType string
+	etag        string
+	modTime     time.Time
+
+	variantsOnce sync.Once
+	variants     map[string][]byte
+}
+
+// variant returns the content of the asset compressed using the given
+// encoding. In case the content is too small to benefit from compression or
+// the compressed variant is not smaller than the original content, nil is
+// returned. Compressed variants are created when they are
+// first requested.
+func (a *asset) variant(encoding string) []byte {
+	a.variantsOnce.Do(func() {
+		if a.variants == nil {
+			a.variants = map[string][]byte{}
+		}
+		if !isCompressible(a.contentType) || len(a.content) < minCompressSize {
+			return
+		}
+		for _, enc := range precompressedEncodings {
+			if _, ok := a.variants[enc.name]; ok {
+				continue
+			}
+			var buf bytes.Buffer
+			var w io.WriteCloser
+			switch enc.name {
+			case "br":
+				w = brotli.NewWriterLevel(&buf, 9)
+			case "gzip":
+				w, _ = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+			}
+			if _, err := w.Write(a.content); err != nil {
+				continue
+			}
+			if err := w.Close(); err != nil {
+				continue
+			}
+			if buf.Len() < len(a.content) {
+				a.variants[enc.name] = buf.Bytes()
+			}
+		}
+	})
+	return a.variants[encoding]
+}
+
+// assetIndex serves static assets from memory. It is built once on startup
+// so requests do not need to touch the underlying file system.
+type assetIndex struct {
+	assets map[string]*asset
+	// dirs contains all paths that are served by an index.html file
+	dirs map[string]bool
+}
+
+// pathLister can be implemented by file systems that do not support listing
+// directories but can list all paths they contain instead.
+type pathLister interface {
+	Paths() ([]string, error)
+}
+
+// newAssetIndex reads all files contained in the given file system. In case
+// the file system does not implement pathLister, it is walked using Readdir.
+func newAssetIndex(fs http.FileSystem) (*assetIndex, error) {
+	idx := &assetIndex{
+		assets: map[string]*asset{},
+		dirs:   map[string]bool{},
+	}
+	if fs == nil {
+		return idx, nil
+	}
+
+	var paths []string
+	if lister, ok := fs.(pathLister); ok {
+		var err error
+		paths, err = lister.Paths()
+		if err != nil {
+			return nil, fmt.Errorf("router: error listing assets: %w", err)
+		}
+	} else {
+		var err error
+		paths, err = walkFileSystem(fs, "/")
+		if err != nil {
+			return nil, fmt.Errorf("router: error walking assets: %w", err)
+		}
+	}
+
+	for _, location := range paths {
+		a, err := readAsset(fs, location)
+		if err != nil {
+			return nil, err
+		}
+		idx.assets[location] = a
+	}
+
+	// files containing compressed variants of other assets are used instead
+	// of compressing the asset on the fly
+	for location, a := range idx.assets {
+		for _, enc := range precompressedEncodings {
+			compressed, ok := idx.assets[location+enc.suffix]
+			if !ok {
+				continue
+			}
+			if a.variants == nil {
+				a.variants = map[string][]byte{}
+			}
+			a.variants[enc.name] = compressed.content
+		}
+	}
+
+	for location := range idx.assets {
+		if path.Base(location) == "index.html" {
+			idx.dirs[strings.TrimSuffix(location, "index.html")] = true
+		}
+	}
+	return idx, nil
+}
+
+func walkFileSystem(fs http.FileSystem, dir string) ([]string, error) {
+	f, err := fs.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, info := range infos {
+		location := path.Join(dir, info.Name())
+		if info.IsDir() {
+			children, err := walkFileSystem(fs, location)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, children...)
+			continue
+		}
+		result = append(result, location)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func readAsset(fs http.FileSystem, location string) (*asset, error) {
+	f, err := fs.Open(location)
+	if err != nil {
+		return nil, fmt.Errorf("router: error opening asset %s: %w", location, err)
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("router: error reading asset %s: %w", location, err)
+	}
+
+	var modTime time.Time
+	if info, err := f.Stat(); err == nil {
+		modTime = info.ModTime()
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(location))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	return &asset{
+		name:        location,
+		content:     content,
+		contentType: contentType,
+		etag:        fmt.Sprintf("%x", sha256.Sum256(content))[:32],
+		modTime:     modTime,
+	}, nil
+}
+
+// lookup returns the asset that is served for the given request path. In case
+// the path needs to be redirected to its canonical form, the location to
+// redirect to is returned instead.
+func (idx *assetIndex) lookup(urlPath string) (a *asset, redirect string) {
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	cleaned := path.Clean(urlPath)
+	if strings.HasSuffix(urlPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	switch {
+	case strings.HasSuffix(cleaned, "/index.html") && idx.dirs[strings.TrimSuffix(cleaned, "index.html")]:
+		return nil, strings.TrimSuffix(cleaned, "index.html")
+	case strings.HasSuffix(cleaned, "/"):
+		if idx.dirs[cleaned] {
+			return idx.assets[cleaned+"index.html"], ""
+		}
+		return nil, ""
+	case idx.dirs[cleaned+"/"]:
+		return nil, cleaned + "/"
+	}
+	return idx.assets[cleaned], ""
+}
+
+// serve writes the given asset using the best encoding the client accepts.
+func (idx *assetIndex) serve(w http.ResponseWriter, r *http.Request, a *asset) {
+	h := w.Header()
+	h.Set("Content-Type", a.contentType)
+
+	content, etag := a.content, a.etag
+	if isCompressible(a.contentType) {
+		addVary(h, "Accept-Encoding")
+		if enc := negotiate(r.Header.Get("Accept-Encoding"), precompressedEncodingNames()); enc != "" {
+			if variant := a.variant(enc); variant != nil {
+				content, etag = variant, a.etag+"-"+enc
+				h.Set("Content-Encoding", enc)
+			}
+		}
+	}
+	h.Set("ETag", `"`+etag+`"`)
+	http.ServeContent(w, r, a.name, a.modTime, bytes.NewReader(content))
+}
+
+// precompress creates the compressed variants of all assets, so they do not
+// need to be created when they are first requested.
+func (idx *assetIndex) precompress() {
+	for _, a := range idx.assets {
+		a.variant(precompressedEncodings[0].name)
+	}
+}
+
+// isAssetPath checks whether the given path is expected to refer to a file
+// instead of a route handled by a single page application.
+func isAssetPath(urlPath string) bool {
+	ext := path.Ext(urlPath)
+	return ext != "" && ext != ".html"
+}
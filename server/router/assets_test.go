@@ -0,0 +1,164 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+var testAssetContent = []byte(strings.Repeat("console.log('hello world');\n", 256))
+
+func newTestAssetIndex(t testing.TB) *assetIndex {
+	t.Helper()
+	idx, err := newAssetIndex(http.FS(fstest.MapFS{
+		"index.html":             {Data: []byte("<html><body>index</body></html>")},
+		"auditorium/index.html":  {Data: []byte("<html><body>auditorium</body></html>")},
+		"vendor-ab21bef31c.js":   {Data: testAssetContent},
+		"script.js":              {Data: testAssetContent},
+		"script.js.gz":           {Data: []byte("precompressed")},
+		"fonts/font.woff2":       {Data: []byte("font")},
+		"static/favicon.svg":     {Data: []byte("<svg></svg>")},
+		"static/unknown.unknown": {Data: []byte("data")},
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return idx
+}
+
+func TestAssetIndex_lookup(t *testing.T) {
+	idx := newTestAssetIndex(t)
+	tests := []struct {
+		name             string
+		path             string
+		expectedAsset    string
+		expectedRedirect string
+	}{
+		{"root", "/", "/index.html", ""},
+		{"root index", "/index.html", "", "/"},
+		{"directory", "/auditorium/", "/auditorium/index.html", ""},
+		{"directory without slash", "/auditorium", "", "/auditorium/"},
+		{"directory index", "/auditorium/index.html", "", "/auditorium/"},
+		{"file", "/vendor-ab21bef31c.js", "/vendor-ab21bef31c.js", ""},
+		{"unclean path", "/static/../script.js", "/script.js", ""},
+		{"unknown file", "/other.js", "", ""},
+		{"unknown directory", "/static/", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, redirect := idx.lookup(test.path)
+			if redirect != test.expectedRedirect {
+				t.Errorf("Expected redirect %v, got %v", test.expectedRedirect, redirect)
+			}
+			var name string
+			if a != nil {
+				name = a.name
+			}
+			if name != test.expectedAsset {
+				t.Errorf("Expected asset %v, got %v", test.expectedAsset, name)
+			}
+		})
+	}
+}
+
+func TestAssetIndex_serve(t *testing.T) {
+	idx := newTestAssetIndex(t)
+	tests := []struct {
+		name             string
+		path             string
+		acceptEncoding   string
+		expectedEncoding string
+		expectedBody     []byte
+	}{
+		{"identity", "/vendor-ab21bef31c.js", "", "", testAssetContent},
+		{"brotli", "/vendor-ab21bef31c.js", "gzip, deflate, br", "br", testAssetContent},
+		{"precompressed", "/script.js", "gzip", "gzip", []byte("precompressed")},
+		{"too small", "/", "br", "", []byte("<html><body>index</body></html>")},
+		{"not compressible", "/fonts/font.woff2", "br", "", []byte("font")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, _ := idx.lookup(test.path)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			idx.serve(w, r, a)
+			if w.Code != http.StatusOK {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if enc := w.Header().Get("Content-Encoding"); enc != test.expectedEncoding {
+				t.Errorf("Expected encoding %v, got %v", test.expectedEncoding, enc)
+			}
+			body := w.Body.Bytes()
+			if test.expectedEncoding == "br" {
+				body, _ = io.ReadAll(brotli.NewReader(w.Body))
+			}
+			if !bytes.Equal(body, test.expectedBody) {
+				t.Errorf("Unexpected body of length %d", len(body))
+			}
+
+			// repeating the request using the returned ETag is expected to
+			// return a 304 for the same encoding only
+			r = httptest.NewRequest(http.MethodGet, test.path, nil)
+			r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+			if test.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			w = httptest.NewRecorder()
+			idx.serve(w, r, a)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("Unexpected status code %v for conditional request", w.Code)
+			}
+		})
+	}
+}
+
+func BenchmarkStaticMiddleware(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	m := gin.New()
+	m.Use(staticMiddleware(newTestAssetIndex(b), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), func() securityHeaders {
+		return securityHeaders{
+			ContentSecurityPolicy:   defaultCSP,
+			StrictTransportSecurity: defaultSTS,
+		}
+	}))
+
+	benchmarks := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+	}{
+		{"html", "/", ""},
+		{"revisioned asset", "/vendor-ab21bef31c.js", ""},
+		{"revisioned asset brotli", "/vendor-ab21bef31c.js", "gzip, deflate, br"},
+		{"fallback", "/auditorium/account/123", ""},
+		{"not found", "/unknown.js", ""},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			r := httptest.NewRequest(http.MethodGet, bm.path, nil)
+			if bm.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", bm.acceptEncoding)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// minCompressSize is the minimum size of a response body for it to be
+// compressed. Compressing smaller responses is likely to increase their size.
+const minCompressSize = 1024
+
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+type encoder struct {
+	name string
+	pool sync.Pool
+}
+
+// encoders contains all supported content encodings in order of preference.
+var encoders = []*encoder{
+	{
+		name: "br",
+		pool: sync.Pool{New: func() interface{} {
+			return brotli.NewWriterLevel(nil, 4)
+		}},
+	},
+	{
+		name: "zstd",
+		pool: sync.Pool{New: func() interface{} {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+			return w
+		}},
+	},
+	{
+		name: "gzip",
+		pool: sync.Pool{New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+			return w
+		}},
+	},
+}
+
+// negotiateEncoding returns the supported encoder that is preferred by the
+// given Accept-Encoding header. In case no supported encoding is accepted,
+// nil is returned.
+func negotiateEncoding(acceptEncoding string) *encoder {
+	names := make([]string, len(encoders))
+	for i, enc := range encoders {
+		names[i] = enc.name
+	}
+	name := negotiate(acceptEncoding, names)
+	for _, enc := range encoders {
+		if enc.name == name {
+			return enc
+		}
+	}
+	return nil
+}
+
+// negotiate returns the encoding out of the given supported ones that is
+// preferred by the given Accept-Encoding header. Supported encodings are
+// expected to be ordered by preference, which is used in case the client
+// accepts multiple encodings with the same quality. In case none of the
+// supported encodings is accepted, an empty string is returned.
+func negotiate(acceptEncoding string, supported []string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[name] = q
+	}
+
+	var match string
+	var matchQuality float64
+	for _, name := range supported {
+		q, ok := qualities[name]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if !ok || q <= 0 {
+			continue
+		}
+		if q > matchQuality {
+			match, matchQuality = name, q
+		}
+	}
+	return match
+}
+
+// isCompressible checks whether responses of the given content type benefit
+// from being compressed.
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		// live updates need to be written as they happen
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/xml", "application/wasm", "image/svg+xml", "font/ttf", "font/otf":
+		return true
+	}
+	return false
+}
+
+// compressHandler compresses responses using the encoding preferred by the
+// client. Responses that are already encoded, too small or of a content
+// type that does not benefit from compression are passed through unchanged.
+func compressHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := newCompressResponseWriter(w, r)
+		if cw == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		defer cw.Close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// compressMiddleware compresses responses in the same way compressHandler
+// does, for routes that are not wrapped by it.
+func compressMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cw := newCompressResponseWriter(c.Writer, c.Request)
+		if cw == nil {
+			c.Next()
+			return
+		}
+		w := c.Writer
+		c.Writer = &ginCompressWriter{ResponseWriter: w, cw: cw}
+		defer func() {
+			cw.Close()
+			c.Writer = w
+		}()
+		c.Next()
+	}
+}
+
+// addVary adds the given value to the Vary header unless it is already
+// contained.
+func addVary(h http.Header, value string) {
+	for _, existing := range h.Values("Vary") {
+		for _, v := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// newCompressResponseWriter returns nil in case the response to the given
+// request cannot be compressed.
+func newCompressResponseWriter(w http.ResponseWriter, r *http.Request) *compressResponseWriter {
+	addVary(w.Header(), "Accept-Encoding")
+	enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if enc == nil || r.Header.Get("Range") != "" {
+		return nil
+	}
+	return &compressResponseWriter{ResponseWriter: w, encoder: enc}
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoder     *encoder
+	writer      compressWriter
+	buf         []byte
+	status      int
+	decided     bool
+	wroteHeader bool
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if w.skip() {
+		w.decided = true
+		w.writeHeader()
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= minCompressSize {
+			if err := w.decide(); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// skip checks whether the response can be passed through before seeing its
+// body.
+func (w *compressResponseWriter) skip() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return true
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return true
+	}
+	if contentType := h.Get("Content-Type"); contentType != "" && !isCompressible(contentType) {
+		return true
+	}
+	return false
+}
+
+// decide starts compressing or passes through the response depending on
+// the data buffered so far.
+func (w *compressResponseWriter) decide() error {
+	w.decided = true
+	if w.Header().Get("Content-Type") == "" && len(w.buf) != 0 {
+		w.Header().Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if len(w.buf) >= minCompressSize && isCompressible(w.Header().Get("Content-Type")) {
+		w.Header().Set("Content-Encoding", w.encoder.name)
+		w.Header().Del("Content-Length")
+		w.Header().Del("Accept-Ranges")
+		w.writer = w.encoder.pool.Get().(compressWriter)
+		w.writer.Reset(w.ResponseWriter)
+	}
+	w.writeHeader()
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.writer != nil {
+		_, err := w.writer.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *compressResponseWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// Flush writes all buffered data to the client, compressing it in case
+// the response is large enough.
+func (w *compressResponseWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.decide()
+	}
+	if w.writer != nil {
+		w.writer.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the response once the handler has returned.
+func (w *compressResponseWriter) Close() error {
+	if w.status == 0 {
+		// the handler did not write anything at all
+		return nil
+	}
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.writer == nil {
+		return nil
+	}
+	err := w.writer.Close()
+	w.writer.Reset(nil)
+	w.encoder.pool.Put(w.writer)
+	w.writer = nil
+	return err
+}
+
+// Unwrap allows http.ResponseController to access the underlying writer.
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ginCompressWriter passes all writes to a compressResponseWriter while
+// keeping the bookkeeping of the wrapped gin.ResponseWriter.
+type ginCompressWriter struct {
+	gin.ResponseWriter
+	cw *compressResponseWriter
+}
+
+func (g *ginCompressWriter) WriteHeader(status int) {
+	g.cw.WriteHeader(status)
+}
+
+func (g *ginCompressWriter) Write(b []byte) (int, error) {
+	return g.cw.Write(b)
+}
+
+func (g *ginCompressWriter) WriteString(s string) (int, error) {
+	return g.cw.Write([]byte(s))
+}
+
+func (g *ginCompressWriter) Flush() {
+	g.cw.Flush()
+}
+
+func (g *ginCompressWriter) WriteHeaderNow() {
+	if g.cw.status == 0 {
+		g.cw.WriteHeader(http.StatusOK)
+	}
+	if !g.cw.decided {
+		g.cw.decide()
+	}
+}
+
+func (g *ginCompressWriter) Status() int {
+	if g.cw.status != 0 {
+		return g.cw.status
+	}
+	return g.ResponseWriter.Status()
+}
+
+func (g *ginCompressWriter) Written() bool {
+	return g.cw.wroteHeader || g.ResponseWriter.Written()
+}
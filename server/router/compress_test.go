@@ -0,0 +1,283 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header         string
+		expectedResult string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, deflate, br, zstd", "br"},
+		{"zstd, gzip", "zstd"},
+		{"br;q=0.5, zstd;q=0.8, gzip;q=0.1", "zstd"},
+		{"br;q=0, gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.1, gzip;q=0.5", "gzip"},
+		{"GZIP", "gzip"},
+		{"gzip;q=abc", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			var result string
+			if enc := negotiateEncoding(test.header); enc != nil {
+				result = enc.name
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %q, got %q", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "":
+		r = bytes.NewReader(body)
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		r = gr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		t.Fatalf("Unexpected encoding %s", encoding)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding body: %v", err)
+	}
+	return string(b)
+}
+
+func TestCompressHandler(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("abc", minCompressSize) + `"}`
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		handler          http.HandlerFunc
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{
+			"gzip",
+			"gzip",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			"gzip",
+			large,
+		},
+		{
+			"brotli",
+			"gzip, br",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			"br",
+			large,
+		},
+		{
+			"zstd",
+			"zstd",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				// data is written in chunks
+				io.WriteString(w, large[:10])
+				io.WriteString(w, large[10:])
+			},
+			"zstd",
+			large,
+		},
+		{
+			"not accepted",
+			"",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			"",
+			large,
+		},
+		{
+			"small response",
+			"gzip",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"ack":true}`)
+			},
+			"",
+			`{"ack":true}`,
+		},
+		{
+			"sniffed content type",
+			"gzip",
+			func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "<!DOCTYPE html>"+large)
+			},
+			"gzip",
+			"<!DOCTYPE html>" + large,
+		},
+		{
+			"incompressible",
+			"gzip",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, large)
+			},
+			"",
+			large,
+		},
+		{
+			"already encoded",
+			"gzip",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, "encoded")
+			},
+			"br",
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			compressHandler(test.handler).ServeHTTP(w, r)
+
+			encoding := w.Header().Get("Content-Encoding")
+			if encoding != test.expectedEncoding {
+				t.Errorf("Expected encoding %q, got %q", test.expectedEncoding, encoding)
+			}
+			if w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Unexpected Vary header %q", w.Header().Get("Vary"))
+			}
+			if test.expectedBody != "" {
+				if body := decodeBody(t, encoding, w.Body.Bytes()); body != test.expectedBody {
+					t.Errorf("Unexpected body %q", body)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat("abc", minCompressSize)
+	tests := []struct {
+		name             string
+		handler          gin.HandlerFunc
+		expectedStatus   int
+		expectedEncoding string
+	}{
+		{
+			"json",
+			func(c *gin.Context) {
+				c.JSON(http.StatusCreated, map[string]string{"data": large})
+			},
+			http.StatusCreated,
+			"gzip",
+		},
+		{
+			"abort",
+			func(c *gin.Context) {
+				c.AbortWithStatus(http.StatusForbidden)
+			},
+			http.StatusForbidden,
+			"",
+		},
+		{
+			"not modified",
+			func(c *gin.Context) {
+				c.Status(http.StatusNotModified)
+			},
+			http.StatusNotModified,
+			"",
+		},
+		{
+			"error",
+			func(c *gin.Context) {
+				newJSONError(io.EOF, http.StatusTooManyRequests).Pipe(c)
+			},
+			http.StatusTooManyRequests,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/", compressMiddleware(), test.handler)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+			if encoding := w.Header().Get("Content-Encoding"); encoding != test.expectedEncoding {
+				t.Errorf("Expected encoding %q, got %q", test.expectedEncoding, encoding)
+			}
+		})
+	}
+}
+
+func TestCompressHandler_Stream(t *testing.T) {
+	flushed := make(chan struct{})
+	srv := httptest.NewServer(compressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "data: x\n\n")
+		w.(http.Flusher).Flush()
+		<-flushed
+	})))
+	defer srv.Close()
+	defer close(flushed)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer res.Body.Close()
+	if encoding := res.Header.Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Expected stream not to be encoded, got %s", encoding)
+	}
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(res.Body, buf); err != nil || string(buf) != "data: x\n\n" {
+		t.Errorf("Expected flushed data to be received, got %q, %v", buf, err)
+	}
+}
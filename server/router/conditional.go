@@ -0,0 +1,73 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sequenceETag derives a weak ETag from the latest sequence stored in the
+// database and the given values describing the response. As every change to
+// stored events creates a new sequence, the ETag changes as soon as anything
+// has been added or deleted.
+func (rt *router) sequenceETag(c *gin.Context, scope ...string) (string, error) {
+	latest, err := rt.db.LatestSequence(c.Request.Context())
+	if err != nil {
+		return "", fmt.Errorf("router: error looking up latest sequence: %w", err)
+	}
+	h := sha256.New()
+	for _, value := range append([]string{latest, rt.retention()}, scope...) {
+		fmt.Fprintf(h, "%d:%s;", len(value), value)
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16]), nil
+}
+
+// notModified sets an ETag for the given scope on the response. In case
+// the request has been sent with a matching If-None-Match header, an empty
+// response with status 304 is written and true is returned. Errors looking
+// up the ETag are not fatal, the response is served without an ETag instead.
+func (rt *router) notModified(c *gin.Context, scope ...string) bool {
+	etag, err := rt.sequenceETag(c, scope...)
+	if err != nil {
+		if rt.logger != nil {
+			rt.logger.WithError(err).Warn("Unable to compute ETag, serving full response")
+		}
+		return false
+	}
+
+	c.Header("ETag", etag)
+	// responses are specific to the user sending the request and must be
+	// revalidated before being reused
+	c.Header("Cache-Control", "private, no-cache")
+	addVary(c.Writer.Header(), "Cookie")
+
+	if matchETag(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// matchETag checks whether the value of an If-None-Match header matches the
+// given ETag using weak comparison.
+func matchETag(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		etag           string
+		expectedResult bool
+	}{
+		{"empty", "", `W/"abc"`, false},
+		{"match", `W/"abc"`, `W/"abc"`, true},
+		{"strong header", `"abc"`, `W/"abc"`, true},
+		{"list", `"xyz", W/"abc"`, `W/"abc"`, true},
+		{"wildcard", "*", `W/"abc"`, true},
+		{"mismatch", `W/"xyz"`, `W/"abc"`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := matchETag(test.header, test.etag); result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+type mockConditionalService struct {
+	persistence.Service
+	latest     string
+	latestErr  error
+	queryCalls int
+}
+
+func (m *mockConditionalService) LatestSequence(context.Context) (string, error) {
+	return m.latest, m.latestErr
+}
+
+func (m *mockConditionalService) Query(context.Context, persistence.Query) (persistence.EventsResult, error) {
+	m.queryCalls++
+	return persistence.EventsResult{Sequence: m.latest}, nil
+}
+
+func TestRouter_getEvents_Conditional(t *testing.T) {
+	db := &mockConditionalService{latest: "seq-a"}
+	rt := router{db: db, config: &config.Config{}}
+	m := gin.New()
+	userID := "user-a"
+	m.GET("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, userID)
+		c.Next()
+	}, rt.getEvents)
+
+	request := func(etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?since=seq-0", nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		m.ServeHTTP(w, r)
+		validateResponse(t, http.MethodGet, "/api/events", r, w)
+		return w
+	}
+
+	first := request("")
+	if first.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected ETag to be set")
+	}
+
+	if w := request(etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected empty 304 response, got %d with %s", w.Code, w.Body.String())
+	}
+	if db.queryCalls != 1 {
+		t.Errorf("Expected events not to be queried when not modified, got %d queries", db.queryCalls)
+	}
+
+	db.latest = "seq-b"
+	if w := request(etag); w.Code != http.StatusOK {
+		t.Errorf("Expected full response after change, got %d", w.Code)
+	}
+
+	db.latest = "seq-a"
+	userID = "user-b"
+	if w := request(etag); w.Code != http.StatusOK {
+		t.Errorf("Expected full response for other user, got %d", w.Code)
+	}
+
+	db.latestErr = errors.New("did not work")
+	if w := request(etag); w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("Expected full response without ETag on error, got %d", w.Code)
+	}
+}
@@ -4,18 +4,84 @@
 package router
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/offen/offen/server/keys"
 	"github.com/offen/offen/server/persistence"
 )
 
 type inboundEventPayload struct {
-	AccountID string `json:"accountId"`
-	Payload   string `json:"payload"`
+	AccountID      string `json:"accountId"`
+	Payload        string `json:"payload"`
+	IngestionToken string `json:"ingestionToken,omitempty"`
+}
+
+const (
+	// maxEventPayloadSize is the maximum size of an encrypted event payload.
+	// Encrypted pageviews are expected to be well below this.
+	maxEventPayloadSize = 16 * 1024
+	// maxEventRequestSize is the maximum size of a request body containing
+	// a single event, allowing for the surrounding envelope.
+	maxEventRequestSize = maxEventPayloadSize + 1024
+	// maxAccountIDLength matches the size of the account identifier column.
+	maxAccountIDLength = 36
+)
+
+// validateEvent checks that the given event is well formed before it is
+// stored, so malformed clients cannot fill the database with data that can
+// never be decrypted.
+func validateEvent(evt inboundEventPayload) error {
+	if evt.AccountID == "" {
+		return errors.New("router: invalid event: accountId is required")
+	}
+	if len(evt.AccountID) > maxAccountIDLength {
+		return fmt.Errorf("router: invalid event: accountId exceeds %d characters", maxAccountIDLength)
+	}
+	if evt.Payload == "" {
+		return errors.New("router: invalid event: payload is required")
+	}
+	if len(evt.Payload) > maxEventPayloadSize {
+		return fmt.Errorf("router: invalid event: payload of %d bytes exceeds maximum size of %d bytes", len(evt.Payload), maxEventPayloadSize)
+	}
+	if err := keys.ValidateSymmetricCipher(evt.Payload); err != nil {
+		return fmt.Errorf("router: invalid event: payload is not an encrypted event: %w", err)
+	}
+	return nil
+}
+
+// bindEnvelope decodes the JSON body of the given request into v. Bodies
+// exceeding the given size, containing unknown fields or trailing data are
+// rejected. In case of failure, an error response has been written and false
+// is returned.
+func bindEnvelope(c *gin.Context, v interface{}, limit int64) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after envelope")
+	}
+	if err == nil {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		newJSONError(
+			fmt.Errorf("router: request body exceeds maximum size of %d bytes", limit),
+			http.StatusRequestEntityTooLarge,
+		).Pipe(c)
+		return false
+	}
+	newJSONError(
+		fmt.Errorf("router: error decoding request payload: %v", err),
+		http.StatusBadRequest,
+	).Pipe(c)
+	return false
 }
 
 type ackResponse struct {
@@ -26,31 +92,77 @@ var errBadRequestContext = errors.New("could not use user id in request context"
 
 func (rt *router) postEvents(c *gin.Context) {
 	userID := c.GetString(contextKeyCookie)
-	if l := <-rt.getLimiter().LinearThrottle(time.Second/2, fmt.Sprintf("postEvents-%s", userID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postEvents", userID) {
 		return
 	}
 
 	evt := inboundEventPayload{}
-	if err := c.BindJSON(&evt); err != nil {
+	if !bindEnvelope(c, &evt, maxEventRequestSize) {
+		return
+	}
+
+	if !rt.insertEvent(c, userID, evt) {
+		return
+	}
+	c.JSON(http.StatusCreated, ackResponse{true})
+}
+
+// postEventBeacon accepts events sent using navigator.sendBeacon, which
+// sends its payload as text/plain and is not able to read the response.
+// Events sent on page unload are expected to use this as regular requests
+// might be aborted before they are completed.
+func (rt *router) postEventBeacon(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	if !rt.throttle(c, "postEvents", userID) {
+		return
+	}
+
+	switch contentType := c.ContentType(); contentType {
+	case "", binding.MIMEPlain, binding.MIMEJSON:
+	default:
 		newJSONError(
-			fmt.Errorf("router: error decoding request payload: %v", err),
-			http.StatusBadRequest,
+			fmt.Errorf("router: unsupported content type %s", contentType),
+			http.StatusUnsupportedMediaType,
 		).Pipe(c)
 		return
 	}
 
-	if err := rt.db.Insert(userID, evt.AccountID, evt.Payload, nil); err != nil {
+	evt := inboundEventPayload{}
+	if !bindEnvelope(c, &evt, maxEventRequestSize) {
+		return
+	}
+
+	if !rt.insertEvent(c, userID, evt) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// insertEvent performs all checks needed for the given event and persists
+// it. In case the event is not inserted, an error response has been written
+// and false is returned.
+func (rt *router) insertEvent(c *gin.Context, userID string, evt inboundEventPayload) bool {
+	if err := validateEvent(evt); err != nil {
+		newJSONError(err, http.StatusBadRequest).Pipe(c)
+		return false
+	}
+
+	if !rt.checkOrigin(c, evt.AccountID) {
+		return false
+	}
+
+	if !rt.checkIngestionToken(c, evt.AccountID, userID, evt.IngestionToken) {
+		return false
+	}
+
+	if err := rt.db.Insert(c.Request.Context(), userID, evt.AccountID, evt.Payload, nil); err != nil {
 		var unknownAccountErr persistence.ErrUnknownAccount
 		if errors.As(err, &unknownAccountErr) {
 			newJSONError(
 				fmt.Errorf("router: error inserting event: %w", unknownAccountErr),
 				http.StatusNotFound,
 			).Pipe(c)
-			return
+			return false
 		}
 
 		var unknownSecretErr persistence.ErrUnknownSecret
@@ -59,33 +171,143 @@ func (rt *router) postEvents(c *gin.Context) {
 				fmt.Errorf("router: error inserting event: %w", unknownSecretErr),
 				http.StatusBadRequest,
 			).Pipe(c)
-			return
+			return false
 		}
 
 		newJSONError(
 			fmt.Errorf("router: error persisting event: %v", err),
 			http.StatusInternalServerError,
 		).Pipe(c)
-		return
+		return false
 	}
 
+	rt.metrics.ObserveEvent(evt.AccountID)
+
 	http.SetCookie(
 		c.Writer,
 		rt.userCookie(userID, c.GetBool(contextKeySecureContext)),
 	)
-	c.JSON(http.StatusCreated, ackResponse{true})
+	return true
 }
 
-func (rt *router) getEvents(c *gin.Context) {
+// maxEventsBatchSize is the maximum number of events that can be sent
+// in a single batch
+const maxEventsBatchSize = 50
+
+type inboundEventsBatchPayload struct {
+	Events []inboundEventPayload `json:"events"`
+}
+
+type eventAck struct {
+	Ack    bool   `json:"ack"`
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+type eventsBatchResponse struct {
+	Events []eventAck `json:"events"`
+}
+
+func newEventNack(err error, status int) eventAck {
+	return eventAck{Error: err.Error(), Status: status}
+}
+
+// insertStatus returns the status code for an error returned when
+// inserting an event.
+func insertStatus(err error) int {
+	var unknownAccountErr persistence.ErrUnknownAccount
+	var unknownSecretErr persistence.ErrUnknownSecret
+	switch {
+	case errors.As(err, &unknownAccountErr):
+		return http.StatusNotFound
+	case errors.As(err, &unknownSecretErr):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// postEventsBatch inserts multiple events, possibly for different accounts,
+// at once. Events that cannot be inserted do not fail the entire batch,
+// the response contains an acknowledgement for each event instead.
+func (rt *router) postEventsBatch(c *gin.Context) {
 	userID := c.GetString(contextKeyCookie)
-	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getEvents-%s", userID)); l.Error != nil {
+	if !rt.throttle(c, "postEventsBatch", userID) {
+		return
+	}
+
+	var req inboundEventsBatchPayload
+	if !bindEnvelope(c, &req, maxEventsBatchSize*maxEventRequestSize) {
+		return
+	}
+
+	if len(req.Events) == 0 || len(req.Events) > maxEventsBatchSize {
 		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
+			fmt.Errorf("router: expected between 1 and %d events, got %d", maxEventsBatchSize, len(req.Events)),
+			http.StatusBadRequest,
 		).Pipe(c)
 		return
 	}
-	result, err := rt.db.Query(persistence.Query{
+
+	acks := make([]eventAck, len(req.Events))
+	var pending []persistence.PendingEvent
+	var pendingIndices []int
+	for i, evt := range req.Events {
+		if err := validateEvent(evt); err != nil {
+			acks[i] = newEventNack(err, http.StatusBadRequest)
+			continue
+		}
+		if err := rt.verifyOrigin(c, evt.AccountID); err != nil {
+			acks[i] = newEventNack(err, ingestStatus(err))
+			continue
+		}
+		if err := rt.verifyIngestionToken(c, evt.AccountID, userID, evt.IngestionToken); err != nil {
+			acks[i] = newEventNack(err, ingestStatus(err))
+			continue
+		}
+		pending = append(pending, persistence.PendingEvent{
+			AccountID: evt.AccountID,
+			Payload:   evt.Payload,
+		})
+		pendingIndices = append(pendingIndices, i)
+	}
+
+	if len(pending) != 0 {
+		eventErrors, err := rt.db.InsertEvents(c.Request.Context(), userID, pending)
+		if err != nil {
+			newJSONError(
+				fmt.Errorf("router: error persisting events: %v", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+		for j, err := range eventErrors {
+			i := pendingIndices[j]
+			if err != nil {
+				acks[i] = newEventNack(fmt.Errorf("router: error inserting event: %w", err), insertStatus(err))
+				continue
+			}
+			acks[i] = eventAck{Ack: true}
+			rt.metrics.ObserveEvent(pending[j].AccountID)
+		}
+	}
+
+	http.SetCookie(
+		c.Writer,
+		rt.userCookie(userID, c.GetBool(contextKeySecureContext)),
+	)
+	c.JSON(http.StatusOK, eventsBatchResponse{Events: acks})
+}
+
+func (rt *router) getEvents(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	if !rt.throttle(c, "getEvents", userID) {
+		return
+	}
+	if rt.notModified(c, "events", userID, c.Query("since")) {
+		return
+	}
+	result, err := rt.db.Query(c.Request.Context(), persistence.Query{
 		UserID: userID,
 		Since:  c.Query("since"),
 	})
@@ -96,20 +318,16 @@ func (rt *router) getEvents(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	result.RetentionPeriod = rt.config.App.Retention.String()
+	result.RetentionPeriod = rt.retention()
 	c.JSON(http.StatusOK, result)
 }
 
 func (rt *router) purgeEvents(c *gin.Context) {
 	userID := c.GetString(contextKeyCookie)
-	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("purgeEvents-%s", userID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "purgeEvents", userID) {
 		return
 	}
-	if err := rt.db.Purge(userID); err != nil {
+	if err := rt.db.Purge(c.Request.Context(), userID); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error purging user events: %v", err),
 			http.StatusInternalServerError,
@@ -4,6 +4,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -24,7 +25,7 @@ type mockPurgeEventsService struct {
 	err error
 }
 
-func (m *mockPurgeEventsService) Purge(string) error {
+func (m *mockPurgeEventsService) Purge(context.Context, string) error {
 	return m.err
 }
 
@@ -63,6 +64,7 @@ func TestRouter_purgeEvents(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", nil)
 
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/purge", r, w)
 
 			if w.Code != test.expectedStatus {
 				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
@@ -77,10 +79,14 @@ type mockGetEventsService struct {
 	err    error
 }
 
-func (m *mockGetEventsService) Query(persistence.Query) (persistence.EventsResult, error) {
+func (m *mockGetEventsService) Query(context.Context, persistence.Query) (persistence.EventsResult, error) {
 	return m.result, m.err
 }
 
+func (m *mockGetEventsService) LatestSequence(context.Context) (string, error) {
+	return "", nil
+}
+
 func TestRouter_getEvents(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -128,6 +134,7 @@ func TestRouter_getEvents(t *testing.T) {
 			r := httptest.NewRequest(http.MethodGet, "/", nil)
 
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodGet, "/api/events", r, w)
 
 			if w.Code != test.expectedStatus {
 				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
@@ -147,7 +154,7 @@ type mockPostEventsService struct {
 	err error
 }
 
-func (m *mockPostEventsService) Insert(string, string, string, *string) error {
+func (m *mockPostEventsService) Insert(context.Context, string, string, string, *string) error {
 	return m.err
 }
 
@@ -166,12 +173,40 @@ func TestRouter_postEvents(t *testing.T) {
 			http.StatusBadRequest,
 			"",
 		},
+		{
+			"unknown field",
+			&mockPostEventsService{},
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M","eventId":"event-a"}`,
+			http.StatusBadRequest,
+			"unknown field",
+		},
+		{
+			"trailing data",
+			&mockPostEventsService{},
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}{}`,
+			http.StatusBadRequest,
+			"unexpected data",
+		},
+		{
+			"payload not encrypted",
+			&mockPostEventsService{},
+			`{"accountId":"account-a","payload":"{\"type\":\"PAGEVIEW\"}"}`,
+			http.StatusBadRequest,
+			"payload is not an encrypted event",
+		},
+		{
+			"body too large",
+			&mockPostEventsService{},
+			`{"accountId":"account-a","payload":"` + strings.Repeat("a", maxEventRequestSize) + `"}`,
+			http.StatusRequestEntityTooLarge,
+			"exceeds maximum size",
+		},
 		{
 			"database error",
 			&mockPostEventsService{
 				err: errors.New("did not work"),
 			},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
 			http.StatusInternalServerError,
 			"",
 		},
@@ -180,7 +215,7 @@ func TestRouter_postEvents(t *testing.T) {
 			&mockPostEventsService{
 				err: persistence.ErrUnknownAccount("unknown account"),
 			},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
 			http.StatusNotFound,
 			"",
 		},
@@ -189,14 +224,14 @@ func TestRouter_postEvents(t *testing.T) {
 			&mockPostEventsService{
 				err: persistence.ErrUnknownSecret("unknown secret"),
 			},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
 			http.StatusBadRequest,
 			"",
 		},
 		{
 			"ok",
 			&mockPostEventsService{},
-			`{"accountId":"account-a","payload":"some-payload"}`,
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
 			http.StatusCreated,
 			`{"ack":true}`,
 		},
@@ -219,6 +254,7 @@ func TestRouter_postEvents(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
 
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/events", r, w)
 
 			if w.Code != test.expectedStatus {
 				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
@@ -232,3 +268,339 @@ func TestRouter_postEvents(t *testing.T) {
 		})
 	}
 }
+
+type mockInsertEventsService struct {
+	persistence.Service
+	eventErrors []error
+	err         error
+	args        []persistence.PendingEvent
+}
+
+func (m *mockInsertEventsService) InsertEvents(ctx context.Context, userID string, events []persistence.PendingEvent) ([]error, error) {
+	m.args = events
+	if m.eventErrors == nil && m.err == nil {
+		return make([]error, len(events)), nil
+	}
+	return m.eventErrors, m.err
+}
+
+func TestRouter_postEventsBatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             *mockInsertEventsService
+		body           string
+		expectedStatus int
+		expectedBody   string
+		expectedArgs   int
+	}{
+		{
+			"bad payload",
+			&mockInsertEventsService{},
+			"o hai!",
+			http.StatusBadRequest,
+			"",
+			0,
+		},
+		{
+			"empty batch",
+			&mockInsertEventsService{},
+			`{"events":[]}`,
+			http.StatusBadRequest,
+			"",
+			0,
+		},
+		{
+			"too many events",
+			&mockInsertEventsService{},
+			`{"events":[` + strings.Repeat(`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"},`, maxEventsBatchSize) + `{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}]}`,
+			http.StatusBadRequest,
+			"",
+			0,
+		},
+		{
+			"database error",
+			&mockInsertEventsService{
+				err: errors.New("did not work"),
+			},
+			`{"events":[{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}]}`,
+			http.StatusInternalServerError,
+			"",
+			1,
+		},
+		{
+			"ok",
+			&mockInsertEventsService{},
+			`{"events":[{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"},{"accountId":"account-b","payload":"{1,} cSUHXiUs2bsYOBUgGc7ScmO7Lfzwb1bn2ic= gkkXCrz8ZAgqPn8P"}]}`,
+			http.StatusOK,
+			`{"events":[{"ack":true},{"ack":true}]}`,
+			2,
+		},
+		{
+			"partial",
+			&mockInsertEventsService{
+				eventErrors: []error{nil, persistence.ErrUnknownAccount("did not work")},
+			},
+			`{"events":[{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"},{"accountId":""},{"accountId":"account-z","payload":"{1,} cSUHXiUs2bsYOBUgGc7ScmO7Lfzwb1bn2ic= gkkXCrz8ZAgqPn8P"}]}`,
+			http.StatusOK,
+			`{"events":[{"ack":true},{"ack":false,"error":"router: invalid event: accountId is required","status":400},{"ack":false,"error":"router: error inserting event: did not work","status":404}]}`,
+			2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			rt := router{
+				db:     test.db,
+				config: &config.Config{},
+			}
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Set(contextKeySecureContext, false)
+				c.Next()
+			}, rt.postEventsBatch)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+
+			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/events/batch", r, w)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Expected response body %s, got %s", test.expectedBody, w.Body.String())
+			}
+			if len(test.db.args) != test.expectedArgs {
+				t.Errorf("Expected %d events to be inserted, got %d", test.expectedArgs, len(test.db.args))
+			}
+		})
+	}
+}
+
+type mockEventBeaconService struct {
+	persistence.Service
+	allowedOrigins []string
+	inserted       int
+}
+
+func (m *mockEventBeaconService) GetAccount(context.Context, string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{AllowedOrigins: m.allowedOrigins}, nil
+}
+
+func (m *mockEventBeaconService) Insert(context.Context, string, string, string, *string) error {
+	m.inserted++
+	return nil
+}
+
+func TestRouter_postEventBeacon(t *testing.T) {
+	tests := []struct {
+		name             string
+		cookies          []*http.Cookie
+		contentType      string
+		origin           string
+		body             string
+		expectedStatus   int
+		expectUserCookie bool
+		expectInsert     bool
+	}{
+		{
+			"no consent",
+			[]*http.Cookie{{Name: "user", Value: "user-id"}},
+			"text/plain;charset=UTF-8",
+			"",
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
+			http.StatusNoContent,
+			false,
+			false,
+		},
+		{
+			"no user cookie",
+			[]*http.Cookie{{Name: "consent", Value: "allow"}},
+			"text/plain;charset=UTF-8",
+			"",
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
+			http.StatusBadRequest,
+			false,
+			false,
+		},
+		{
+			"text/plain",
+			[]*http.Cookie{{Name: "consent", Value: "allow"}, {Name: "user", Value: "user-id"}},
+			"text/plain;charset=UTF-8",
+			"",
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
+			http.StatusNoContent,
+			true,
+			true,
+		},
+		{
+			"application/json",
+			[]*http.Cookie{{Name: "consent", Value: "allow"}, {Name: "user", Value: "user-id"}},
+			"application/json",
+			"",
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
+			http.StatusNoContent,
+			true,
+			true,
+		},
+		{
+			"unsupported content type",
+			[]*http.Cookie{{Name: "consent", Value: "allow"}, {Name: "user", Value: "user-id"}},
+			"application/x-www-form-urlencoded",
+			"",
+			`accountId=account-a&payload={1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M`,
+			http.StatusUnsupportedMediaType,
+			false,
+			false,
+		},
+		{
+			"bad payload",
+			[]*http.Cookie{{Name: "consent", Value: "allow"}, {Name: "user", Value: "user-id"}},
+			"text/plain;charset=UTF-8",
+			"",
+			`o hai!`,
+			http.StatusBadRequest,
+			false,
+			false,
+		},
+		{
+			"allowed origin",
+			[]*http.Cookie{{Name: "consent", Value: "allow"}, {Name: "user", Value: "user-id"}},
+			"text/plain;charset=UTF-8",
+			"https://www.example.com",
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
+			http.StatusNoContent,
+			true,
+			true,
+		},
+		{
+			"other origin",
+			[]*http.Cookie{{Name: "consent", Value: "allow"}, {Name: "user", Value: "user-id"}},
+			"text/plain;charset=UTF-8",
+			"https://www.example.net",
+			`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`,
+			http.StatusForbidden,
+			false,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockEventBeaconService{allowedOrigins: []string{"https://www.example.com"}}
+			rt := router{
+				db:     db,
+				config: &config.Config{},
+			}
+			m := gin.New()
+			m.POST(
+				"/",
+				func(c *gin.Context) {
+					c.Set(contextKeySecureContext, true)
+					c.Next()
+				},
+				optinMiddleware(optinKey, optinValue),
+				userCookieMiddleware(cookieKey, contextKeyCookie),
+				rt.postEventBeacon,
+			)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "https://offen.example.com/", strings.NewReader(test.body))
+			r.Header.Set("Content-Type", test.contentType)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			for _, ck := range test.cookies {
+				r.AddCookie(ck)
+			}
+
+			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/events/beacon", r, w)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+
+			// beacons are sent from the vault's own origin, so responses are
+			// never expected to allow cross origin reads
+			for key := range w.Header() {
+				if strings.HasPrefix(key, "Access-Control-") {
+					t.Errorf("Unexpected CORS header %s", key)
+				}
+			}
+
+			var userCookie *http.Cookie
+			for _, ck := range w.Result().Cookies() {
+				if ck.Name == cookieKey {
+					userCookie = ck
+				}
+			}
+			if (userCookie != nil) != test.expectUserCookie {
+				t.Errorf("Unexpected user cookie %v", userCookie)
+			}
+			if userCookie != nil {
+				if userCookie.Value != "user-id" || !userCookie.Secure || !userCookie.HttpOnly || userCookie.SameSite != http.SameSiteNoneMode {
+					t.Errorf("Unexpected user cookie %v", userCookie)
+				}
+			}
+
+			if (db.inserted != 0) != test.expectInsert {
+				t.Errorf("Unexpected number of inserts %d", db.inserted)
+			}
+		})
+	}
+}
+
+func TestValidateEvent(t *testing.T) {
+	tests := []struct {
+		name          string
+		evt           inboundEventPayload
+		expectedError string
+	}{
+		{
+			"ok",
+			inboundEventPayload{AccountID: "account-a", Payload: "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"},
+			"",
+		},
+		{
+			"missing account id",
+			inboundEventPayload{Payload: "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"},
+			"accountId is required",
+		},
+		{
+			"account id too long",
+			inboundEventPayload{AccountID: strings.Repeat("a", 37), Payload: "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"},
+			"accountId exceeds 36 characters",
+		},
+		{
+			"missing payload",
+			inboundEventPayload{AccountID: "account-a"},
+			"payload is required",
+		},
+		{
+			"payload too large",
+			inboundEventPayload{AccountID: "account-a", Payload: "{1,} " + strings.Repeat("a", maxEventPayloadSize)},
+			"exceeds maximum size",
+		},
+		{
+			"bad cipher",
+			inboundEventPayload{AccountID: "account-a", Payload: "{1,} YWJj"},
+			"payload is not an encrypted event",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateEvent(test.evt)
+			if test.expectedError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("Expected error containing %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
@@ -15,7 +14,7 @@ import (
 )
 
 func (rt *router) getPublicKey(c *gin.Context) {
-	account, err := rt.db.GetAccount(c.Query("accountId"), false, false, "")
+	account, err := rt.db.GetAccount(c.Request.Context(), c.Query("accountId"), false, false, "")
 	if err != nil {
 		var unknownAccountErr persistence.ErrUnknownAccount
 		if errors.As(err, &unknownAccountErr) {
@@ -31,6 +30,10 @@ func (rt *router) getPublicKey(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
+
+	if !rt.checkOrigin(c, account.AccountID) {
+		return
+	}
 	c.JSON(http.StatusOK, account)
 }
 
@@ -66,15 +69,15 @@ func (rt *router) postUserSecret(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("postUserSecret-%s", userID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postUserSecret", userID) {
+		return
+	}
+
+	if !rt.checkOrigin(c, payload.AccountID) {
 		return
 	}
 
-	if err := rt.db.AssociateUserSecret(payload.AccountID, userID, payload.EncryptedUserSecret); err != nil {
+	if err := rt.db.AssociateUserSecret(c.Request.Context(), payload.AccountID, userID, payload.EncryptedUserSecret); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error associating user secret: %v", err),
 			http.StatusBadRequest,
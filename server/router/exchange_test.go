@@ -4,6 +4,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -23,7 +24,7 @@ type mockAccountsDatabase struct {
 	err    error
 }
 
-func (m *mockAccountsDatabase) GetAccount(accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error) {
+func (m *mockAccountsDatabase) GetAccount(ctx context.Context, accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error) {
 	return m.result, m.err
 }
 
@@ -32,6 +33,7 @@ func TestRouter_GetPublicKey(t *testing.T) {
 		name               string
 		db                 persistence.Service
 		queryString        string
+		origin             string
 		expectedStatusCode int
 	}{
 		{
@@ -40,6 +42,7 @@ func TestRouter_GetPublicKey(t *testing.T) {
 				err: errors.New("did not work"),
 			},
 			"accountId=12345",
+			"",
 			http.StatusInternalServerError,
 		},
 		{
@@ -48,6 +51,7 @@ func TestRouter_GetPublicKey(t *testing.T) {
 				err: persistence.ErrUnknownAccount("unknown account"),
 			},
 			"accountId=12345",
+			"",
 			http.StatusBadRequest,
 		},
 		{
@@ -59,8 +63,33 @@ func TestRouter_GetPublicKey(t *testing.T) {
 				},
 			},
 			"accountId=12345",
+			"",
 			http.StatusOK,
 		},
+		{
+			"allowed origin",
+			&mockAccountsDatabase{
+				result: persistence.AccountResult{
+					AccountID:      "12345",
+					AllowedOrigins: []string{"https://www.example.com"},
+				},
+			},
+			"accountId=12345",
+			"https://www.example.com",
+			http.StatusOK,
+		},
+		{
+			"other origin",
+			&mockAccountsDatabase{
+				result: persistence.AccountResult{
+					AccountID:      "12345",
+					AllowedOrigins: []string{"https://www.example.com"},
+				},
+			},
+			"accountId=12345",
+			"https://www.example.net",
+			http.StatusForbidden,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -69,7 +98,11 @@ func TestRouter_GetPublicKey(t *testing.T) {
 			m.GET("/", rt.getPublicKey)
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", test.queryString), nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodGet, "/api/exchange", r, w)
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Expected status code %d, got %d", test.expectedStatusCode, w.Code)
 			}
@@ -82,7 +115,7 @@ type mockUserSecretDatabase struct {
 	err error
 }
 
-func (m *mockUserSecretDatabase) AssociateUserSecret(string, string, string) error {
+func (m *mockUserSecretDatabase) AssociateUserSecret(context.Context, string, string, string) error {
 	return m.err
 }
 
@@ -157,6 +190,7 @@ func TestRouter_PostUserSecret(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			r.AddCookie(test.cookie)
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/exchange", r, w)
 			if w.Code != test.expectedStatus {
 				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
 			}
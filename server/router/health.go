@@ -4,14 +4,18 @@
 package router
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
 )
 
 func (rt *router) getHealth(c *gin.Context) {
-	if err := rt.db.CheckHealth(); err != nil {
+	if err := rt.db.CheckHealth(c.Request.Context()); err != nil {
 		newJSONError(
 			fmt.Errorf("router: failed checking health of connected persistence layer: %v", err),
 			http.StatusBadGateway,
@@ -20,3 +24,126 @@ func (rt *router) getHealth(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, map[string]bool{"ok": true})
 }
+
+// getLiveness reports whether the process is able to handle requests at all.
+// It does not check any dependencies so that an orchestrator does not restart
+// the application in case e.g. the database is unavailable.
+func (rt *router) getLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, map[string]bool{"ok": true})
+}
+
+// ReadinessCheck checks whether a dependency of the application is ready.
+// Optional checks are reported, but the application is still considered
+// ready in case they fail. Internal checks are only run when readiness is
+// requested on the internal listener, so that public requests cannot cause
+// connections to third parties, e.g. the SMTP server.
+type ReadinessCheck struct {
+	Name     string
+	Optional bool
+	Internal bool
+	Check    func(context.Context) error
+}
+
+type readinessResult struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Optional bool   `json:"optional,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type readinessResponse struct {
+	OK     bool              `json:"ok"`
+	Checks []readinessResult `json:"checks"`
+}
+
+const readinessTimeout = time.Second * 5
+
+func (rt *router) allReadinessChecks() []ReadinessCheck {
+	checks := []ReadinessCheck{
+		{Name: "database", Check: rt.db.CheckHealth},
+		{Name: "migrations", Check: func(ctx context.Context) error {
+			pending, err := rt.db.PendingMigrations(ctx)
+			if err != nil {
+				return err
+			}
+			if len(pending) != 0 {
+				return fmt.Errorf("router: %d database migrations have not been applied yet", len(pending))
+			}
+			return nil
+		}},
+	}
+	if _, ok := rt.getMailer().(mailer.Pinger); ok {
+		checks = append(checks, ReadinessCheck{Name: "mailer", Optional: true, Internal: true, Check: func(ctx context.Context) error {
+			s, done := rt.useMailer()
+			defer done()
+			if pinger, ok := s.mailer.(mailer.Pinger); ok {
+				return pinger.Ping(ctx)
+			}
+			return nil
+		}})
+	}
+	checks = append(checks, rt.readinessChecks...)
+	if rt.internal {
+		return checks
+	}
+	var public []ReadinessCheck
+	for _, check := range checks {
+		if !check.Internal {
+			public = append(public, check)
+		}
+	}
+	return public
+}
+
+// getReadiness runs all readiness checks concurrently and responds with
+// 503 in case any of the non-optional checks fail. This allows orchestrators
+// to hold back traffic e.g. until database migrations have been applied.
+// Errors are logged, but only included in the response when it is served
+// on the internal listener.
+func (rt *router) getReadiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := rt.allReadinessChecks()
+	results := make([]readinessResult, len(checks))
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check ReadinessCheck) {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = check.Check(ctx)
+			results[i] = readinessResult{
+				Name:     check.Name,
+				OK:       errs[i] == nil,
+				Optional: check.Optional,
+				Duration: time.Since(start).String(),
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	response := readinessResponse{OK: true, Checks: results}
+	for i, result := range results {
+		if !result.OK && !result.Optional {
+			response.OK = false
+		}
+		if errs[i] != nil && rt.logger != nil {
+			rt.logger.WithError(errs[i]).WithField("check", result.Name).Warn("Readiness check failed")
+		}
+		if rt.internal {
+			if errs[i] != nil {
+				results[i].Error = errs[i].Error()
+			}
+		} else {
+			results[i] = readinessResult{Name: result.Name, OK: result.OK}
+		}
+	}
+	status := http.StatusOK
+	if !response.OK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
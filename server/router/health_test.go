@@ -4,9 +4,12 @@
 package router
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -15,13 +18,18 @@ import (
 
 type mockHealthChecker struct {
 	persistence.Service
-	err error
+	err     error
+	pending []string
 }
 
-func (m *mockHealthChecker) CheckHealth() error {
+func (m *mockHealthChecker) CheckHealth(context.Context) error {
 	return m.err
 }
 
+func (m *mockHealthChecker) PendingMigrations(context.Context) ([]string, error) {
+	return m.pending, nil
+}
+
 func TestRouter_getHealth(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		rt := router{
@@ -32,6 +40,7 @@ func TestRouter_getHealth(t *testing.T) {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
 		m.ServeHTTP(w, r)
+		validateResponse(t, http.MethodGet, "/healthz", r, w)
 		if w.Code != http.StatusOK {
 			t.Errorf("Unexpected status code %v", w.Code)
 		}
@@ -47,8 +56,129 @@ func TestRouter_getHealth(t *testing.T) {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
 		m.ServeHTTP(w, r)
+		validateResponse(t, http.MethodGet, "/healthz", r, w)
 		if w.Code != http.StatusBadGateway {
 			t.Errorf("Unexpected status code %v", w.Code)
 		}
 	})
 }
+
+type mockPinger struct {
+	mockMailer
+	err error
+}
+
+func (m *mockPinger) Ping(context.Context) error {
+	return m.err
+}
+
+func TestRouter_getReadiness(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             *mockHealthChecker
+		mailer         *mockPinger
+		checks         []ReadinessCheck
+		internal       bool
+		expectedStatus int
+		expectedChecks map[string]bool
+	}{
+		{
+			"ok",
+			&mockHealthChecker{},
+			&mockPinger{},
+			nil,
+			false,
+			http.StatusOK,
+			map[string]bool{"database": true, "migrations": true},
+		},
+		{
+			"pending migrations",
+			&mockHealthChecker{pending: []string{"008_new"}},
+			&mockPinger{},
+			nil,
+			false,
+			http.StatusServiceUnavailable,
+			map[string]bool{"database": true, "migrations": false},
+		},
+		{
+			"optional failures",
+			&mockHealthChecker{},
+			&mockPinger{err: errors.New("did not work")},
+			[]ReadinessCheck{
+				{Name: "certificates", Optional: true, Check: func(context.Context) error {
+					return errors.New("did not work")
+				}},
+			},
+			true,
+			http.StatusOK,
+			map[string]bool{"database": true, "migrations": true, "mailer": false, "certificates": false},
+		},
+		{
+			"internal",
+			&mockHealthChecker{err: errors.New("did not work")},
+			&mockPinger{},
+			nil,
+			true,
+			http.StatusServiceUnavailable,
+			map[string]bool{"database": false, "migrations": true, "mailer": true},
+		},
+		{
+			"internal checks skipped publicly",
+			&mockHealthChecker{},
+			&mockPinger{err: errors.New("must not be called")},
+			[]ReadinessCheck{
+				{Name: "certificates", Optional: true, Internal: true, Check: func(context.Context) error {
+					return errors.New("must not be called")
+				}},
+			},
+			false,
+			http.StatusOK,
+			map[string]bool{"database": true, "migrations": true},
+		},
+		{
+			"database error",
+			&mockHealthChecker{err: errors.New("did not work")},
+			&mockPinger{},
+			nil,
+			false,
+			http.StatusServiceUnavailable,
+			map[string]bool{"database": false, "migrations": true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db:              test.db,
+				mailer:          test.mailer,
+				readinessChecks: test.checks,
+				internal:        test.internal,
+			}
+			m := gin.New()
+			m.GET("/", rt.getReadiness)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodGet, "/readyz", r, w)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			var response readinessResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			checks := map[string]bool{}
+			for _, result := range response.Checks {
+				checks[result.Name] = result.OK
+				if hasDetails := result.Duration != ""; hasDetails != test.internal {
+					t.Errorf("Expected details to be included %v, got %v", test.internal, result)
+				}
+				if hasError := result.Error != ""; hasError != (test.internal && !result.OK) {
+					t.Errorf("Unexpected error in result %v", result)
+				}
+			}
+			if !reflect.DeepEqual(checks, test.expectedChecks) {
+				t.Errorf("Unexpected checks %v", checks)
+			}
+		})
+	}
+}
@@ -7,10 +7,11 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/offen/offen/server/css"
+	"github.com/offen/offen/server/metrics"
 )
 
 func (rt *router) getVault(c *gin.Context) {
@@ -23,24 +24,7 @@ func (rt *router) getVault(c *gin.Context) {
 		return
 	}
 
-	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-styles-%s", accountID)
-	if cachedItem, ok := cache.Get(cacheKey); ok {
-		cachedStyles, castOk := cachedItem.(string)
-		if !castOk {
-			c.HTML(http.StatusInternalServerError, "error", map[string]string{
-				"message": fmt.Sprintf("Unexpected cache item for account %s", accountID),
-			})
-			return
-		}
-
-		c.HTML(http.StatusOK, "vault", map[string]interface{}{
-			"accountStyles": template.CSS(cachedStyles),
-			"locale":        c.Query("locale"),
-		})
-		return
-	}
-
-	account, err := rt.db.GetAccount(accountID, true, false, "")
+	settings, err := rt.getAccountSettings(c.Request.Context(), accountID)
 	if err != nil {
 		c.HTML(http.StatusBadRequest, "error", map[string]string{
 			"message": fmt.Sprintf("Error %v looking up account %s", err, accountID),
@@ -48,35 +32,116 @@ func (rt *router) getVault(c *gin.Context) {
 		return
 	}
 
-	ttl := 5 * time.Minute
-	if rt.config.App.Development || rt.config.App.DemoAccount != "" {
-		ttl = time.Second
+	// in case the account defines allowed origins, the vault can only be
+	// embedded by these
+	if len(settings.AllowedOrigins) != 0 {
+		c.Header("Content-Security-Policy", withFrameAncestors(
+			rt.securityHeaders().ContentSecurityPolicy,
+			append([]string{"'self'"}, settings.AllowedOrigins...)...,
+		))
 	}
 
-	styles := account.AccountStyles
-	if styles != "" {
-		if err := css.ValidateCSS(styles); err != nil {
-			styles = ""
-			rt.logger.WithError(err).Warnf(
-				"Custom styles for account %s in database did not pass validation, default styling will apply.",
-				account.Name,
-			)
+	var ingestionToken string
+	if rt.config.App.IngestionTokenTTL > 0 {
+		// browsers are expected to enforce frame-ancestors, but the referer
+		// allows to refuse issuing tokens when it is known that the vault
+		// is embedded by a site that is not allowed to do so
+		origin := embeddingOrigin(c.Request)
+		if rt.mayIssueIngestionToken(c.Request, settings, origin) {
+			claims := ingestionClaims{AccountID: accountID, Origin: origin}
+			if ck, err := c.Request.Cookie(cookieKey); err == nil {
+				claims.UserID = ck.Value
+			}
+			token, err := rt.ingestionToken(claims)
+			if err != nil {
+				c.HTML(http.StatusInternalServerError, "error", map[string]string{
+					"message": fmt.Sprintf("Error %v issuing ingestion token for account %s", err, accountID),
+				})
+				return
+			}
+			ingestionToken = token
+		} else {
+			rt.rejectIngest(accountID, metrics.RejectReferer, origin)
 		}
 	}
 
-	// Writing to the cache at this point means the application _might_ cache
-	// an empty string in case the CSS in the database is considered invalid,
-	// which might be confusing but mitigates the possibility of attacking the
-	// application by inserting malformed CSS into the database.
-	cache.Set(cacheKey, styles, ttl)
-
 	c.HTML(http.StatusOK, "vault", map[string]interface{}{
-		"accountStyles": template.CSS(styles),
-		"lang":          rt.config.App.Locale,
-		"locale":        c.Query("locale"),
+		"accountStyles":           template.CSS(settings.Styles),
+		"ingestionToken":          ingestionToken,
+		"ingestionTokenExpiresIn": int(rt.config.App.IngestionTokenTTL.Seconds()),
+		"lang":                    rt.config.App.Locale,
+		"locale":                  c.Query("locale"),
 	})
 }
 
+// withFrameAncestors adds the given sources to the frame-ancestors directive
+// of the given policy. In case the policy already contains the directive, the
+// sources are merged into it, as browsers only respect the first occurrence
+// of a directive and ignore all others. A source of 'none' is dropped as it cannot be combined with
+// any other source.
+func withFrameAncestors(csp string, sources ...string) string {
+	var directives []string
+	merged := -1
+	for _, directive := range strings.Split(csp, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		if !strings.EqualFold(fields[0], "frame-ancestors") {
+			directives = append(directives, strings.Join(fields, " "))
+			continue
+		}
+		// browsers ignore repeated directives, so they are dropped
+		if merged == -1 {
+			merged = len(directives)
+			directives = append(directives, "")
+			sources = append(fields[1:], sources...)
+		}
+	}
+
+	result := []string{"frame-ancestors"}
+	seen := map[string]bool{}
+	for _, source := range sources {
+		if strings.EqualFold(source, "'none'") || seen[strings.ToLower(source)] {
+			continue
+		}
+		seen[strings.ToLower(source)] = true
+		result = append(result, source)
+	}
+	if merged == -1 {
+		directives = append(directives, strings.Join(result, " "))
+	} else {
+		directives[merged] = strings.Join(result, " ")
+	}
+	return strings.Join(directives, "; ")
+}
+
+// embeddingOrigin returns the origin of the site embedding the vault, using
+// the Referer header of the given request and falling back to its Origin
+// header. In case neither is present, an empty string is returned.
+func embeddingOrigin(r *http.Request) string {
+	if u, err := url.Parse(r.Referer()); err == nil && u.Host != "" {
+		return strings.ToLower(fmt.Sprintf("%s://%s", u.Scheme, u.Host))
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		return strings.ToLower(origin)
+	}
+	return ""
+}
+
+// mayIssueIngestionToken checks whether the vault embedded by the given
+// origin is allowed to send events for an account. Accounts that define
+// allowed origins require the embedding site to be known.
+func (rt *router) mayIssueIngestionToken(r *http.Request, settings accountSettings, origin string) bool {
+	if len(settings.AllowedOrigins) == 0 {
+		return true
+	}
+	if origin == "" {
+		return false
+	}
+	return isInstanceOrigin(r, origin) || matchOrigin(settings.AllowedOrigins, origin)
+}
+
 func (rt *router) getIntro(c *gin.Context) {
 	c.HTML(http.StatusOK, "intro", map[string]interface{}{
 		"demoAccount": rt.config.App.DemoAccount,
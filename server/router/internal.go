@@ -0,0 +1,83 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewInternal creates a router that serves health checks, version
+// information and metrics only. It is meant to be bound to an address that
+// is not reachable publicly, in which case the router returned by New does
+// not serve these routes. Responses served by this router contain details
+// that are not exposed publicly, e.g. errors returned by readiness checks.
+//
+// The API used by operators is not served by this router. The Auditorium
+// is served from the public origin and its login cookie is scoped to it, so
+// moving the API would break it for all operators. Access to the API can be
+// restricted using client certificates instead.
+func NewInternal(opts ...Config) http.Handler {
+	rt := router{internal: true}
+	for _, opt := range opts {
+		opt(&rt)
+	}
+
+	if !rt.config.App.Development {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	app := gin.New()
+	app.Use(gin.Recovery())
+	if rt.accessLogger != nil && rt.config.Server.AccessLog {
+		app.Use(accessLogMiddleware(rt.accessLogger))
+	}
+	rt.internalRoutes(app, true)
+	return app
+}
+
+// internalRoutes adds the routes used for operating the application to the
+// given engine.
+func (rt *router) internalRoutes(app *gin.Engine, withMetrics bool) {
+	noStore := headerMiddleware(map[string]func() string{
+		"Cache-Control": func() string {
+			return "no-store"
+		},
+	})
+	app.Any("/healthz", noStore, rt.getHealth)
+	app.GET("/livez", noStore, rt.getLiveness)
+	app.GET("/readyz", noStore, rt.getReadiness)
+	app.GET("/versionz", noStore, rt.getVersion)
+	if rt.config.Server.Metrics && withMetrics {
+		handlers := []gin.HandlerFunc{noStore}
+		if !rt.internal {
+			// metrics contain account identifiers, so they are not
+			// exposed publicly without authentication
+			handlers = append(handlers, bearerTokenMiddleware(rt.config.Server.MetricsToken))
+		}
+		app.GET("/metrics", append(handlers, gin.WrapH(rt.metrics.Handler()))...)
+	}
+}
+
+// bearerTokenMiddleware rejects all requests that do not send the given
+// token in their Authorization header. In case the token is empty, all
+// requests are rejected.
+func bearerTokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			newJSONError(
+				errors.New("router: missing or invalid bearer token"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		c.Next()
+	}
+}
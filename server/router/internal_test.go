@@ -0,0 +1,84 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/metrics"
+)
+
+func TestNewInternal(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.ReverseProxy = true
+	cfg.Server.Metrics = true
+	cfg.Server.InternalListen = config.ListenAddress{Network: "tcp", Address: "127.0.0.1:9000"}
+
+	internal := NewInternal(
+		WithDatabase(&mockHealthChecker{}),
+		WithConfig(cfg),
+		WithMetrics(metrics.New()),
+	)
+	for _, path := range []string{"/healthz", "/livez", "/readyz", "/versionz", "/metrics"} {
+		w := httptest.NewRecorder()
+		internal.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %d for %s", w.Code, path)
+		}
+	}
+
+	app := New(
+		WithDatabase(&mockDatabase{}),
+		WithConfig(cfg),
+		WithTemplate(template.New("a test")),
+		WithMetrics(metrics.New()),
+	).(*gin.Engine)
+	for _, route := range app.Routes() {
+		switch route.Path {
+		case "/healthz", "/livez", "/readyz", "/versionz", "/metrics":
+			t.Errorf("Unexpected public route %s %s", route.Method, route.Path)
+		}
+	}
+}
+
+func TestNew_publicMetrics(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.ReverseProxy = true
+	cfg.Server.Metrics = true
+	cfg.Server.MetricsToken = "s3cr3t"
+
+	app := New(
+		WithDatabase(&mockDatabase{}),
+		WithConfig(cfg),
+		WithTemplate(template.New("a test")),
+		WithMetrics(metrics.New()),
+	)
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"bad token", "Bearer other", http.StatusUnauthorized},
+		{"ok", "Bearer s3cr3t", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			app.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/persistence"
@@ -44,24 +43,16 @@ func (rt *router) postLogin(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("postLogin-%s", credentials.Username)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postLogin", credentials.Username) {
 		return
 	}
 
 	// we rate limit this twice to prevent flooding with arbitrary emails
-	if l := <-rt.getLimiter().LinearThrottle(time.Second/2, "postLogin-*"); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postLogin-*", "") {
 		return
 	}
 
-	result, err := rt.db.Login(credentials.Username, credentials.Password)
+	result, err := rt.db.Login(c.Request.Context(), credentials.Username, credentials.Password)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error logging in: %w", err),
@@ -112,11 +103,7 @@ func (rt *router) postChangePassword(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postChangePassword-%s", user.AccountUserID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postChangePassword", user.AccountUserID) {
 		return
 	}
 
@@ -128,7 +115,7 @@ func (rt *router) postChangePassword(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	if err := rt.db.ChangePassword(user.AccountUserID, req.CurrentPassword, req.ChangedPassword); err != nil {
+	if err := rt.db.ChangePassword(c.Request.Context(), user.AccountUserID, req.CurrentPassword, req.ChangedPassword); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error changing password: %w", err),
 			http.StatusBadRequest,
@@ -156,11 +143,7 @@ func (rt *router) postChangeEmail(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postChangeEmail-%s", accountUser.AccountUserID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postChangeEmail", accountUser.AccountUserID) {
 		return
 	}
 
@@ -172,7 +155,7 @@ func (rt *router) postChangeEmail(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	if err := rt.db.ChangeEmail(accountUser.AccountUserID, req.EmailAddress, req.EmailCurrent, req.Password); err != nil {
+	if err := rt.db.ChangeEmail(c.Request.Context(), accountUser.AccountUserID, req.EmailAddress, req.EmailCurrent, req.Password); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error changing email address: %v", err),
 			http.StatusBadRequest,
@@ -207,24 +190,16 @@ func (rt *router) postForgotPassword(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second*5, fmt.Sprintf("postForgotPassword-%s", req.EmailAddress)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postForgotPassword", req.EmailAddress) {
 		return
 	}
 
 	// we rate limit this twice to prevent floodding with arbitrary emails
-	if l := <-rt.getLimiter().LinearThrottle(time.Second, "postForgotPassword-*"); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postForgotPassword-*", "") {
 		return
 	}
 
-	token, err := rt.db.GenerateOneTimeKey(req.EmailAddress)
+	token, err := rt.db.GenerateOneTimeKey(c.Request.Context(), req.EmailAddress)
 	if err != nil {
 		rt.logError(err, "error generating one time key")
 		c.Status(http.StatusNoContent)
@@ -258,7 +233,7 @@ func (rt *router) postForgotPassword(c *gin.Context) {
 		return
 	}
 
-	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.EmailAddress, subject.String(), body.String()); err != nil {
+	if err := rt.sendMail(req.EmailAddress, subject.String(), body.String()); err != nil {
 		newJSONError(
 			fmt.Errorf("error sending email message: %v", err),
 			http.StatusInternalServerError,
@@ -292,11 +267,7 @@ func (rt *router) postResetPassword(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second*5, fmt.Sprintf("postResetPassword-%s", credentials.EmailAddress)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postResetPassword", credentials.EmailAddress) {
 		return
 	}
 
@@ -308,7 +279,7 @@ func (rt *router) postResetPassword(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.ResetPassword(req.EmailAddress, req.Password, credentials.Token); err != nil {
+	if err := rt.db.ResetPassword(c.Request.Context(), req.EmailAddress, req.Password, credentials.Token); err != nil {
 		// on error a successful status is sent in order not to leak information
 		// to attackers
 		rt.logError(err, "error resetting password")
@@ -4,6 +4,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -35,6 +36,7 @@ func TestRouter_postLogout(t *testing.T) {
 	})
 
 	m.ServeHTTP(w, r)
+	validateResponse(t, http.MethodPost, "/api/logout", r, w)
 	cookies := w.Result().Cookies()
 	if len(cookies) != 1 {
 		t.Errorf("Unexpected additional cookies in response: %v", cookies)
@@ -57,7 +59,7 @@ type mockPostLoginDatabase struct {
 	err    error
 }
 
-func (m *mockPostLoginDatabase) Login(string, string) (persistence.LoginResult, error) {
+func (m *mockPostLoginDatabase) Login(context.Context, string, string) (persistence.LoginResult, error) {
 	return m.result, m.err
 }
 func TestRouter_postLogin(t *testing.T) {
@@ -108,6 +110,7 @@ func TestRouter_postLogin(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/login", r, w)
 
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
@@ -146,6 +149,7 @@ func TestRouter_getLogin(t *testing.T) {
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
 		w := httptest.NewRecorder()
 		m.ServeHTTP(w, r)
+		validateResponse(t, http.MethodGet, "/api/login", r, w)
 		if w.Code != http.StatusOK {
 			t.Errorf("Unexpected status code %v", w.Code)
 		}
@@ -159,6 +163,7 @@ func TestRouter_getLogin(t *testing.T) {
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
 		w := httptest.NewRecorder()
 		m.ServeHTTP(w, r)
+		validateResponse(t, http.MethodGet, "/api/login", r, w)
 		if w.Code != http.StatusUnauthorized {
 			t.Errorf("Unexpected status code %v", w.Code)
 		}
@@ -170,7 +175,7 @@ type mockPostChangePasswordDatabase struct {
 	err error
 }
 
-func (m *mockPostChangePasswordDatabase) ChangePassword(string, string, string) error {
+func (m *mockPostChangePasswordDatabase) ChangePassword(context.Context, string, string, string) error {
 	return m.err
 }
 
@@ -238,6 +243,7 @@ func TestRouter_postChangePassword(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/change-password", r, w)
 
 			if w.Code != test.expectedStatus {
 				t.Errorf("Unexpected status code %v", w.Code)
@@ -267,7 +273,7 @@ type mockPostChangeEmailDatabase struct {
 	err error
 }
 
-func (m *mockPostChangeEmailDatabase) ChangeEmail(string, string, string, string) error {
+func (m *mockPostChangeEmailDatabase) ChangeEmail(context.Context, string, string, string, string) error {
 	return m.err
 }
 
@@ -335,6 +341,7 @@ func TestRouter_postChangeEmail(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/change-email", r, w)
 
 			if w.Code != test.expectedStatus {
 				t.Errorf("Unexpected status code %v", w.Code)
@@ -364,7 +371,7 @@ type mockPostResetPasswordDatabase struct {
 	err error
 }
 
-func (m *mockPostResetPasswordDatabase) ResetPassword(string, string, []byte) error {
+func (m *mockPostResetPasswordDatabase) ResetPassword(context.Context, string, string, []byte) error {
 	return m.err
 }
 
@@ -449,6 +456,7 @@ func TestRouter_postResetPassword(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/reset-password", r, w)
 
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
@@ -463,7 +471,7 @@ type mockPostForgotPasswordDatabase struct {
 	err    error
 }
 
-func (m *mockPostForgotPasswordDatabase) GenerateOneTimeKey(string) ([]byte, error) {
+func (m *mockPostForgotPasswordDatabase) GenerateOneTimeKey(context.Context, string) ([]byte, error) {
 	return m.result, m.err
 }
 
@@ -542,6 +550,7 @@ func TestRouter_postForgotPassword(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/forgot-password", r, w)
 
 			if w.Code != test.expectedStatus {
 				t.Errorf("Unexpected status code %v", w.Body)
@@ -0,0 +1,145 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
+)
+
+var linkRe = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// linkify escapes the given text and turns all contained URLs into
+// clickable links.
+func linkify(s string) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, match := range linkRe.FindAllStringIndex(s, -1) {
+		b.WriteString(template.HTMLEscapeString(s[last:match[0]]))
+		link := template.HTMLEscapeString(s[match[0]:match[1]])
+		fmt.Fprintf(&b, `<a href="%s">%s</a>`, link, link)
+		last = match[1]
+	}
+	b.WriteString(template.HTMLEscapeString(s[last:]))
+	return template.HTML(b.String())
+}
+
+var mailboxTemplate = template.Must(template.New("mailbox").Funcs(template.FuncMap{
+	"linkify": linkify,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Development mailbox</title>
+	<style>
+		body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+		table { width: 100%; border-collapse: collapse; }
+		td, th { text-align: left; padding: 0.25em 0.5em; border-bottom: 1px solid #ddd; }
+		pre { white-space: pre-wrap; background: #f4f4f4; padding: 1em; }
+	</style>
+</head>
+<body>
+{{ if .message }}
+	<p><a href="/_dev/mailbox">&larr; All messages</a></p>
+	<h1>{{ .message.Subject }}</h1>
+	<p>
+		From: {{ .message.From }}<br>
+		To: {{ .message.To }}<br>
+		Date: {{ .message.Date.Format "2006-01-02 15:04:05 MST" }}
+	</p>
+	<pre>{{ linkify .message.Body }}</pre>
+{{ else }}
+	<h1>Development mailbox</h1>
+	{{ if .messages }}
+	<table>
+		<tr><th>Date</th><th>To</th><th>Subject</th></tr>
+		{{ range .messages }}
+		<tr>
+			<td>{{ .Date.Format "2006-01-02 15:04:05" }}</td>
+			<td>{{ .To }}</td>
+			<td><a href="/_dev/mailbox/{{ .ID }}">{{ .Subject }}</a></td>
+		</tr>
+		{{ end }}
+	</table>
+	{{ else }}
+	<p>No messages have been sent yet.</p>
+	{{ end }}
+{{ end }}
+</body>
+</html>
+`))
+
+func (rt *router) renderMailbox(c *gin.Context, data map[string]interface{}) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := mailboxTemplate.Execute(c.Writer, data); err != nil {
+		rt.logError(err, "error rendering mailbox")
+	}
+}
+
+func (rt *router) getMailbox(c *gin.Context) {
+	mailbox, ok := rt.getMailer().(mailer.Mailbox)
+	if !ok {
+		newJSONError(
+			errors.New("router: configured mailer does not store messages"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	messages, err := mailbox.Messages()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error reading messages from mailbox: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(http.StatusOK, messages)
+		return
+	}
+	rt.renderMailbox(c, map[string]interface{}{
+		"messages": messages,
+	})
+}
+
+func (rt *router) getMailboxMessage(c *gin.Context) {
+	mailbox, ok := rt.getMailer().(mailer.Mailbox)
+	if !ok {
+		newJSONError(
+			errors.New("router: configured mailer does not store messages"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	message, err := mailbox.Message(c.Param("messageID"))
+	if err != nil {
+		if errors.Is(err, mailer.ErrUnknownMessage) {
+			newJSONError(
+				fmt.Errorf("router: message %s not found", c.Param("messageID")),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error reading message from mailbox: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(http.StatusOK, message)
+		return
+	}
+	rt.renderMailbox(c, map[string]interface{}{
+		"message": message,
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
+)
+
+type mockMailbox struct {
+	mailer.Mailer
+	messages []mailer.Message
+}
+
+func (m *mockMailbox) Messages() ([]mailer.Message, error) {
+	return m.messages, nil
+}
+
+func (m *mockMailbox) Message(id string) (mailer.Message, error) {
+	for _, msg := range m.messages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return mailer.Message{}, mailer.ErrUnknownMessage
+}
+
+func TestRouter_getMailbox(t *testing.T) {
+	messages := []mailer.Message{
+		{ID: "abc", To: "develop@offen.dev", Subject: "Reset your password", Date: time.Now(), Body: "Go to https://offen.dev/reset/?token=<x>"},
+	}
+	tests := []struct {
+		name           string
+		mailer         mailer.Mailer
+		path           string
+		accept         string
+		expectedStatus int
+		expectedBody   []string
+	}{
+		{
+			"not a mailbox",
+			nil,
+			"/_dev/mailbox",
+			"",
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"list html",
+			&mockMailbox{messages: messages},
+			"/_dev/mailbox",
+			"",
+			http.StatusOK,
+			[]string{`<a href="/_dev/mailbox/abc">Reset your password</a>`},
+		},
+		{
+			"list json",
+			&mockMailbox{messages: messages},
+			"/_dev/mailbox",
+			"application/json",
+			http.StatusOK,
+			[]string{`"subject":"Reset your password"`},
+		},
+		{
+			"message html",
+			&mockMailbox{messages: messages},
+			"/_dev/mailbox/abc",
+			"",
+			http.StatusOK,
+			[]string{`<a href="https://offen.dev/reset/?token=">https://offen.dev/reset/?token=</a>&lt;x&gt;`},
+		},
+		{
+			"unknown message",
+			&mockMailbox{messages: messages},
+			"/_dev/mailbox/xyz",
+			"",
+			http.StatusNotFound,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{mailer: test.mailer}
+			m := gin.New()
+			m.GET("/_dev/mailbox", rt.getMailbox)
+			m.GET("/_dev/mailbox/:messageID", rt.getMailboxMessage)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				r.Header.Set("Accept", test.accept)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			for _, fragment := range test.expectedBody {
+				if !strings.Contains(w.Body.String(), fragment) {
+					t.Errorf("Expected body %s to contain %s", w.Body.String(), fragment)
+				}
+			}
+		})
+	}
+	t.Run("json roundtrip", func(t *testing.T) {
+		rt := router{mailer: &mockMailbox{messages: messages}}
+		m := gin.New()
+		m.GET("/_dev/mailbox", rt.getMailbox)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/_dev/mailbox", nil)
+		r.Header.Set("Accept", "application/json")
+		m.ServeHTTP(w, r)
+		var result []mailer.Message
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(result) != 1 || result[0].ID != "abc" {
+			t.Errorf("Unexpected result %v", result)
+		}
+	})
+}
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/css"
@@ -50,11 +49,7 @@ func (rt *router) putAccountStyles(c *gin.Context) {
 		}
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("putAccountStyles-%s", accountUser.AccountUserID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "putAccountStyles", accountUser.AccountUserID) {
 		return
 	}
 
@@ -71,13 +66,92 @@ func (rt *router) putAccountStyles(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.UpdateAccountStyles(accountID, req.AccountStyles); err != nil {
+	if err := rt.db.UpdateAccountStyles(c.Request.Context(), accountID, req.AccountStyles); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error updating styles for account %s: %w", accountID, err),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
+	rt.getCache().Delete(accountSettingsCacheKey(accountID))
+
+	c.Status(http.StatusNoContent)
+}
+
+type accountAllowedOriginsRequest struct {
+	AllowedOrigins []string `json:"allowedOrigins"`
+}
+
+func (rt *router) putAccountAllowedOrigins(c *gin.Context) {
+	var req accountAllowedOriginsRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding response body: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	accountID := c.Param("accountID")
+	if !accountUser.CanAccessAccount(accountID) {
+		newJSONError(
+			fmt.Errorf("router: user is not allowed to access account %s", accountID),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	if !rt.throttle(c, "putAccountAllowedOrigins", accountUser.AccountUserID) {
+		return
+	}
+
+	if len(req.AllowedOrigins) > maxAllowedOrigins {
+		newJSONError(
+			fmt.Errorf("router: expected at most %d allowed origins, got %d", maxAllowedOrigins, len(req.AllowedOrigins)),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	var origins []string
+	seen := map[string]bool{}
+	for _, origin := range req.AllowedOrigins {
+		normalized, err := normalizeOrigin(origin)
+		if err != nil {
+			newJSONError(
+				fmt.Errorf("router: error validating given origins: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			origins = append(origins, normalized)
+		}
+	}
+
+	if c.Request.URL.Query().Get("dryRun") != "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if err := rt.db.UpdateAccountAllowedOrigins(c.Request.Context(), accountID, origins); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error updating allowed origins for account %s: %w", accountID, err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	rt.getCache().Delete(accountSettingsCacheKey(accountID))
 
 	c.Status(http.StatusNoContent)
 }
@@ -120,16 +194,12 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		}
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("postShareAccount-%s", accountUser.AccountUserID)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postShareAccount", accountUser.AccountUserID) {
 		return
 	}
 
 	// the given credentials might not be valid
-	accountInRequest, err := rt.db.Login(req.ProviderEmailAddress, req.ProviderPassword)
+	accountInRequest, err := rt.db.Login(c.Request.Context(), req.ProviderEmailAddress, req.ProviderPassword)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error validating given credentials: %w", err),
@@ -156,7 +226,7 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.ShareAccount(req.InviteeEmailAddress, req.ProviderEmailAddress, req.ProviderPassword, c.Param("accountID"), req.GrantAdminPrivileges)
+	result, err := rt.db.ShareAccount(c.Request.Context(), req.InviteeEmailAddress, req.ProviderEmailAddress, req.ProviderPassword, c.Param("accountID"), req.GrantAdminPrivileges)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error inviting user: %w", err),
@@ -202,7 +272,7 @@ func (rt *router) postShareAccount(c *gin.Context) {
 			return
 		}
 	}
-	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.InviteeEmailAddress, subject.String(), body.String()); err != nil {
+	if err := rt.sendMail(req.InviteeEmailAddress, subject.String(), body.String()); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error sending email message: %v", err),
 			http.StatusInternalServerError,
@@ -243,24 +313,16 @@ func (rt *router) postJoin(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("postJoin-%s", req.EmailAddress)); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postJoin", req.EmailAddress) {
 		return
 	}
 
 	// we rate limit this twice to prevent floodding with arbitrary emails
-	if l := <-rt.getLimiter().LinearThrottle(time.Second/2, "postJoin-*"); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error rate limiting request: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postJoin-*", "") {
 		return
 	}
 
-	if err := rt.db.Join(req.EmailAddress, req.Password); err != nil {
+	if err := rt.db.Join(c.Request.Context(), req.EmailAddress, req.Password); err != nil {
 		rt.logError(err, "error joining")
 	}
 	c.Status(http.StatusNoContent)
@@ -4,6 +4,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -27,11 +28,11 @@ type mockPostShareAccountDatabase struct {
 	loginErr           error
 }
 
-func (m *mockPostShareAccountDatabase) ShareAccount(string, string, string, string, bool) (persistence.ShareAccountResult, error) {
+func (m *mockPostShareAccountDatabase) ShareAccount(context.Context, string, string, string, string, bool) (persistence.ShareAccountResult, error) {
 	return m.shareAccountResult, m.shareAccountErr
 }
 
-func (m *mockPostShareAccountDatabase) Login(string, string) (persistence.LoginResult, error) {
+func (m *mockPostShareAccountDatabase) Login(context.Context, string, string) (persistence.LoginResult, error) {
 	return m.loginResult, m.loginErr
 }
 
@@ -333,6 +334,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/%s", test.accountID), test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/share-account/:accountID", r, w)
 
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
@@ -346,7 +348,7 @@ type mockPostJoinDatabase struct {
 	err error
 }
 
-func (m *mockPostJoinDatabase) Join(string, string) error {
+func (m *mockPostJoinDatabase) Join(context.Context, string, string) error {
 	return m.err
 }
 
@@ -429,6 +431,7 @@ func TestRouter_postJoin(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/join", r, w)
 
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
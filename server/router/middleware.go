@@ -8,19 +8,75 @@ import (
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 )
 
-func secureContextMiddleware(contextKey string, isDevelopment bool) gin.HandlerFunc {
+// secureContextMiddleware stores whether the request is expected to be made
+// in a secure context, i.e. cookies need to be set using the Secure flag.
+// Information about the original request passed in Forwarded or
+// X-Forwarded-* headers is only considered for requests made by one of the
+// given trusted proxies.
+func secureContextMiddleware(contextKey string, isDevelopment bool, trustedProxies config.TrustedProxies) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		u := location.Get(c)
-		isLocalhost := u.Hostname() == "localhost"
-		c.Set(contextKey, !isLocalhost && !isDevelopment)
+		var host, proto string
+		if c.Request.TLS != nil {
+			proto = "https"
+		}
+		if trustedProxies.Contains(c.Request.RemoteAddr) {
+			forwarded := parseForwarded(c.Request.Header.Get("Forwarded"))
+			host = firstNonEmpty(forwarded["host"], c.Request.Header.Get("X-Forwarded-Host"), c.Request.Host)
+			proto = strings.ToLower(firstNonEmpty(forwarded["proto"], c.Request.Header.Get("X-Forwarded-Proto"), proto))
+		} else {
+			// requests from unknown sources keep resolving the host from headers
+			// like older versions did, as instances running behind proxies that
+			// have not been configured as trusted would otherwise stop setting
+			// secure cookies
+			host = firstNonEmpty(c.Request.Header.Get("X-Forwarded-For"), c.Request.Header.Get("X-Host"), c.Request.Host)
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		isLocalhost := host == "localhost"
+		c.Set(contextKey, !isLocalhost && !isDevelopment && proto != "http")
+	}
+}
+
+// parseForwarded returns the parameters of the first element of the given
+// Forwarded header as defined in RFC 7239, which is the element that has been
+// added by the proxy closest to the client.
+func parseForwarded(value string) map[string]string {
+	result := map[string]string{}
+	first, _, _ := strings.Cut(value, ",")
+	for _, pair := range strings.Split(first, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		result[strings.ToLower(key)] = strings.Trim(value, `"`)
+	}
+	return result
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
+	return ""
 }
 
 // optinMiddleware drops all requests to the given handler that are missing
@@ -76,7 +132,7 @@ func (rt *router) accountUserMiddleware(cookieKey, contextKey string) gin.Handle
 			return
 		}
 
-		user, userErr := rt.db.LookupAccountUser(userID)
+		user, userErr := rt.db.LookupAccountUser(c.Request.Context(), userID)
 		if userErr != nil {
 			authCookie, _ = rt.authCookie("", c.GetBool(contextKeySecureContext))
 			http.SetCookie(c.Writer, authCookie)
@@ -91,6 +147,22 @@ func (rt *router) accountUserMiddleware(cookieKey, contextKey string) gin.Handle
 	}
 }
 
+// clientCertificateMiddleware rejects all requests that have not been made
+// using a client certificate that has been verified when establishing the
+// TLS connection.
+func clientCertificateMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			newJSONError(
+				errors.New("router: a valid client certificate is required"),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+		c.Next()
+	}
+}
+
 func headerMiddleware(valueProvider map[string]func() string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		for key, provider := range valueProvider {
@@ -129,3 +201,79 @@ func etagMiddleware() gin.HandlerFunc {
 		bw.ResponseWriter.Write(data)
 	}
 }
+
+// metricsMiddleware records each request using its route template. Requests
+// that do not match a route are recorded as static file requests. Status
+// codes are anonymized in the same way as they are for access logs.
+func metricsMiddleware(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "static"
+		}
+		m.ObserveRequest(route, c.Request.Method, anonymizeStatusCode(c.Writer.Status()), time.Since(start))
+	}
+}
+
+// accessLogMiddleware logs each handled request using the given logger.
+// Fields that contain privacy sensitive data (IPs, User-Agent Strings,
+// Referrers) are never logged. Status codes are anonymized and the response
+// size is only logged for failed requests as both could otherwise leak
+// information about returning visitors.
+func accessLogMiddleware(l *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "static"
+		}
+		status := anonymizeStatusCode(c.Writer.Status())
+		fields := logrus.Fields{
+			"route":    route,
+			"method":   c.Request.Method,
+			"uri":      c.Request.RequestURI,
+			"proto":    c.Request.Proto,
+			"status":   status,
+			"duration": time.Since(start).Seconds(),
+		}
+		if status >= http.StatusBadRequest {
+			fields["bytes"] = c.Writer.Size()
+		}
+		l.WithFields(fields).Infof(
+			"\"%s %s %s\" %d", c.Request.Method, c.Request.RequestURI, c.Request.Proto, status,
+		)
+	}
+}
+
+// tracingMiddleware creates a span for each request and passes it on to
+// handlers using the request's context. Only the route template, the method
+// and the anonymized status code are recorded, so spans never contain any
+// information that identifies a user.
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(
+			c.Request.Context(), propagation.HeaderCarrier(c.Request.Header),
+		)
+		route := c.FullPath()
+		if route == "" {
+			route = "static"
+		}
+		ctx, span := tracing.Start(
+			ctx, c.Request.Method+" "+route,
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := anonymizeStatusCode(c.Writer.Status())
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
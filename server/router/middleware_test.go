@@ -4,6 +4,11 @@
 package router
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -13,7 +18,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/metrics"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestOptinMiddleware(t *testing.T) {
@@ -125,7 +137,7 @@ type mockUserLookupDatabase struct {
 	persistence.Service
 }
 
-func (*mockUserLookupDatabase) LookupAccountUser(accountUserID string) (persistence.LoginResult, error) {
+func (*mockUserLookupDatabase) LookupAccountUser(ctx context.Context, accountUserID string) (persistence.LoginResult, error) {
 	if accountUserID == "account-user-id-1" {
 		return persistence.LoginResult{
 			AccountUserID: "account-user-id-1",
@@ -197,6 +209,76 @@ func TestAccountUserMiddleware(t *testing.T) {
 	})
 }
 
+func TestSecureContextMiddleware(t *testing.T) {
+	var trusted config.TrustedProxies
+	if err := trusted.Decode("10.0.0.0/8"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		host           string
+		headers        map[string]string
+		development    bool
+		expectedResult bool
+	}{
+		{"public host", "192.0.2.1:1234", "offen.example.net", nil, false, true},
+		{"localhost", "127.0.0.1:1234", "localhost:3000", nil, false, false},
+		{"development", "192.0.2.1:1234", "offen.example.net", nil, true, false},
+		{"untrusted forwarded proto", "192.0.2.1:1234", "offen.example.net", map[string]string{"Forwarded": "proto=http"}, false, true},
+		{"legacy proxy", "127.0.0.1:1234", "localhost:3000", map[string]string{"X-Forwarded-For": "192.0.2.1"}, false, true},
+		{"trusted forwarded https", "10.0.0.1:1234", "localhost:3000", map[string]string{"Forwarded": `for=192.0.2.1;host="offen.example.net";proto=https, for=10.0.0.2`}, false, true},
+		{"trusted forwarded http", "10.0.0.1:1234", "localhost:3000", map[string]string{"Forwarded": "for=192.0.2.1;host=offen.example.net;proto=http"}, false, false},
+		{"trusted x-forwarded http", "10.0.0.1:1234", "offen.example.net", map[string]string{"X-Forwarded-Proto": "http"}, false, false},
+		{"trusted x-forwarded localhost", "10.0.0.1:1234", "offen.example.net", map[string]string{"X-Forwarded-Host": "localhost:8080", "X-Forwarded-Proto": "https"}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result interface{}
+			m := gin.New()
+			m.GET("/", secureContextMiddleware("secure", test.development, trusted), func(c *gin.Context) {
+				result, _ = c.Get("secure")
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			r.Host = test.host
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+			m.ServeHTTP(httptest.NewRecorder(), r)
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestClientCertificateMiddleware(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		state          *tls.ConnectionState
+		expectedStatus int
+	}{
+		{"plain connection", nil, http.StatusForbidden},
+		{"no certificate", &tls.ConnectionState{}, http.StatusForbidden},
+		{"verified certificate", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/", clientCertificateMiddleware(), func(c *gin.Context) {
+				c.String(http.StatusOK, "OK!")
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.TLS = test.state
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
 func TestHeaderMiddleware(t *testing.T) {
 	m := gin.New()
 	m.GET("/", headerMiddleware(map[string]func() string{
@@ -273,3 +355,121 @@ func TestEtagMiddleware(t *testing.T) {
 		t.Errorf("Unexpected status code %v", w2.Code)
 	}
 }
+
+func TestMetricsMiddleware(t *testing.T) {
+	collector := metrics.New()
+	m := gin.New()
+	m.Use(metricsMiddleware(collector))
+	m.GET("/accounts/:accountID", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	m.GET("/limited", func(c *gin.Context) {
+		c.Status(http.StatusTooManyRequests)
+	})
+
+	for _, path := range []string{"/accounts/some-account", "/limited", "/unknown"} {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, expected := range []string{
+		`offen_http_requests_total{method="GET",route="/accounts/:accountID",status="200"} 1`,
+		`offen_http_requests_total{method="GET",route="static",status="404"} 1`,
+		`offen_ratelimiter_rejections_total{route="/limited"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %s", expected)
+		}
+	}
+	if strings.Contains(body, "some-account") {
+		t.Error("Expected metrics not to contain actual path")
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.JSONFormatter{})
+
+	m := gin.New()
+	m.Use(accessLogMiddleware(l))
+	m.GET("/accounts/:accountID", func(c *gin.Context) {
+		c.String(http.StatusCreated, "created")
+	})
+	m.GET("/fail", func(c *gin.Context) {
+		c.String(http.StatusBadRequest, "bad")
+	})
+
+	for _, path := range []string{"/accounts/some-account", "/fail"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("User-Agent", "some-agent")
+		m.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if strings.Contains(buf.String(), "192.0.2.1") || strings.Contains(buf.String(), "some-agent") {
+		t.Errorf("Expected logs not to contain privacy sensitive data, got %s", buf.String())
+	}
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Unexpected number of log entries %d", len(entries))
+	}
+
+	if entries[0]["route"] != "/accounts/:accountID" || entries[0]["status"] != float64(http.StatusOK) {
+		t.Errorf("Unexpected entry %v", entries[0])
+	}
+	if _, ok := entries[0]["bytes"]; ok {
+		t.Errorf("Unexpected bytes field in successful entry %v", entries[0])
+	}
+	if entries[1]["status"] != float64(http.StatusBadRequest) || entries[1]["bytes"] != float64(3) {
+		t.Errorf("Unexpected entry %v", entries[1])
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	m := gin.New()
+	m.Use(tracingMiddleware())
+	m.GET("/accounts/:accountID", func(c *gin.Context) {
+		_, span := tracing.Start(c.Request.Context(), "handler")
+		span.End()
+		c.Status(http.StatusNoContent)
+	})
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/accounts/some-account", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Unexpected number of spans %d", len(spans))
+	}
+	handler, request := spans[0], spans[1]
+	if request.Name() != "GET /accounts/:accountID" {
+		t.Errorf("Unexpected span name %v", request.Name())
+	}
+	if handler.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Error("Expected handler span to be nested in request span")
+	}
+	for _, attr := range request.Attributes() {
+		if strings.Contains(attr.Value.Emit(), "some-account") {
+			t.Errorf("Unexpected identifier in attribute %v", attr)
+		}
+		if attr.Key == "http.response.status_code" && attr.Value.AsInt64() != http.StatusOK {
+			t.Errorf("Unexpected status code %v", attr.Value.AsInt64())
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPIDocument describes all routes served by the router. It is checked
+// against the registered routes and the responses returned by handlers in
+// tests, so it needs to be updated whenever the API changes.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+func (rt *router) getOpenAPIDocument(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPIDocument)
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/metrics"
+)
+
+func loadOpenAPIDocument(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(openAPIDocument)
+	if err != nil {
+		t.Fatalf("Unexpected error loading OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+// validateResponse checks the response recorded in w against the operation
+// that is described for the given method and route in the OpenAPI document.
+// route is expected to use the gin syntax for path parameters.
+func validateResponse(t *testing.T, method, route string, r *http.Request, w *httptest.ResponseRecorder) {
+	t.Helper()
+	doc := loadOpenAPIDocument(t)
+	path := toOpenAPIPath(route)
+	pathItem := doc.Paths.Find(path)
+	if pathItem == nil {
+		t.Fatalf("Path %s is not described in the OpenAPI document", path)
+	}
+	operation := pathItem.GetOperation(method)
+	if operation == nil {
+		t.Fatalf("Operation %s %s is not described in the OpenAPI document", method, path)
+	}
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request: r,
+			Route: &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  pathItem,
+				Method:    method,
+				Operation: operation,
+			},
+		},
+		Status:  w.Code,
+		Header:  w.Header(),
+		Options: &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	input.SetBodyBytes(w.Body.Bytes())
+	if err := openapi3filter.ValidateResponse(context.Background(), input); err != nil {
+		t.Errorf("Response for %s %s does not match the OpenAPI document: %v", method, path, err)
+	}
+}
+
+var ginPathParam = regexp.MustCompile(`:([^/]+)`)
+
+func toOpenAPIPath(route string) string {
+	return ginPathParam.ReplaceAllString(route, "{$1}")
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("Unexpected error validating OpenAPI document: %v", err)
+	}
+
+	t.Run("routes", func(t *testing.T) {
+		// routes that do not return JSON are not part of the document
+		undocumented := map[string]bool{
+			"/vault":                   true,
+			"/intro":                   true,
+			"/metrics":                 true,
+			"/_dev/mailbox":            true,
+			"/_dev/mailbox/:messageID": true,
+		}
+		cfg := &config.Config{}
+		cfg.App.Development = true
+		cfg.App.DemoAccount = "demo"
+		cfg.Server.ReverseProxy = true
+		cfg.Server.Metrics = true
+		app := New(
+			WithDatabase(&mockDatabase{}),
+			WithConfig(cfg),
+			WithTemplate(template.New("a test")),
+			WithMetrics(metrics.New()),
+		).(*gin.Engine)
+
+		for _, route := range app.Routes() {
+			if undocumented[route.Path] {
+				continue
+			}
+			// the health check accepts any method for legacy reasons, but
+			// only GET is documented
+			if route.Path == "/healthz" && route.Method != http.MethodGet {
+				continue
+			}
+			path := toOpenAPIPath(route.Path)
+			pathItem := doc.Paths.Find(path)
+			if pathItem == nil {
+				t.Errorf("Route %s %s is not described in the OpenAPI document", route.Method, path)
+				continue
+			}
+			if pathItem.GetOperation(route.Method) == nil {
+				t.Errorf("Route %s %s is not described in the OpenAPI document", route.Method, path)
+			}
+		}
+	})
+
+	t.Run("served", func(t *testing.T) {
+		rt := router{}
+		m := gin.New()
+		m.GET("/api/openapi.json", rt.getOpenAPIDocument)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		validateResponse(t, http.MethodGet, "/api/openapi.json", r, w)
+	})
+}
@@ -0,0 +1,334 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/css"
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/persistence"
+	"github.com/sirupsen/logrus"
+)
+
+// maxAllowedOrigins limits the number of origins that can be configured for
+// a single account so the resulting headers stay reasonably sized.
+const maxAllowedOrigins = 32
+
+// normalizeOrigin validates the given origin and returns it in the form
+// scheme://host[:port]. The leftmost label of the host can be a wildcard
+// (i.e. https://*.example.com) matching all of its subdomains.
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil {
+		return "", fmt.Errorf("normalizeOrigin: error parsing %s: %w", origin, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("normalizeOrigin: unsupported scheme in %s", origin)
+	}
+	if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("normalizeOrigin: %s is expected to contain scheme and host only", origin)
+	}
+	hostname := strings.TrimPrefix(u.Hostname(), "*.")
+	if hostname == "" || strings.ContainsAny(hostname, "*;, ") {
+		return "", fmt.Errorf("normalizeOrigin: invalid host in %s", origin)
+	}
+	return strings.ToLower(fmt.Sprintf("%s://%s", u.Scheme, u.Host)), nil
+}
+
+// matchOrigin checks whether the given request origin is matched by any
+// of the given allowed origins.
+func matchOrigin(allowed []string, origin string) bool {
+	o, err := url.Parse(strings.ToLower(origin))
+	if err != nil || o.Host == "" {
+		return false
+	}
+	for _, candidate := range allowed {
+		a, err := url.Parse(candidate)
+		if err != nil || a.Scheme != o.Scheme || a.Port() != o.Port() {
+			continue
+		}
+		if a.Hostname() == o.Hostname() {
+			return true
+		}
+		if strings.HasPrefix(a.Hostname(), "*.") && strings.HasSuffix(o.Hostname(), a.Hostname()[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInstanceOrigin checks whether the given origin points to the Offen
+// instance handling the given request.
+func isInstanceOrigin(r *http.Request, origin string) bool {
+	o, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(o.Host, r.Host)
+}
+
+// accountSettings contains the configuration of an account that is needed
+// when serving requests that do not require authentication, i.e. the vault
+// or events sent by users.
+type accountSettings struct {
+	Styles         string
+	AllowedOrigins []string
+}
+
+func accountSettingsCacheKey(accountID string) string {
+	return fmt.Sprintf("account-settings-%s", accountID)
+}
+
+func (rt *router) getAccountSettings(ctx context.Context, accountID string) (accountSettings, error) {
+	cache, cacheKey := rt.getCache(), accountSettingsCacheKey(accountID)
+	if cachedItem, ok := cache.Get(cacheKey); ok {
+		settings, castOk := cachedItem.(accountSettings)
+		if !castOk {
+			return accountSettings{}, fmt.Errorf("router: unexpected cache item for account %s", accountID)
+		}
+		return settings, nil
+	}
+
+	account, err := rt.db.GetAccount(ctx, accountID, true, false, "")
+	if err != nil {
+		return accountSettings{}, fmt.Errorf("router: error looking up account %s: %w", accountID, err)
+	}
+
+	settings := accountSettings{
+		Styles:         account.AccountStyles,
+		AllowedOrigins: account.AllowedOrigins,
+	}
+	if settings.Styles != "" {
+		if err := css.ValidateCSS(settings.Styles); err != nil {
+			settings.Styles = ""
+			if rt.logger != nil {
+				rt.logger.WithError(err).Warnf(
+					"Custom styles for account %s in database did not pass validation, default styling will apply.",
+					account.Name,
+				)
+			}
+		}
+	}
+
+	ttl := 5 * time.Minute
+	if rt.config.App.Development || rt.config.App.DemoAccount != "" {
+		ttl = time.Second
+	}
+
+	// Writing to the cache at this point means the application _might_ cache
+	// empty styles in case the CSS in the database is considered invalid,
+	// which might be confusing but mitigates the possibility of attacking the
+	// application by inserting malformed CSS into the database.
+	cache.Set(cacheKey, settings, ttl)
+	return settings, nil
+}
+
+// errIngestForbidden is wrapped by errors returned when data for an account
+// is sent from an origin that is not allowed or without a valid ingestion
+// token.
+var errIngestForbidden = errors.New("router: sending data for account is not allowed")
+
+// ingestStatus returns the status code for an error returned when verifying
+// a request sending data for an account.
+func ingestStatus(err error) int {
+	var unknownAccountErr persistence.ErrUnknownAccount
+	switch {
+	case errors.As(err, &unknownAccountErr):
+		return http.StatusNotFound
+	case errors.Is(err, errIngestForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// verifyOrigin verifies the Origin header of the given request against
+// the origins allowed for the given account. Requests without an Origin
+// header, requests originating from the Offen instance itself and accounts
+// that do not define any allowed origins are always passing.
+func (rt *router) verifyOrigin(c *gin.Context, accountID string) error {
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		return nil
+	}
+	if isInstanceOrigin(c.Request, origin) {
+		return nil
+	}
+
+	settings, err := rt.getAccountSettings(c.Request.Context(), accountID)
+	if err != nil {
+		return fmt.Errorf("router: error checking origin: %w", err)
+	}
+
+	if len(settings.AllowedOrigins) == 0 || matchOrigin(settings.AllowedOrigins, origin) {
+		return nil
+	}
+	rt.rejectIngest(accountID, metrics.RejectOrigin, origin)
+	return fmt.Errorf("%w: origin %s is not allowed for account %s", errIngestForbidden, origin, accountID)
+}
+
+// checkOrigin calls verifyOrigin. In case the check fails, an error response
+// has been written and false is returned.
+func (rt *router) checkOrigin(c *gin.Context, accountID string) bool {
+	if err := rt.verifyOrigin(c, accountID); err != nil {
+		newJSONError(err, ingestStatus(err)).Pipe(c)
+		return false
+	}
+	return true
+}
+
+// rejectIngest records a request for the given account that has been
+// rejected, so operators can tell when their allowed origins are
+// misconfigured or someone is trying to send data from elsewhere.
+func (rt *router) rejectIngest(accountID, reason, origin string) {
+	rt.metrics.ObserveIngestRejection(accountID, reason)
+	if rt.logger != nil {
+		rt.logger.WithFields(logrus.Fields{
+			"accountId": accountID,
+			"reason":    reason,
+			"origin":    origin,
+		}).Warn("Rejected request sending data for account")
+	}
+}
+
+const ingestionTokenKey = "ingestion"
+
+// ingestionClaims are encoded in ingestion tokens. Tokens are bound to the
+// user they have been issued for and to the origin of the site embedding the
+// vault. Tokens issued before the user cookie is set do not contain a user
+// id and can only be used for requesting a new token.
+type ingestionClaims struct {
+	AccountID string
+	UserID    string
+	Origin    string
+}
+
+// ingestionToken returns a token signed with the instance secret that allows
+// sending events using the given claims until the configured TTL elapses.
+func (rt *router) ingestionToken(claims ingestionClaims) (string, error) {
+	token, err := rt.getTokenSigner().Encode(ingestionTokenKey, claims)
+	if err != nil {
+		return "", fmt.Errorf("router: error signing ingestion token: %w", err)
+	}
+	return token, nil
+}
+
+// decodeIngestionToken returns the claims of the given token in case it has
+// been issued for the given account, has not expired yet and is used by the
+// origin it has been issued for. Requests originating from the vault itself
+// are passing the origin check.
+func (rt *router) decodeIngestionToken(c *gin.Context, accountID, token string) (ingestionClaims, bool) {
+	var claims ingestionClaims
+	if err := rt.getTokenSigner().Decode(ingestionTokenKey, token, &claims); err != nil || claims.AccountID != accountID {
+		return ingestionClaims{}, false
+	}
+	origin := c.GetHeader("Origin")
+	if claims.Origin == "" || origin == "" || isInstanceOrigin(c.Request, origin) {
+		return claims, true
+	}
+	return claims, strings.EqualFold(claims.Origin, origin)
+}
+
+// verifyIngestionToken verifies the given token has been issued for the given
+// account and user and has not expired yet. In case ingestion tokens are not
+// enabled, all requests pass.
+func (rt *router) verifyIngestionToken(c *gin.Context, accountID, userID, token string) error {
+	if rt.config.App.IngestionTokenTTL <= 0 {
+		return nil
+	}
+
+	// looking up the account ensures no arbitrary identifiers are
+	// recorded when rejecting the request
+	if _, err := rt.getAccountSettings(c.Request.Context(), accountID); err != nil {
+		return fmt.Errorf("router: error checking ingestion token: %w", err)
+	}
+
+	if claims, ok := rt.decodeIngestionToken(c, accountID, token); !ok || claims.UserID != userID {
+		rt.rejectIngest(accountID, metrics.RejectToken, c.GetHeader("Origin"))
+		return fmt.Errorf("%w: no valid ingestion token given for account %s", errIngestForbidden, accountID)
+	}
+	return nil
+}
+
+// checkIngestionToken calls verifyIngestionToken. In case the check fails,
+// an error response has been written and false is returned.
+func (rt *router) checkIngestionToken(c *gin.Context, accountID, userID, token string) bool {
+	if err := rt.verifyIngestionToken(c, accountID, userID, token); err != nil {
+		newJSONError(err, ingestStatus(err)).Pipe(c)
+		return false
+	}
+	return true
+}
+
+type ingestionTokenPayload struct {
+	AccountID      string `json:"accountId"`
+	IngestionToken string `json:"ingestionToken"`
+}
+
+type ingestionTokenResponse struct {
+	IngestionToken string `json:"ingestionToken"`
+	ExpiresIn      int    `json:"expiresIn"`
+}
+
+// postIngestionToken exchanges a valid ingestion token for a new one that is
+// bound to the user sending the request. This allows the vault to keep
+// sending events once the user cookie has been set or for longer than the
+// token's TTL without having to be reloaded.
+func (rt *router) postIngestionToken(c *gin.Context) {
+	if rt.config.App.IngestionTokenTTL <= 0 {
+		newJSONError(
+			errors.New("router: ingestion tokens are not enabled"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	userID := c.GetString(contextKeyCookie)
+	if !rt.throttle(c, "postIngestionToken", userID) {
+		return
+	}
+
+	var payload ingestionTokenPayload
+	if err := c.BindJSON(&payload); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if _, err := rt.getAccountSettings(c.Request.Context(), payload.AccountID); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up account: %w", err),
+			ingestStatus(err),
+		).Pipe(c)
+		return
+	}
+
+	claims, ok := rt.decodeIngestionToken(c, payload.AccountID, payload.IngestionToken)
+	if !ok || (claims.UserID != "" && claims.UserID != userID) {
+		rt.rejectIngest(payload.AccountID, metrics.RejectToken, c.GetHeader("Origin"))
+		newJSONError(
+			fmt.Errorf("%w: no valid ingestion token given for account %s", errIngestForbidden, payload.AccountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	claims.UserID = userID
+	token, err := rt.ingestionToken(claims)
+	if err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, ingestionTokenResponse{
+		IngestionToken: token,
+		ExpiresIn:      int(rt.config.App.IngestionTokenTTL.Seconds()),
+	})
+}
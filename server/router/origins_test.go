@@ -0,0 +1,444 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestNormalizeOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		origin         string
+		expectedResult string
+		expectError    bool
+	}{
+		{"ok", "https://www.example.com", "https://www.example.com", false},
+		{"trailing slash", "https://www.example.com/", "https://www.example.com", false},
+		{"port", "http://localhost:8080", "http://localhost:8080", false},
+		{"uppercase", "HTTPS://WWW.Example.com", "https://www.example.com", false},
+		{"wildcard", "https://*.example.com", "https://*.example.com", false},
+		{"path", "https://www.example.com/blog", "", true},
+		{"query", "https://www.example.com?x=y", "", true},
+		{"scheme", "ftp://www.example.com", "", true},
+		{"no scheme", "www.example.com", "", true},
+		{"inner wildcard", "https://www.*.example.com", "", true},
+		{"bare wildcard", "https://*", "", true},
+		{"separator", "https://example.com;script-src", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := normalizeOrigin(test.origin)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	allowed := []string{"https://www.example.com", "https://*.example.net", "http://localhost:8080"}
+	tests := []struct {
+		origin         string
+		expectedResult bool
+	}{
+		{"https://www.example.com", true},
+		{"https://WWW.example.com", true},
+		{"http://www.example.com", false},
+		{"https://example.com", false},
+		{"https://blog.example.net", true},
+		{"https://a.b.example.net", true},
+		{"https://example.net", false},
+		{"https://badexample.net", false},
+		{"http://localhost:8080", true},
+		{"http://localhost", false},
+		{"null", false},
+	}
+	for _, test := range tests {
+		t.Run(test.origin, func(t *testing.T) {
+			if result := matchOrigin(allowed, test.origin); result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+type mockAccountSettingsService struct {
+	persistence.Service
+	result persistence.AccountResult
+	err    error
+}
+
+func (m *mockAccountSettingsService) GetAccount(context.Context, string, bool, bool, string) (persistence.AccountResult, error) {
+	return m.result, m.err
+}
+
+func (m *mockAccountSettingsService) Insert(context.Context, string, string, string, *string) error {
+	return nil
+}
+
+func TestRouter_checkOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             persistence.Service
+		origin         string
+		expectedStatus int
+	}{
+		{
+			"no origin",
+			&mockAccountSettingsService{},
+			"",
+			http.StatusCreated,
+		},
+		{
+			"own origin",
+			&mockAccountSettingsService{
+				result: persistence.AccountResult{AllowedOrigins: []string{"https://www.example.com"}},
+			},
+			"https://offen.example.com",
+			http.StatusCreated,
+		},
+		{
+			"no allowed origins",
+			&mockAccountSettingsService{},
+			"https://www.example.com",
+			http.StatusCreated,
+		},
+		{
+			"allowed origin",
+			&mockAccountSettingsService{
+				result: persistence.AccountResult{AllowedOrigins: []string{"https://www.example.com"}},
+			},
+			"https://www.example.com",
+			http.StatusCreated,
+		},
+		{
+			"other origin",
+			&mockAccountSettingsService{
+				result: persistence.AccountResult{AllowedOrigins: []string{"https://www.example.com"}},
+			},
+			"https://www.example.net",
+			http.StatusForbidden,
+		},
+		{
+			"unknown account",
+			&mockAccountSettingsService{
+				err: persistence.ErrUnknownAccount("did not work"),
+			},
+			"https://www.example.net",
+			http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db:     test.db,
+				config: &config.Config{},
+			}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.postEvents)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "https://offen.example.com/", strings.NewReader(`{"accountId":"account-a","payload":"{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M"}`))
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+
+			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/events", r, w)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_getVault(t *testing.T) {
+	tests := []struct {
+		name        string
+		db          persistence.Service
+		csp         string
+		expectedCSP string
+	}{
+		{
+			"no allowed origins",
+			&mockAccountSettingsService{},
+			"",
+			"",
+		},
+		{
+			"allowed origins",
+			&mockAccountSettingsService{
+				result: persistence.AccountResult{AllowedOrigins: []string{"https://www.example.com", "https://*.example.net"}},
+			},
+			"",
+			defaultCSP + "; frame-ancestors 'self' https://www.example.com https://*.example.net",
+		},
+		{
+			"configured frame-ancestors",
+			&mockAccountSettingsService{
+				result: persistence.AccountResult{AllowedOrigins: []string{"https://www.example.com", "https://*.example.net"}},
+			},
+			"default-src 'self'; frame-ancestors 'self' https://admin.example.com; img-src 'self' data:;",
+			"default-src 'self'; frame-ancestors 'self' https://admin.example.com https://www.example.com https://*.example.net; img-src 'self' data:",
+		},
+		{
+			"configured frame-ancestors none",
+			&mockAccountSettingsService{
+				result: persistence.AccountResult{AllowedOrigins: []string{"https://www.example.com"}},
+			},
+			"default-src 'self'; Frame-Ancestors 'none'; frame-ancestors https://ignored.example.com",
+			"default-src 'self'; frame-ancestors 'self' https://www.example.com",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Server.ContentSecurityPolicy = test.csp
+			rt := router{
+				db:     test.db,
+				config: cfg,
+			}
+			m := gin.New()
+			m.SetHTMLTemplate(template.Must(template.New("vault").Parse("ok!")))
+			m.GET("/", rt.getVault)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/?accountId=account-a", nil)
+
+			m.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if csp := w.Header().Get("Content-Security-Policy"); csp != test.expectedCSP {
+				t.Errorf("Expected CSP %q, got %q", test.expectedCSP, csp)
+			}
+		})
+	}
+}
+
+func TestRouter_checkIngestionToken(t *testing.T) {
+	cfg := &config.Config{Secret: config.Bytes("secret")}
+	cfg.App.IngestionTokenTTL = time.Hour
+
+	issuer := router{config: cfg}
+	validToken, err := issuer.ingestionToken(ingestionClaims{AccountID: "account-a", UserID: "user-id", Origin: "https://www.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error issuing token: %v", err)
+	}
+	otherToken, _ := issuer.ingestionToken(ingestionClaims{AccountID: "account-b", UserID: "user-id"})
+	otherUserToken, _ := issuer.ingestionToken(ingestionClaims{AccountID: "account-a", UserID: "other-user-id"})
+	unboundToken, _ := issuer.ingestionToken(ingestionClaims{AccountID: "account-a"})
+
+	tests := []struct {
+		name           string
+		config         *config.Config
+		token          string
+		origin         string
+		expectedStatus int
+	}{
+		{"disabled", &config.Config{}, "", "", http.StatusCreated},
+		{"ok", cfg, validToken, "", http.StatusCreated},
+		{"ok from vault", cfg, validToken, "https://offen.example.com", http.StatusCreated},
+		{"ok from origin", cfg, validToken, "https://www.example.com", http.StatusCreated},
+		{"other origin", cfg, validToken, "https://www.example.net", http.StatusForbidden},
+		{"missing", cfg, "", "", http.StatusForbidden},
+		{"bad token", cfg, "abc123", "", http.StatusForbidden},
+		{"other account", cfg, otherToken, "", http.StatusForbidden},
+		{"other user", cfg, otherUserToken, "", http.StatusForbidden},
+		{"unbound", cfg, unboundToken, "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db:     &mockAccountSettingsService{},
+				config: test.config,
+			}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.postEvents)
+
+			body, _ := json.Marshal(map[string]string{
+				"accountId":      "account-a",
+				"payload":        "{1,} Ae2MwPi40sKVmCsSDhlhSVjbX5CMUsJ5CvU= O1RbpLcBVqHDVu+M",
+				"ingestionToken": test.token,
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "https://offen.example.com/", bytes.NewReader(body))
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+
+			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/events", r, w)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_getVault_ingestionToken(t *testing.T) {
+	cfg := &config.Config{Secret: config.Bytes("secret")}
+	cfg.App.IngestionTokenTTL = time.Hour
+
+	tests := []struct {
+		name           string
+		referer        string
+		origin         string
+		cookie         string
+		allowedOrigin  []string
+		expectedClaims *ingestionClaims
+	}{
+		{"no referer", "", "", "", []string{"https://www.example.com"}, nil},
+		{"no referer without allowed origins", "", "", "", nil, &ingestionClaims{AccountID: "account-a"}},
+		{"allowed referer", "https://www.example.com/blog/", "", "", []string{"https://www.example.com"}, &ingestionClaims{AccountID: "account-a", Origin: "https://www.example.com"}},
+		{"allowed origin", "", "https://www.example.com", "", []string{"https://www.example.com"}, &ingestionClaims{AccountID: "account-a", Origin: "https://www.example.com"}},
+		{"instance", "https://offen.example.com/auditorium/", "", "", []string{"https://www.example.com"}, &ingestionClaims{AccountID: "account-a", Origin: "https://offen.example.com"}},
+		{"user cookie", "https://www.example.com/", "", "user-id", []string{"https://www.example.com"}, &ingestionClaims{AccountID: "account-a", UserID: "user-id", Origin: "https://www.example.com"}},
+		{"other referer", "https://www.example.net/", "", "", []string{"https://www.example.com"}, nil},
+		{"no allowed origins", "https://www.example.net/", "", "", nil, &ingestionClaims{AccountID: "account-a", Origin: "https://www.example.net"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db: &mockAccountSettingsService{
+					result: persistence.AccountResult{AllowedOrigins: test.allowedOrigin},
+				},
+				config: cfg,
+			}
+			m := gin.New()
+			m.SetHTMLTemplate(template.Must(template.New("vault").Parse("{{ .ingestionToken }}")))
+			m.GET("/", rt.getVault)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://offen.example.com/?accountId=account-a", nil)
+			if test.referer != "" {
+				r.Header.Set("Referer", test.referer)
+			}
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: cookieKey, Value: test.cookie})
+			}
+
+			m.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedClaims == nil {
+				if w.Body.Len() != 0 {
+					t.Errorf("Expected no token to be issued, got %s", w.Body.String())
+				}
+				return
+			}
+			var claims ingestionClaims
+			if err := rt.getTokenSigner().Decode(ingestionTokenKey, w.Body.String(), &claims); err != nil {
+				t.Fatalf("Unexpected error decoding token: %v", err)
+			}
+			if claims != *test.expectedClaims {
+				t.Errorf("Expected claims %v, got %v", *test.expectedClaims, claims)
+			}
+		})
+	}
+}
+
+func TestRouter_postIngestionToken(t *testing.T) {
+	cfg := &config.Config{Secret: config.Bytes("secret")}
+	cfg.App.IngestionTokenTTL = time.Hour
+
+	issuer := router{config: cfg}
+	unboundToken, _ := issuer.ingestionToken(ingestionClaims{AccountID: "account-a", Origin: "https://www.example.com"})
+	boundToken, _ := issuer.ingestionToken(ingestionClaims{AccountID: "account-a", UserID: "user-id", Origin: "https://www.example.com"})
+	otherUserToken, _ := issuer.ingestionToken(ingestionClaims{AccountID: "account-a", UserID: "other-user-id"})
+	otherAccountToken, _ := issuer.ingestionToken(ingestionClaims{AccountID: "account-b"})
+
+	tests := []struct {
+		name           string
+		config         *config.Config
+		token          string
+		origin         string
+		expectedStatus int
+	}{
+		{"disabled", &config.Config{}, unboundToken, "", http.StatusNotFound},
+		{"unbound", cfg, unboundToken, "", http.StatusOK},
+		{"bound", cfg, boundToken, "https://offen.example.com", http.StatusOK},
+		{"other origin", cfg, boundToken, "https://www.example.net", http.StatusForbidden},
+		{"other user", cfg, otherUserToken, "", http.StatusForbidden},
+		{"other account", cfg, otherAccountToken, "", http.StatusForbidden},
+		{"bad token", cfg, "abc123", "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db:     &mockAccountSettingsService{},
+				config: test.config,
+			}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.postIngestionToken)
+
+			body, _ := json.Marshal(map[string]string{
+				"accountId":      "account-a",
+				"ingestionToken": test.token,
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "https://offen.example.com/", bytes.NewReader(body))
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+
+			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/ingestion-token", r, w)
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response ingestionTokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if response.ExpiresIn != 3600 {
+				t.Errorf("Unexpected expiry %d", response.ExpiresIn)
+			}
+			var claims ingestionClaims
+			if err := rt.getTokenSigner().Decode(ingestionTokenKey, response.IngestionToken, &claims); err != nil {
+				t.Fatalf("Unexpected error decoding token: %v", err)
+			}
+			if expected := (ingestionClaims{AccountID: "account-a", UserID: "user-id", Origin: "https://www.example.com"}); claims != expected {
+				t.Errorf("Expected claims %v, got %v", expected, claims)
+			}
+		})
+	}
+}
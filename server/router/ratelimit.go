@@ -0,0 +1,150 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/ratelimiter"
+	"github.com/offen/offen/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type rateLimit struct {
+	threshold   time.Duration
+	exponential bool
+}
+
+// defaultRateLimits defines the minimum interval between two calls of each
+// rate limited operation. Operations suffixed with `-*` are limited globally,
+// all others per user, account or email address. Thresholds can be overridden
+// using configuration.
+var defaultRateLimits = map[string]rateLimit{
+	"getAccount":               {time.Second, false},
+	"deleteAccount":            {time.Second, false},
+	"postAccount":              {time.Second * 5, false},
+	"postEvents":               {time.Second / 2, false},
+	"postEventsBatch":          {time.Second, false},
+	"postIngestionToken":       {time.Second, false},
+	"getEvents":                {time.Second, false},
+	"purgeEvents":              {time.Second, false},
+	"postUserSecret":           {time.Second, false},
+	"postLogin":                {time.Second, true},
+	"postLogin-*":              {time.Second / 2, false},
+	"postChangePassword":       {time.Second * 5, false},
+	"postChangeEmail":          {time.Second * 5, false},
+	"postForgotPassword":       {time.Second * 5, true},
+	"postForgotPassword-*":     {time.Second, false},
+	"postResetPassword":        {time.Second * 5, true},
+	"putAccountStyles":         {time.Second, true},
+	"putAccountAllowedOrigins": {time.Second, true},
+	"postShareAccount":         {time.Second, true},
+	"getStream":                {time.Second, true},
+	"postJoin":                 {time.Second, true},
+	"postJoin-*":               {time.Second / 2, false},
+	"postSetup-*":              {time.Second * 5, false},
+}
+
+// fallbackRateLimit is applied to operations that do not define a rate
+// limit, using the strictest of the default values.
+var fallbackRateLimit = rateLimit{time.Second * 5, true}
+
+// unknownRateLimits returns the sorted names of all operations in the given
+// configuration that do not define a rate limit.
+func unknownRateLimits(c *config.Config) []string {
+	var unknown []string
+	if c == nil {
+		return unknown
+	}
+	for operation := range c.Server.RateLimits {
+		if _, ok := defaultRateLimits[operation]; !ok {
+			unknown = append(unknown, operation)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func (rt *router) rateLimit(operation string) rateLimit {
+	limit, ok := defaultRateLimits[operation]
+	if !ok {
+		// configured thresholds are ignored for unknown operations, so
+		// a typo in the configuration cannot lift the limit
+		rt.logError(
+			fmt.Errorf("router: no rate limit defined for %s", operation),
+			"falling back to default rate limit",
+		)
+		return fallbackRateLimit
+	}
+	if c := rt.settings().config; c != nil {
+		if threshold, ok := c.Server.RateLimits[operation]; ok {
+			limit.threshold = threshold
+		}
+	}
+	return limit
+}
+
+// throttle applies the rate limit for the given operation. In case identifier
+// is empty, the limit is applied globally. When the request is not allowed to
+// proceed, an error response is written and false is returned.
+func (rt *router) throttle(c *gin.Context, operation, identifier string) bool {
+	limit := rt.rateLimit(operation)
+	key := operation
+	if identifier != "" {
+		key = fmt.Sprintf("%s-%s", operation, identifier)
+	}
+
+	// the span only records the operation as the key contains identifiers
+	_, span := tracing.Start(
+		c.Request.Context(), "router.throttle",
+		attribute.String("offen.operation", operation),
+	)
+	var result ratelimiter.Result
+	if limit.exponential {
+		result = <-rt.getLimiter().ExponentialThrottle(limit.threshold, key)
+	} else {
+		result = <-rt.getLimiter().LinearThrottle(limit.threshold, key)
+	}
+	// requests being limited is expected, so only failures of the limiter
+	// itself mark the span as failed
+	limited := errors.Is(result.Error, ratelimiter.ErrRateLimited)
+	span.SetAttributes(attribute.Bool("offen.rate_limited", limited))
+	if limited {
+		span.End()
+	} else {
+		tracing.End(span, result.Error)
+	}
+
+	if result.Limit > 0 {
+		c.Header("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		c.Header("RateLimit-Reset", seconds(result.Reset))
+	}
+
+	if result.Error != nil {
+		if errors.Is(result.Error, ratelimiter.ErrRateLimited) {
+			c.Header("Retry-After", seconds(result.Delay))
+		}
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", result.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return false
+	}
+	return true
+}
+
+// seconds formats the given duration as a number of seconds, rounded up
+// so clients never retry too early.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
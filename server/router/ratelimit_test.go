@@ -0,0 +1,197 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRouter_rateLimit(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.RateLimits = config.RateLimits{"postEvents": time.Millisecond}
+	rt := router{config: cfg}
+	if limit := rt.rateLimit("postEvents"); limit.threshold != time.Millisecond {
+		t.Errorf("Expected configured threshold to be used, got %v", limit.threshold)
+	}
+	if limit := rt.rateLimit("postLogin"); limit.threshold != time.Second || !limit.exponential {
+		t.Errorf("Expected default threshold to be used, got %v", limit)
+	}
+
+	cfg.Server.RateLimits["postEvnets"] = time.Millisecond
+	if limit := rt.rateLimit("postEvnets"); limit != fallbackRateLimit {
+		t.Errorf("Expected fallback to be used for unknown operation, got %v", limit)
+	}
+	if unknown := unknownRateLimits(cfg); !reflect.DeepEqual(unknown, []string{"postEvnets"}) {
+		t.Errorf("Unexpected unknown operations %v", unknown)
+	}
+}
+
+// TestRouter_throttleOperations makes sure all operations passed to throttle
+// define a rate limit, so none of them silently uses the fallback.
+func TestRouter_throttleOperations(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	fset := token.NewFileSet()
+	var found int
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 3 {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "throttle" {
+				return true
+			}
+			lit, ok := call.Args[1].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				t.Errorf("%s: expected operation to be a string literal", fset.Position(call.Pos()))
+				return true
+			}
+			operation, _ := strconv.Unquote(lit.Value)
+			if _, ok := defaultRateLimits[operation]; !ok {
+				t.Errorf("%s: no rate limit defined for %s", fset.Position(call.Pos()), operation)
+			}
+			found++
+			return true
+		})
+	}
+	if found == 0 {
+		t.Error("Expected to find calls to throttle")
+	}
+}
+
+func TestRouter_throttle(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Server.RateLimitMode = "reject"
+		cfg.Server.RateLimitBurst = 1
+		rt := router{config: cfg}
+		m := gin.New()
+		m.POST("/", func(c *gin.Context) {
+			if !rt.throttle(c, "postSetup-*", "") {
+				return
+			}
+			c.Status(http.StatusNoContent)
+		})
+
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if h := w.Header().Get("RateLimit-Limit"); h != "1" {
+			t.Errorf("Unexpected RateLimit-Limit header %v", h)
+		}
+		if h := w.Header().Get("RateLimit-Remaining"); h != "0" {
+			t.Errorf("Unexpected RateLimit-Remaining header %v", h)
+		}
+
+		w = httptest.NewRecorder()
+		start := time.Now()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		if time.Since(start) > time.Second {
+			t.Error("Expected request to be rejected without delay")
+		}
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if h := w.Header().Get("Retry-After"); h != "5" {
+			t.Errorf("Unexpected Retry-After header %v", h)
+		}
+		if h := w.Header().Get("RateLimit-Reset"); h != "5" {
+			t.Errorf("Unexpected RateLimit-Reset header %v", h)
+		}
+	})
+	t.Run("delay", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Server.RateLimits = config.RateLimits{"postSetup-*": time.Millisecond * 10}
+		rt := router{config: cfg}
+		m := gin.New()
+		m.POST("/", func(c *gin.Context) {
+			if !rt.throttle(c, "postSetup-*", "") {
+				return
+			}
+			c.Status(http.StatusNoContent)
+		})
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+			if w.Code != http.StatusNoContent {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if h := w.Header().Get("RateLimit-Limit"); h != "" {
+				t.Errorf("Unexpected RateLimit-Limit header %v", h)
+			}
+		}
+	})
+}
+
+func TestRouter_throttle_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	cfg := &config.Config{}
+	cfg.Server.RateLimitMode = "reject"
+	cfg.Server.RateLimitBurst = 1
+	rt := router{config: cfg}
+	m := gin.New()
+	m.POST("/", func(c *gin.Context) {
+		if !rt.throttle(c, "postEvents", "some-user") {
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	for i := 0; i < 2; i++ {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Unexpected number of spans %d", len(spans))
+	}
+	for i, span := range spans {
+		if span.Name() != "router.throttle" {
+			t.Errorf("Unexpected span name %v", span.Name())
+		}
+		if span.Status().Code == codes.Error {
+			t.Errorf("Expected span %d not to be marked as failed", i)
+		}
+		for _, attr := range span.Attributes() {
+			if strings.Contains(attr.Value.Emit(), "some-user") {
+				t.Errorf("Unexpected identifier in attribute %v", attr)
+			}
+			if attr.Key == "offen.rate_limited" && attr.Value.AsBool() != (i == 1) {
+				t.Errorf("Unexpected rate limited attribute on span %d", i)
+			}
+		}
+	}
+}
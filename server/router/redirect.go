@@ -0,0 +1,52 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewRedirect creates a handler that redirects all requests to the same
+// location using HTTPS on the given port.
+func NewRedirect(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			// IPv6 hosts without a port are still wrapped in brackets,
+			// which JoinHostPort would add a second time
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if host == "" {
+			http.Error(w, "router: unable to redirect request without host", http.StatusBadRequest)
+			return
+		}
+		switch port {
+		case "", "443", "https":
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+		default:
+			host = net.JoinHostPort(host, port)
+		}
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawPath:  r.URL.RawPath,
+			RawQuery: r.URL.RawQuery,
+		}
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// clients are expected to repeat the request using the same
+			// method and body
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, target.String(), status)
+	})
+}
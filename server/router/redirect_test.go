@@ -0,0 +1,41 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRedirect(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		port             string
+		method           string
+		target           string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"default port", "443", http.MethodGet, "http://offen.example.com/auditorium/?a=b", http.StatusMovedPermanently, "https://offen.example.com/auditorium/?a=b"},
+		{"named port", "https", http.MethodHead, "http://offen.example.com:80/", http.StatusMovedPermanently, "https://offen.example.com/"},
+		{"custom port", "8443", http.MethodGet, "http://offen.example.com:8080/vault", http.StatusMovedPermanently, "https://offen.example.com:8443/vault"},
+		{"post", "443", http.MethodPost, "http://offen.example.com/api/events", http.StatusPermanentRedirect, "https://offen.example.com/api/events"},
+		{"ipv6", "8443", http.MethodGet, "http://[::1]:8080/", http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"ipv6 without port", "8443", http.MethodGet, "http://[::1]/", http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"ipv6 default port", "443", http.MethodGet, "http://[::1]:8080/", http.StatusMovedPermanently, "https://[::1]/"},
+		{"ipv6 without port default port", "443", http.MethodGet, "http://[::1]/", http.StatusMovedPermanently, "https://[::1]/"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewRedirect(test.port).ServeHTTP(w, httptest.NewRequest(test.method, test.target, nil))
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != test.expectedLocation {
+				t.Errorf("Expected location %s, got %s", test.expectedLocation, location)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/mailer"
+)
+
+// ReloadableSettings lists the configuration values that are applied by
+// Reloader.Reload. Changes to any other value require a restart.
+var ReloadableSettings = map[string]bool{
+	"OFFEN_SERVER_RATELIMITS":              true,
+	"OFFEN_SERVER_CONTENTSECURITYPOLICY":   true,
+	"OFFEN_SERVER_STRICTTRANSPORTSECURITY": true,
+	"OFFEN_SERVER_PERMISSIONSPOLICY":       true,
+	"OFFEN_APP_RETENTION":                  true,
+	"OFFEN_SMTP_AUTHTYPE":                  true,
+	"OFFEN_SMTP_USER":                      true,
+	"OFFEN_SMTP_PASSWORD":                  true,
+	"OFFEN_SMTP_HOST":                      true,
+	"OFFEN_SMTP_PORT":                      true,
+	"OFFEN_SMTP_SENDER":                    true,
+	"OFFEN_SMTP_IMPLICITTLS":               true,
+	"OFFEN_SMTP_STARTTLS":                  true,
+	"OFFEN_SMTP_ROOTCA":                    true,
+	"OFFEN_SMTP_TIMEOUT":                   true,
+	"OFFEN_SMTP_POOLSIZE":                  true,
+	"OFFEN_SMTP_IDLETIMEOUT":               true,
+}
+
+// reloadable contains the settings that can be replaced while the router
+// is serving requests. Only the values listed in ReloadableSettings are read
+// from config.
+type reloadable struct {
+	config *config.Config
+	mailer mailer.Mailer
+	// inUse is held for reading while the mailer is being used, so it can
+	// be retired once all pending usages are done
+	inUse   sync.RWMutex
+	retired bool
+}
+
+// retire waits until the mailer is not in use anymore and makes sure it is
+// not used again.
+func (r *reloadable) retire() {
+	r.inUse.Lock()
+	defer r.inUse.Unlock()
+	r.retired = true
+}
+
+// Reloader applies changes in the runtime configuration to all routers that
+// have been created using WithReloader.
+type Reloader struct {
+	mu      sync.Mutex
+	routers []*router
+}
+
+// Reload atomically replaces the mailer and the values listed in
+// ReloadableSettings for all attached routers. It returns once the previous
+// mailer is not used by any of the routers anymore, so it can safely be
+// closed afterwards.
+func (r *Reloader) Reload(c *config.Config, m mailer.Mailer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rt := range r.routers {
+		previous := rt.settings()
+		rt.live.Store(&reloadable{config: c, mailer: m})
+		previous.retire()
+	}
+}
+
+func (r *Reloader) attach(rt *router) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routers = append(r.routers, rt)
+}
+
+// WithReloader allows changing settings of the router after it has been
+// created by calling Reload on the given Reloader.
+func WithReloader(r *Reloader) Config {
+	return func(rt *router) {
+		r.attach(rt)
+	}
+}
+
+// settings returns the settings that have been applied most recently,
+// falling back to the values the router has been created with.
+func (rt *router) settings() *reloadable {
+	if s := rt.live.Load(); s != nil {
+		return s
+	}
+	rt.live.CompareAndSwap(nil, &reloadable{config: rt.config, mailer: rt.mailer})
+	return rt.live.Load()
+}
+
+func (rt *router) getMailer() mailer.Mailer {
+	return rt.settings().mailer
+}
+
+// useMailer returns the current settings, making sure their mailer is not
+// closed before the returned function has been called.
+func (rt *router) useMailer() (*reloadable, func()) {
+	for {
+		s := rt.settings()
+		s.inUse.RLock()
+		if !s.retired {
+			return s, s.inUse.RUnlock
+		}
+		// the settings have been replaced in the meantime
+		s.inUse.RUnlock()
+	}
+}
+
+// retention returns the name of the preset that matches the configured
+// retention period, which is what clients expect to be given.
+func (rt *router) retention() string {
+	if c := rt.settings().config; c != nil && c.App.Retention.Duration() != 0 {
+		return c.App.Retention.Preset()
+	}
+	return ""
+}
+
+// retentionPeriod returns the duration for which events are kept, falling
+// back to the package default in case no retention is configured.
+func (rt *router) retentionPeriod() time.Duration {
+	if c := rt.settings().config; c != nil && c.App.Retention.Duration() != 0 {
+		return c.App.Retention.Duration()
+	}
+	return config.EventRetention
+}
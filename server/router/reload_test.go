@@ -0,0 +1,109 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/config"
+)
+
+func TestReloader_Reload(t *testing.T) {
+	initial := &config.Config{}
+	initial.App.Retention.Decode("6months")
+	initialMailer := &mockMailer{}
+	rt := &router{config: initial, mailer: initialMailer}
+
+	reloader := &Reloader{}
+	WithReloader(reloader)(rt)
+
+	if rt.getMailer() != initialMailer {
+		t.Error("Expected initial mailer to be used before reloading")
+	}
+	if h := rt.securityHeaders(); h.ContentSecurityPolicy != defaultCSP {
+		t.Errorf("Unexpected CSP %v", h.ContentSecurityPolicy)
+	}
+	if limit := rt.rateLimit("postLogin"); limit.threshold != defaultRateLimits["postLogin"].threshold {
+		t.Errorf("Unexpected rate limit %v", limit.threshold)
+	}
+
+	next := &config.Config{}
+	next.App.Retention.Decode("7days")
+	next.Server.ContentSecurityPolicy = "default-src 'none'"
+	next.Server.RateLimits = config.RateLimits{"postLogin": time.Minute}
+	nextMailer := &mockMailer{err: errors.New("did not work")}
+	reloader.Reload(next, nextMailer)
+
+	if rt.getMailer() != nextMailer {
+		t.Error("Expected reloaded mailer to be used")
+	}
+	if h := rt.securityHeaders(); h.ContentSecurityPolicy != "default-src 'none'" {
+		t.Errorf("Unexpected CSP %v", h.ContentSecurityPolicy)
+	}
+	if limit := rt.rateLimit("postLogin"); limit.threshold != time.Minute {
+		t.Errorf("Unexpected rate limit %v", limit.threshold)
+	}
+	if retention := rt.retention(); retention != "7days" {
+		t.Errorf("Unexpected retention %v", retention)
+	}
+	if period := rt.retentionPeriod(); period != time.Hour*24*7 {
+		t.Errorf("Unexpected retention period %v", period)
+	}
+	// the configuration the router has been created with is not modified
+	if initial.Server.ContentSecurityPolicy != "" {
+		t.Errorf("Unexpected modification of initial config %v", initial.Server.ContentSecurityPolicy)
+	}
+}
+
+type blockingMailer struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (m *blockingMailer) Send(from, to, subject, body string) error {
+	close(m.started)
+	<-m.unblock
+	return nil
+}
+
+func TestReloader_Reload_pendingSend(t *testing.T) {
+	initialMailer := &blockingMailer{started: make(chan struct{}), unblock: make(chan struct{})}
+	rt := &router{config: &config.Config{}, mailer: initialMailer}
+	reloader := &Reloader{}
+	WithReloader(reloader)(rt)
+
+	sent := make(chan error)
+	go func() {
+		sent <- rt.sendMail("me@offen.dev", "subject", "body")
+	}()
+	<-initialMailer.started
+
+	reloaded := make(chan struct{})
+	nextMailer := &mockMailer{}
+	go func() {
+		reloader.Reload(&config.Config{}, nextMailer)
+		close(reloaded)
+	}()
+
+	select {
+	case <-reloaded:
+		t.Fatal("Expected reload to wait for pending message")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(initialMailer.unblock)
+	if err := <-sent; err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for reload")
+	}
+	if rt.getMailer() != nextMailer {
+		t.Error("Expected reloaded mailer to be used")
+	}
+}
@@ -5,22 +5,21 @@ package router
 
 import (
 	"errors"
-	"fmt"
 	"html/template"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/NYTimes/gziphandler"
-	"github.com/felixge/httpsnoop"
-	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/metrics"
 	"github.com/offen/offen/server/persistence"
 	ratelimiter "github.com/offen/offen/server/ratelimiter"
+	"github.com/offen/offen/server/stream"
 	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
 )
@@ -30,21 +29,39 @@ type router struct {
 	mailer       mailer.Mailer
 	fs           http.FileSystem
 	logger       *logrus.Logger
+	accessLogger *logrus.Logger
 	cookieSigner *securecookie.SecureCookie
+	tokenSigner  *securecookie.SecureCookie
 	template     *template.Template
 	emails       *template.Template
 	config       *config.Config
 	sanitizer    *bluemonday.Policy
 	limiter      ratelimiter.Throttler
+	limitStore   ratelimiter.Store
 	cache        *cache.Cache
+	metrics      *metrics.Metrics
+	broadcaster  *stream.Broadcaster
+	// live contains settings that have been reloaded after the router has
+	// been created
+	live atomic.Pointer[reloadable]
+
+	readinessChecks []ReadinessCheck
+	// internal is set for routers serving the internal listener only
+	internal bool
 }
 
 func (rt *router) getLimiter() ratelimiter.Throttler {
 	if rt.limiter == nil {
-		if rt.config != nil && rt.config.Server.ReverseProxy {
+		var opts []ratelimiter.Option
+		if rt.config != nil && rt.config.Server.RateLimitMode.Reject() {
+			opts = append(opts, ratelimiter.NonBlocking(rt.config.Server.RateLimitBurst))
+		}
+		if rt.config != nil && rt.config.Server.RateLimitStore.Disabled() {
 			rt.limiter = ratelimiter.NewNoopRateLimiter()
+		} else if rt.limitStore != nil {
+			rt.limiter = ratelimiter.NewWithStore(time.Second*30, rt.limitStore, rt.config.Secret.Bytes(), opts...)
 		} else {
-			rt.limiter = ratelimiter.New(time.Second*30, cache.New(time.Minute, time.Minute*2))
+			rt.limiter = ratelimiter.New(time.Second*30, cache.New(time.Minute, time.Minute*2), opts...)
 		}
 	}
 	return rt.limiter
@@ -57,6 +74,25 @@ func (rt *router) getCache() *cache.Cache {
 	return rt.cache
 }
 
+// getTokenSigner returns the signer used for ingestion tokens. It is not
+// shared with cookieSigner as setting MaxAge modifies the signer in place.
+func (rt *router) getTokenSigner() *securecookie.SecureCookie {
+	if rt.tokenSigner == nil {
+		rt.tokenSigner = securecookie.New(rt.config.Secret.Bytes(), nil).
+			MaxAge(int(rt.config.App.IngestionTokenTTL.Seconds()))
+	}
+	return rt.tokenSigner
+}
+
+// sendMail sends a transactional email using the configured sender address
+func (rt *router) sendMail(to, subject, body string) error {
+	s, done := rt.useMailer()
+	defer done()
+	err := s.mailer.Send(s.config.SMTP.Sender, to, subject, body)
+	rt.metrics.ObserveMail(err)
+	return err
+}
+
 func (rt *router) logError(err error, message string) {
 	sanitizedErrorMessage := strings.ReplaceAll(err.Error(), "\n", " ")
 	if rt.logger != nil {
@@ -90,7 +126,7 @@ func (rt *router) userCookie(userID string, secure bool) *http.Cookie {
 		Path:     "/api",
 	}
 	if userID != "" {
-		c.Expires = time.Now().Add(config.EventRetention)
+		c.Expires = time.Now().Add(rt.retentionPeriod())
 	}
 	return c
 }
@@ -133,6 +169,14 @@ func WithLogger(l *logrus.Logger) Config {
 	}
 }
 
+// WithAccessLogger sets the logger the router will use for logging
+// handled requests
+func WithAccessLogger(l *logrus.Logger) Config {
+	return func(r *router) {
+		r.accessLogger = l
+	}
+}
+
 // WithTemplate ensures the router is using the given template object
 // for rendering dynamic HTML output.
 func WithTemplate(t *template.Template) Config {
@@ -170,6 +214,37 @@ func WithMailer(m mailer.Mailer) Config {
 	}
 }
 
+// WithMetrics attaches a collector for operational metrics
+func WithMetrics(m *metrics.Metrics) Config {
+	return func(r *router) {
+		r.metrics = m
+	}
+}
+
+// WithRateLimitStore makes the router keep the state of rate limits in the
+// given store instead of process-local memory.
+func WithRateLimitStore(s ratelimiter.Store) Config {
+	return func(r *router) {
+		r.limitStore = s
+	}
+}
+
+// WithBroadcaster enables live updates for dashboards, sending all changes
+// distributed by the given broadcaster to subscribed clients.
+func WithBroadcaster(b *stream.Broadcaster) Config {
+	return func(r *router) {
+		r.broadcaster = b
+	}
+}
+
+// WithReadinessChecks adds checks to be run when readiness is requested, in
+// addition to the default checks for the database and its migrations.
+func WithReadinessChecks(checks ...ReadinessCheck) Config {
+	return func(r *router) {
+		r.readinessChecks = append(r.readinessChecks, checks...)
+	}
+}
+
 // New creates a new application router that reads and writes data
 // to the given database implementation. In the context of the application
 // this expects to be the only top level router in charge of handling all
@@ -181,7 +256,13 @@ func New(opts ...Config) http.Handler {
 	}
 
 	rt.sanitizer = bluemonday.StrictPolicy()
+	for _, operation := range unknownRateLimits(rt.config) {
+		if rt.logger != nil {
+			rt.logger.Warnf("Ignoring rate limit for unknown operation %s", operation)
+		}
+	}
 	rt.cookieSigner = securecookie.New(rt.config.Secret.Bytes(), nil)
+	rt.getTokenSigner()
 
 	optin := optinMiddleware(optinKey, optinValue)
 	userCookie := userCookieMiddleware(cookieKey, contextKeyCookie)
@@ -194,7 +275,10 @@ func New(opts ...Config) http.Handler {
 
 	csp := headerMiddleware(map[string]func() string{
 		"Content-Security-Policy": func() string {
-			return defaultCSP
+			return rt.securityHeaders().ContentSecurityPolicy
+		},
+		"Permissions-Policy": func() string {
+			return rt.securityHeaders().PermissionsPolicy
 		},
 	})
 	etag := etagMiddleware()
@@ -205,14 +289,35 @@ func New(opts ...Config) http.Handler {
 
 	app := gin.New()
 	app.SetHTMLTemplate(rt.template)
+	// only trusted proxies are allowed to pass the client's address,
+	// gin would otherwise trust all proxies by default
+	if err := app.SetTrustedProxies(rt.config.Server.TrustedProxies.Strings()); err != nil {
+		rt.logError(err, "error setting trusted proxies")
+	}
 	app.Use(
 		gin.Recovery(),
-		location.Default(),
-		secureContextMiddleware(contextKeySecureContext, rt.config.App.Development),
+		secureContextMiddleware(contextKeySecureContext, rt.config.App.Development, rt.config.Server.TrustedProxies),
 	)
+	if rt.config.Tracing.Exporter != "" {
+		app.Use(tracingMiddleware())
+	}
+	if rt.accessLogger != nil && rt.config.Server.AccessLog {
+		app.Use(accessLogMiddleware(rt.accessLogger))
+	}
+	if rt.metrics != nil {
+		app.Use(metricsMiddleware(rt.metrics))
+	}
 
-	app.Any("/healthz", noStore, rt.getHealth)
-	app.GET("/versionz", noStore, rt.getVersion)
+	// in case an internal listener is used, routes for operating the
+	// application are not exposed publicly
+	if rt.config.Server.InternalListen.IsZero() {
+		rt.internalRoutes(app, rt.config.Server.MetricsPort == 0)
+	}
+
+	if rt.config.App.Development {
+		app.GET("/_dev/mailbox", noStore, rt.getMailbox)
+		app.GET("/_dev/mailbox/:messageID", noStore, rt.getMailboxMessage)
+	}
 
 	app.GET("/vault", etag, csp, rt.getVault)
 	if rt.config.App.DemoAccount != "" {
@@ -222,62 +327,71 @@ func New(opts ...Config) http.Handler {
 	{
 		api := app.Group("/api")
 		api.Use(noStore)
+		if rt.config.Server.ReverseProxy {
+			// reverse proxies are expected to compress static assets, but
+			// commonly do not compress dynamic API responses
+			api.Use(compressMiddleware())
+		}
+		api.GET("/openapi.json", rt.getOpenAPIDocument)
 		api.GET("/exchange", rt.getPublicKey)
 		api.POST("/exchange", rt.postUserSecret)
 
-		api.GET("/accounts/:accountID", accountAuth, rt.getAccount)
-		api.DELETE("/accounts/:accountID", accountAuth, rt.deleteAccount)
-		api.PUT("/accounts/:accountID/account-styles", accountAuth, rt.putAccountStyles)
-		api.POST("/accounts", accountAuth, rt.postAccount)
+		// routes used by operators in the Auditorium can be restricted to
+		// clients presenting a verified certificate
+		operator := api.Group("")
+		if rt.config.Server.SSLClientCA != "" {
+			operator.Use(clientCertificateMiddleware())
+		}
+
+		operator.GET("/accounts/:accountID", accountAuth, rt.getAccount)
+		operator.DELETE("/accounts/:accountID", accountAuth, rt.deleteAccount)
+		operator.PUT("/accounts/:accountID/account-styles", accountAuth, rt.putAccountStyles)
+		operator.PUT("/accounts/:accountID/allowed-origins", accountAuth, rt.putAccountAllowedOrigins)
+		operator.POST("/accounts", accountAuth, rt.postAccount)
+		operator.GET("/stream", accountAuth, rt.getStream)
 
 		api.POST("/purge", userCookie, rt.purgeEvents)
 
-		api.GET("/login", accountAuth, rt.getLogin)
-		api.POST("/login", rt.postLogin)
-		api.POST("/logout", rt.postLogout)
+		operator.GET("/login", accountAuth, rt.getLogin)
+		operator.POST("/login", rt.postLogin)
+		operator.POST("/logout", rt.postLogout)
 
-		api.POST("/change-password", accountAuth, rt.postChangePassword)
-		api.POST("/change-email", accountAuth, rt.postChangeEmail)
-		api.POST("/forgot-password", rt.postForgotPassword)
-		api.POST("/reset-password", rt.postResetPassword)
-		api.POST("/share-account/:accountID", accountAuth, rt.postShareAccount)
-		api.POST("/share-account", accountAuth, rt.postShareAccount)
-		api.POST("/join", rt.postJoin)
-		api.GET("/setup", rt.getSetup)
-		api.POST("/setup", rt.postSetup)
+		operator.POST("/change-password", accountAuth, rt.postChangePassword)
+		operator.POST("/change-email", accountAuth, rt.postChangeEmail)
+		operator.POST("/forgot-password", rt.postForgotPassword)
+		operator.POST("/reset-password", rt.postResetPassword)
+		operator.POST("/share-account/:accountID", accountAuth, rt.postShareAccount)
+		operator.POST("/share-account", accountAuth, rt.postShareAccount)
+		operator.POST("/join", rt.postJoin)
+		operator.GET("/setup", rt.getSetup)
+		operator.POST("/setup", rt.postSetup)
 
 		api.GET("/events", userCookie, rt.getEvents)
 		api.POST("/events", optin, userCookie, rt.postEvents)
+		api.POST("/events/batch", optin, userCookie, rt.postEventsBatch)
+		api.POST("/events/beacon", optin, userCookie, rt.postEventBeacon)
+		api.POST("/ingestion-token", optin, userCookie, rt.postIngestionToken)
 	}
 
 	root := gin.New()
 	root.SetHTMLTemplate(rt.template)
 	root.GET("/*any", etag, csp, rt.getIndex)
 
-	app.Use(staticMiddleware(http.FileServer(rt.fs), root))
+	assets, err := newAssetIndex(rt.fs)
+	if err != nil {
+		if rt.logger != nil {
+			rt.logger.WithError(err).Error("Error indexing static assets, no static assets will be served")
+		}
+		assets, _ = newAssetIndex(nil)
+	}
+	go assets.precompress()
+	app.Use(staticMiddleware(assets, root, rt.securityHeaders))
 
 	if rt.config.Server.ReverseProxy {
 		return app
 	}
 
-	withGzip := gziphandler.GzipHandler(app)
-	// HTTP logging is only added when the reverse proxy setting is not
-	// enabled
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		metrics := httpsnoop.CaptureMetrics(withGzip, w, r)
-		fmt.Printf(
-			"%s %s %s [%s] \"%s %s %s\" %d %s\n",
-			"-",
-			"-",
-			"-",
-			time.Now().Format("02/Jan/2006:15:04:05 -0700"),
-			r.Method,
-			r.RequestURI,
-			r.Proto,
-			anonymizeStatusCode(metrics.Code),
-			"-",
-		)
-	})
+	return compressHandler(app)
 }
 
 // anonymizeStatusCode turns all non-error status codes into http.StatusOK
@@ -4,13 +4,16 @@
 package router
 
 import (
+	"context"
 	"html/template"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
 type mockDatabase struct {
@@ -29,3 +32,42 @@ func TestNew(t *testing.T) {
 		WithTemplate(template.New("a test")),
 	)
 }
+
+type mockRateLimitStore struct {
+	updates int
+}
+
+func (m *mockRateLimitStore) Update(ctx context.Context, key string, fn func(*ratelimiter.State) (*ratelimiter.State, error)) error {
+	m.updates++
+	_, err := fn(nil)
+	return err
+}
+
+func TestRouter_getLimiter(t *testing.T) {
+	t.Run("reverse proxy", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Server.ReverseProxy = true
+		rt := router{config: cfg}
+		if _, ok := rt.getLimiter().(*ratelimiter.Limiter); !ok {
+			t.Errorf("Unexpected limiter %T", rt.getLimiter())
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Server.RateLimitStore = "none"
+		rt := router{config: cfg, limitStore: &mockRateLimitStore{}}
+		if _, ok := rt.getLimiter().(*ratelimiter.NoopRatelimiter); !ok {
+			t.Errorf("Unexpected limiter %T", rt.getLimiter())
+		}
+	})
+	t.Run("shared store", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Server.ReverseProxy = true
+		store := &mockRateLimitStore{}
+		rt := router{config: cfg, limitStore: store}
+		<-rt.getLimiter().LinearThrottle(time.Second, "identifier")
+		if store.updates != 1 {
+			t.Errorf("Expected store to be used, got %d updates", store.updates)
+		}
+	})
+}
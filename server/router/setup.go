@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"html"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
@@ -15,7 +14,7 @@ import (
 )
 
 func (rt *router) getSetup(c *gin.Context) {
-	if !rt.db.ProbeEmpty() {
+	if !rt.db.ProbeEmpty(c.Request.Context()) {
 		c.JSON(http.StatusForbidden, nil)
 	}
 	c.Status(http.StatusNoContent)
@@ -37,11 +36,7 @@ func (rt *router) postSetup(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, "postSetup-*"); l.Error != nil {
-		newJSONError(
-			fmt.Errorf("router: error applying rate limit: %w", l.Error),
-			http.StatusTooManyRequests,
-		).Pipe(c)
+	if !rt.throttle(c, "postSetup-*", "") {
 		return
 	}
 
@@ -54,7 +49,7 @@ func (rt *router) postSetup(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.Bootstrap(persistence.BootstrapConfig{
+	if err := rt.db.Bootstrap(c.Request.Context(), persistence.BootstrapConfig{
 		Accounts: []persistence.BootstrapAccount{
 			{
 				Name:      html.UnescapeString(rt.sanitizer.Sanitize(req.AccountName)),
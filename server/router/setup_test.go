@@ -4,6 +4,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
@@ -22,7 +23,7 @@ type mockGetSetupDatabase struct {
 	result bool
 }
 
-func (m *mockGetSetupDatabase) ProbeEmpty() bool {
+func (m *mockGetSetupDatabase) ProbeEmpty(context.Context) bool {
 	return m.result
 }
 
@@ -38,6 +39,7 @@ func TestRouter_getSetup(t *testing.T) {
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
 		w := httptest.NewRecorder()
 		m.ServeHTTP(w, r)
+		validateResponse(t, http.MethodGet, "/api/setup", r, w)
 
 		if w.Code != http.StatusNoContent {
 			t.Errorf("Unexpected status code %v", w.Code)
@@ -54,6 +56,7 @@ func TestRouter_getSetup(t *testing.T) {
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
 		w := httptest.NewRecorder()
 		m.ServeHTTP(w, r)
+		validateResponse(t, http.MethodGet, "/api/setup", r, w)
 
 		if w.Code != http.StatusForbidden {
 			t.Errorf("Unexpected status code %v", w.Code)
@@ -66,7 +69,7 @@ type mockPostSetupDatabase struct {
 	err error
 }
 
-func (m *mockPostSetupDatabase) Bootstrap(persistence.BootstrapConfig) error {
+func (m *mockPostSetupDatabase) Bootstrap(context.Context, persistence.BootstrapConfig) error {
 	return m.err
 }
 
@@ -112,6 +115,7 @@ func TestRouter_postSetup(t *testing.T) {
 			r := httptest.NewRequest(http.MethodPost, "/", test.body)
 			w := httptest.NewRecorder()
 			m.ServeHTTP(w, r)
+			validateResponse(t, http.MethodPost, "/api/setup", r, w)
 
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Unexpected status code %v", w.Code)
@@ -8,7 +8,6 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"net/http/httptest"
 	"regexp"
 	"strings"
 	"time"
@@ -31,6 +30,34 @@ var (
 	}
 )
 
+// securityHeaders are the headers sent with HTML documents
+type securityHeaders struct {
+	ContentSecurityPolicy   string
+	StrictTransportSecurity string
+	PermissionsPolicy       string
+}
+
+// securityHeaders returns the headers as configured, falling back to
+// defaults for values that are not set
+func (rt *router) securityHeaders() securityHeaders {
+	h := securityHeaders{
+		ContentSecurityPolicy:   defaultCSP,
+		StrictTransportSecurity: defaultSTS,
+	}
+	c := rt.settings().config
+	if c == nil {
+		return h
+	}
+	if csp := c.Server.ContentSecurityPolicy; csp != "" {
+		h.ContentSecurityPolicy = csp
+	}
+	if sts := c.Server.StrictTransportSecurity; sts != "" {
+		h.StrictTransportSecurity = sts
+	}
+	h.PermissionsPolicy = c.Server.PermissionsPolicy
+	return h
+}
+
 // muteRequest suppresses all error logging that is happening from inside the
 // http package
 func muteRequest(r *http.Request) *http.Request {
@@ -39,49 +66,64 @@ func muteRequest(r *http.Request) *http.Request {
 	}))
 }
 
-func staticMiddleware(fileServer, fallback http.Handler) gin.HandlerFunc {
-	tryStatic := func(method, url string) (int, string) {
-		r := httptest.NewRequest(method, url, nil)
-		w := httptest.NewRecorder()
-		fileServer.ServeHTTP(w, muteRequest(r))
-		return w.Code, w.Header().Get("Content-Type")
-	}
-
+// staticMiddleware serves the assets contained in the given index. Requests
+// for paths that are not contained in the index are handled by the given
+// fallback, unless they refer to a file, in which case a 404 is returned.
+func staticMiddleware(assets *assetIndex, fallback http.Handler, headers func() securityHeaders) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		secureContext := c.GetBool(contextKeySecureContext)
-		status, contentType := tryStatic(c.Request.Method, c.Request.URL.String())
-		// Right now, we manually trigger an error when trying to read a directory
-		// so we can skip the directory listings provided by the Go FileServer.
-		// TODO: revisit this solution.
-		if status == http.StatusNotFound || status == http.StatusInternalServerError {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
 			fallback.ServeHTTP(c.Writer, muteRequest(c.Request))
 			return
 		}
 
-		if strings.HasPrefix(contentType, "text/html") {
+		a, redirect := assets.lookup(c.Request.URL.Path)
+		if redirect != "" {
+			if q := c.Request.URL.RawQuery; q != "" {
+				redirect += "?" + q
+			}
+			c.Redirect(http.StatusMovedPermanently, redirect)
+			return
+		}
+		if a == nil {
+			if isAssetPath(c.Request.URL.Path) {
+				http.NotFound(c.Writer, c.Request)
+				return
+			}
+			fallback.ServeHTTP(c.Writer, muteRequest(c.Request))
+			return
+		}
+
+		secureContext := c.GetBool(contextKeySecureContext)
+		h := headers()
+		if strings.HasPrefix(a.contentType, "text/html") {
 			c.Header("Cache-Control", "no-cache")
-			c.Header("Content-Security-Policy", defaultCSP)
+			c.Header("Content-Security-Policy", h.ContentSecurityPolicy)
+			if h.PermissionsPolicy != "" {
+				c.Header("Permissions-Policy", h.PermissionsPolicy)
+			}
 			if secureContext {
-				c.Header("Strict-Transport-Security", defaultSTS)
+				c.Header("Strict-Transport-Security", h.StrictTransportSecurity)
 			}
 		}
 
-		switch uri := c.Request.URL.Path; {
+		switch uri := a.name; {
 		case revisionedJSRe.MatchString(uri), webfontRe.MatchString(uri):
+			// the content of revisioned assets never changes for a given name
 			expires := time.Now().Add(time.Hour * 24 * 365).Format(time.RFC1123)
 			c.Header("Expires", expires)
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
 		case stylesheetRe.MatchString(uri), assetRe.MatchString(uri):
 			c.Header("Cache-Control", "no-cache")
 		case scriptRe.MatchString(uri):
 			c.Header("Cache-Control", "no-cache")
 			if secureContext {
-				c.Header("Strict-Transport-Security", defaultSTS)
+				c.Header("Strict-Transport-Security", h.StrictTransportSecurity)
 			}
 		}
 
 		for key, value := range defaultResponseHeaders {
 			c.Header(key, value)
 		}
-		fileServer.ServeHTTP(c.Writer, muteRequest(c.Request))
+		assets.serve(c.Writer, c.Request, a)
 	}
 }
@@ -6,21 +6,32 @@ package router
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
 )
 
 func TestStaticMiddleware(t *testing.T) {
 	m := gin.New()
-	fileServer := http.FileServer(http.Dir("./testdata"))
+	assets, err := newAssetIndex(http.Dir("./testdata"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
 
-	middleware := staticMiddleware(fileServer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	middleware := staticMiddleware(assets, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
-	}))
+	}), func() securityHeaders {
+		return securityHeaders{
+			ContentSecurityPolicy:   defaultCSP,
+			StrictTransportSecurity: defaultSTS,
+			PermissionsPolicy:       "camera=()",
+		}
+	})
 
 	m.Use(middleware)
 
@@ -41,6 +52,10 @@ func TestStaticMiddleware(t *testing.T) {
 		if w.Header().Get("Content-Security-Policy") == "" {
 			t.Error("Unexpected empty CSP header")
 		}
+
+		if w.Header().Get("Permissions-Policy") != "camera=()" {
+			t.Errorf("Unexpected Permissions-Policy header %v", w.Header().Get("Permissions-Policy"))
+		}
 	}
 
 	{
@@ -82,6 +97,36 @@ func TestStaticMiddleware(t *testing.T) {
 		if w.Header().Get("Expires") == "" {
 			t.Error("Unexpected empty Expires header on revisioned asset")
 		}
+
+		if w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+			t.Errorf("Unexpected Cache-Control header on revisioned asset %v", w.Header().Get("Cache-Control"))
+		}
+	}
+
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/vendor-0000000000.js", nil)
+
+		m.ServeHTTP(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	}
+
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/spa?param=12", nil)
+
+		m.ServeHTTP(w, r)
+
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+
+		if w.Header().Get("Location") != "/spa/?param=12" {
+			t.Errorf("Unexpected Location header %v", w.Header().Get("Location"))
+		}
 	}
 
 	{
@@ -114,3 +159,31 @@ func TestStaticMiddleware(t *testing.T) {
 		}
 	}
 }
+
+func TestRouter_securityHeaders(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		rt := router{config: &config.Config{}}
+		expected := securityHeaders{
+			ContentSecurityPolicy:   defaultCSP,
+			StrictTransportSecurity: defaultSTS,
+		}
+		if h := rt.securityHeaders(); !reflect.DeepEqual(expected, h) {
+			t.Errorf("Expected %v, got %v", expected, h)
+		}
+	})
+	t.Run("overrides", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Server.ContentSecurityPolicy = "default-src 'none'"
+		cfg.Server.StrictTransportSecurity = "max-age=63072000; includeSubDomains"
+		cfg.Server.PermissionsPolicy = "geolocation=()"
+		rt := router{config: cfg}
+		expected := securityHeaders{
+			ContentSecurityPolicy:   "default-src 'none'",
+			StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+			PermissionsPolicy:       "geolocation=()",
+		}
+		if h := rt.securityHeaders(); !reflect.DeepEqual(expected, h) {
+			t.Errorf("Expected %v, got %v", expected, h)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+	"github.com/oklog/ulid"
+)
+
+// streamHeartbeatInterval defines how often a comment is sent to clients
+// listening for live updates so intermediaries do not close idle connections.
+const streamHeartbeatInterval = 30 * time.Second
+
+// streamMissedChangesLimit is the number of missed changes that are looked up
+// at once when a client reconnects.
+var streamMissedChangesLimit = 500
+
+// getStream sends all events and tombstones for the requested accounts
+// as server-sent events as soon as they are stored. Clients reconnecting
+// with a Last-Event-ID header receive the changes they have missed first.
+// Clients that have been disconnected for longer than the retention period
+// are expected to load all events again instead.
+func (rt *router) getStream(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	if !rt.throttle(c, "getStream", accountUser.AccountUserID) {
+		return
+	}
+
+	accountIDs := c.QueryArray("accountId")
+	if len(accountIDs) == 0 {
+		for _, account := range accountUser.Accounts {
+			accountIDs = append(accountIDs, account.AccountID)
+		}
+	}
+	for _, accountID := range accountIDs {
+		if !accountUser.CanAccessAccount(accountID) {
+			newJSONError(
+				fmt.Errorf("router: account user does not have permissions to access account %s", accountID),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+	}
+
+	if rt.broadcaster == nil {
+		newJSONError(
+			errors.New("router: live updates are not available"),
+			http.StatusServiceUnavailable,
+		).Pipe(c)
+		return
+	}
+
+	// subscribing before looking up missed changes makes sure no change
+	// is lost in between
+	sub := rt.broadcaster.Subscribe(accountIDs)
+	defer sub.Close()
+
+	var missed []persistence.Change
+	lastSequence := c.GetHeader("Last-Event-ID")
+	if lastSequence != "" {
+		if err := rt.validateLastEventID(lastSequence); err != nil {
+			newJSONError(
+				fmt.Errorf("router: unable to resume stream: %w", err),
+				http.StatusGone,
+			).Pipe(c)
+			return
+		}
+		changes, err := rt.db.Changes(c.Request.Context(), persistence.ChangesQuery{
+			Since:      lastSequence,
+			AccountIDs: accountIDs,
+			Limit:      streamMissedChangesLimit,
+		})
+		if err != nil {
+			newJSONError(
+				fmt.Errorf("router: error looking up missed changes: %w", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+		missed = changes
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for {
+		for _, change := range missed {
+			if err := writeChange(c, change); err != nil {
+				return
+			}
+			lastSequence = change.Sequence
+		}
+		c.Writer.Flush()
+		if len(missed) < streamMissedChangesLimit {
+			break
+		}
+		next, err := rt.db.Changes(c.Request.Context(), persistence.ChangesQuery{
+			Since:      lastSequence,
+			AccountIDs: accountIDs,
+			Limit:      streamMissedChangesLimit,
+		})
+		if err != nil {
+			// the client reconnects and resumes after the last change
+			// it has received
+			return
+		}
+		missed = next
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case change, ok := <-sub.Changes():
+			if !ok {
+				// the subscription has been closed because the client could
+				// not keep up or the server is shutting down, in both cases
+				// the client is expected to reconnect
+				return
+			}
+			if change.Sequence <= lastSequence {
+				continue
+			}
+			if err := writeChange(c, change); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// validateLastEventID checks whether a stream can be resumed after the
+// given sequence. This is not possible for sequences older than the retention
+// period, as changes to expired events are not retained.
+func (rt *router) validateLastEventID(sequence string) error {
+	id, err := ulid.Parse(sequence)
+	if err != nil {
+		return fmt.Errorf("invalid last event id %s: %w", sequence, err)
+	}
+	if ulid.Time(id.Time()).Before(time.Now().Add(-rt.retentionPeriod())) {
+		return fmt.Errorf("last event id %s is older than the retention period", sequence)
+	}
+	return nil
+}
+
+// writeChange writes the given change as a server-sent event. Its sequence
+// is used as the event's id so clients can resume after reconnecting.
+func writeChange(c *gin.Context, change persistence.Change) error {
+	eventType := "event"
+	if change.Event == nil {
+		eventType = "tombstone"
+	}
+	data, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("router: error marshaling change: %w", err)
+	}
+	if _, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", change.Sequence, eventType, data); err != nil {
+		return fmt.Errorf("router: error writing change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/stream"
+)
+
+type mockStreamService struct {
+	persistence.Service
+	pages   [][]persistence.Change
+	queries []persistence.ChangesQuery
+}
+
+func (m *mockStreamService) Changes(ctx context.Context, query persistence.ChangesQuery) ([]persistence.Change, error) {
+	m.queries = append(m.queries, query)
+	if len(m.pages) == 0 {
+		return []persistence.Change{}, nil
+	}
+	page := m.pages[0]
+	m.pages = m.pages[1:]
+	return page, nil
+}
+
+func sequenceAt(t *testing.T, ts time.Time) string {
+	sequence, err := persistence.EventIDAt(ts)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return sequence
+}
+
+func newStreamTestServer(rt *router) *httptest.Server {
+	m := gin.New()
+	m.GET("/api/stream", func(c *gin.Context) {
+		c.Set(contextKeyAuth, persistence.LoginResult{
+			AccountUserID: "account-user-a",
+			Accounts: []persistence.LoginAccountResult{
+				{AccountID: "account-a"},
+				{AccountID: "account-b"},
+			},
+		})
+		c.Next()
+	}, rt.getStream)
+	return httptest.NewServer(m)
+}
+
+func TestRouter_getStream_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		broadcaster    *stream.Broadcaster
+		query          string
+		lastEventID    string
+		expectedStatus int
+	}{
+		{
+			"not enabled",
+			nil,
+			"",
+			"",
+			http.StatusServiceUnavailable,
+		},
+		{
+			"inaccessible account",
+			stream.NewBroadcaster(0),
+			"?accountId=account-a&accountId=account-z",
+			"",
+			http.StatusForbidden,
+		},
+		{
+			"invalid last event id",
+			stream.NewBroadcaster(0),
+			"",
+			"seq-0",
+			http.StatusGone,
+		},
+		{
+			"last event id older than retention",
+			stream.NewBroadcaster(0),
+			"",
+			sequenceAt(t, time.Now().Add(-config.EventRetention-time.Hour)),
+			http.StatusGone,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := &router{
+				db:          &mockStreamService{},
+				config:      &config.Config{},
+				broadcaster: test.broadcaster,
+			}
+			srv := newStreamTestServer(rt)
+			defer srv.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/stream"+test.query, nil)
+			if test.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", test.lastEventID)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRouter_getStream(t *testing.T) {
+	defer func(l int) { streamMissedChangesLimit = l }(streamMissedChangesLimit)
+	streamMissedChangesLimit = 2
+
+	base := time.Now().Add(-time.Hour)
+	var seq []string
+	for i := 0; i < 5; i++ {
+		seq = append(seq, sequenceAt(t, base.Add(time.Duration(i)*time.Second)))
+	}
+
+	db := &mockStreamService{
+		pages: [][]persistence.Change{
+			{
+				{AccountID: "account-a", Sequence: seq[1], Event: &persistence.EventResult{EventID: "event-a", Payload: "payload-a"}},
+				{AccountID: "account-a", Sequence: seq[2], Event: &persistence.EventResult{EventID: "event-b", Payload: "payload-b"}},
+			},
+			{
+				{AccountID: "account-a", Sequence: seq[3], DeletedEventID: "event-x"},
+			},
+		},
+	}
+	broadcaster := stream.NewBroadcaster(0)
+	rt := &router{
+		db:          db,
+		config:      &config.Config{},
+		broadcaster: broadcaster,
+	}
+	srv := newStreamTestServer(rt)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/stream?accountId=account-a", nil)
+	req.Header.Set("Last-Event-ID", seq[0])
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", res.StatusCode)
+	}
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Unexpected content type %s", contentType)
+	}
+
+	broadcaster.Publish([]persistence.Change{
+		{AccountID: "account-a", Sequence: seq[3], DeletedEventID: "event-x"},
+		{AccountID: "account-b", Sequence: seq[4], DeletedEventID: "event-y"},
+		{AccountID: "account-a", Sequence: seq[4], DeletedEventID: "event-a"},
+	})
+	broadcaster.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error reading body %v", err)
+	}
+
+	expectedQueries := []persistence.ChangesQuery{
+		{Since: seq[0], AccountIDs: []string{"account-a"}, Limit: 2},
+		{Since: seq[2], AccountIDs: []string{"account-a"}, Limit: 2},
+	}
+	if !reflect.DeepEqual(expectedQueries, db.queries) {
+		t.Errorf("Expected queries %v, got %v", expectedQueries, db.queries)
+	}
+
+	expected := strings.Join([]string{
+		fmt.Sprintf("id: %s\nevent: event\ndata: {\"accountId\":\"account-a\",\"sequence\":\"%s\",\"event\":{\"eventId\":\"event-a\",\"payload\":\"payload-a\"}}\n\n", seq[1], seq[1]),
+		fmt.Sprintf("id: %s\nevent: event\ndata: {\"accountId\":\"account-a\",\"sequence\":\"%s\",\"event\":{\"eventId\":\"event-b\",\"payload\":\"payload-b\"}}\n\n", seq[2], seq[2]),
+		fmt.Sprintf("id: %s\nevent: tombstone\ndata: {\"accountId\":\"account-a\",\"sequence\":\"%s\",\"deletedEventId\":\"event-x\"}\n\n", seq[3], seq[3]),
+		fmt.Sprintf("id: %s\nevent: tombstone\ndata: {\"accountId\":\"account-a\",\"sequence\":\"%s\",\"deletedEventId\":\"event-a\"}\n\n", seq[4], seq[4]),
+	}, "")
+	if string(body) != expected {
+		t.Errorf("Expected body %q, got %q", expected, string(body))
+	}
+}
@@ -20,6 +20,7 @@ func TestRouter_getVersion(t *testing.T) {
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
 	m.ServeHTTP(w, r)
+	validateResponse(t, http.MethodGet, "/versionz", r, w)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Unexpected status code %v", w.Code)
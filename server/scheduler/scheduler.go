@@ -0,0 +1,143 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package scheduler runs background jobs periodically.
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Job is a task that is run periodically. Returning an error causes the job
+// to be retried.
+type Job func(ctx context.Context) error
+
+// Scheduler runs a job in a fixed interval. A random jitter is added to each
+// interval so that multiple instances do not run the same job at the same
+// time. Failing runs are retried using exponential backoff.
+type Scheduler struct {
+	interval   time.Duration
+	jitter     time.Duration
+	newBackOff func() backoff.BackOff
+}
+
+// New creates a Scheduler that waits between interval and interval + jitter
+// after each successful run.
+func New(interval, jitter time.Duration) *Scheduler {
+	return &Scheduler{
+		interval: interval,
+		jitter:   jitter,
+		newBackOff: func() backoff.BackOff {
+			b := backoff.NewExponentialBackOff()
+			b.InitialInterval = time.Second
+			// failing runs are retried until they succeed, but never less
+			// often than successful runs happen
+			b.MaxInterval = interval
+			b.MaxElapsedTime = 0
+			return b
+		},
+	}
+}
+
+// Run runs the job immediately and then repeatedly until the given context
+// is cancelled. In case the job fails, onError is called with the error
+// and the delay after which the job is retried.
+func (s *Scheduler) Run(ctx context.Context, job Job, onError func(err error, retry time.Duration)) {
+	b := s.newBackOff()
+	for {
+		var delay time.Duration
+		if err := job(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			delay = b.NextBackOff()
+			if onError != nil {
+				onError(err, delay)
+			}
+		} else {
+			b.Reset()
+			delay = s.next()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// next returns the delay before the next run after a successful one.
+func (s *Scheduler) next() time.Duration {
+	if s.jitter <= 0 {
+		return s.interval
+	}
+	return s.interval + time.Duration(rand.Int63n(int64(s.jitter)))
+}
+
+// Lock is a lock held by a single instance at a time.
+type Lock interface {
+	// Check returns an error in case the lock is not held anymore.
+	Check(ctx context.Context) error
+	Unlock() error
+}
+
+// Locker acquires locks that are shared between all instances running the
+// same jobs.
+type Locker interface {
+	TryLock(ctx context.Context, name string) (Lock, bool, error)
+}
+
+// Leader wraps the given job so that it is only run by a single instance.
+// The first instance acquiring the lock of the given name becomes the leader
+// and keeps holding the lock until the context passed to the job is done, so
+// the job runs once per interval no matter how many instances are running.
+// Other instances skip their runs and try to acquire the lock again after
+// the next interval, so the job keeps running when the leader is gone.
+// The leader checks it still holds the lock before each run. In case the
+// lock has been lost, e.g. because the database connection holding it was
+// closed, it gives up leadership and tries to acquire the lock again.
+func Leader(l Locker, name string, job Job) Job {
+	var mu sync.Mutex
+	var held Lock
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if held != nil {
+			if err := held.Check(ctx); err != nil {
+				// another instance might be leading already, so the lock
+				// is released no matter what and needs to be acquired again
+				held.Unlock()
+				held = nil
+			}
+		}
+		if held == nil {
+			lock, acquired, err := l.TryLock(ctx, name)
+			if err != nil {
+				return err
+			}
+			if !acquired {
+				return nil
+			}
+			held = lock
+			go func() {
+				<-ctx.Done()
+				mu.Lock()
+				defer mu.Unlock()
+				// the lock might have been lost and replaced in the meantime
+				if held == lock {
+					held = nil
+					lock.Unlock()
+				}
+			}()
+		}
+		return job(ctx)
+	}
+}
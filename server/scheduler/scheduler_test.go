@@ -0,0 +1,237 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+func TestScheduler_Run(t *testing.T) {
+	t.Run("repeated runs", func(t *testing.T) {
+		s := New(time.Millisecond, time.Millisecond)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		runs := 0
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx, func(context.Context) error {
+				runs++
+				if runs == 3 {
+					cancel()
+				}
+				return nil
+			}, func(err error, retry time.Duration) {
+				t.Errorf("Unexpected error %v", err)
+			})
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for scheduler to stop")
+		}
+		if runs != 3 {
+			t.Errorf("Unexpected number of runs %d", runs)
+		}
+	})
+	t.Run("retry on error", func(t *testing.T) {
+		s := New(time.Hour, 0)
+		s.newBackOff = func() backoff.BackOff {
+			return backoff.NewConstantBackOff(time.Millisecond)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		var errs []error
+		runs := 0
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx, func(context.Context) error {
+				runs++
+				if runs < 3 {
+					return errors.New("did not work")
+				}
+				cancel()
+				return nil
+			}, func(err error, retry time.Duration) {
+				mu.Lock()
+				defer mu.Unlock()
+				if retry != time.Millisecond {
+					t.Errorf("Unexpected retry delay %v", retry)
+				}
+				errs = append(errs, err)
+			})
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for scheduler to stop")
+		}
+		if runs != 3 {
+			t.Errorf("Unexpected number of runs %d", runs)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(errs) != 2 {
+			t.Errorf("Unexpected number of errors %d", len(errs))
+		}
+	})
+}
+
+func TestScheduler_next(t *testing.T) {
+	s := New(time.Minute, time.Second*10)
+	for i := 0; i < 100; i++ {
+		next := s.next()
+		if next < time.Minute || next >= time.Minute+time.Second*10 {
+			t.Errorf("Unexpected delay %v", next)
+		}
+	}
+	if next := New(time.Minute, 0).next(); next != time.Minute {
+		t.Errorf("Unexpected delay %v", next)
+	}
+}
+
+type mockLock struct {
+	checkErr error
+	unlocked chan struct{}
+}
+
+func (m *mockLock) Check(context.Context) error {
+	return m.checkErr
+}
+
+func (m *mockLock) Unlock() error {
+	close(m.unlocked)
+	return nil
+}
+
+type mockLocker struct {
+	acquired bool
+	err      error
+	attempts int
+	locks    []*mockLock
+}
+
+func (m *mockLocker) TryLock(context.Context, string) (Lock, bool, error) {
+	m.attempts++
+	if m.err != nil || !m.acquired {
+		return nil, false, m.err
+	}
+	lock := &mockLock{unlocked: make(chan struct{})}
+	m.locks = append(m.locks, lock)
+	return lock, true, nil
+}
+
+func TestLeader(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		locker         *mockLocker
+		expectRuns     int
+		expectAttempts int
+		expectError    bool
+		expectLeader   bool
+	}{
+		// the leader does not try to acquire the lock again
+		{"acquired", &mockLocker{acquired: true}, 3, 1, false, true},
+		{"held elsewhere", &mockLocker{}, 0, 3, false, false},
+		{"lock error", &mockLocker{err: errors.New("did not work")}, 0, 3, true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			runs := 0
+			job := Leader(test.locker, "job", func(context.Context) error {
+				runs++
+				return nil
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			for i := 0; i < 3; i++ {
+				if err := job(ctx); (err != nil) != test.expectError {
+					t.Errorf("Unexpected error value %v", err)
+				}
+			}
+			if runs != test.expectRuns {
+				t.Errorf("Expected %d runs, got %d", test.expectRuns, runs)
+			}
+			if test.locker.attempts != test.expectAttempts {
+				t.Errorf("Expected %d attempts to acquire the lock, got %d", test.expectAttempts, test.locker.attempts)
+			}
+			if (len(test.locker.locks) != 0) != test.expectLeader {
+				t.Fatalf("Unexpected number of locks %d", len(test.locker.locks))
+			}
+
+			cancel()
+			if !test.expectLeader {
+				return
+			}
+			select {
+			case <-test.locker.locks[0].unlocked:
+			case <-time.After(time.Millisecond * 50):
+				t.Error("Expected lock to be released when the context is done")
+			}
+		})
+	}
+}
+
+func TestLeader_LostLock(t *testing.T) {
+	locker := &mockLocker{acquired: true}
+	runs := 0
+	job := Leader(locker, "job", func(context.Context) error {
+		runs++
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := job(ctx); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// another instance acquires the lock after it has been lost
+	locker.locks[0].checkErr = errors.New("connection closed")
+	locker.acquired = false
+	if err := job(ctx); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("Expected job not to run after losing the lock, got %d runs", runs)
+	}
+	if locker.attempts != 2 {
+		t.Errorf("Expected lock to be acquired again, got %d attempts", locker.attempts)
+	}
+	select {
+	case <-locker.locks[0].unlocked:
+	default:
+		t.Error("Expected lost lock to be released")
+	}
+
+	// the lock is available again
+	locker.acquired = true
+	if err := job(ctx); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if runs != 2 {
+		t.Errorf("Expected job to run after acquiring the lock again, got %d runs", runs)
+	}
+	if len(locker.locks) != 2 {
+		t.Fatalf("Unexpected number of locks %d", len(locker.locks))
+	}
+
+	cancel()
+	select {
+	case <-locker.locks[1].unlocked:
+	case <-time.After(time.Millisecond * 50):
+		t.Error("Expected lock to be released when the context is done")
+	}
+}
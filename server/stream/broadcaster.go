@@ -0,0 +1,145 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package stream distributes changes to stored events to subscribers, e.g.
+// clients listening for live updates.
+package stream
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+// DefaultBufferSize is the number of changes that can be pending for a
+// subscription before it is considered too slow and closed.
+const DefaultBufferSize = 256
+
+// Broadcaster distributes published changes to all subscriptions that
+// are interested in the affected accounts. It implements
+// persistence.Publisher, so it can be notified by the persistence layer
+// directly in case only a single instance is running.
+type Broadcaster struct {
+	bufferSize    int
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+// NewBroadcaster creates a new Broadcaster. In case bufferSize is not
+// positive, DefaultBufferSize is used.
+func NewBroadcaster(bufferSize int) *Broadcaster {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Broadcaster{
+		bufferSize:    bufferSize,
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives all changes for the accounts it has been created for.
+type Subscription struct {
+	accountIDs map[string]bool
+	changes    chan persistence.Change
+	b          *Broadcaster
+}
+
+// Changes returns the channel the subscription's changes are sent on. The
+// channel is closed when the subscription is closed, either by calling Close,
+// because the subscriber did not keep up with the published changes or
+// because the broadcaster has been closed.
+func (s *Subscription) Changes() <-chan persistence.Change {
+	return s.changes
+}
+
+// Close ends the subscription. It is safe to call Close multiple times.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.remove(s)
+}
+
+// Subscribe creates a subscription receiving changes for the given accounts.
+// Callers are expected to close the subscription when they are done.
+func (b *Broadcaster) Subscribe(accountIDs []string) *Subscription {
+	s := &Subscription{
+		accountIDs: map[string]bool{},
+		changes:    make(chan persistence.Change, b.bufferSize),
+		b:          b,
+	}
+	for _, accountID := range accountIDs {
+		s.accountIDs[accountID] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.changes)
+		return s
+	}
+	b.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Publish sends the given changes to all interested subscriptions. It never
+// blocks: subscriptions that cannot receive any more changes are closed
+// so their subscribers can catch up by other means.
+func (b *Broadcaster) Publish(changes []persistence.Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscriptions {
+		for _, change := range changes {
+			if !s.accountIDs[change.AccountID] {
+				continue
+			}
+			select {
+			case s.changes <- change:
+				continue
+			default:
+				b.remove(s)
+			}
+			break
+		}
+	}
+}
+
+// AccountIDs returns the accounts that at least one subscription is
+// interested in.
+func (b *Broadcaster) AccountIDs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	accountIDs := map[string]bool{}
+	for s := range b.subscriptions {
+		for accountID := range s.accountIDs {
+			accountIDs[accountID] = true
+		}
+	}
+	var result []string
+	for accountID := range accountIDs {
+		result = append(result, accountID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Close closes all subscriptions. Subscriptions created after calling Close
+// are closed immediately.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscriptions {
+		b.remove(s)
+	}
+}
+
+// remove expects the caller to hold the lock.
+func (b *Broadcaster) remove(s *Subscription) {
+	if _, ok := b.subscriptions[s]; !ok {
+		return
+	}
+	delete(b.subscriptions, s)
+	close(s.changes)
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package stream
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func drain(s *Subscription) ([]persistence.Change, bool) {
+	var result []persistence.Change
+	for {
+		select {
+		case change, ok := <-s.Changes():
+			if !ok {
+				return result, true
+			}
+			result = append(result, change)
+		default:
+			return result, false
+		}
+	}
+}
+
+func TestBroadcaster_Publish(t *testing.T) {
+	b := NewBroadcaster(2)
+	subA := b.Subscribe([]string{"account-a"})
+	defer subA.Close()
+	subAB := b.Subscribe([]string{"account-a", "account-b"})
+	defer subAB.Close()
+	subC := b.Subscribe([]string{"account-c"})
+	defer subC.Close()
+
+	b.Publish([]persistence.Change{
+		{AccountID: "account-a", Sequence: "seq-a"},
+		{AccountID: "account-b", Sequence: "seq-b"},
+	})
+
+	t.Run("single account", func(t *testing.T) {
+		result, closed := drain(subA)
+		if closed {
+			t.Error("Unexpected closed subscription")
+		}
+		expected := []persistence.Change{{AccountID: "account-a", Sequence: "seq-a"}}
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+	})
+	t.Run("multiple accounts", func(t *testing.T) {
+		result, closed := drain(subAB)
+		if closed {
+			t.Error("Unexpected closed subscription")
+		}
+		if len(result) != 2 {
+			t.Errorf("Expected two changes, got %v", result)
+		}
+	})
+	t.Run("other account", func(t *testing.T) {
+		result, closed := drain(subC)
+		if closed {
+			t.Error("Unexpected closed subscription")
+		}
+		if len(result) != 0 {
+			t.Errorf("Expected no changes, got %v", result)
+		}
+	})
+}
+
+func TestBroadcaster_SlowSubscriber(t *testing.T) {
+	b := NewBroadcaster(1)
+	sub := b.Subscribe([]string{"account-a"})
+	b.Publish([]persistence.Change{
+		{AccountID: "account-a", Sequence: "seq-a"},
+		{AccountID: "account-a", Sequence: "seq-b"},
+	})
+	result, closed := drain(sub)
+	if !closed {
+		t.Error("Expected subscription to be closed")
+	}
+	if len(result) != 1 {
+		t.Errorf("Expected buffered change to be delivered, got %v", result)
+	}
+	// publishing and closing again must not panic
+	b.Publish([]persistence.Change{{AccountID: "account-a"}})
+	sub.Close()
+}
+
+func TestBroadcaster_Close(t *testing.T) {
+	b := NewBroadcaster(0)
+	sub := b.Subscribe([]string{"account-a"})
+	b.Close()
+	if _, closed := drain(sub); !closed {
+		t.Error("Expected subscription to be closed")
+	}
+	sub.Close()
+
+	late := b.Subscribe([]string{"account-a"})
+	if _, closed := drain(late); !closed {
+		t.Error("Expected subscription created after closing to be closed")
+	}
+	late.Close()
+}
+
+func TestBroadcaster_AccountIDs(t *testing.T) {
+	b := NewBroadcaster(0)
+	if accountIDs := b.AccountIDs(); len(accountIDs) != 0 {
+		t.Errorf("Expected no account ids, got %v", accountIDs)
+	}
+	subA := b.Subscribe([]string{"account-b", "account-a"})
+	subB := b.Subscribe([]string{"account-b"})
+	defer subB.Close()
+	if expected, accountIDs := []string{"account-a", "account-b"}, b.AccountIDs(); !reflect.DeepEqual(expected, accountIDs) {
+		t.Errorf("Expected %v, got %v", expected, accountIDs)
+	}
+	subA.Close()
+	if expected, accountIDs := []string{"account-b"}, b.AccountIDs(); !reflect.DeepEqual(expected, accountIDs) {
+		t.Errorf("Expected %v, got %v", expected, accountIDs)
+	}
+}
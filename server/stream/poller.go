@@ -0,0 +1,148 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package stream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"github.com/oklog/ulid"
+)
+
+// DefaultPollInterval is the interval used by a Poller in case no positive
+// interval is given.
+const DefaultPollInterval = time.Second
+
+// pollOverlap is the time window that is queried again on each poll. Sequences
+// are created before the surrounding transaction is committed, so changes
+// might become visible after changes with a newer sequence.
+const pollOverlap = 10 * time.Second
+
+// Changer looks up changes made after a given sequence.
+type Changer interface {
+	Changes(ctx context.Context, query persistence.ChangesQuery) ([]persistence.Change, error)
+	ResolveChanges(ctx context.Context, changes []persistence.Change) ([]persistence.Change, error)
+}
+
+// Publisher receives the changes found by a Poller.
+type Publisher interface {
+	persistence.Publisher
+	// AccountIDs returns the accounts that changes are currently
+	// published for.
+	AccountIDs() []string
+}
+
+// Poller publishes changes by repeatedly querying the database. It can be
+// used when multiple instances are writing to the same database, so changes
+// made by other instances are published as well.
+type Poller struct {
+	db        Changer
+	publisher Publisher
+	interval  time.Duration
+	now       func() time.Time
+}
+
+// NewPoller creates a new Poller querying the given database every interval
+// and passing new changes to the given publisher.
+func NewPoller(db Changer, publisher Publisher, interval time.Duration) *Poller {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &Poller{
+		db:        db,
+		publisher: publisher,
+		interval:  interval,
+		now:       time.Now,
+	}
+}
+
+// Run polls the database until the given context is cancelled. Only changes
+// made after Run has been called are published. The database is not queried
+// while no changes are published for any account. Errors do not stop the poller
+// and are passed to onError instead, in case it is not nil.
+func (p *Poller) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	start := p.now()
+	seen := map[string]string{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.poll(ctx, start, seen); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// poll publishes all changes since start or the beginning of the overlap
+// window that have not been published before. seen keeps track of the
+// changes that have been published before. As most changes have been seen
+// already, payloads are only looked up for unseen changes.
+func (p *Poller) poll(ctx context.Context, start time.Time, seen map[string]string) error {
+	from := p.now().Add(-pollOverlap)
+	if from.Before(start) {
+		from = start
+	}
+	since := sequenceAt(from)
+
+	for key, sequence := range seen {
+		if sequence <= since {
+			delete(seen, key)
+		}
+	}
+
+	accountIDs := p.publisher.AccountIDs()
+	if len(accountIDs) == 0 {
+		return nil
+	}
+
+	changes, err := p.db.Changes(ctx, persistence.ChangesQuery{
+		Since:        since,
+		AccountIDs:   accountIDs,
+		OmitPayloads: true,
+	})
+	if err != nil {
+		return fmt.Errorf("stream: error polling for changes: %w", err)
+	}
+
+	var unseen []persistence.Change
+	for _, change := range changes {
+		if _, ok := seen[changeKey(change)]; !ok {
+			unseen = append(unseen, change)
+		}
+	}
+	if len(unseen) == 0 {
+		return nil
+	}
+
+	unseen, err = p.db.ResolveChanges(ctx, unseen)
+	if err != nil {
+		return fmt.Errorf("stream: error looking up polled changes: %w", err)
+	}
+	for _, change := range unseen {
+		seen[changeKey(change)] = change.Sequence
+	}
+	if len(unseen) != 0 {
+		p.publisher.Publish(unseen)
+	}
+	return nil
+}
+
+// sequenceAt returns the lowest possible sequence for the given time.
+func sequenceAt(t time.Time) string {
+	return ulid.MustNew(ulid.Timestamp(t), nil).String()
+}
+
+func changeKey(c persistence.Change) string {
+	if c.Event != nil {
+		return "event-" + c.Event.EventID
+	}
+	return "tombstone-" + c.DeletedEventID
+}
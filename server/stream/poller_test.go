@@ -0,0 +1,169 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockChanger struct {
+	result     []persistence.Change
+	err        error
+	queries    []persistence.ChangesQuery
+	resolved   [][]persistence.Change
+	resolveErr error
+}
+
+func (m *mockChanger) Changes(ctx context.Context, query persistence.ChangesQuery) ([]persistence.Change, error) {
+	m.queries = append(m.queries, query)
+	var result []persistence.Change
+	for _, change := range m.result {
+		if change.Event != nil {
+			change.Event = &persistence.EventResult{EventID: change.Event.EventID}
+		}
+		result = append(result, change)
+	}
+	return result, m.err
+}
+
+func (m *mockChanger) ResolveChanges(ctx context.Context, changes []persistence.Change) ([]persistence.Change, error) {
+	m.resolved = append(m.resolved, changes)
+	if m.resolveErr != nil {
+		return nil, m.resolveErr
+	}
+	payloads := map[string]*persistence.EventResult{}
+	for _, change := range m.result {
+		if change.Event != nil {
+			payloads[change.Event.EventID] = change.Event
+		}
+	}
+	var result []persistence.Change
+	for _, change := range changes {
+		if change.Event != nil {
+			change.Event = payloads[change.Event.EventID]
+		}
+		result = append(result, change)
+	}
+	return result, nil
+}
+
+type mockPublisher struct {
+	changes    []persistence.Change
+	accountIDs []string
+}
+
+func (m *mockPublisher) Publish(changes []persistence.Change) {
+	m.changes = append(m.changes, changes...)
+}
+
+func (m *mockPublisher) AccountIDs() []string {
+	return m.accountIDs
+}
+
+func TestPoller_poll(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(time.Minute)
+
+	db := &mockChanger{
+		result: []persistence.Change{
+			{AccountID: "account-a", Sequence: sequenceAt(now.Add(-time.Second)), Event: &persistence.EventResult{EventID: "event-a", Payload: "payload-a"}},
+			{AccountID: "account-a", Sequence: sequenceAt(now), DeletedEventID: "event-z"},
+		},
+	}
+	pub := &mockPublisher{}
+	p := NewPoller(db, pub, time.Second)
+	p.now = func() time.Time { return now }
+
+	// the database is not queried without subscribers
+	seen := map[string]string{}
+	if err := p.poll(context.Background(), start, seen); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(db.queries) != 0 {
+		t.Errorf("Expected no queries, got %v", db.queries)
+	}
+
+	pub.accountIDs = []string{"account-a", "account-b"}
+	if err := p.poll(context.Background(), start, seen); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(db.result, pub.changes) {
+		t.Errorf("Expected %v, got %v", db.result, pub.changes)
+	}
+	expectedQuery := persistence.ChangesQuery{
+		Since:        sequenceAt(now.Add(-pollOverlap)),
+		AccountIDs:   []string{"account-a", "account-b"},
+		OmitPayloads: true,
+	}
+	if !reflect.DeepEqual(expectedQuery, db.queries[0]) {
+		t.Errorf("Expected query %v, got %v", expectedQuery, db.queries[0])
+	}
+
+	// changes within the overlap are neither resolved nor published again
+	if err := p.poll(context.Background(), start, seen); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(pub.changes) != 2 {
+		t.Errorf("Expected changes to be published once, got %v", pub.changes)
+	}
+	if len(db.resolved) != 1 {
+		t.Errorf("Expected changes to be resolved once, got %v", db.resolved)
+	}
+
+	// no changes before start are requested
+	p.now = func() time.Time { return start.Add(time.Second) }
+	if err := p.poll(context.Background(), start, seen); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := sequenceAt(start); db.queries[2].Since != expected {
+		t.Errorf("Expected query since %s, got %s", expected, db.queries[2].Since)
+	}
+
+	db.err = errors.New("did not work")
+	if err := p.poll(context.Background(), start, seen); err == nil {
+		t.Error("Expected error, got nil")
+	}
+
+	db.err = nil
+	db.resolveErr = errors.New("did not work")
+	if err := p.poll(context.Background(), start, map[string]string{}); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestPoller_Run(t *testing.T) {
+	db := &mockChanger{err: errors.New("did not work")}
+	p := NewPoller(db, &mockPublisher{accountIDs: []string{"account-a"}}, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx, func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Error("Expected error to be passed to callback")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected poller to stop after cancelling context")
+	}
+}
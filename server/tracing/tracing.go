@@ -0,0 +1,92 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tracing configures the OpenTelemetry tracer provider that is used
+// by all instrumented packages. In case tracing is not enabled, the global
+// no-op provider will be used and creating spans will be almost free.
+//
+// Span attributes must never contain data that identifies a user, i.e. no
+// user or account user identifiers, email addresses, IPs or similar.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/offen/offen/server"
+
+// Setup configures the global tracer provider using the given exporter,
+// which can be one of "otlp" or "stdout". The returned function flushes
+// pending spans and needs to be called before the process exits.
+func Setup(exporter string, sampleRatio float64, version string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	switch exporter {
+	case "otlp":
+		e, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("tracing: error creating otlp exporter: %w", err)
+		}
+		exp = e
+	case "stdout":
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("tracing: error creating stdout exporter: %w", err)
+		}
+		exp = e
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %s", exporter)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("offen"),
+			semconv.ServiceVersion(version),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: error creating resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(
+			sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio)),
+		),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	return provider.Shutdown, nil
+}
+
+// Start creates a new span of the given name that is a child of any span
+// contained in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the given span, marking it as failed in case err is non-nil.
+// The error message itself is not recorded as it might contain identifiers.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, "")
+	}
+	span.End()
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		previous := otel.GetTracerProvider()
+		defer otel.SetTracerProvider(previous)
+		shutdown, err := Setup("stdout", 1, "test")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		if _, err := Setup("jaeger", 1, "test"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
+
+func TestStartEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	End(child, errors.New("user abc123 not found"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Unexpected number of spans %d", len(spans))
+	}
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Error("Expected child span to be nested in parent span")
+	}
+	if spans[0].Status().Code != codes.Error || spans[0].Status().Description != "" {
+		t.Errorf("Unexpected status %v", spans[0].Status())
+	}
+	if len(spans[0].Events()) != 0 {
+		t.Errorf("Expected error not to be recorded, got %v", spans[0].Events())
+	}
+}
@@ -49,25 +49,124 @@ function getEventsWith (accountsUrl) {
   }
 }
 
-exports.postEvent = postEventWith(window.location.origin + '/api/events')
+exports.postEvent = postEventWith(
+  window.location.origin + '/api/events',
+  window.location.origin + '/api/ingestion-token'
+)
 exports.postEventWith = postEventWith
 
-function postEventWith (eventsUrl) {
+function postEventWith (eventsUrl, ingestionTokenUrl) {
+  var refreshIngestionToken = refreshIngestionTokenWith(ingestionTokenUrl)
   return function (accountId, payload) {
     var url = new window.URL(eventsUrl)
+    function send () {
+      return window
+        .fetch(url, {
+          method: 'POST',
+          credentials: 'include',
+          body: JSON.stringify({
+            accountId: accountId,
+            payload: payload,
+            ingestionToken: ingestionToken.get()
+          })
+        })
+        .then(handleFetchResponse)
+    }
+    var pending = ingestionTokenUrl && ingestionToken.stale()
+      ? refreshIngestionToken(accountId).catch(function () {})
+      : Promise.resolve()
+    return pending
+      .then(send)
+      .catch(function (err) {
+        // tokens issued before the user cookie has been set need to be
+        // exchanged before they can be used, so rejected events are
+        // retried once using a new token
+        if (err.status !== 403 || !ingestionTokenUrl || !ingestionToken.get()) {
+          throw err
+        }
+        return refreshIngestionToken(accountId).then(send)
+      })
+  }
+}
+
+exports.refreshIngestionToken = refreshIngestionTokenWith(window.location.origin + '/api/ingestion-token')
+exports.refreshIngestionTokenWith = refreshIngestionTokenWith
+
+// refreshIngestionTokenWith exchanges the current ingestion token for a new
+// one that is bound to the current user and has not expired yet.
+function refreshIngestionTokenWith (ingestionTokenUrl) {
+  return function (accountId) {
+    var current = ingestionToken.get()
+    if (!current) {
+      return Promise.resolve(null)
+    }
     return window
-      .fetch(url, {
+      .fetch(ingestionTokenUrl, {
         method: 'POST',
         credentials: 'include',
         body: JSON.stringify({
           accountId: accountId,
-          payload: payload
+          ingestionToken: current
         })
       })
       .then(handleFetchResponse)
+      .then(function (response) {
+        if (response) {
+          ingestionToken.set(response.ingestionToken, response.expiresIn)
+        }
+        return response
+      })
   }
 }
 
+// ingestionToken holds the token the server might have issued when
+// rendering the vault. In case no token has been issued, get returns undefined
+// and the field will be omitted from request bodies. Tokens are considered
+// stale once half of their lifetime has passed, or when the user cookie has
+// been set after they have been issued.
+var ingestionToken = (function () {
+  var token
+  var refreshAt = Infinity
+  var initialized = false
+
+  function init () {
+    if (initialized) {
+      return
+    }
+    initialized = true
+    var host = document.getElementById('host')
+    if (host && host.dataset.ingestionToken) {
+      set(host.dataset.ingestionToken, parseInt(host.dataset.ingestionTokenExpiresIn, 10))
+    }
+  }
+
+  function set (value, expiresIn) {
+    initialized = true
+    token = value
+    refreshAt = expiresIn
+      ? Date.now() + expiresIn * 1000 / 2
+      : Infinity
+  }
+
+  return {
+    get: function () {
+      init()
+      return token
+    },
+    set: set,
+    stale: function () {
+      init()
+      return Boolean(token) && Date.now() >= refreshAt
+    },
+    invalidate: function () {
+      init()
+      refreshAt = 0
+    }
+  }
+})()
+
+exports.ingestionToken = ingestionToken
+
 exports.getPublicKey = getPublicKeyWith(window.location.origin + '/api/exchange')
 exports.getPublicKeyWith = getPublicKeyWith
 
@@ -99,6 +198,12 @@ function postUserSecretWith (exchangeUrl) {
         body: JSON.stringify(body)
       })
       .then(handleFetchResponse)
+      .then(function (response) {
+        // the user cookie might have been set, so a token bound to the user
+        // is requested before sending the next event
+        ingestionToken.invalidate()
+        return response
+      })
   }
 }
 
@@ -50,4 +50,41 @@ describe('src/api.js', function () {
         })
     })
   })
+
+  describe('postEvent', function () {
+    var attempts
+    before(function () {
+      attempts = 0
+      fetchMock.post('https://server.offen.dev/events', function (url, opts) {
+        attempts++
+        var body = JSON.parse(opts.body)
+        if (body.ingestionToken !== 'token-b') {
+          return { status: 403, body: { error: 'no valid ingestion token', status: 403 } }
+        }
+        return { status: 201, body: { ack: true } }
+      })
+      fetchMock.post('https://server.offen.dev/ingestion-token', function (url, opts) {
+        var body = JSON.parse(opts.body)
+        assert.strictEqual(body.ingestionToken, 'token-a')
+        return { status: 200, body: { ingestionToken: 'token-b', expiresIn: 3600 } }
+      })
+      api.ingestionToken.set('token-a', 3600)
+    })
+
+    after(function () {
+      fetchMock.restore()
+      api.ingestionToken.set(undefined)
+    })
+
+    it('retries rejected events using a new ingestion token', function () {
+      var post = api.postEventWith('https://server.offen.dev/events', 'https://server.offen.dev/ingestion-token')
+      return post('account-a', 'payload')
+        .then(function (result) {
+          assert.deepStrictEqual(result, { ack: true })
+          assert.strictEqual(attempts, 2)
+          assert.strictEqual(api.ingestionToken.get(), 'token-b')
+          assert.strictEqual(api.ingestionToken.stale(), false)
+        })
+    })
+  })
 })